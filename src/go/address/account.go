@@ -0,0 +1,184 @@
+package address
+
+import (
+	"bytes"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/eth/sha3"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// eip55Validator 校验 eth 系的地址, 0x 前缀可以省略
+// 全小写或全大写的地址没有校验和, 大小写混合时按 EIP-55 校验
+func eip55Validator(coin string) validator {
+	return func(network types.Network, addr string) (*Info, error) {
+		s := strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X")
+		if len(s) != 40 {
+			return nil, invalid("%v address must be 40 hex characters, got %d", coin, len(s))
+		}
+		if _, err := hex.DecodeString(s); err != nil {
+			return nil, invalid("%v address is not hex", coin)
+		}
+		if s != strings.ToLower(s) && s != strings.ToUpper(s) && s != toChecksumHex(s) {
+			return nil, invalid("EIP-55 checksum mismatch, want 0x%v", toChecksumHex(s))
+		}
+		return &Info{Type: Account}, nil
+	}
+}
+
+// ChecksumAddress 返回 EIP-55 格式的地址, hexaddr 是 40 个 16 进制字符, 可以带 0x 前缀
+func ChecksumAddress(hexaddr string) string {
+	return "0x" + toChecksumHex(strings.TrimPrefix(strings.TrimPrefix(hexaddr, "0x"), "0X"))
+}
+
+func toChecksumHex(s string) string {
+	s = strings.ToLower(s)
+	h := sha3.NewKeccak256()
+	h.Write([]byte(s))
+	hash := h.Sum(nil)
+	b := []byte(s)
+	for i := range b {
+		nibble := hash[i/2] >> 4
+		if i%2 == 1 {
+			nibble = hash[i/2] & 0x0f
+		}
+		if b[i] > '9' && nibble >= 8 {
+			b[i] -= 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// tron 地址是 0x41 加 20 字节, 主网和测试网相同
+const tronPrefix = 0x41
+
+// validateTRX 接受 base58check 地址 (T 开头) 和 16 进制地址 (41 开头)
+func validateTRX(network types.Network, addr string) (*Info, error) {
+	var payload []byte
+	if len(addr) == 42 && strings.HasPrefix(addr, "41") {
+		b, err := hex.DecodeString(addr)
+		if err != nil {
+			return nil, invalid("TRX hex address is not hex")
+		}
+		payload = b
+	} else {
+		b, err := decodeCheck(addr, bitcoinAlphabet, doubleSHA256)
+		if err != nil {
+			return nil, err
+		}
+		payload = b
+	}
+	if len(payload) != 21 {
+		return nil, invalid("TRX address must be 21 bytes, got %d", len(payload))
+	}
+	if payload[0] != tronPrefix {
+		return nil, invalid("TRX address prefix 0x%02x, want 0x41", payload[0])
+	}
+	return &Info{Type: Account}, nil
+}
+
+// validateXRP 校验 ripple 字母表的 base58check 经典地址, 各网络相同
+func validateXRP(network types.Network, addr string) (*Info, error) {
+	payload, err := decodeCheck(addr, rippleAlphabet, doubleSHA256)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != 21 || payload[0] != 0x00 {
+		return nil, invalid("not an XRP account address")
+	}
+	return &Info{Type: Account}, nil
+}
+
+// bech32AccountValidator 校验 cosmos 系的地址, hrps 是各网络的前缀, 键为空表示各网络相同
+func bech32AccountValidator(coin string, hrps map[types.Network]string) validator {
+	return func(network types.Network, addr string) (*Info, error) {
+		hrp, _, err := decodeBech32Account(addr)
+		if err != nil {
+			return nil, err
+		}
+		for n, want := range hrps {
+			if hrp != want {
+				continue
+			}
+			if n != "" && network != "" && n != network {
+				return nil, wrongNetwork(addr, n, network)
+			}
+			return &Info{Network: n, Type: Account}, nil
+		}
+		return nil, invalid("unknown %v address prefix %v", coin, hrp)
+	}
+}
+
+var (
+	// eos 账户名: 最多 12 个字符 a-z1-5 和 '.', 不能以 '.' 结尾, 第 13 个字符只能是 a-j1-5
+	eosNameExp = regexp.MustCompile(`^[a-z1-5.]{1,12}$|^[a-z1-5.]{12}[a-j1-5]$`)
+	// dcrm 生成的 eos 用户 key, 见 eos.PublicKeyToAddress, 字母表有重复字符, 不能解码校验
+	eosUserKeyExp = regexp.MustCompile(`^d[1-5a-z]{32,33}$`)
+)
+
+// validateEOS 接受账户名, dcrm 用户 key 和公钥 (EOS..., PUB_K1_...)
+func validateEOS(network types.Network, addr string) (*Info, error) {
+	switch {
+	case strings.HasPrefix(addr, "EOS"), strings.HasPrefix(addr, "PUB_"):
+		if err := checkPublicKey(addr, "EOS"); err != nil {
+			return nil, err
+		}
+		return &Info{Type: PublicKey}, nil
+	case eosUserKeyExp.MatchString(addr):
+		return &Info{Type: UserKey}, nil
+	case eosNameExp.MatchString(addr) && !strings.HasSuffix(addr, "."):
+		return &Info{Type: AccountName}, nil
+	}
+	return nil, invalid("%v is not an EOS account name, user key or public key", addr)
+}
+
+// evt 的空地址
+const evtNullAddress = "EVT00000000000000000000000000000000000000000000000000"
+
+// validateEVT 接受公钥和空地址
+func validateEVT(network types.Network, addr string) (*Info, error) {
+	if addr == evtNullAddress {
+		return &Info{Type: Null}, nil
+	}
+	if err := checkPublicKey(addr, "EVT"); err != nil {
+		return nil, err
+	}
+	return &Info{Type: PublicKey}, nil
+}
+
+// checkPublicKey 校验 eos 格式的公钥, 旧格式是 prefix 加 base58(压缩公钥 + ripemd160(公钥)[:4])
+// 新格式是 PUB_K1_ 或 PUB_R1_ 加 base58(压缩公钥 + ripemd160(公钥 + 曲线名)[:4])
+func checkPublicKey(addr, prefix string) error {
+	var s, suffix string
+	switch {
+	case strings.HasPrefix(addr, "PUB_K1_"):
+		s, suffix = addr[len("PUB_K1_"):], "K1"
+	case strings.HasPrefix(addr, "PUB_R1_"):
+		s, suffix = addr[len("PUB_R1_"):], "R1"
+	case strings.HasPrefix(addr, prefix):
+		s = addr[len(prefix):]
+	default:
+		return invalid("public key must start with %v or PUB_K1_", prefix)
+	}
+	b, err := decodeBase58(s, bitcoinAlphabet)
+	if err != nil {
+		return err
+	}
+	if len(b) != 37 {
+		return invalid("public key must be 33 bytes plus checksum, got %d bytes", len(b))
+	}
+	key, sum := b[:33], b[33:]
+	if key[0] != 0x02 && key[0] != 0x03 {
+		return invalid("public key is not compressed")
+	}
+	h := ripemd160.New()
+	h.Write(key)
+	h.Write([]byte(suffix))
+	if !bytes.Equal(h.Sum(nil)[:4], sum) {
+		return invalid("public key checksum mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Package address 离线校验各币种的地址, 包括校验和, 网络和地址类型
+package address
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// Type 是地址类型
+type Type string
+
+const (
+	P2PKH Type = "p2pkh"
+	P2SH Type = "p2sh"
+	P2WPKH Type = "p2wpkh"
+	P2WSH Type = "p2wsh"
+	P2TR Type = "p2tr"
+	// 未知版本的隔离见证地址
+	Witness Type = "witness"
+	// 账户型链的普通地址, 包括 eth 系, trx, xrp, atom, bnb
+	Account Type = "account"
+	// 合约地址, 离线无法和普通账户区分, Validate 不会返回, 调用方查询节点后 (如 eth_getCode) 可以改成这个类型
+	Contract Type = "contract"
+	// eos 账户名
+	AccountName Type = "accountname"
+	// eos/evt 公钥
+	PublicKey Type = "publickey"
+	// dcrm 的 eos 用户 key, 见 eos.PublicKeyToAddress
+	UserKey Type = "userkey"
+	// evt 的空地址
+	Null Type = "null"
+)
+
+// Info 是校验通过的地址信息
+type Info struct {
+	Coin string `json:"coin"`
+	// 地址所属的网络, 几个网络格式相同时为空
+	Network types.Network `json:"network,omitempty"`
+	Type Type `json:"type"`
+}
+
+type validator func(network types.Network, addr string) (*Info, error)
+
+var validators = map[string]validator{
+	"BTC": utxoValidator("BTC"),
+	"BCH": validateBCH,
+	"LTC": utxoValidator("LTC"),
+	"DASH": utxoValidator("DASH"),
+	"ZCASH": utxoValidator("ZCASH"),
+	"BITGOLD": utxoValidator("BITGOLD"),
+	"DCR": utxoValidator("DCR"),
+	"ETH": eip55Validator("ETH"),
+	"ETC": eip55Validator("ETC"),
+	"VEN": eip55Validator("VEN"),
+	"TRX": validateTRX,
+	"XRP": validateXRP,
+	"ATOM": bech32AccountValidator("ATOM", map[types.Network]string{"": "cosmos"}),
+	"BNB": bech32AccountValidator("BNB", map[types.Network]string{types.Mainnet: "bnb", types.Testnet: "tbnb"}),
+	"EOS": validateEOS,
+	"EVT": validateEVT,
+}
+
+// CoinType 把代币类型换成校验地址用的币种, ERC20* 是 ETH, OMNI* 和 USDT 是 BTC, EVT* 是 EVT
+func CoinType(cointype string) string {
+	switch {
+	case strings.HasPrefix(cointype, "ERC20"):
+		return "ETH"
+	case strings.HasPrefix(cointype, "OMNI"), cointype == "USDT":
+		return "BTC"
+	case strings.HasPrefix(cointype, "EVT"):
+		return "EVT"
+	}
+	return cointype
+}
+
+// Supported 返回 cointype 的地址是否可以用 Validate 校验
+func Supported(cointype string) bool {
+	_, ok := validators[CoinType(cointype)]
+	return ok
+}
+
+// Validate 校验 cointype 在 network 上的地址, network 为空时接受任意网络的地址
+// 地址无效时返回 types.ErrInvalidAddress 分类的错误, 错误信息说明原因
+func Validate(cointype string, network types.Network, addr string) (*Info, error) {
+	coin := CoinType(cointype)
+	v, ok := validators[coin]
+	if !ok {
+		return nil, fmt.Errorf("address validation for %v is %w", cointype, types.ErrNotSupported)
+	}
+	if addr == "" {
+		return nil, invalid("empty address")
+	}
+	if strings.TrimSpace(addr) != addr {
+		return nil, invalid("address has leading or trailing whitespace")
+	}
+	info, err := v(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	info.Coin = coin
+	return info, nil
+}
+
+func invalid(format string, args ...interface{}) error {
+	return types.Errorf(types.ErrInvalidAddress, format, args...)
+}
+
+// wrongNetwork 是地址格式正确但是不属于请求的网络
+func wrongNetwork(addr string, got, want types.Network) error {
+	if got == "" {
+		return invalid("%v is not a %v address", addr, want)
+	}
+	return invalid("%v is a %v address, want %v", addr, got, want)
+}
@@ -0,0 +1,116 @@
+package address
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+var validAddresses = []struct {
+	coin string
+	network types.Network
+	addr string
+	want Info
+}{
+	// BIP-173
+	{"BTC", "", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", Info{"BTC", types.Mainnet, P2WPKH}},
+	{"BTC", types.Testnet, "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", Info{"BTC", types.Testnet, P2WSH}},
+	{"BTC", "", "tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", Info{"BTC", types.Testnet, P2WSH}},
+	// BIP-350
+	{"BTC", "", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", Info{"BTC", types.Mainnet, P2TR}},
+	{"BTC", "", "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", Info{"BTC", types.Testnet, P2TR}},
+	{"BTC", "", "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", Info{"BTC", types.Mainnet, Witness}},
+	{"BTC", "", "BC1SW50QGDZ25J", Info{"BTC", types.Mainnet, Witness}},
+	{"BTC", "", "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", Info{"BTC", types.Mainnet, Witness}},
+	// base58check
+	{"BTC", types.Mainnet, "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", Info{"BTC", types.Mainnet, P2PKH}},
+	{"BTC", "", "3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC", Info{"BTC", types.Mainnet, P2SH}},
+	{"BTC", types.Testnet, "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", Info{"BTC", types.Testnet, P2PKH}},
+	{"OMNIUSDT", "", "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", Info{"BTC", types.Mainnet, P2PKH}},
+	// CashAddr 规范的例子, 和上面的 base58 地址是同一个 hash
+	{"BCH", "", "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", Info{"BCH", types.Mainnet, P2PKH}},
+	{"BCH", types.Mainnet, "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", Info{"BCH", types.Mainnet, P2PKH}},
+	{"BCH", "", "bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq", Info{"BCH", types.Mainnet, P2SH}},
+	{"BCH", "", "BITCOINCASH:PPM2QSZNHKS23Z7629MMS6S4CWEF74VCWVN0H829PQ", Info{"BCH", types.Mainnet, P2SH}},
+	{"BCH", "", "bchtest:pr6m7j9njldwwzlg9v7v53unlr4jkmx6eyvwc0uz5t", Info{"BCH", types.Testnet, P2SH}},
+	{"BCH", "", "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", Info{"BCH", types.Mainnet, P2PKH}},
+	// EIP-55 的例子, 全小写和全大写的地址没有校验和
+	{"ETH", "", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Info{"ETH", "", Account}},
+	{"ETH", "", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", Info{"ETH", "", Account}},
+	{"ETH", "", "0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB", Info{"ETH", "", Account}},
+	{"ERC20BNB", "", "0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb", Info{"ETH", "", Account}},
+	{"ETH", "", "0x52908400098527886E0F7030069857D2E4169EE7", Info{"ETH", "", Account}},
+	{"ETH", "", "0xde709f2102306220921060314715629080e2fb77", Info{"ETH", "", Account}},
+	{"XRP", "", "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTh", Info{"XRP", "", Account}},
+	{"EOS", "", "eosio.token", Info{"EOS", "", AccountName}},
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range validAddresses {
+		info, err := Validate(c.coin, c.network, c.addr)
+		if err != nil {
+			t.Fatalf("%v %v: %v", c.coin, c.addr, err)
+		}
+		if *info != c.want {
+			t.Fatalf("%v %v: got %+v, want %+v", c.coin, c.addr, *info, c.want)
+		}
+	}
+}
+
+var invalidAddresses = []struct {
+	coin string
+	network types.Network
+	addr string
+}{
+	// BIP-173, BIP-350
+	{"BTC", "", "tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut"},
+	{"BTC", "", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd"},
+	{"BTC", "", "BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL"},
+	{"BTC", "", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh"},
+	{"BTC", "", "tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47"},
+	{"BTC", "", "bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4"},
+	{"BTC", "", "BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R"},
+	{"BTC", "", "bc1pw5dgrnzv"},
+	{"BTC", "", "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P"},
+	{"BTC", "", "bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du"},
+	{"BTC", "", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3Q0sl5k7"},
+	{"BTC", "", "bc1gmk9yu"},
+	// 网络不对
+	{"BTC", types.Testnet, "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4"},
+	{"BTC", types.Mainnet, "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn"},
+	{"BCH", types.Testnet, "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"},
+	// 校验和错误
+	{"BTC", "", "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggv"},
+	{"BCH", "", "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b"},
+	{"BCH", "", "pref:pr6m7j9njldwwzlg9v7v53unlr4jkmx6ey65nvtks5"},
+	{"ETH", "", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD"},
+	{"ETH", "", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA"},
+	{"XRP", "", "rHb9CJAWyB4rj91VRWn96DkukG4bwdtyTj"},
+	{"BTC", "", " 1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu"},
+	{"BTC", "", ""},
+}
+
+func TestValidateInvalid(t *testing.T) {
+	for _, c := range invalidAddresses {
+		if info, err := Validate(c.coin, c.network, c.addr); !errors.Is(err, types.ErrInvalidAddress) {
+			t.Fatalf("%v %q: got %+v, %v, want ErrInvalidAddress", c.coin, c.addr, info, err)
+		}
+	}
+	if _, err := Validate("DOGE", "", "D8vFz4p1L37jdg47HXKtSHA5uYLYxbGgPD"); !errors.Is(err, types.ErrNotSupported) {
+		t.Fatalf("got %v, want ErrNotSupported", err)
+	}
+}
+
+func TestChecksumAddress(t *testing.T) {
+	for _, want := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		if got := ChecksumAddress(want[2:]); got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
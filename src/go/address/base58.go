@@ -0,0 +1,73 @@
+package address
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/dcr/blake256"
+)
+
+const (
+	bitcoinAlphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	rippleAlphabet = "rpshnaf39wBUDNEGHJKLM4PQRST7VWXYZ2bcdeCg65jkm8oFqi1tuvAxyz"
+)
+
+var bigRadix = big.NewInt(58)
+
+// decodeBase58 用 alphabet 解码, 开头的 alphabet[0] 对应 0x00
+func decodeBase58(s, alphabet string) ([]byte, error) {
+	if s == "" {
+		return nil, invalid("empty address")
+	}
+	n := new(big.Int)
+	for i := 0; i < len(s); i++ {
+		idx := bytes.IndexByte([]byte(alphabet), s[i])
+		if idx < 0 {
+			return nil, invalid("invalid base58 character %q at position %d", s[i], i)
+		}
+		n.Mul(n, bigRadix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+	var zeros int
+	for zeros < len(s) && s[zeros] == alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// 校验和是 payload 的 hash 的前 4 个字节
+type checksumFunc func(payload []byte) []byte
+
+// 比特币系: 两次 sha256
+func doubleSHA256(payload []byte) []byte {
+	h := sha256.Sum256(payload)
+	h = sha256.Sum256(h[:])
+	return h[:4]
+}
+
+// decred: 两次 blake256
+func doubleBlake256(payload []byte) []byte {
+	h := blake256.New()
+	h.Write(payload)
+	first := h.Sum(nil)
+	h.Reset()
+	h.Write(first)
+	return h.Sum(nil)[:4]
+}
+
+// decodeCheck 解码 base58check, 返回去掉校验和的数据 (包括版本字节)
+func decodeCheck(s, alphabet string, checksum checksumFunc) ([]byte, error) {
+	b, err := decodeBase58(s, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 5 {
+		return nil, invalid("too short for base58check: %d bytes", len(b))
+	}
+	payload, sum := b[:len(b)-4], b[len(b)-4:]
+	if !bytes.Equal(checksum(payload), sum) {
+		return nil, invalid("base58check checksum mismatch")
+	}
+	return payload, nil
+}
@@ -0,0 +1,157 @@
+package address
+
+import (
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32 和 bech32m (BIP-350) 的校验和常数
+const (
+	bech32Const = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	ret := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]>>5)
+	}
+	ret = append(ret, 0)
+	for i := 0; i < len(hrp); i++ {
+		ret = append(ret, hrp[i]&31)
+	}
+	return ret
+}
+
+// decodeBech32 解码 bech32 或 bech32m, 返回 hrp, 5 位一组的数据 (不含校验和) 和校验和常数
+func decodeBech32(s string) (hrp string, data []byte, constant uint32, err error) {
+	if len(s) > 90 {
+		return "", nil, 0, invalid("bech32 string too long: %d characters", len(s))
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, invalid("bech32 string has mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, invalid("bech32 separator misplaced")
+	}
+	hrp = s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, invalid("invalid bech32 prefix character")
+		}
+	}
+	for i := pos + 1; i < len(s); i++ {
+		idx := strings.IndexByte(bech32Charset, s[i])
+		if idx < 0 {
+			return "", nil, 0, invalid("invalid bech32 character %q at position %d", s[i], i)
+		}
+		data = append(data, byte(idx))
+	}
+	constant = bech32Polymod(append(bech32HrpExpand(hrp), data...))
+	if constant != bech32Const && constant != bech32mConst {
+		return "", nil, 0, invalid("bech32 checksum mismatch")
+	}
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// convertBits 在 fromBits 和 toBits 位一组之间转换, pad 为 false 时多余的位必须为 0
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<toBits - 1
+	var ret []byte
+	for _, v := range data {
+		if uint(v)>>fromBits != 0 {
+			return nil, invalid("invalid data value")
+		}
+		acc = acc<<fromBits | uint(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			ret = append(ret, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			ret = append(ret, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, invalid("invalid padding")
+	}
+	return ret, nil
+}
+
+// decodeSegwit 解码隔离见证地址 (BIP-173, BIP-350), 返回 hrp, 见证版本和见证程序
+func decodeSegwit(s string) (hrp string, version byte, program []byte, err error) {
+	hrp, data, constant, err := decodeBech32(s)
+	if err != nil {
+		return
+	}
+	if len(data) == 0 {
+		err = invalid("empty witness program")
+		return
+	}
+	version = data[0]
+	if version > 16 {
+		err = invalid("invalid witness version %d", version)
+		return
+	}
+	if version == 0 && constant != bech32Const {
+		err = invalid("witness version 0 must use bech32, not bech32m")
+		return
+	}
+	if version != 0 && constant != bech32mConst {
+		err = invalid("witness version %d must use bech32m, not bech32", version)
+		return
+	}
+	program, err = convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return
+	}
+	if len(program) < 2 || len(program) > 40 {
+		err = invalid("invalid witness program length %d", len(program))
+		return
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		err = invalid("invalid witness v0 program length %d", len(program))
+		return
+	}
+	return
+}
+
+// decodeBech32Account 解码 cosmos 系的 bech32 账户地址, 返回 hrp 和 20 字节的地址
+func decodeBech32Account(s string) (hrp string, account []byte, err error) {
+	hrp, data, constant, err := decodeBech32(s)
+	if err != nil {
+		return
+	}
+	if constant != bech32Const {
+		err = invalid("account address must use bech32, not bech32m")
+		return
+	}
+	account, err = convertBits(data, 5, 8, false)
+	if err != nil {
+		return
+	}
+	if len(account) != 20 {
+		err = invalid("invalid account length %d", len(account))
+	}
+	return
+}
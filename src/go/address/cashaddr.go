@@ -0,0 +1,74 @@
+package address
+
+import (
+	"strings"
+)
+
+func cashAddrPolymod(values []byte) uint64 {
+	gen := [5]uint64{0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470}
+	c := uint64(1)
+	for _, d := range values {
+		c0 := byte(c >> 35)
+		c = (c&0x07ffffffff)<<5 ^ uint64(d)
+		for i := 0; i < 5; i++ {
+			if (c0>>uint(i))&1 == 1 {
+				c ^= gen[i]
+			}
+		}
+	}
+	return c ^ 1
+}
+
+func cashAddrPrefixExpand(prefix string) []byte {
+	ret := make([]byte, 0, len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		ret = append(ret, prefix[i]&0x1f)
+	}
+	return append(ret, 0)
+}
+
+// decodeCashAddr 解码 prefix 下的 CashAddr 地址, 地址可以省略 prefix
+// 返回地址类型 (0 是 P2PKH, 1 是 P2SH) 和 hash
+func decodeCashAddr(s, prefix string) (typ byte, hash []byte, err error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return 0, nil, invalid("cashaddr has mixed case")
+	}
+	s = strings.ToLower(s)
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		if s[:i] != prefix {
+			return 0, nil, invalid("cashaddr prefix %v, want %v", s[:i], prefix)
+		}
+		s = s[i+1:]
+	}
+	if len(s) < 9 {
+		return 0, nil, invalid("cashaddr too short")
+	}
+	data := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		idx := strings.IndexByte(bech32Charset, s[i])
+		if idx < 0 {
+			return 0, nil, invalid("invalid cashaddr character %q at position %d", s[i], i)
+		}
+		data[i] = byte(idx)
+	}
+	if cashAddrPolymod(append(cashAddrPrefixExpand(prefix), data...)) != 0 {
+		return 0, nil, invalid("cashaddr checksum mismatch")
+	}
+	payload, err := convertBits(data[:len(data)-8], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(payload) == 0 {
+		return 0, nil, invalid("empty cashaddr payload")
+	}
+	version := payload[0]
+	if version&0x80 != 0 {
+		return 0, nil, invalid("invalid cashaddr version byte 0x%02x", version)
+	}
+	sizes := [8]int{20, 24, 28, 32, 40, 48, 56, 64}
+	hash = payload[1:]
+	if len(hash) != sizes[version&0x07] {
+		return 0, nil, invalid("cashaddr hash length %d does not match version byte 0x%02x", len(hash), version)
+	}
+	return version >> 3, hash, nil
+}
@@ -0,0 +1,206 @@
+package address
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// utxoParams 是 utxo 币种一个网络的地址参数
+type utxoParams struct {
+	network types.Network
+	// base58check 版本字节, zcash 和 decred 是 2 个字节
+	p2pkh [][]byte
+	p2sh [][]byte
+	// 隔离见证地址的 bech32 前缀, 空表示不支持隔离见证
+	hrp string
+	// decred 用 blake256 计算校验和
+	checksum checksumFunc
+}
+
+func v(b ...byte) [][]byte {
+	return [][]byte{b}
+}
+
+// 同一个币种里版本字节相同的网络 (如比特币的 testnet 和 regtest), 不指定网络时返回排在前面的
+var utxoChains = map[string][]utxoParams{
+	"BTC": {
+		{types.Mainnet, v(0x00), v(0x05), "bc", doubleSHA256},
+		{types.Testnet, v(0x6f), v(0xc4), "tb", doubleSHA256},
+		{types.Regtest, v(0x6f), v(0xc4), "bcrt", doubleSHA256},
+	},
+	"LTC": {
+		// 早期的 P2SH 地址和比特币一样以 3 开头
+		{types.Mainnet, v(0x30), [][]byte{{0x32}, {0x05}}, "ltc", doubleSHA256},
+		{types.Testnet, v(0x6f), [][]byte{{0x3a}, {0xc4}}, "tltc", doubleSHA256},
+		{types.Regtest, v(0x6f), [][]byte{{0x3a}, {0xc4}}, "rltc", doubleSHA256},
+	},
+	"DASH": {
+		{types.Mainnet, v(0x4c), v(0x10), "", doubleSHA256},
+		{types.Testnet, v(0x8c), v(0x13), "", doubleSHA256},
+		{types.Regtest, v(0x8c), v(0x13), "", doubleSHA256},
+	},
+	// 只支持透明地址 (t1, t3), 不支持隐私地址
+	"ZCASH": {
+		{types.Mainnet, v(0x1c, 0xb8), v(0x1c, 0xbd), "", doubleSHA256},
+		{types.Testnet, v(0x1d, 0x25), v(0x1c, 0xba), "", doubleSHA256},
+		{types.Regtest, v(0x1d, 0x25), v(0x1c, 0xba), "", doubleSHA256},
+	},
+	"BITGOLD": {
+		{types.Mainnet, v(0x26), v(0x17), "btg", doubleSHA256},
+		{types.Testnet, v(0x6f), v(0xc4), "tbtg", doubleSHA256},
+	},
+	"DCR": {
+		{types.Mainnet, v(0x07, 0x3f), v(0x07, 0x1a), "", doubleBlake256},
+		{types.Testnet, v(0x0f, 0x21), v(0x0e, 0xfc), "", doubleBlake256},
+		{types.Regtest, v(0x0e, 0x00), v(0x0d, 0xdb), "", doubleBlake256},
+	},
+	// bch 的旧格式地址, 新格式见 validateBCH
+	"BCH": {
+		{types.Mainnet, v(0x00), v(0x05), "", doubleSHA256},
+		{types.Testnet, v(0x6f), v(0xc4), "", doubleSHA256},
+		{types.Regtest, v(0x6f), v(0xc4), "", doubleSHA256},
+	},
+}
+
+// chainsFor 返回 network 上的参数, network 为空返回全部, 第二个返回值是币种是否支持这个网络
+func chainsFor(coin string, network types.Network) ([]utxoParams, bool) {
+	chains := utxoChains[coin]
+	if network == "" {
+		return chains, true
+	}
+	for _, c := range chains {
+		if c.network == network {
+			return []utxoParams{c}, true
+		}
+	}
+	return nil, false
+}
+
+func utxoValidator(coin string) validator {
+	return func(network types.Network, addr string) (*Info, error) {
+		chains, ok := chainsFor(coin, network)
+		if !ok {
+			return nil, invalid("%v has no %v addresses", coin, network)
+		}
+		// 隔离见证地址
+		if i := strings.LastIndexByte(addr, '1'); i > 0 {
+			prefix := strings.ToLower(addr[:i])
+			for _, all := range utxoChains[coin] {
+				if all.hrp == "" || all.hrp != prefix {
+					continue
+				}
+				return segwitInfo(chains, all.network, addr)
+			}
+		}
+		return base58Info(coin, chains, network, addr)
+	}
+}
+
+func segwitInfo(chains []utxoParams, detected types.Network, addr string) (*Info, error) {
+	var want types.Network
+	for _, c := range chains {
+		if c.network == detected {
+			want = detected
+		}
+	}
+	if want == "" {
+		return nil, wrongNetwork(addr, detected, chains[0].network)
+	}
+	_, version, program, err := decodeSegwit(addr)
+	if err != nil {
+		return nil, err
+	}
+	typ := Witness
+	switch {
+	case version == 0 && len(program) == 20:
+		typ = P2WPKH
+	case version == 0 && len(program) == 32:
+		typ = P2WSH
+	case version == 1 && len(program) == 32:
+		typ = P2TR
+	}
+	return &Info{Network: detected, Type: typ}, nil
+}
+
+func base58Info(coin string, chains []utxoParams, network types.Network, addr string) (*Info, error) {
+	payload, err := decodeCheck(addr, bitcoinAlphabet, chains[0].checksum)
+	if err != nil {
+		return nil, err
+	}
+	match := func(chains []utxoParams) *Info {
+		for _, c := range chains {
+			for _, ver := range c.p2pkh {
+				if bytes.HasPrefix(payload, ver) && len(payload) == len(ver)+20 {
+					return &Info{Network: c.network, Type: P2PKH}
+				}
+			}
+			for _, ver := range c.p2sh {
+				if bytes.HasPrefix(payload, ver) && len(payload) == len(ver)+20 {
+					return &Info{Network: c.network, Type: P2SH}
+				}
+			}
+		}
+		return nil
+	}
+	if info := match(chains); info != nil {
+		return info, nil
+	}
+	if network != "" {
+		if info := match(utxoChains[coin]); info != nil {
+			return nil, wrongNetwork(addr, info.Network, network)
+		}
+	}
+	return nil, invalid("unknown %v address version 0x%x or length %d", coin, payload[0], len(payload))
+}
+
+// bch 的 CashAddr 前缀
+var cashAddrPrefixes = []struct {
+	network types.Network
+	prefix string
+}{
+	{types.Mainnet, "bitcoincash"},
+	{types.Testnet, "bchtest"},
+	{types.Regtest, "bchreg"},
+}
+
+// validateBCH 接受 CashAddr (前缀可省略) 和旧格式的地址
+func validateBCH(network types.Network, addr string) (*Info, error) {
+	lower := strings.ToLower(addr)
+	// 旧格式地址是大小写混合的 base58, CashAddr 只有小写 (或全大写)
+	if !strings.Contains(addr, ":") && lower != addr && strings.ToUpper(addr) != addr {
+		chains, ok := chainsFor("BCH", network)
+		if !ok {
+			return nil, invalid("BCH has no %v addresses", network)
+		}
+		return base58Info("BCH", chains, network, addr)
+	}
+	var firstErr error
+	for _, p := range cashAddrPrefixes {
+		if i := strings.IndexByte(lower, ':'); i >= 0 && lower[:i] != p.prefix {
+			continue
+		}
+		typ, _, err := decodeCashAddr(addr, p.prefix)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if network != "" && network != p.network {
+			return nil, wrongNetwork(addr, p.network, network)
+		}
+		switch typ {
+		case 0:
+			return &Info{Network: p.network, Type: P2PKH}, nil
+		case 1:
+			return &Info{Network: p.network, Type: P2SH}, nil
+		}
+		return nil, invalid("unknown cashaddr type %d", typ)
+	}
+	if firstErr == nil {
+		firstErr = invalid("unknown cashaddr prefix")
+	}
+	return nil, firstErr
+}
@@ -1,37 +1,79 @@
 package atom
 
 import (
+	"context"
+	"time"
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"runtime/debug"
-	"strings"
-	"github.com/btcsuite/btcd/btcec"
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/cosmos/cosmos-sdk/x/bank"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
 	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 	"github.com/tendermint/tendermint/crypto/secp256k1"
 )
 
 var DefaultSendAtomFee *big.Int = big.NewInt(1)
 
-type AtomHandler struct {}
+// 默认网络
+const DefaultNetwork = types.Mainnet
+
+// cosmos 各网络的地址前缀相同, chain id 从节点获取, 网络只决定网关
+var networks = map[types.Network]bool{
+	types.Mainnet: true,
+	types.Testnet: true,
+}
+
+type AtomHandler struct {
+	network types.Network
+	apiAddress string
+	// 网关配置的 chain id, 为空时向节点查询
+	chainID string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
+}
 
 func NewAtomHandler () *AtomHandler {
-	return &AtomHandler{}
+	h, _ := NewAtomHandlerForNetwork(DefaultNetwork)
+	return h
 }
 
-func (h *AtomHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error){
-	pubKeyHex = strings.TrimPrefix(pubKeyHex, "0x")
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
+// NewAtomHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewAtomHandlerForNetwork (network types.Network) (*AtomHandler, error) {
+	return NewAtomHandlerFromConfig(network, config.Current())
+}
+
+// NewAtomHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 CosmosGateway
+func NewAtomHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*AtomHandler, error) {
+	network = network.Or(DefaultNetwork)
+	if !networks[network] {
+		return nil, types.UnsupportedNetworkError("ATOM", network)
 	}
-	pk, err := btcec.ParsePubKey(bb, btcec.S256())
+	gateway := gateways.ForNetwork(string(network)).CosmosGateway
+	rpcutils.RegisterApiGateway(gateway, nil, gateways.HealthCheckInterval())
+	return &AtomHandler{
+		network: network,
+		apiAddress: gateway.ApiAddress,
+		chainID: gateway.ChainID,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *AtomHandler) Network() types.Network {
+	return h.network
+}
+
+func (h *AtomHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error){
+	pk, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
@@ -49,43 +91,302 @@ func (h *AtomHandler) PublicKeyToAddress(pubKeyHex string) (address string, err
 }
 
 func (h *AtomHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *AtomHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+var SupportedBuildOptions = []string{types.OptFee, types.OptGasLimit, types.OptMemo, types.OptNonce}
+
+func (h *AtomHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *AtomHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: true,
+		Balance: true,
+		MultiOutput: true,
+		Memo: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			return networks[n]
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *AtomHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "ATOM",
+		Decimals: 6,
+		SLIP44: 118,
+		AddressFormat: types.AddressBech32,
+		SmallestUnit: "uatom",
+	}
+}
+
+func (h *AtomHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, []types.TxOutput{{ToAddress: toAddress, Amount: amount}}, opts)
+}
+
+// 一个收款人用 MsgSend, 多个收款人用 MsgMultiSend
+func (h *AtomHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		return
+	}
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 chain id 和账户的 account number, sequence, 网关配置了 chain id 时不查询 chain id
+func (h *AtomHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if err := opts.Check("ATOM", SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	chainID := h.chainID
+	if chainID == "" {
+		var err error
+		if chainID, err = getChainID(ctx, h.apiAddress); err != nil {
+			return nil, err
+		}
+	}
+	accountNumber, sequence, err := getAccount(ctx, h.apiAddress, fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	state := types.NewChainState("ATOM", h.network.String())
+	state.ChainID = chainID
+	state.AccountNumber = &accountNumber
+	state.Nonce = &sequence
+	return state, nil
+}
+
+// Assemble 用 state 的 chain id, account number 和 sequence 构造 StdSignMsg, 不访问网络
+func (h *AtomHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	if opts == nil {
+		opts = &types.BuildOptions{}
+	}
+	if err = state.Check("ATOM", h.network.String()); err != nil {
+		return
+	}
+	if err = opts.Check("ATOM", SupportedBuildOptions...); err != nil {
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	if state.ChainID == "" {
+		err = types.MissingStateError("chain id")
+		return
+	}
+	if state.AccountNumber == nil {
+		err = types.MissingStateError("account number")
+		return
+	}
+	sequence := state.Nonce
+	if opts.Nonce != nil {
+		sequence = opts.Nonce
+	}
+	if sequence == nil {
+		err = types.MissingStateError("sequence")
+		return
+	}
+	fromAddr, err := sdk.AccAddressFromBech32(fromAddress)
+	if err != nil {
+		return
+	}
+	total := sdk.ZeroInt()
+	var bankOutputs []bank.Output
+	for i, out := range outputs {
+		toAddr, err1 := sdk.AccAddressFromBech32(out.ToAddress)
+		if err1 != nil {
+			err = types.Errorf(types.ErrInvalidAddress, "output %v: invalid address %v: %v", i, out.ToAddress, err1)
+			return
+		}
+		amt := sdk.NewIntFromBigInt(out.Amount)
+		total = total.Add(amt)
+		bankOutputs = append(bankOutputs, bank.NewOutput(toAddr, sdk.Coins{sdk.NewCoin("uatom", amt)}))
+	}
+	var msgs []sdk.Msg
+	if len(bankOutputs) == 1 {
+		msgs = []sdk.Msg{bank.NewMsgSend(fromAddr, bankOutputs[0].Address, bankOutputs[0].Coins)}
+	} else {
+		inputs := []bank.Input{bank.NewInput(fromAddr, sdk.Coins{sdk.NewCoin("uatom", total)})}
+		msgs = []sdk.Msg{bank.NewMsgMultiSend(inputs, bankOutputs)}
+	}
+
+	fee := DefaultSendAtomFee
+	if opts.Fee != nil {
+		fee = opts.Fee
+	}
+	gas := DefaultGas + DefaultGasPerOutput*uint64(len(outputs)-1)
+	if opts.GasLimit != nil {
+		gas = *opts.GasLimit
+	}
+	memo := ""
+	if opts.Memo != nil {
+		memo = *opts.Memo
+	}
+
+	signMsg := auth.StdSignMsg{
+		ChainID: state.ChainID,
+		AccountNumber: *state.AccountNumber,
+		Sequence: *sequence,
+		Fee: auth.NewStdFee(gas, sdk.Coins{sdk.NewCoin("uatom", sdk.NewIntFromBigInt(fee))}),
+		Msgs: msgs,
+		Memo: memo,
+	}
+	transaction = &AtomTx{
+		SignMsg: signMsg,
+		Pubkey: fromPublicKey,
+	}
+	digest := sha256.Sum256(signMsg.Bytes())
+	digests = append(digests, hex.EncodeToString(digest[:]))
 	return
 }
 
 func (h *AtomHandler) SignTransaction(hash []string, privateKey interface{}) (rsv []string, err error) {
+	for _, hs := range hash {
+		b, err := hex.DecodeString(hs)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := ethcrypto.Sign(b, privateKey.(*ecdsa.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		rsv = append(rsv, hex.EncodeToString(sig))
+	}
 	return
 }
 
 func (h *AtomHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransactionContext(context.Background(), rsv, transaction)
+}
+
+// MakeSignedTransactionContext 校验签名是 Pubkey 对 sha256(signBytes) 的签名, 失败返回 *types.SignatureError
+func (h *AtomHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	if len(rsv) < 1 {
+		err = fmt.Errorf("no rsv")
+		return
+	}
+	atx, ok := transaction.(*AtomTx)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", transaction)
+		return
+	}
+	pk, err := signature.ParsePublicKey(atx.Pubkey)
+	if err != nil {
+		return
+	}
+	digest := sha256.Sum256(atx.SignMsg.Bytes())
+	rsvSig, err := signature.Check(0, rsv[0], digest[:], pk, signature.Rules{})
+	if err != nil {
+		return
+	}
+	// tendermint 只接受 low S 的签名, 签名是 64 字节的 r s, 不带 v
+	sigBytes := rsvSig.Normalize().Bytes()[:64]
+	var pub [33]byte
+	copy(pub[:], pk.SerializeCompressed())
+
+	sig := auth.StdSignature{
+		PubKey: secp256k1.PubKeySecp256k1(pub),
+		Signature: sigBytes,
+	}
+	signMsg := atx.SignMsg
+	stdTx := auth.NewStdTx(signMsg.Msgs, signMsg.Fee, []auth.StdSignature{sig}, signMsg.Memo)
+	signedTransaction = stdTx
 	return
 }
 
 func (h *AtomHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *AtomHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	stdTx, ok := signedTransaction.(auth.StdTx)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	return broadcastTx(ctx, h.apiAddress, stdTx)
+}
+
+// payload 是 amino json 编码的 AtomTx
+func (h *AtomHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	atx, ok := transaction.(*AtomTx)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	payload, err := cdc.MarshalJSON(atx)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxEnvelope("ATOM", h.network.String(), digests, payload), nil
+}
+
+func (h *AtomHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("ATOM", h.network.String()); err != nil {
+		return
+	}
+	atx := &AtomTx{}
+	if err = cdc.UnmarshalJSON(env.Payload, atx); err != nil {
+		return
+	}
+	transaction = atx
 	return
 }
 
 func (h *AtomHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *AtomHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
-	ret, err := rpcutils.HttpGet(config.ApiGateways.CosmosGateway.ApiAddress,"txs"+"/"+txhash,nil)
-	fmt.Println(string(ret))
+	ret, err := rpcutils.HttpGetContext(ctx, h.apiAddress,"txs"+"/"+txhash,nil)
 	if err != nil {
 		return
 	}
 	var txRes sdk.TxResponse
 	err = UnmarshalJSON(ret, &txRes)
 	if err != nil {
-		err = errors.New("tx response error: "+string(ret)+err.Error())
+		err = types.ClassifyError(errors.New("tx response error: "+string(ret)+err.Error()))
 		return
 	}
 
 	isSend := false
 	for _, tag := range txRes.Tags {
-		if tag.Key == "action" && tag.Value == "send" {
+		if tag.Key == "action" && (tag.Value == "send" || tag.Value == "multisend") {
 			isSend = true
 			break
 		}
@@ -98,26 +399,53 @@ func (h *AtomHandler) GetTransactionInfo(txhash string) (fromAddress string, txO
 		if txRes.Logs[i].Success {
 			// confirmed = true
 		}
-		var atomamt sdk.Coin = sdk.NewCoin("uatom", sdk.ZeroInt())
-		for _, amt := range msg.(MsgSend).Amount {
-			if amt.Denom != "uatom" {
+		switch m := msg.(type) {
+		case MsgSend:
+			atomamt := uatomAmount(m.Amount)
+			if atomamt.Equal(sdk.ZeroInt()) {
 				continue
 			}
-			atomamt = atomamt.Add(amt)
+			fromAddress = m.From.String()
+			toAddress := m.To.String()
+			amt := atomamt.BigInt()
+			txOutputs = append(txOutputs, types.TxOutput{ToAddress:toAddress,Amount:amt})
+			return
+		case bank.MsgMultiSend:
+			// 批量转账, 每个 output 一个 TxOutput
+			if len(m.Inputs) > 0 {
+				fromAddress = m.Inputs[0].Address.String()
+			}
+			for _, out := range m.Outputs {
+				atomamt := uatomAmount(out.Coins)
+				if atomamt.Equal(sdk.ZeroInt()) {
+					continue
+				}
+				txOutputs = append(txOutputs, types.TxOutput{ToAddress:out.Address.String(),Amount:atomamt.BigInt()})
+			}
+			return
 		}
-		if atomamt.Amount.Equal(sdk.ZeroInt()) {
+	}
+	return
+}
+
+func uatomAmount(coins sdk.Coins) sdk.Int {
+	atomamt := sdk.ZeroInt()
+	for _, amt := range coins {
+		if amt.Denom != "uatom" {
 			continue
 		}
-		fromAddress = msg.(MsgSend).From.String()
-		toAddress := msg.(MsgSend).To.String()
-		amt := atomamt.Amount.BigInt()
-		txOutputs = append(txOutputs, types.TxOutput{ToAddress:toAddress,Amount:amt})
-		return
+		atomamt = atomamt.Add(amt.Amount)
 	}
-	return
+	return atomamt
 }
 
 func (h *AtomHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *AtomHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
@@ -126,7 +454,7 @@ func (h *AtomHandler) GetAddressBalance(address string, jsonstring string) (bala
 	} ()
 
 
-	ret, err := rpcutils.HttpGet(config.ApiGateways.CosmosGateway.ApiAddress,"bank/balances"+"/"+address,nil)
+	ret, err := rpcutils.HttpGetContext(ctx, h.apiAddress,"bank/balances"+"/"+address,nil)
 	if err != nil {
 		return
 	}
@@ -171,13 +499,17 @@ func UnmarshalJSON (resjson []byte, res *sdk.TxResponse) (err error) {
 	msgsI := tx["value"].(map[string]interface{})["msg"].([]interface{})
 	var msgs []sdk.Msg
 	for _, msgI := range msgsI {
-		if msgI.(map[string]interface{})["type"] != "cosmos-sdk/MsgSend" {
-			continue
-		}
 		msgjson, _ := json.Marshal(msgI.(map[string]interface{})["value"])
-		var msg MsgSend
-		json.Unmarshal(msgjson, &msg)
-		msgs = append(msgs, msg)
+		switch msgI.(map[string]interface{})["type"] {
+		case "cosmos-sdk/MsgSend":
+			var msg MsgSend
+			json.Unmarshal(msgjson, &msg)
+			msgs = append(msgs, msg)
+		case "cosmos-sdk/MsgMultiSend":
+			var msg bank.MsgMultiSend
+			json.Unmarshal(msgjson, &msg)
+			msgs = append(msgs, msg)
+		}
 	}
 	stdTx.Msgs = msgs
 	res.Tx = stdTx
@@ -0,0 +1,151 @@
+package atom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/auth"
+	"github.com/cosmos/cosmos-sdk/x/bank"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 默认 gas, 批量转账每多一个收款人增加 DefaultGasPerOutput
+var (
+	DefaultGas uint64 = 200000
+	DefaultGasPerOutput uint64 = 50000
+)
+
+var cdc = makeCodec()
+
+func makeCodec() *codec.Codec {
+	cdc := codec.New()
+	sdk.RegisterCodec(cdc)
+	codec.RegisterCrypto(cdc)
+	auth.RegisterCodec(cdc)
+	bank.RegisterCodec(cdc)
+	return cdc
+}
+
+// AtomTx 是未签名交易, SignMsg 的签名原文做 sha256 得到 digest
+type AtomTx struct {
+	SignMsg auth.StdSignMsg
+	Pubkey string
+}
+
+type broadcastReq struct {
+	Tx auth.StdTx `json:"tx"`
+	Mode string `json:"mode"`
+}
+
+type broadcastRes struct {
+	TxHash string `json:"txhash"`
+	Code uint32 `json:"code"`
+	RawLog string `json:"raw_log"`
+}
+
+type accountValue struct {
+	AccountNumber uint64 `json:"account_number,string"`
+	Sequence uint64 `json:"sequence,string"`
+}
+
+// 查询 account number 和 sequence
+// 兼容 {"type":..,"value":{..}} 和 {"height":..,"result":{"type":..,"value":{..}}} 两种格式
+func getAccount(ctx context.Context, apiAddress, address string) (accountNumber, sequence uint64, err error) {
+	ret, err := rpcutils.HttpGetContext(ctx, apiAddress, "auth/accounts/"+address, nil)
+	if err != nil {
+		return
+	}
+	var res struct {
+		Result *json.RawMessage `json:"result"`
+		Value *json.RawMessage `json:"value"`
+	}
+	if err = json.Unmarshal(ret, &res); err != nil {
+		err = types.ClassifyError(fmt.Errorf("get account error: %v, %v", err, string(ret)))
+		return
+	}
+	if res.Result != nil {
+		if err = json.Unmarshal(*res.Result, &res); err != nil {
+			err = fmt.Errorf("get account error: %v, %v", err, string(ret))
+			return
+		}
+	}
+	if res.Value == nil {
+		err = types.ClassifyError(fmt.Errorf("get account error: %v", string(ret)))
+		return
+	}
+	var acc accountValue
+	if err = json.Unmarshal(*res.Value, &acc); err != nil {
+		err = fmt.Errorf("get account error: %v, %v", err, string(ret))
+		return
+	}
+	return acc.AccountNumber, acc.Sequence, nil
+}
+
+// 查询 chain id
+// 兼容 {"network":..} 和 {"node_info":{"network":..}} 两种格式
+func getChainID(ctx context.Context, apiAddress string) (chainID string, err error) {
+	ret, err := rpcutils.HttpGetContext(ctx, apiAddress, "node_info", nil)
+	if err != nil {
+		return
+	}
+	var res struct {
+		Network string `json:"network"`
+		NodeInfo *struct {
+			Network string `json:"network"`
+		} `json:"node_info"`
+	}
+	if err = json.Unmarshal(ret, &res); err != nil {
+		err = fmt.Errorf("get node info error: %v, %v", err, string(ret))
+		return
+	}
+	chainID = res.Network
+	if res.NodeInfo != nil {
+		chainID = res.NodeInfo.Network
+	}
+	if chainID == "" {
+		err = fmt.Errorf("get node info error: %v", string(ret))
+	}
+	return
+}
+
+// cosmos-sdk 的错误码
+var broadcastErrorKinds = map[uint32]error{
+	5: types.ErrInsufficientFunds,
+	7: types.ErrInvalidAddress,
+	13: types.ErrFeeTooLow,
+}
+
+func broadcastTx(ctx context.Context, apiAddress string, stdTx auth.StdTx) (txhash string, err error) {
+	req, err := cdc.MarshalJSON(broadcastReq{Tx: stdTx, Mode: "sync"})
+	if err != nil {
+		return
+	}
+	// lcd 拒绝交易时可能返回非 2xx, 响应里有错误码时按错误码分类
+	ret, err := rpcutils.PostJSON(ctx, apiAddress, "txs", string(req))
+	var res broadcastRes
+	if json.Unmarshal(ret, &res) != nil || (res.Code == 0 && err != nil) {
+		if err == nil {
+			err = types.ClassifyError(fmt.Errorf("broadcast tx error: %v", string(ret)))
+		}
+		return
+	}
+	if res.Code != 0 {
+		err = fmt.Errorf("broadcast tx error: code %v, %v", res.Code, res.RawLog)
+		if kind, ok := broadcastErrorKinds[res.Code]; ok {
+			err = types.WrapError(kind, err)
+		} else {
+			err = types.ClassifyError(err)
+		}
+		return
+	}
+	if res.TxHash == "" {
+		err = fmt.Errorf("broadcast tx error: %v", string(ret))
+		return
+	}
+	return res.TxHash, nil
+}
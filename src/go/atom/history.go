@@ -0,0 +1,112 @@
+package atom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/x/bank"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetAddressHistory 用 lcd 的 txs 接口按 sender 和 recipient 标签查询地址的 ATOM 转账
+// lcd 只能按页查询, 先列出转出的交易, 再列出转入的交易, 游标形如 "sender:2" 或 "recipient:1"
+// 执行失败的交易不列出
+func (h *AtomHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	tag, pageNum := "sender", 1
+	if page.Cursor != "" {
+		parts := strings.Split(page.Cursor, ":")
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if len(parts) != 2 || (parts[0] != "sender" && parts[0] != "recipient") || err != nil {
+			return nil, fmt.Errorf("invalid cursor %v", page.Cursor)
+		}
+		tag, pageNum = parts[0], n
+	}
+	limit := page.PageLimit()
+	params := map[string][]string{
+		"action": {"send"},
+		tag: {address},
+		"page": {strconv.Itoa(pageNum)},
+		"limit": {strconv.Itoa(limit)},
+	}
+	ret, err := rpcutils.HttpGetContext(ctx, h.apiAddress, "txs", params)
+	if err != nil {
+		return nil, err
+	}
+	// 新版本的 lcd 返回 SearchTxsResult, 旧版本直接返回交易列表
+	var search struct {
+		Txs []json.RawMessage `json:"txs"`
+	}
+	if err := json.Unmarshal(ret, &search); err != nil {
+		if err := json.Unmarshal(ret, &search.Txs); err != nil {
+			return nil, types.ClassifyError(errors.New("txs response error: " + string(ret)))
+		}
+	}
+	hist := &types.HistoryPage{}
+	for i := len(search.Txs) - 1; i >= 0; i-- {
+		raw := search.Txs[i]
+		var txRes sdk.TxResponse
+		if err := UnmarshalJSON(raw, &txRes); err != nil || txRes.Code != 0 {
+			continue
+		}
+		var extra struct {
+			Timestamp string `json:"timestamp"`
+		}
+		json.Unmarshal(raw, &extra)
+		var timestamp int64
+		if tm, err := time.Parse(time.RFC3339, extra.Timestamp); err == nil {
+			timestamp = tm.Unix()
+		}
+		for _, t := range msgTransfers(txRes.Tx.GetMsgs(), address, tag == "sender") {
+			t.TxHash = txRes.TxHash
+			t.BlockHeight = uint64(txRes.Height)
+			t.Timestamp = timestamp
+			hist.Transfers = append(hist.Transfers, t)
+		}
+	}
+	switch {
+	case len(search.Txs) >= limit:
+		hist.NextCursor = tag + ":" + strconv.Itoa(pageNum+1)
+	case tag == "sender":
+		hist.NextCursor = "recipient:1"
+	}
+	return hist, nil
+}
+
+// 交易里和 address 有关的 ATOM 转账, sent 为 true 时列出转出, 否则列出别人转入的
+func msgTransfers(msgs []sdk.Msg, address string, sent bool) (transfers []types.Transfer) {
+	add := func(from, to string, coins sdk.Coins) {
+		amt := uatomAmount(coins)
+		if amt.Equal(sdk.ZeroInt()) {
+			return
+		}
+		if sent && from == address {
+			transfers = append(transfers, types.Transfer{Direction: types.DirectionOut, Counterparty: to, Amount: amt.BigInt()})
+		} else if !sent && from != address && to == address {
+			transfers = append(transfers, types.Transfer{Direction: types.DirectionIn, Counterparty: from, Amount: amt.BigInt()})
+		}
+	}
+	for _, msg := range msgs {
+		switch m := msg.(type) {
+		case MsgSend:
+			add(m.From.String(), m.To.String(), m.Amount)
+		case bank.MsgMultiSend:
+			if len(m.Inputs) == 0 {
+				continue
+			}
+			from := m.Inputs[0].Address.String()
+			for _, out := range m.Outputs {
+				add(from, out.Address.String(), out.Coins)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package atom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// tendermint 出块即最终确认
+var FinalityConfirmations uint64 = 1
+
+// GetTransactionStatus 用 lcd 的 txs/{hash} 查询交易所在的区块, code 不为 0 的交易是 TxFailed
+// lcd 查不到交易池, 没有上链的交易都是 TxUnknown
+func (h *AtomHandler) GetTransactionStatus(ctx context.Context, txhash string) (status *types.TxStatus, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	threshold := FinalityConfirmations
+	ret, err := rpcutils.HttpGetContext(ctx, h.apiAddress, "txs/"+txhash, nil)
+	if errors.Is(err, types.ErrNotFound) {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	if err != nil {
+		return
+	}
+	var txRes sdk.TxResponse
+	if err1 := UnmarshalJSON(ret, &txRes); err1 != nil || txRes.Height == 0 {
+		if errors.Is(types.ClassifyMessage(string(ret)), types.ErrNotFound) {
+			return types.UnknownTxStatus(txhash, threshold), nil
+		}
+		err = types.ClassifyError(errors.New("tx response error: " + string(ret)))
+		return
+	}
+	height := uint64(txRes.Height)
+	blockHash, _, err := h.block(ctx, "blocks/"+strconv.FormatUint(height, 10))
+	if err != nil {
+		return
+	}
+	_, best, err := h.block(ctx, "blocks/latest")
+	if err != nil {
+		return
+	}
+	status = types.IncludedTxStatus(txhash, height, blockHash, types.Confirmations(height, best), threshold)
+	if txRes.Code != 0 {
+		status.State = types.TxFailed
+	}
+	return
+}
+
+// 返回 lcd 的区块 path 的哈希和高度
+func (h *AtomHandler) block(ctx context.Context, path string) (hash string, height uint64, err error) {
+	ret, err := rpcutils.HttpGetContext(ctx, h.apiAddress, path, nil)
+	if err != nil {
+		return
+	}
+	var blk struct {
+		BlockMeta struct {
+			BlockId struct {
+				Hash string `json:"hash"`
+			} `json:"block_id"`
+			Header struct {
+				Height string `json:"height"`
+			} `json:"header"`
+		} `json:"block_meta"`
+	}
+	if err = json.Unmarshal(ret, &blk); err != nil {
+		err = types.ClassifyError(errors.New("block response error: " + string(ret)))
+		return
+	}
+	height, err = strconv.ParseUint(blk.BlockMeta.Header.Height, 10, 64)
+	if err != nil {
+		err = types.ClassifyError(errors.New("block response error: " + string(ret)))
+		return
+	}
+	hash = blk.BlockMeta.BlockId.Hash
+	return
+}
@@ -1,30 +1,55 @@
 package bch
 
 import (
-	"encoding/hex"
-	"fmt"
+	"context"
 	"math/big"
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
 	"github.com/gaozhengxin/cryptocoins/src/go/btc"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	addrconv "github.com/schancel/cashaddr-converter/address"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
 var allowHighFees = true
 
-var chainconfig = &chaincfg.TestNet3Params
+// 默认网络
+const DefaultNetwork = types.Testnet
 
 type BCHHandler struct {
+	network types.Network
+	// legacy 地址和比特币相同
+	chainConfig *chaincfg.Params
 	btcHandler *btc.BTCHandler
 }
 
 func NewBCHHandler () *BCHHandler {
-	return &BCHHandler{
-		btcHandler: btc.NewBTCHandlerWithConfig(config.ApiGateways.BitcoincashGateway.Host,config.ApiGateways.BitcoincashGateway.Port,config.ApiGateways.BitcoincashGateway.User,config.ApiGateways.BitcoincashGateway.Passwd,config.ApiGateways.BitcoincashGateway.Usessl),
+	h, _ := NewBCHHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewBCHHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewBCHHandlerForNetwork (network types.Network) (*BCHHandler, error) {
+	return NewBCHHandlerFromConfig(network, config.Current())
+}
+
+// NewBCHHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 BitcoincashGateway
+func NewBCHHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*BCHHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, err := btc.ChainConfigForNetwork(network)
+	if err != nil {
+		return nil, types.UnsupportedNetworkError("BCH", network)
 	}
+	return &BCHHandler{
+		network: network,
+		chainConfig: params,
+		btcHandler: btc.NewBTCHandlerForChain(network, params, gateways.ForNetwork(string(network)).BitcoincashGateway, gateways.HealthCheckInterval(), gateways.ForNetwork(string(network)).Timeout()),
+	}, nil
+}
+
+func (h *BCHHandler) Network() types.Network {
+	return h.network
 }
 
 var BCH_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -33,21 +58,19 @@ func (h *BCHHandler) GetDefaultFee() *big.Int {
 	return BCH_DEFAULT_FEE
 }
 
+// EstimateFee 用节点的 estimatesmartfee 估计手续费, 节点无法估计时三档都是 BCH_DEFAULT_FEE
+func (h *BCHHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	return h.btcHandler.EstimateFeeWithFallback(ctx, fromAddress, toAddress, amount, BCH_DEFAULT_FEE)
+}
+
 func (h *BCHHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error){
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed()
 	pkHash := btcutil.Hash160(b)
-	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, chainconfig)
+	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, h.chainConfig)
 	if err != nil {
 		return
 	}
@@ -58,41 +81,120 @@ func (h *BCHHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 	}
 	cashAddress, _ := addr.CashAddress()  // bitcoin cash
 	address, err = cashAddress.Encode()
-// for lockin test
-//************
-	address = "qq25efya3nwtmmplsj6j7whzmkj70z609v0rdeq5zf"
-//************
 	return
 }
 
-// NOT completed, may or not work
+// BCH 的签名要用 SIGHASH_FORKID 和 BIP143 的 digest, btc 构造的交易会被节点拒绝, 还没有实现
+// 构造, 签名和提交都返回 types.ErrNotSupported, 见 Capabilities
 func (h *BCHHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	transaction, digests, err = h.btcHandler.BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *BCHHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *BCHHandler) SupportedBuildOptions() []string {
+	return nil
+}
+
+func (h *BCHHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		TxLookup: true,
+		TxStatus: true,
+		History: h.btcHandler.HasElectrs(),
+		FeeEstimate: true,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, err := btc.ChainConfigForNetwork(n)
+			return err == nil
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *BCHHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "BCH",
+		Decimals: 8,
+		SLIP44: 145,
+		AddressFormat: types.AddressCashAddr,
+		SmallestUnit: "satoshi",
+	}
+}
+
+func (h *BCHHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	err = types.NotSupportedError("BCH", "BuildUnsignedTransaction")
+	return
+}
+
+func (h *BCHHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	err = types.NotSupportedError("BCH", "BuildUnsignedBatchTransaction")
+	return
+}
+
+func (h *BCHHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	return nil, types.NotSupportedError("BCH", "FetchChainState")
+}
+
+func (h *BCHHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	err = types.NotSupportedError("BCH", "Assemble")
 	return
 }
 
-// NOT completed, may or not work
 func (h *BCHHandler) SignTransaction(hash []string, wif interface{}) (rsv []string, err error){
-	return h.btcHandler.SignTransaction(hash, wif)
+	err = types.NotSupportedError("BCH", "SignTransaction")
+	return
 }
 
-// NOT completed, may or not work
 func (h *BCHHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
-	return h.btcHandler.MakeSignedTransaction(rsv, transaction)
+	err = types.NotSupportedError("BCH", "MakeSignedTransaction")
+	return
+}
+
+func (h *BCHHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
 }
 
-// NOT completed, may or not work
 func (h *BCHHandler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	return h.btcHandler.SubmitTransaction(signedTransaction)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *BCHHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	err = types.NotSupportedError("BCH", "SubmitTransaction")
+	return
 }
 
 func (h *BCHHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	return h.btcHandler.GetTransactionInfo(txhash)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *BCHHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.btcHandler.GetTransactionInfoContext(ctx, txhash)
+}
+
+// BCH 交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 6
+
+func (h *BCHHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	return h.btcHandler.TransactionStatus(ctx, txhash, FinalityConfirmations)
+}
+
+// GetAddressHistory 从节点网关配置的 electrs 查询地址历史, 没有配置 electrs 时返回 types.ErrNotSupported
+func (h *BCHHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	return h.btcHandler.ElectrsHistory(ctx, address, page)
 }
 
 // TODO
-func (h *BCHHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error){
-	err = fmt.Errorf("function currently not available")
+func (h *BCHHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *BCHHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	err = types.NotSupportedError("BCH", "GetAddressBalance")
 	//return nil, err
 	//addrsUrl := "https://api.blockcypher.com/v1/bch/test3/addrs/" + address
 	//resstr := loginPre1("GET",addrsUrl)
@@ -105,3 +207,11 @@ func (h *BCHHandler) GetAddressBalance(address string, jsonstring string) (balan
 	//balance = big.NewInt(int64(addrApiResult.Balance))
 	return
 }
+
+func (h *BCHHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return btc.MarshalEnvelope("BCH", h.network.String(), transaction, digests)
+}
+
+func (h *BCHHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return btc.UnmarshalEnvelope("BCH", h.network.String(), env)
+}
@@ -1,31 +1,58 @@
 package bitgold
 
 import (
-	"encoding/hex"
-	"fmt"
+	"context"
 	"math/big"
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
 	"github.com/gaozhengxin/cryptocoins/src/go/btc"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
-var ChainConfig = chaincfg.Params {
-	PubKeyHashAddrID: 0x26,
+// 默认网络
+const DefaultNetwork = types.Mainnet
+
+// 各网络的链参数
+var chainConfigs = map[types.Network]*chaincfg.Params{
+	types.Mainnet: {Name: "mainnet", PubKeyHashAddrID: 0x26},
 }
 
 var allowHighFees = true
 
 type BITGOLDHandler struct {
+	network types.Network
+	chainConfig *chaincfg.Params
 	btcHandler *btc.BTCHandler
 }
 
 func NewBITGOLDHandler () *BITGOLDHandler {
-	return &BITGOLDHandler{
-		btcHandler: btc.NewBTCHandlerWithConfig(config.BITGOLD_SERVER_HOST,config.BITGOLD_SERVER_PORT,config.BITGOLD_USER,config.BITGOLD_PASSWD,config.BITGOLD_USESSL),
+	h, _ := NewBITGOLDHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewBITGOLDHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewBITGOLDHandlerForNetwork (network types.Network) (*BITGOLDHandler, error) {
+	return NewBITGOLDHandlerFromConfig(network, config.Current())
+}
+
+// NewBITGOLDHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 BitgoldGateway
+func NewBITGOLDHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*BITGOLDHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, ok := chainConfigs[network]
+	if !ok {
+		return nil, types.UnsupportedNetworkError("BITGOLD", network)
 	}
+	return &BITGOLDHandler{
+		network: network,
+		chainConfig: params,
+		btcHandler: btc.NewBTCHandlerForChain(network, params, gateways.ForNetwork(string(network)).BitgoldGateway, gateways.HealthCheckInterval(), gateways.ForNetwork(string(network)).Timeout()),
+	}, nil
+}
+
+func (h *BITGOLDHandler) Network() types.Network {
+	return h.network
 }
 
 var BITGOLD_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -34,21 +61,19 @@ func (h *BITGOLDHandler) GetDefaultFee() *big.Int {
 	return BITGOLD_DEFAULT_FEE
 }
 
+// EstimateFee 用节点的 estimatesmartfee 估计手续费, 节点无法估计时三档都是 BITGOLD_DEFAULT_FEE
+func (h *BITGOLDHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	return h.btcHandler.EstimateFeeWithFallback(ctx, fromAddress, toAddress, amount, BITGOLD_DEFAULT_FEE)
+}
+
 func (h *BITGOLDHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error){
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed()
 	pkHash := btcutil.Hash160(b)
-	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, &ChainConfig)
+	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, h.chainConfig)
 	if err != nil {
 		return
 	}
@@ -56,33 +81,134 @@ func (h *BITGOLDHandler) PublicKeyToAddress(pubKeyHex string) (address string, e
 	return
 }
 
-// NOT completed, may or not work
 func (h *BITGOLDHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	return h.btcHandler.BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *BITGOLDHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *BITGOLDHandler) SupportedBuildOptions() []string {
+	return btc.SupportedBuildOptions
+}
+
+func (h *BITGOLDHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: h.btcHandler.HasElectrs(),
+		MultiOutput: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: btc.SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *BITGOLDHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "BTG",
+		Decimals: 8,
+		SLIP44: 156,
+		AddressFormat: types.AddressBase58Check,
+		SmallestUnit: "satoshi",
+	}
+}
+
+func (h *BITGOLDHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("BITGOLD", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *BITGOLDHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("BITGOLD", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 fromAddress 可以花费的 utxo, 见 btc.BTCHandler.FetchUTXOs
+func (h *BITGOLDHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	if err := opts.Check("BITGOLD", btc.SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	return h.btcHandler.FetchUTXOs(ctx, "BITGOLD", fromAddress)
+}
+
+// Assemble 用 state 的 utxo 构造未签名交易, 不访问网络
+func (h *BITGOLDHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.btcHandler.AssembleForCoin("BITGOLD", state, fromAddress, fromPublicKey, outputs, opts)
 }
 
-// NOT completed, may or not work
 func (h *BITGOLDHandler) SignTransaction(hash []string, wif interface{}) (rsv []string, err error){
 	return h.btcHandler.SignTransaction(hash, wif)
 }
 
-// NOT completed, may or not work
 func (h *BITGOLDHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
 	return h.btcHandler.MakeSignedTransaction(rsv, transaction)
 }
 
-// NOT completed, may or not work
+func (h *BITGOLDHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *BITGOLDHandler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	return h.btcHandler.SubmitTransaction(signedTransaction)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *BITGOLDHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	return h.btcHandler.SubmitTransactionContext(ctx, signedTransaction)
 }
 
 func (h *BITGOLDHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	return h.btcHandler.GetTransactionInfo(txhash)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *BITGOLDHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.btcHandler.GetTransactionInfoContext(ctx, txhash)
+}
+
+// BITGOLD 交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 6
+
+func (h *BITGOLDHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	return h.btcHandler.TransactionStatus(ctx, txhash, FinalityConfirmations)
+}
+
+// GetAddressHistory 从节点网关配置的 electrs 查询地址历史, 没有配置 electrs 时返回 types.ErrNotSupported
+func (h *BITGOLDHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	return h.btcHandler.ElectrsHistory(ctx, address, page)
 }
 
 // TODO
-func (h *BITGOLDHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error){
-	err = fmt.Errorf("function currently not available")
+func (h *BITGOLDHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *BITGOLDHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	err = types.NotSupportedError("BITGOLD", "GetAddressBalance")
 	return nil, err
 }
 
+
+func (h *BITGOLDHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return btc.MarshalEnvelope("BITGOLD", h.network.String(), transaction, digests)
+}
+
+func (h *BITGOLDHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return btc.UnmarshalEnvelope("BITGOLD", h.network.String(), env)
+}
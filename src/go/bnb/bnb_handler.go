@@ -1,10 +1,14 @@
 package bnb
 
 import (
+	"context"
+	"time"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
 	"github.com/binance-chain/go-sdk/client/basic"
 	"github.com/binance-chain/go-sdk/client/query"
 	ctypes "github.com/binance-chain/go-sdk/common/types"
@@ -13,26 +17,110 @@ import (
 	"github.com/binance-chain/go-sdk/types/tx"
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcutil"
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 	"github.com/tendermint/tendermint/crypto"
 	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"github.com/tendermint/tendermint/libs/bech32"
 )
 
-var Network string = "testnet"
+// 默认网络
+const DefaultNetwork = types.Testnet
 
-type BNBHandler struct {}
+// 地址前缀和 chain id
+// 不使用 sdk 的全局 ctypes.Network, 地址编解码由 handler 自己完成
+type chainParams struct {
+	hrp string
+	chainID string
+	sdkNetwork ctypes.ChainNetwork
+}
+
+var chainConfigs = map[types.Network]*chainParams{
+	types.Mainnet: &chainParams{hrp: "bnb", chainID: "Binance-Chain-Tigris", sdkNetwork: ctypes.ProdNetwork},
+	types.Testnet: &chainParams{hrp: "tbnb", chainID: "Binance-Chain-Nile", sdkNetwork: ctypes.TestNetwork},
+}
+
+// sdk 的地址 json 编码 (签名数据, 信封) 依赖全局 ctypes.Network
+// 用到时加锁切换成 handler 的网络, 结束后恢复
+var sdkNetworkLock sync.Mutex
+
+func (h *BNBHandler) withSDKNetwork(fn func() error) error {
+	sdkNetworkLock.Lock()
+	defer sdkNetworkLock.Unlock()
+	saved := ctypes.Network
+	ctypes.Network = h.params.sdkNetwork
+	defer func() {
+		ctypes.Network = saved
+	}()
+	return fn()
+}
+
+type BNBHandler struct {
+	network types.Network
+	params *chainParams
+	apiAddress string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
+}
 
 func NewBNBHandler () *BNBHandler {
-	return &BNBHandler{}
+	h, _ := NewBNBHandlerForNetwork(DefaultNetwork)
+	return h
 }
 
-func (h *BNBHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	pubbytes, err := hex.DecodeString(pubKeyHex)
+// NewBNBHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewBNBHandlerForNetwork (network types.Network) (*BNBHandler, error) {
+	return NewBNBHandlerFromConfig(network, config.Current())
+}
+
+// NewBNBHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 BinanceGateway
+func NewBNBHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*BNBHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, ok := chainConfigs[network]
+	if !ok {
+		return nil, types.UnsupportedNetworkError("BNB", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).BinanceGateway
+	rpcutils.RegisterApiGateway(gateway, nil, gateways.HealthCheckInterval())
+	if gateway.ChainID != "" {
+		p := *params
+		p.chainID = gateway.ChainID
+		params = &p
+	}
+	return &BNBHandler{
+		network: network,
+		params: params,
+		apiAddress: gateway.ApiAddress,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *BNBHandler) Network() types.Network {
+	return h.network
+}
+
+func (h *BNBHandler) encodeAddress(addr ctypes.AccAddress) (string, error) {
+	return bech32.ConvertAndEncode(h.params.hrp, addr.Bytes())
+}
+
+func (h *BNBHandler) decodeAddress(address string) (addr ctypes.AccAddress, err error) {
+	hrp, bz, err := bech32.DecodeAndConvert(address)
 	if err != nil {
+		err = types.Errorf(types.ErrInvalidAddress, "invalid address %v: %v", address, err)
 		return
 	}
+	if hrp != h.params.hrp {
+		err = types.Errorf(types.ErrInvalidAddress, "invalid address %v: expected prefix %v, got %v", address, h.params.hrp, hrp)
+		return
+	}
+	addr = ctypes.AccAddress(bz)
+	return
+}
 
-	pubkey, err := btcec.ParsePubKey(pubbytes, btcec.S256())
+func (h *BNBHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
+	pubkey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
@@ -41,52 +129,153 @@ func (h *BNBHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 
 	pkhash := btcutil.Hash160(cpub)
 
-	pkhashstr := hex.EncodeToString(pkhash)
+	address, err = h.encodeAddress(ctypes.AccAddress(pkhash))
 
-	if Network == "testnet" {
-		ctypes.Network = ctypes.TestNetwork
-	}
+	return
+}
 
-	accAddress, err := ctypes.AccAddressFromHex(pkhashstr)
+func (h *BNBHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *BNBHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
 	if err != nil {
 		return
 	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
 
-	address = accAddress.String()
+var SupportedBuildOptions = []string{types.OptMemo}
 
-	return
+func (h *BNBHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
 }
 
-func (h *BNBHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	amt := amount.Int64()
-	c := basic.NewClient("testnet-dex.binance.org:443")
-	q := query.NewClient(c)
-	acc, err := q.GetAccount(fromAddress)
+func (h *BNBHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		Balance: true,
+		MultiOutput: true,
+		Memo: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *BNBHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "BNB",
+		Decimals: 8,
+		SLIP44: 714,
+		AddressFormat: types.AddressBech32,
+	}
+}
+
+func (h *BNBHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, []types.TxOutput{{ToAddress: toAddress, Amount: amount}}, opts)
+}
+
+// 多个收款人放在同一个 send msg 的 msg.Transfer 列表里
+func (h *BNBHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
 	if err != nil {
 		return
 	}
-	fromCoins := ctypes.Coins{{"BNB", amt}}
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
 
-	fromAddr, err := ctypes.AccAddressFromBech32(fromAddress)
-	if err != nil {
+// FetchChainState 查询账户的 account number 和 sequence
+func (h *BNBHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	if err := opts.Check("BNB", SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	c := basic.NewClient(h.apiAddress)
+	q := query.NewClient(c)
+	var acc *ctypes.BalanceAccount
+	err := rpcutils.DoContext(ctx, h.timeout, func() (e error) {
+		acc, e = q.GetAccount(fromAddress)
 		return
+	})
+	if err != nil {
+		return nil, err
 	}
+	accountNumber, sequence := uint64(acc.Number), uint64(acc.Sequence)
+	state := types.NewChainState("BNB", h.network.String())
+	state.ChainID = h.params.chainID
+	state.AccountNumber = &accountNumber
+	state.Nonce = &sequence
+	return state, nil
+}
 
-	toAddr, err := ctypes.AccAddressFromBech32(toAddress)
+// Assemble 用 state 的 account number 和 sequence 构造 StdSignMsg, 不访问网络
+func (h *BNBHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = state.Check("BNB", h.network.String()); err != nil {
+		return
+	}
+	if err = opts.Check("BNB", SupportedBuildOptions...); err != nil {
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	if state.ChainID != "" && state.ChainID != h.params.chainID {
+		err = fmt.Errorf("chain state chain id mismatch: got %v, want %v", state.ChainID, h.params.chainID)
+		return
+	}
+	if state.AccountNumber == nil {
+		err = types.MissingStateError("account number")
+		return
+	}
+	if state.Nonce == nil {
+		err = types.MissingStateError("sequence")
+		return
+	}
+	fromAddr, err := h.decodeAddress(fromAddress)
 	if err != nil {
 		return
 	}
 
-	to := []msg.Transfer{{toAddr, []ctypes.Coin{{"BNB", amt}}}}
+	var total int64
+	var to []msg.Transfer
+	for i, out := range outputs {
+		toAddr, err1 := h.decodeAddress(out.ToAddress)
+		if err1 != nil {
+			err = types.Errorf(types.ErrInvalidAddress, "output %v: invalid address %v: %v", i, out.ToAddress, err1)
+			return
+		}
+		if !out.Amount.IsInt64() || total+out.Amount.Int64() < total {
+			err = fmt.Errorf("output %v: invalid amount %v", i, out.Amount)
+			return
+		}
+		amt := out.Amount.Int64()
+		total += amt
+		to = append(to, msg.Transfer{toAddr, []ctypes.Coin{{"BNB", amt}}})
+	}
+	fromCoins := ctypes.Coins{{"BNB", total}}
 
 	sendMsg := msg.CreateSendMsg(fromAddr, fromCoins, to)
 
+	memo := "this is a Dcrm lockout transaction (^_^)"
+	if opts != nil && opts.Memo != nil {
+		memo = *opts.Memo
+	}
+
 	signMsg := tx.StdSignMsg{
-		ChainID:"Binance-Chain-Nile",
-		AccountNumber:acc.Number,
-		Sequence:acc.Sequence,
+		ChainID:h.params.chainID,
+		AccountNumber:int64(*state.AccountNumber),
+		Sequence:int64(*state.Nonce),
 		Msgs:[]msg.Msg{sendMsg},
-		Memo:"this is a Dcrm lockout transaction (^_^)",
+		Memo:memo,
 		Source:tx.Source,
 	}
 
@@ -94,7 +283,12 @@ func (h *BNBHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddr
 		SignMsg: signMsg,
 		Pubkey: fromPublicKey,
 	}
-	digest := hex.EncodeToString(signMsg.Bytes())
+	var signBytes []byte
+	h.withSDKNetwork(func() error {
+		signBytes = signMsg.Bytes()
+		return nil
+	})
+	digest := hex.EncodeToString(signBytes)
 	digests = append(digests, digest)
 	return
 }
@@ -110,42 +304,59 @@ func (h *BNBHandler) SignTransaction(hash []string, privateKey interface{}) (rsv
 		if err != nil {
 			return nil, err
 		}
-		rs, err := privateKey.(crypto.PrivKey).Sign(b)
+		key := privateKey.(crypto.PrivKey)
+		rs, err := key.Sign(b)
+		if err != nil {
+			return nil, err
+		}
+		pk := key.PubKey().(secp256k1.PubKeySecp256k1)
+		pub, err := btcec.ParsePubKey(pk[:], btcec.S256())
 		if err != nil {
 			return nil, err
 		}
-		rsv = append(rsv, hex.EncodeToString(rs)+"00")
+		// tendermint 对 sha256(signBytes) 签名, 只返回 r s, 用公钥算出 v
+		digest := sha256.Sum256(b)
+		sig, err := signature.New(new(big.Int).SetBytes(rs[:32]), new(big.Int).SetBytes(rs[32:]), digest[:], pub)
+		if err != nil {
+			return nil, err
+		}
+		rsv = append(rsv, sig.String())
 	}
 	return
 }
 
+// MakeSignedTransaction 校验签名是 Pubkey 对 sha256(signBytes) 的签名, 失败返回 *types.SignatureError
 func (h *BNBHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
 	if len(rsv) < 1 {
 		err := fmt.Errorf("no rsv")
 		return nil, err
 	}
-	b, err := hex.DecodeString(rsv[0])
-	if err != nil {
-		return
-	}
-	var rs []byte
-	if len(b) == 65 {
-		rs = b[:64]
-	}
-	fmt.Printf("\n\n\nlen(rs):\n%v\n\n\n", len(rs))
 
-	signMsg := transaction.(BNBTx).SignMsg
-	pubkeyhex := transaction.(BNBTx).Pubkey
+	btx, ok := transaction.(BNBTx)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	signMsg := btx.SignMsg
+	pubkeyhex := btx.Pubkey
 
-	pb, err := hex.DecodeString(pubkeyhex)
+	pub, err := signature.ParsePublicKey(pubkeyhex)
 	if err != nil {
 		return
 	}
 
-	pub, err := btcec.ParsePubKey(pb, btcec.S256())
+	var signBytes []byte
+	h.withSDKNetwork(func() error {
+		signBytes = signMsg.Bytes()
+		return nil
+	})
+	digest := sha256.Sum256(signBytes)
+	// tendermint 只接受 low S 的签名
+	rsvSig, err := signature.Check(0, rsv[0], digest[:], pub, signature.Rules{LowS: true})
 	if err != nil {
 		return
 	}
+	// tendermint 的签名是 64 字节的 r s, 不带 v
+	rs := rsvSig.Bytes()[:64]
 
 	cpub := pub.SerializeCompressed()
 	var arr [33]byte
@@ -168,25 +379,60 @@ func (h *BNBHandler) MakeSignedTransaction(rsv []string, transaction interface{}
 	return
 }
 
+func (h *BNBHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *BNBHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
-	c := basic.NewClient("testnet-dex.binance.org:443")
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *BNBHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	stx, ok := signedTransaction.([]byte)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	c := basic.NewClient(h.apiAddress)
 	param := map[string]string{}
 	param["sync"] = "true"
-	commits, err := c.PostTx(signedTransaction.([]byte), param)
+	var hash string
+	err = rpcutils.DoContext(ctx, h.timeout, func() error {
+		commits, err := c.PostTx(stx, param)
+		if err != nil {
+			return err
+		}
+		hash = commits[0].Hash
+		return nil
+	})
 	if err != nil {
+		err = types.ClassifyError(err)
 		return
 	}
-	txhash = commits[0].Hash
+	txhash = hash
 	return
 }
 
 func (h *BNBHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	c := basic.NewClient("testnet-dex.binance.org:443")
-	resp, err := c.GetTx(txhash)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *BNBHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	c := basic.NewClient(h.apiAddress)
+	var data string
+	err = rpcutils.DoContext(ctx, h.timeout, func() error {
+		resp, err := c.GetTx(txhash)
+		if err != nil {
+			return err
+		}
+		data = resp.Data
+		return nil
+	})
 	if err != nil {
+		err = types.ClassifyError(err)
 		return
 	}
-	b, err := hex.DecodeString(resp.Data[3:len(resp.Data)-1])
+	b, err := hex.DecodeString(data[3:len(data)-1])
 	if err != nil {
 		return
 	}
@@ -201,12 +447,20 @@ func (h *BNBHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 		if m.Type() == "send" {
 			sendmsg := m.(msg.SendMsg)
 			if sendmsg.Inputs[0].Coins[0].Denom == "BNB" {
-				fromAddress = sendmsg.Inputs[0].Address.String()
+				fromAddress, err = h.encodeAddress(sendmsg.Inputs[0].Address)
+				if err != nil {
+					return
+				}
 			}
 			for _, out := range sendmsg.Outputs {
 				if out.Coins[0].Denom == "BNB" {
+					toAddress, err1 := h.encodeAddress(out.Address)
+					if err1 != nil {
+						err = err1
+						return
+					}
 					output := types.TxOutput{
-						ToAddress: out.Address.String(),
+						ToAddress: toAddress,
 						Amount: big.NewInt(out.Coins[0].Amount),
 					}
 					txOutputs = append(txOutputs, output)
@@ -219,10 +473,19 @@ func (h *BNBHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 }
 
 func (h *BNBHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	c := basic.NewClient("testnet-dex.binance.org:443")
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *BNBHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	c := basic.NewClient(h.apiAddress)
 	q := query.NewClient(c)
-	ba, err := q.GetAccount(address)
+	var ba *ctypes.BalanceAccount
+	err = rpcutils.DoContext(ctx, h.timeout, func() (e error) {
+		ba, e = q.GetAccount(address)
+		return
+	})
 	if err != nil {
+		err = types.ClassifyError(err)
 		return
 	}
 	for _, bal := range ba.Balances {
@@ -242,3 +505,35 @@ func (h *BNBHandler) GetDefaultFee() *big.Int {
 	return big.NewInt(50000)
 }
 
+
+// payload 是 amino json 编码的 BNBTx
+func (h *BNBHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	btx, ok := transaction.(BNBTx)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	var payload []byte
+	err := h.withSDKNetwork(func() (e error) {
+		payload, e = tx.Cdc.MarshalJSON(btx)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxEnvelope("BNB", h.network.String(), digests, payload), nil
+}
+
+func (h *BNBHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("BNB", h.network.String()); err != nil {
+		return
+	}
+	var btx BNBTx
+	err = h.withSDKNetwork(func() error {
+		return tx.Cdc.UnmarshalJSON(env.Payload, &btx)
+	})
+	if err != nil {
+		return
+	}
+	transaction = btx
+	return
+}
@@ -0,0 +1,63 @@
+package bnb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// binance chain 出块即最终确认
+var FinalityConfirmations uint64 = 1
+
+// GetTransactionStatus 用 dex api 的 tx/{hash} 查询交易所在的区块, code 不为 0 的交易是 TxFailed
+// api 查不到交易池, 没有上链的交易都是 TxUnknown
+func (h *BNBHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	threshold := FinalityConfirmations
+	// 和 sdk 的 basic client 一样使用 https
+	host := "https://" + h.apiAddress
+	ret, err := rpcutils.HttpGetContext(ctx, host, "api/v1/tx/"+txhash, map[string][]string{"format": {"json"}})
+	if errors.Is(err, types.ErrNotFound) {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var txRes struct {
+		Code int64 `json:"code"`
+		Hash string `json:"hash"`
+		Height string `json:"height"`
+	}
+	if err := json.Unmarshal(ret, &txRes); err != nil || txRes.Hash == "" {
+		if errors.Is(types.ClassifyMessage(string(ret)), types.ErrNotFound) {
+			return types.UnknownTxStatus(txhash, threshold), nil
+		}
+		return nil, types.ClassifyError(errors.New("tx response error: " + string(ret)))
+	}
+	height, err := strconv.ParseUint(txRes.Height, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	ret, err = rpcutils.HttpGetContext(ctx, host, "api/v1/node-info", nil)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		SyncInfo struct {
+			LatestBlockHeight uint64 `json:"latest_block_height"`
+		} `json:"sync_info"`
+	}
+	if err := json.Unmarshal(ret, &info); err != nil {
+		return nil, types.ClassifyError(errors.New("node info error: " + string(ret)))
+	}
+	status := types.IncludedTxStatus(txhash, height, "", types.Confirmations(height, info.SyncInfo.LatestBlockHeight), threshold)
+	if txRes.Code != 0 {
+		status.State = types.TxFailed
+	}
+	return status, nil
+}
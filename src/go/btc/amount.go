@@ -0,0 +1,30 @@
+package btc
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 1 BTC = 10^Decimals satoshi
+const Decimals = 8
+
+// ParseAmount 把十进制的 BTC 金额 (如 "0.0001") 精确转换成 satoshi
+func ParseAmount(s string) (btcutil.Amount, error) {
+	v, err := types.ParseUnits(s, Decimals)
+	if err != nil {
+		return 0, err
+	}
+	if !v.IsInt64() {
+		return 0, fmt.Errorf("invalid amount %v: out of range", s)
+	}
+	return btcutil.Amount(v.Int64()), nil
+}
+
+// NewAmount 把 float64 的 BTC 金额 (btcjson 的 ListUnspentResult.Amount) 转换成 satoshi
+// 和 btcutil.NewAmount 不同, 不做浮点乘法, 而是解析 f 的最短十进制表示, 超过 8 位小数时返回错误
+func NewAmount(f float64) (btcutil.Amount, error) {
+	return ParseAmount(strconv.FormatFloat(f, 'f', -1, 64))
+}
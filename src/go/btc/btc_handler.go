@@ -2,17 +2,15 @@ package btc
 
 import (
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"math/big"
-	"net/http"
 	"runtime/debug"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -25,42 +23,101 @@ import (
 	"github.com/btcsuite/btcwallet/wallet/txauthor"
 	"github.com/btcsuite/btcwallet/wallet/txrules"
 
-	"github.com/ethereum/go-ethereum/crypto"
 	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
-var ChainConfig = chaincfg.TestNet3Params
+// 默认网络
+const DefaultNetwork = types.Testnet
+
+// 各网络的链参数
+var chainConfigs = map[types.Network]*chaincfg.Params{
+	types.Mainnet: &chaincfg.MainNetParams,
+	types.Testnet: &chaincfg.TestNet3Params,
+	types.Regtest: &chaincfg.RegressionNetParams,
+}
+
+// ChainConfigForNetwork 返回比特币 network 的链参数
+func ChainConfigForNetwork(network types.Network) (*chaincfg.Params, error) {
+	params, ok := chainConfigs[network.Or(DefaultNetwork)]
+	if !ok {
+		return nil, types.UnsupportedNetworkError("BTC", network)
+	}
+	return params, nil
+}
 
 var RequiredConfirmations = int64(1)
 
 var allowHighFees = true
 
-var feeRate, _ = btcutil.NewAmount(0.0001)
+// 默认 0.0001 BTC/kB
+var feeRate = btcutil.Amount(10000)
 
 var hashType = txscript.SigHashAll
 
 type BTCHandler struct{
+	network types.Network
+	chainConfig *chaincfg.Params
+	electrsAddress string
+	explorerAddress string
 	serverHost string
 	serverPort int
 	rpcuser string
 	passwd string
 	usessl bool
+	// 节点使用自签名证书, 不检查证书
+	insecure bool
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
 }
 
 func NewBTCHandler () *BTCHandler {
+	h, _ := NewBTCHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewBTCHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewBTCHandlerForNetwork (network types.Network) (*BTCHandler, error) {
+	return NewBTCHandlerFromConfig(network, config.Current())
+}
+
+// NewBTCHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 BitcoinGateway
+func NewBTCHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*BTCHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, err := ChainConfigForNetwork(network)
+	if err != nil {
+		return nil, err
+	}
+	return NewBTCHandlerForChain(network, params, gateways.ForNetwork(string(network)).BitcoinGateway, gateways.HealthCheckInterval(), gateways.ForNetwork(string(network)).Timeout()), nil
+}
+
+// NewBTCHandlerForChain 用给定的链参数和网关创建 handler, ltc, dash 等币种用它构造交易
+// 网关配置了备用节点时注册到 rpcutils, 请求自动切换到健康的节点, interval 是健康检查的间隔, timeout 是网关请求的超时
+func NewBTCHandlerForChain (network types.Network, chainConfig *chaincfg.Params, gateway *config.RpcClientConfig, interval, timeout time.Duration) *BTCHandler {
+	rpcutils.RegisterRpcGateway(gateway, interval)
 	return &BTCHandler{
-		serverHost: config.ApiGateways.BitcoinGateway.Host,
-		serverPort: config.ApiGateways.BitcoinGateway.Port,
-		rpcuser: config.ApiGateways.BitcoinGateway.User,
-		passwd: config.ApiGateways.BitcoinGateway.Passwd,
-		usessl: config.ApiGateways.BitcoinGateway.Usessl,
+		network: network,
+		chainConfig: chainConfig,
+		electrsAddress: gateway.ElectrsAddress,
+		explorerAddress: gateway.ExplorerAddress,
+		serverHost: gateway.Host,
+		serverPort: gateway.Port,
+		rpcuser: gateway.User,
+		passwd: gateway.Passwd,
+		usessl: gateway.Usessl,
+		insecure: gateway.InsecureSkipVerify,
+		timeout: timeout,
 	}
 }
 
+// 使用默认网络的链参数和 electrs
 func NewBTCHandlerWithConfig (userServerHost string, suserServerPort int, userRpcuser, userPasswd string, userUsessl bool) *BTCHandler {
 		return &BTCHandler{
+			network: DefaultNetwork,
+			chainConfig: chainConfigs[DefaultNetwork],
+			electrsAddress: config.Current().BitcoinGateway.ElectrsAddress,
 			serverHost: userServerHost,
 			serverPort: suserServerPort,
 			rpcuser: userRpcuser,
@@ -69,6 +126,14 @@ func NewBTCHandlerWithConfig (userServerHost string, suserServerPort int, userRp
 		}
 }
 
+func (h *BTCHandler) Network() types.Network {
+	return h.network
+}
+
+func (h *BTCHandler) ChainConfig() *chaincfg.Params {
+	return h.chainConfig
+}
+
 var BTC_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
 
 func (h *BTCHandler) GetDefaultFee() *big.Int {
@@ -76,21 +141,14 @@ func (h *BTCHandler) GetDefaultFee() *big.Int {
 }
 
 func (h *BTCHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error){
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed() /// <--
 	//b := pubKey.SerializeUncompressed()
 	pkHash := btcutil.Hash160(b)
-	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, &ChainConfig)
+	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, h.chainConfig)
 	if err != nil {
 		return
 	}
@@ -100,223 +158,143 @@ func (h *BTCHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 
 // jsonstring: '{"feeRate":0.0001,"changAddress":"mtjq9RmBBDVne7YB4AFHYCZFn3P2AXv9D5"}'
 func (h *BTCHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	defer func () {
-		if e := recover(); e != nil {
-			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
-			return
-		}
-	} ()
-	changeAddress := fromAddress
-	var args interface{}
-	json.Unmarshal([]byte(jsonstring), &args)
-	if args != nil {
-		userFeeRate := args.(map[string]interface{})["feeRate"]
-		userChangeAddress := args.(map[string]interface{})["changeAddress"]
-		if userFeeRate != nil {
-			feeRate, err = btcutil.NewAmount(userFeeRate.(float64))
-			if err != nil {
-				return
-			}
-		}
-		if userChangeAddress != nil {
-			changeAddress = userChangeAddress.(string)
-		}
-	}
-	//unspentOutputs, err := listUnspent_blockchaininfo(fromAddress)
-	//unspentOutputs, err := listUnspent(fromAddress)
-	unspentOutputs, err := listUnspent_electrs(fromAddress)
-	if err != nil {
-		err = errContext(err, "failed to fetch unspent outputs")
-		return
-	}
-	sourceOutputs := make(map[string][]btcjson.ListUnspentResult)
-	for _, unspentOutput := range unspentOutputs {
-		if !unspentOutput.Spendable {
-			continue
-		}
-		if unspentOutput.Confirmations < RequiredConfirmations {
-			continue
-		}
-		b, _ := hex.DecodeString(unspentOutput.ScriptPubKey)
-		pkScript, err := txscript.ParsePkScript(b)
-		if err != nil {
-			continue
-		}
-		class := pkScript.Class().String()
-		if class != "pubkeyhash" {
-			continue
-		}
-		sourceAddressOutputs := sourceOutputs[unspentOutput.Address]
-		sourceOutputs[unspentOutput.Address] = append(sourceAddressOutputs, unspentOutput)
-	}
-	// 设置交易输出
-	// 生成锁定脚本
-	var txOuts []*wire.TxOut
-	toAddr, _ := btcutil.DecodeAddress(toAddress, &ChainConfig)
-	pkscript, _ := txscript.PayToAddrScript(toAddr)
-	txOut := wire.NewTxOut(amount.Int64(), pkscript)
-	txOuts = append(txOuts,txOut)
-	if len(sourceOutputs) < 1 {
-		err = errContext(err, "cannot find p2pkh utxo")
-		return
-	}
-	previousOutputs := sourceOutputs[fromAddress]
-	targetAmount := SumOutputValues(txOuts)
-	estimatedSize := EstimateVirtualSize(0, 1, 0, txOuts, true)
-	targetFee := txrules.FeeForSerializeSize(feeRate, estimatedSize)
-	// 选择utxo作为交易输入
-	// *************************************************
-	var inputSource txauthor.InputSource
-	for i, _ := range previousOutputs {
-		inputSource = makeInputSource(previousOutputs[:i+1])
-		inputAmount, _, _, _, err1 := inputSource(targetAmount + targetFee)
-		if err1 != nil {
-			err = err1
-			return
-		}
-		if inputAmount < targetAmount+targetFee {
-			fmt.Printf("=========inputAmount %v, targetAmount %v, targetFee %v=========\n",inputAmount,targetAmount,targetFee)
-			continue
-		} else {
-			break
-		}
-	}
-	// *************************************************
-	// 设置找零
-	changeAddr, _ := btcutil.DecodeAddress(changeAddress, &ChainConfig)
-	changeSource := func()([]byte,error){
-		return txscript.PayToAddrScript(changeAddr)
-	}
-	transaction, err = newUnsignedTransaction(txOuts, feeRate, inputSource, changeSource)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *BTCHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
 	if err != nil {
 		return
 	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
 
-	for idx, _ := range transaction.(*AuthoredTx).Tx.TxIn {
-		pkscript, _ := hex.DecodeString(previousOutputs[idx].ScriptPubKey)
+// utxo 币种支持的 build options
+var SupportedBuildOptions = []string{types.OptFeeRate, types.OptChangeAddress, types.OptConfirmations}
 
-		txhashbytes, err1 := txscript.CalcSignatureHash(pkscript, hashType, transaction.(*AuthoredTx).Tx, idx)
-		if err1 != nil {
-			err = err1
-			return
-		}
-		txhash := hex.EncodeToString(txhashbytes)
-		digests = append(digests, txhash)
-	}
-	transaction.(*AuthoredTx).Digests = digests
+func (h *BTCHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
 
-	if fromPublicKey[:2] == "0x" || fromPublicKey[:2] == "0X" {
-		fromPublicKey = fromPublicKey[2:]
+// 余额从 blockcypher 查询, 没有配置 ExplorerAddress 也没有对应链的网络不支持
+func (h *BTCHandler) Capabilities() types.Capabilities {
+	_, balance := h.explorer()
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		Balance: balance,
+		History: balance || h.HasElectrs(),
+		MultiOutput: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
 	}
-	bb, err := hex.DecodeString(fromPublicKey)
-	if err != nil {
-		return
+}
+
+func (h *BTCHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "BTC",
+		Decimals: Decimals,
+		SLIP44: 0,
+		AddressFormat: types.AddressBase58Check,
+		SmallestUnit: "satoshi",
 	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+}
+
+func (h *BTCHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, []types.TxOutput{{ToAddress: toAddress, Amount: amount}}, opts)
+}
+
+// 一笔交易给多个地址转账, 每个收款人一个 TxOut, 找零单独一个 TxOut
+func (h *BTCHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
 	if err != nil {
 		return
 	}
-	transaction.(*AuthoredTx).PubKeyData = pubKey.SerializeCompressed()
-
-	return
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
 }
 
 func (h *BTCHandler) SignTransaction(hash []string, wif interface{}) (rsv []string, err error){
-	//fmt.Printf("\n\n\n######## 注意 注意 wif is %v ########\n\n\n\n",wif.(string))
 	pkwif, err :=  btcutil.DecodeWIF(wif.(string))
 	if err != nil {
 		return
 	}
-	//fmt.Printf("\n\n\n######## 注意 注意 pkwif is %v ########\n\n\n\n",pkwif)
 	privateKey := pkwif.PrivKey
-	pkwif.CompressPubKey = true
-	privateKeyUncompressed := pkwif.String()
-	fmt.Printf("\n\n\n######## 注意 注意 privateKeyUncompressed is %v ########\n\n\n\n",privateKeyUncompressed)
-
-
-	//pubkey := privateKey.PubKey()
-	//pub := pubkey.SerializeUncompressed()
-	//pub := pubkey.SerializeCompressed()
-	//pubstr := hex.EncodeToString(pub)
-	//fmt.Printf("\n\n\n######## 注意 注意 pub is %v ########\n\n\n\n",pubstr)
-
-	//signeraddr, _ := h.PublicKeyToAddress(pubstr)
-	//fmt.Printf("\n\n\n######## 注意 注意 signeraddr is %v ########\n\n\n\n",signeraddr)
-
-
-	//fmt.Println(privateKey.ToECDSA())
 	for _, hs := range hash {
 		b, err1 := hex.DecodeString(hs)
 		if err1 != nil {
 			err = err1
 			return
 		}
-		signature, err2 := privateKey.Sign(b)
+		sig, err2 := privateKey.Sign(b)
 		if err2 != nil {
 			err = err2
 			return
 		}
-		rr := fmt.Sprintf("%X", signature.R)
-		ss := fmt.Sprintf("%X", signature.S)
-		for len(rr) < 64 {
-			rr = "0" + rr
-		}
-		for len(ss) < 64 {
-			ss = "0" + ss
+		// 和 dcrm 一样返回 low-S 和正确的 v
+		rs, err3 := signature.New(sig.R, sig.S, b, privateKey.PubKey())
+		if err3 != nil {
+			err = err3
+			return
 		}
-		str := fmt.Sprintf("%s%s00", rr, ss)
-		rsv = append(rsv, str)
+		rsv = append(rsv, rs.String())
 	}
 	return
 }
 
+// MakeSignedTransaction 校验每个输入的签名是构造交易时的公钥对 digest 的签名, 失败返回 *types.SignatureError
+// digest 用信封里的 PrevScripts 重新计算, 和信封里的 Digests 不一致时返回错误
 func (h *BTCHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
-	txIn := transaction.(*AuthoredTx).Tx.TxIn
+	authored, ok := transaction.(*AuthoredTx)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", transaction)
+		return
+	}
+	txIn := authored.Tx.TxIn
 	if len(txIn) != len(rsv) {
 		err = fmt.Errorf("signatures number does not match transaction inputs number")
 		return
 	}
-	if len(transaction.(*AuthoredTx).Digests) != len(txIn) {
+	if len(authored.Digests) != len(txIn) {
 		err = fmt.Errorf("digests number does not match transaction inputs number")
 		return
 	}
+	if len(authored.PrevScripts) != len(txIn) {
+		err = fmt.Errorf("previous scripts number does not match transaction inputs number")
+		return
+	}
+	pk, err := btcec.ParsePubKey(authored.PubKeyData, btcec.S256())
+	if err != nil {
+		err = fmt.Errorf("invalid transaction public key: %v", err)
+		return
+	}
+	cPkData := authored.PubKeyData
 	for i, txin := range txIn {
-		l := len(rsv[i])-2
-		rs := rsv[i][0:l]
-
-		r := rs[:64]
-		s := rs[64:]
-
-		rr, _ := new(big.Int).SetString(r,16)
-		ss, _ := new(big.Int).SetString(s,16)
-
-		sign := &btcec.Signature{
-			R: rr,
-			S: ss,
+		txhashbytes, err1 := txscript.CalcSignatureHash(authored.PrevScripts[i], hashType, authored.Tx, i)
+		if err1 != nil {
+			err = fmt.Errorf("input %v: %v", i, err1)
+			return
 		}
-
-		//fmt.Println("dcrm sign is ",sign)
-		// r, s 转成BTC标准格式的签名, 添加hashType
-		signbytes := append(sign.Serialize(), byte(hashType))
-
-		// 从rsv中恢复公钥
-		rsv_bytes, _ := hex.DecodeString(rsv[i])
-		txhashbytes, _ := hex.DecodeString(transaction.(*AuthoredTx).Digests[i])
-		pkData, err1 := crypto.Ecrecover(txhashbytes, rsv_bytes)
+		if !strings.EqualFold(authored.Digests[i], hex.EncodeToString(txhashbytes)) {
+			err = fmt.Errorf("input %v: digest %v does not match the transaction", i, authored.Digests[i])
+			return
+		}
+		// v 不参与比特币系的签名校验, DER 会把 S 规范化成 low S
+		sig, err1 := signature.Check(i, rsv[i], txhashbytes, pk, signature.Rules{})
 		if err1 != nil {
 			err = err1
 			return
 		}
-		pk, _ := btcec.ParsePubKey(pkData, btcec.S256())
-		cPkData := pk.SerializeCompressed()
-		//cPkData := pk.SerializeUncompressed()
-
-		cPkData1 := transaction.(*AuthoredTx).PubKeyData
-		if string(cPkData) != string(cPkData1) {
-			//err = fmt.Errorf("recover public key error: got %v, want %v", cPkData, cPkData1)
-			//return
-			cPkData = cPkData1
-		}
+		// r, s 转成BTC标准格式的签名, 添加hashType
+		signbytes := append(sig.DER(), byte(hashType))
 
 		sigScript, err2 := txscript.NewScriptBuilder().AddData(signbytes).AddData(cPkData).Script()
 		if err2 != nil {
@@ -329,13 +307,35 @@ func (h *BTCHandler) MakeSignedTransaction(rsv []string, transaction interface{}
 	return
 }
 
+// 组装签名交易不需要访问网络
+func (h *BTCHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *BTCHandler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	c, _ := rpcutils.NewClient(h.serverHost,h.serverPort,h.rpcuser,h.passwd,h.usessl)
-	ret, err = SendRawTransaction (c, signedTransaction.(*AuthoredTx).Tx, allowHighFees)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *BTCHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	authored, ok := signedTransaction.(*AuthoredTx)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	c, _ := rpcutils.NewClient(h.serverHost,h.serverPort,h.rpcuser,h.passwd,h.usessl,h.insecure)
+	ret, err = SendRawTransactionContext (ctx, c, authored.Tx, allowHighFees)
 	return
 }
 
 func (h *BTCHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *BTCHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
@@ -343,24 +343,6 @@ func (h *BTCHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 		}
 	} ()
 
-grtreq := `{"jsonrpc":"1.0","method":"getrawtransaction","params":["` + txhash + `",true],"id":1}`
-//grtreq := `{"jsonrpc":"1.0","method":"getrawtransaction","params":["` + txhash + `"],"id":1}`
-client, _ := rpcutils.NewClient(h.serverHost,h.serverPort,h.rpcuser,h.passwd,h.usessl)
-ret1, err := client.Send(grtreq)
-if err != nil {
-	return
-} else {
-	var ret1Obj interface{}
-fmt.Println("=======ret1=========")
-	fmt.Println(ret1)
-fmt.Println("====================")
-	json.Unmarshal([]byte(ret1), &ret1Obj)
-	confirmations := ret1Obj.(map[string]interface{})["result"].(map[string]interface{})["confirmations"]
-	if confirmations != nil {
-		fmt.Printf("!!!!!!!!confirmations is %v\n\n",int(confirmations.(float64)))
-	}
-}
-
 	cmd := btcjson.NewGetRawTransactionCmd(txhash, nil)
 
 	marshalledJSON, err := btcjson.MarshalCmd(1, cmd)
@@ -368,8 +350,8 @@ fmt.Println("====================")
 		return
 	}
 
-	c, _ := rpcutils.NewClient(h.serverHost,h.serverPort,h.rpcuser,h.passwd,h.usessl)
-	retJSON, err := c.Send(string(marshalledJSON))
+	c, _ := rpcutils.NewClient(h.serverHost,h.serverPort,h.rpcuser,h.passwd,h.usessl,h.insecure)
+	retJSON, err := c.SendContext(ctx, string(marshalledJSON))
 	if err != nil {
 		return
 	}
@@ -384,15 +366,20 @@ fmt.Println("====================")
 	if err != nil {
 		return
 	}
-	retJSON2, err := c.Send(string(marshalledJSON2))
+	retJSON2, err := c.SendContext(ctx, string(marshalledJSON2))
+	// 金额用 json.Number 解析, 不经过 float64
 	var tx interface{}
-	json.Unmarshal([]byte(retJSON2), &tx)
+	dec := json.NewDecoder(strings.NewReader(retJSON2))
+	dec.UseNumber()
+	dec.Decode(&tx)
 	vouts := tx.(map[string]interface{})["result"].(map[string]interface{})["vout"].([]interface{})
 	for _, vout := range vouts {
 		toAddress := vout.(map[string]interface{})["scriptPubKey"].(map[string]interface{})["addresses"].([]interface{})[0].(string)
-		flt := vout.(map[string]interface{})["value"].(float64)
-		amt, _ := btcutil.NewAmount(flt)
-		transferAmount := big.NewInt(int64(amt.ToUnit(btcutil.AmountSatoshi)))
+		transferAmount, err1 := types.ParseUnits(vout.(map[string]interface{})["value"].(json.Number).String(), Decimals)
+		if err1 != nil {
+			err = err1
+			return
+		}
 		txOutputs = append(txOutputs, types.TxOutput{ToAddress:toAddress, Amount:transferAmount})
 	}
 
@@ -409,7 +396,8 @@ fmt.Println("====================")
 		fromAddress = coinbase.(string)
 	}
 	vintxid := vintx.(string)
-	vinvout := int(tx.(map[string]interface{})["result"].(map[string]interface{})["vin"].([]interface{})[0].(map[string]interface{})["vout"].(float64))
+	vinvout64, _ := tx.(map[string]interface{})["result"].(map[string]interface{})["vin"].([]interface{})[0].(map[string]interface{})["vout"].(json.Number).Int64()
+	vinvout := int(vinvout64)
 
 	cmd3 := btcjson.NewGetRawTransactionCmd(vintxid, nil)
 
@@ -418,7 +406,7 @@ fmt.Println("====================")
 		return
 	}
 
-	retJSON3, err := c.Send(string(marshalledJSON3))
+	retJSON3, err := c.SendContext(ctx, string(marshalledJSON3))
 	if err != nil {
 		return
 	}
@@ -434,7 +422,7 @@ fmt.Println("====================")
 		return
 	}
 
-	retJSON4, err := c.Send(string(marshalledJSON4))
+	retJSON4, err := c.SendContext(ctx, string(marshalledJSON4))
 	if err != nil {
 		return
 	}
@@ -448,15 +436,43 @@ fmt.Println("====================")
 }
 
 func (h *BTCHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	addrsUrl := "https://api.blockcypher.com/v1/btc/test3/addrs/" + address
-	resstr := loginPre1("GET",addrsUrl)
-	if resstr == "" {
-		err = fmt.Errorf("cannot get address balance, blockcypher didnt response")
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+// blockcypher 上各网络的链名
+var blockcypherChains = map[types.Network]string{
+	types.Mainnet: "main",
+	types.Testnet: "test3",
+}
+
+// explorer 返回查询余额和历史的 api, 没有配置 ExplorerAddress 时使用 blockcypher 上 handler 网络的链
+func (h *BTCHandler) explorer() (string, bool) {
+	if h.explorerAddress != "" {
+		return strings.TrimRight(h.explorerAddress, "/"), true
+	}
+	chain, ok := blockcypherChains[h.network]
+	if !ok {
+		return "", false
+	}
+	return "https://api.blockcypher.com/v1/btc/" + chain, true
+}
+
+func (h *BTCHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	explorer, ok := h.explorer()
+	if !ok {
+		err = types.NotSupportedError("BTC", "GetAddressBalance on " + h.network.String())
+		return
+	}
+	addrsUrl := explorer + "/addrs/" + address
+	resstr, err := explorerGet(ctx, addrsUrl)
+	if err != nil {
 		return
 	}
 
 	addrApiResult := parseAddrApiResult(resstr)
-	balance = big.NewInt(int64(addrApiResult.Balance))
+	balance = big.NewInt(addrApiResult.Balance)
 	return
 }
 
@@ -471,7 +487,7 @@ func (noInputValue) Error() string {
 }
 
 func errContext(err error, context string) error {
-        return fmt.Errorf("%s: %v", context, err)
+        return fmt.Errorf("%s: %w", context, err)
 }
 
 func pickNoun(n int, singularForm, pluralForm string) string {
@@ -529,8 +545,7 @@ func newUnsignedTransaction(outputs []*wire.TxOut, relayFeePerKb btcutil.Amount,
 			return nil, err
 		}
 		if inputAmount < targetAmount+targetFee {
-			fmt.Printf("inputAmount is %v\ntargetAmount is %v\ntargetFee is%v\n",inputAmount,targetAmount,targetFee)
-			return nil, fmt.Errorf("insufficient funds")
+			return nil, types.ErrInsufficientFunds
 		}
 		// We count the types of inputs, which we'll use to estimate
 		// the vsize of the transaction.
@@ -589,6 +604,10 @@ func newUnsignedTransaction(outputs []*wire.TxOut, relayFeePerKb btcutil.Amount,
 
 // 发送交易
 func SendRawTransaction (c *rpcutils.RpcClient, tx *wire.MsgTx, allowHighFees bool) (ret string, err error){
+	return SendRawTransactionContext(context.Background(), c, tx, allowHighFees)
+}
+
+func SendRawTransactionContext (ctx context.Context, c *rpcutils.RpcClient, tx *wire.MsgTx, allowHighFees bool) (ret string, err error){
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
@@ -607,17 +626,19 @@ func SendRawTransaction (c *rpcutils.RpcClient, tx *wire.MsgTx, allowHighFees bo
 	cmd := btcjson.NewSendRawTransactionCmd(txHex, &allowHighFees)
 
 	marshalledJSON, err := btcjson.MarshalCmd(1, cmd)
-	fmt.Printf("%v\n\n", string(marshalledJSON))
         if err != nil {
 		return "", err
 	}
 
-	retJSON, err := c.Send(string(marshalledJSON))
+	retJSON, err := c.SendContext(ctx, string(marshalledJSON))
+	if err != nil {
+		return "", err
+	}
 	var res interface{}
 	json.Unmarshal([]byte(retJSON),&res)
 	txhash := res.(map[string]interface{})["result"]
 	if txhash == nil {
-		return "", fmt.Errorf("retJSON")
+		return "", types.ClassifyError(fmt.Errorf("sendrawtransaction error: %v", res.(map[string]interface{})["error"]))
 	}
 
 	return txhash.(string), err
@@ -625,29 +646,39 @@ func SendRawTransaction (c *rpcutils.RpcClient, tx *wire.MsgTx, allowHighFees bo
 }
 
 func MakeInputSource(outputs []btcjson.ListUnspentResult) txauthor.InputSource {
-	return makeInputSource(outputs)
+	utxos := make([]types.UTXO, 0, len(outputs))
+	for _, output := range outputs {
+		utxo, err := UTXOFromListUnspent(output)
+		if err != nil {
+			return func(btcutil.Amount) (btcutil.Amount, []*wire.TxIn, []btcutil.Amount, [][]byte, error) {
+				return 0, nil, nil, nil, err
+			}
+		}
+		utxos = append(utxos, utxo)
+	}
+	return makeInputSource(utxos)
 }
 
 // makeInputSource creates an InputSource that creates inputs for every unspent
 // output with non-zero output values.  The target amount is ignored since every
-// output is consumed.  The InputSource does not return any previous output
-// scripts as they are not needed for creating the unsinged transaction.
-func makeInputSource(outputs []btcjson.ListUnspentResult) txauthor.InputSource {
+// output is consumed.  The previous output scripts are returned in input order,
+// they are needed for computing the signature hashes.
+func makeInputSource(outputs []types.UTXO) txauthor.InputSource {
 	var (
 		totalInputValue btcutil.Amount
 		inputs          = make([]*wire.TxIn, 0, len(outputs))
 		inputValues     = make([]btcutil.Amount, 0, len(outputs))
+		scripts         = make([][]byte, 0, len(outputs))
 		sourceErr       error
 	)
 	for _, output := range outputs {
-//fmt.Println("output %+v\n", output)
-		outputAmount, err := btcutil.NewAmount(output.Amount)
-		if err != nil {
+		if output.Amount == nil || !output.Amount.IsInt64() {
 			sourceErr = fmt.Errorf(
 				"invalid amount `%v` in listunspent result",
 				output.Amount)
 			break
 		}
+		outputAmount := btcutil.Amount(output.Amount.Int64())
 		if outputAmount == 0 {
 			continue
 		}
@@ -657,7 +688,6 @@ func makeInputSource(outputs []btcjson.ListUnspentResult) txauthor.InputSource {
 				outputAmount)
 			break
 		}
-fmt.Printf("totalInputValue is %v, outputAmount is %v, outputnum is %v\n", totalInputValue, outputAmount, output.Vout)
 		totalInputValue += outputAmount
 
 		previousOutPoint, err := parseOutPoint(&output)
@@ -667,9 +697,17 @@ fmt.Printf("totalInputValue is %v, outputAmount is %v, outputnum is %v\n", total
 				err)
 			break
 		}
+		script, err := hex.DecodeString(output.ScriptPubKey)
+		if err != nil {
+			sourceErr = fmt.Errorf(
+				"invalid script `%v` in listunspent result",
+				output.ScriptPubKey)
+			break
+		}
 
 		inputs = append(inputs, wire.NewTxIn(&previousOutPoint, nil, nil))
 		inputValues = append(inputValues, outputAmount)
+		scripts = append(scripts, script)
 	}
 
 	if sourceErr == nil && totalInputValue == 0 {
@@ -677,12 +715,12 @@ fmt.Printf("totalInputValue is %v, outputAmount is %v, outputnum is %v\n", total
 	}
 
 	return func(btcutil.Amount) (btcutil.Amount, []*wire.TxIn, []btcutil.Amount, [][]byte, error) {
-		return totalInputValue, inputs, inputValues, nil, sourceErr
+		return totalInputValue, inputs, inputValues, scripts, sourceErr
 	}
 }
 
-func parseOutPoint(input *btcjson.ListUnspentResult) (wire.OutPoint, error) {
-        txHash, err := chainhash.NewHashFromStr(input.TxID)
+func parseOutPoint(input *types.UTXO) (wire.OutPoint, error) {
+        txHash, err := chainhash.NewHashFromStr(input.TxHash)
         if err != nil {
                 return wire.OutPoint{}, err
         }
@@ -695,14 +733,16 @@ func saneOutputValue(amount btcutil.Amount) bool {
 
 type AddrApiResult struct {
 	Address string
-	Total_received float64
-	Balance float64
-	Unconfirmed_balance uint64
-	Final_balance float64
+	Total_received int64
+	Balance int64
+	Unconfirmed_balance int64
+	Final_balance int64
 	N_tx int64
 	Unconfirmed_n_tx int64
 	Final_n_tx int64
 	Txrefs []Txref
+	Unconfirmed_txrefs []Txref
+	HasMore bool
 	Tx_url string
 }
 
@@ -715,8 +755,8 @@ type Txref struct {
 	Block_height int64
 	Tx_input_n int32
 	Tx_output_n int32
-	Value float64
-	Ref_balance float64
+	Value int64
+	Ref_balance int64
 	Spent bool
 	Confirmations int64
 	Confirmed string
@@ -772,22 +812,24 @@ func parseTxApiResult (resstr string) *TxApiResult {
 // 使用 addrs 接口查询属于dcrm地址的交易信息，其中包含dcrm地址的utxo
 func listUnspent(dcrmaddr string) ([]btcjson.ListUnspentResult, error) {
 	addrsUrl := "https://api.blockcypher.com/v1/btc/test3/addrs/" + dcrmaddr
-	resstr := loginPre1("GET",addrsUrl)
-	if resstr == "" {
-		return nil, fmt.Errorf("cannont get address's utxo, blockcypher didnt response")
+	resstr, err := explorerGet(context.Background(), addrsUrl)
+	if err != nil {
+		return nil, err
 	}
 
 	addrApiResult := parseAddrApiResult(resstr)
 
 	// addrs 接口查询到的交易信息中不包含上交易输出的锁定脚本
 	// 使用 txs 接口查询交易的详细信息，得到锁定脚本，用于交易签名
-fmt.Println("listUnspent lalala")
 	return makeListUnspentResult(addrApiResult, dcrmaddr)
 }
 
 func getTxByTxHash (txhash string) (*TxApiResult, error) {
 	addrsUrl := "https://api.blockcypher.com/v1/btc/test3/txs/" + txhash
-	resstr := loginPre1("GET",addrsUrl)
+	resstr, err := explorerGet(context.Background(), addrsUrl)
+	if err != nil {
+		return nil, err
+	}
 	return parseTxApiResult(resstr), nil
 }
 
@@ -795,10 +837,6 @@ func makeListUnspentResult (r *AddrApiResult, dcrmaddr string) ([]btcjson.ListUn
 	//cnt := 0
 	//var list []btcjson.ListUnspentResult
 
-fmt.Println("make list unspent result")
-fmt.Println(r.Txrefs)
-fmt.Printf("length is %v\n\n",len(r.Txrefs))
-
 	var list sortableLURSlice
 	for _, txref := range r.Txrefs {
 		// 判断 txref 是否是未花费的交易输出
@@ -809,7 +847,7 @@ fmt.Printf("length is %v\n\n",len(r.Txrefs))
 				Address: dcrmaddr,
 				//ScriptPubKey:
 				//RedeemScript:
-				Amount: txref.Value/1e8,
+				Amount: btcutil.Amount(txref.Value).ToBTC(),
 				Confirmations: txref.Confirmations,
 				Spendable: !txref.Spent,
 			}
@@ -822,9 +860,6 @@ if txRes == nil || len(txRes.Outputs) <= 0 {
 	continue
 }
 
-fmt.Printf("txref.Tx_output_n is %v\n\n", txref.Tx_output_n)
-fmt.Printf("txRes.Outputs is %v\n\n", txRes.Outputs)
-
 			res.ScriptPubKey = txRes.Outputs[txref.Tx_output_n].Script
 			list = append(list, res)
 		}
@@ -847,67 +882,26 @@ func (s sortableLURSlice) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
-//++++++++++++++++++caihaijun+++++++++++++++++++
-func loginPre1(method string, url string) string {
-	c := &http.Client{}
-
-        //reqest, err := http.NewRequest("GET", "https://api.blockcypher.com/v1/btc/test3/addrs/" + dcrmaddr, nil)
-
-	reqest, err := http.NewRequest(method, url, nil)
-
-    if err != nil {
-	    fmt.Println("get Fatal error ", err.Error())
-	    return ""
-    }
-
-    reqest.Header.Add("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-    reqest.Header.Add("Accept-Encoding", "gzip, deflate")
-    reqest.Header.Add("Accept-Language", "zh-cn,zh;q=0.8,en-us;q=0.5,en;q=0.3")
-    reqest.Header.Add("Connection", "keep-alive")
-    reqest.Header.Add("Host", "login.sina.com.cn")
-    reqest.Header.Add("Referer", "http://weibo.com/")
-    reqest.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64; rv:12.0) Gecko/20100101 Firefox/12.0")
-    response, err := c.Do(reqest)
-    if response == nil {
-	    return ""
-    }
-    defer response.Body.Close()
-
-    if err != nil {
-	    fmt.Println("Fatal error ", err.Error())
-	    return ""
-    }
-
-    if response.StatusCode == 200 {
-
-	    var body string
-
-	    switch response.Header.Get("Content-Encoding") {
-	    case "gzip":
-		    reader, _ := gzip.NewReader(response.Body)
-		    for {
-			    buf := make([]byte, 1024)
-			    n, err := reader.Read(buf)
-
-			    if err != nil && err != io.EOF {
-				 panic(err)
-				return ""
-			    }
-
-			    if n == 0 {
-				 break
-			    }
-			    body += string(buf)
-			}
-	    default:
-		    bodyByte, _ := ioutil.ReadAll(response.Body)
-		    body = string(bodyByte)
-	    }
+type sortableUTXOSlice []types.UTXO
 
-	    return body
-    }
+func (s sortableUTXOSlice) Len() int {
+	return len(s)
+}
+
+func (s sortableUTXOSlice) Less(i, j int) bool {
+	return s[i].Amount.Cmp(s[j].Amount) > 0
+}
+
+func (s sortableUTXOSlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
 
-    return ""
+// explorerGet 请求区块浏览器 (blockcypher, blockchain.info) 的 url, 见 rpcutils.Client
+func explorerGet(ctx context.Context, url string) (string, error) {
+	ret, err := rpcutils.Get(ctx, url, "")
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
 }
-//+++++++++++++++++++++end++++++++++++++++++++++
 
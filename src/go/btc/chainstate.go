@@ -0,0 +1,218 @@
+package btc
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"runtime/debug"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+
+	"github.com/btcsuite/btcwallet/wallet/txauthor"
+	"github.com/btcsuite/btcwallet/wallet/txrules"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// FetchChainState 从 electrs 查询 fromAddress 可以花费的 utxo
+func (h *BTCHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	if err := opts.Check("BTC", SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	return h.FetchUTXOs(ctx, "BTC", fromAddress)
+}
+
+// FetchUTXOs 查询 address 可以花费的 utxo, 返回币种为 coinType 的 ChainState, ltc, omni 等用 btcHandler 构造交易的币种共用
+func (h *BTCHandler) FetchUTXOs(ctx context.Context, coinType, address string) (*types.ChainState, error) {
+	utxos, err := h.ListUTXOs(ctx, address)
+	if err != nil {
+		return nil, errContext(err, "failed to fetch unspent outputs")
+	}
+	state := types.NewChainState(coinType, h.network.String())
+	state.UTXOs = utxos
+	return state, nil
+}
+
+// Assemble 从 state 的 utxo 里选择输入, 构造未签名交易, 不访问网络
+func (h *BTCHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.AssembleForCoin("BTC", state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// AssembleForCoin 和 Assemble 相同, state 的币种是 coinType
+func (h *BTCHandler) AssembleForCoin(coinType string, state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	if err = state.Check(coinType, h.network.String()); err != nil {
+		return
+	}
+	if err = opts.Check(coinType, SupportedBuildOptions...); err != nil {
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	// 设置交易输出
+	// 生成锁定脚本
+	var txOuts []*wire.TxOut
+	for i, out := range outputs {
+		toAddr, err1 := btcutil.DecodeAddress(out.ToAddress, h.chainConfig)
+		if err1 != nil {
+			err = types.Errorf(types.ErrInvalidAddress, "output %v: invalid address %v: %v", i, out.ToAddress, err1)
+			return
+		}
+		if !toAddr.IsForNet(h.chainConfig) {
+			err = types.Errorf(types.ErrInvalidAddress, "output %v: address %v is not for %v", i, out.ToAddress, h.network)
+			return
+		}
+		pkscript, err2 := txscript.PayToAddrScript(toAddr)
+		if err2 != nil {
+			err = fmt.Errorf("output %v: %v", i, err2)
+			return
+		}
+		if !out.Amount.IsInt64() {
+			err = fmt.Errorf("output %v: invalid amount %v", i, out.Amount)
+			return
+		}
+		txOuts = append(txOuts, wire.NewTxOut(out.Amount.Int64(), pkscript))
+	}
+	tx, digests, err := h.AssembleTxOuts(state, fromAddress, fromPublicKey, txOuts, opts)
+	if err != nil {
+		return
+	}
+	transaction = tx
+	return
+}
+
+// AssembleTxOuts 从 state 里选择 fromAddress 的 p2pkh utxo 支付 txOuts, 剩余金额找零
+// 调用者负责检查 state 和 opts, omni 用它构造带 OP_RETURN 输出的交易
+func (h *BTCHandler) AssembleTxOuts(state *types.ChainState, fromAddress, fromPublicKey string, txOuts []*wire.TxOut, opts *types.BuildOptions) (transaction *AuthoredTx, digests []string, err error) {
+	changeAddress := fromAddress
+	feeRate := feeRate
+	requiredConfirmations := RequiredConfirmations
+	if opts != nil {
+		if opts.FeeRate != nil {
+			feeRate, err = ParseAmount(opts.FeeRate.String())
+			if err != nil {
+				err = fmt.Errorf("invalid build option feeRate: %v", err)
+				return
+			}
+		}
+		if opts.ChangeAddress != nil {
+			changeAddress = *opts.ChangeAddress
+		}
+		if opts.Confirmations != nil {
+			requiredConfirmations = *opts.Confirmations
+		}
+	}
+	var previousOutputs []types.UTXO
+	for _, utxo := range state.UTXOs {
+		if utxo.Address != fromAddress || utxo.Confirmations < requiredConfirmations {
+			continue
+		}
+		b, _ := hex.DecodeString(utxo.ScriptPubKey)
+		pkScript, err1 := txscript.ParsePkScript(b)
+		if err1 != nil || pkScript.Class() != txscript.PubKeyHashTy {
+			continue
+		}
+		if utxo.Amount == nil || !utxo.Amount.IsInt64() || !saneOutputValue(btcutil.Amount(utxo.Amount.Int64())) {
+			err = fmt.Errorf("invalid amount %v in utxo %v:%v", utxo.Amount, utxo.TxHash, utxo.Vout)
+			return
+		}
+		previousOutputs = append(previousOutputs, utxo)
+	}
+	if len(previousOutputs) < 1 {
+		err = errContext(types.ErrInsufficientFunds, "cannot find p2pkh utxo")
+		return
+	}
+	targetAmount := SumOutputValues(txOuts)
+	estimatedSize := EstimateVirtualSize(0, 1, 0, txOuts, true)
+	targetFee := txrules.FeeForSerializeSize(feeRate, estimatedSize)
+	// 选择utxo作为交易输入
+	var inputSource txauthor.InputSource
+	for i := range previousOutputs {
+		inputSource = makeInputSource(previousOutputs[:i+1])
+		inputAmount, _, _, _, err1 := inputSource(targetAmount + targetFee)
+		if err1 != nil {
+			err = err1
+			return
+		}
+		if inputAmount >= targetAmount+targetFee {
+			break
+		}
+	}
+	// 设置找零
+	changeAddr, err := btcutil.DecodeAddress(changeAddress, h.chainConfig)
+	if err != nil {
+		err = types.Errorf(types.ErrInvalidAddress, "invalid change address %v: %v", changeAddress, err)
+		return
+	}
+	if !changeAddr.IsForNet(h.chainConfig) {
+		err = types.Errorf(types.ErrInvalidAddress, "change address %v is not for %v", changeAddress, h.network)
+		return
+	}
+	changeSource := func()([]byte,error){
+		return txscript.PayToAddrScript(changeAddr)
+	}
+	transaction, err = newUnsignedTransaction(txOuts, feeRate, inputSource, changeSource)
+	if err != nil {
+		return
+	}
+	// 跳过了金额为 0 的 utxo, 输入和 previousOutputs 不一一对应, 用 inputSource 返回的脚本
+	for idx := range transaction.Tx.TxIn {
+		txhashbytes, err1 := txscript.CalcSignatureHash(transaction.PrevScripts[idx], hashType, transaction.Tx, idx)
+		if err1 != nil {
+			err = err1
+			return
+		}
+		digests = append(digests, hex.EncodeToString(txhashbytes))
+	}
+	transaction.Digests = digests
+	pubKey, err := signature.ParsePublicKey(fromPublicKey)
+	if err != nil {
+		return
+	}
+	transaction.PubKeyData = pubKey.SerializeCompressed()
+	return
+}
+
+// UTXOFromListUnspent 把 listunspent 的结果转成 types.UTXO, 金额从 BTC 换算成 satoshi
+// btcjson 的金额是 float64, 只用于兼容 MakeInputSource, 构造交易时 utxo 金额一直是 satoshi
+func UTXOFromListUnspent(u btcjson.ListUnspentResult) (types.UTXO, error) {
+	amount, err := NewAmount(u.Amount)
+	if err != nil {
+		return types.UTXO{}, fmt.Errorf("invalid amount `%v` in listunspent result: %v", u.Amount, err)
+	}
+	return types.UTXO{
+		TxHash: u.TxID,
+		Vout: u.Vout,
+		Address: u.Address,
+		ScriptPubKey: u.ScriptPubKey,
+		Amount: big.NewInt(int64(amount)),
+		Confirmations: u.Confirmations,
+	}, nil
+}
+
+// ListUnspentFromUTXO 是 UTXOFromListUnspent 的逆变换, 用于返回 btcjson 格式的 ListUnspent_electrs
+func ListUnspentFromUTXO(u types.UTXO) (btcjson.ListUnspentResult, error) {
+	if u.Amount == nil || !u.Amount.IsInt64() || !saneOutputValue(btcutil.Amount(u.Amount.Int64())) {
+		return btcjson.ListUnspentResult{}, fmt.Errorf("invalid amount %v in utxo %v:%v", u.Amount, u.TxHash, u.Vout)
+	}
+	return btcjson.ListUnspentResult{
+		TxID: u.TxHash,
+		Vout: u.Vout,
+		Address: u.Address,
+		ScriptPubKey: u.ScriptPubKey,
+		Amount: btcutil.Amount(u.Amount.Int64()).ToBTC(),
+		Confirmations: u.Confirmations,
+		Spendable: true,
+	}, nil
+}
@@ -1,29 +1,62 @@
 package btc
 
 import (
+	"context"
 	"fmt"
 	"encoding/json"
 	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 	"runtime/debug"
+	"math/big"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
 	"github.com/fusion/go-fusion/log"
 	"sort"
 )
 
 func ListUnspent_electrs(addr string) (list []btcjson.ListUnspentResult, err error) {
-	return listUnspent_electrs(addr)
+	return listUnspent_electrs(context.Background(), config.Current().BitcoinGateway.ElectrsAddress, addr)
 }
 
-func listUnspent_electrs(addr string) (list []btcjson.ListUnspentResult, err error) {
+func ListUnspent_electrsContext(ctx context.Context, addr string) (list []btcjson.ListUnspentResult, err error) {
+	return listUnspent_electrs(ctx, config.Current().BitcoinGateway.ElectrsAddress, addr)
+}
+
+// ListUTXOs 从 handler 所在网络的 electrs 查询 utxo, 金额单位是 satoshi, 按金额从大到小排序
+func (h *BTCHandler) ListUTXOs(ctx context.Context, addr string) ([]types.UTXO, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	return listUTXOs_electrs(ctx, h.electrsAddress, addr)
+}
+
+func listUnspent_electrs(ctx context.Context, electrsAddress, addr string) (list []btcjson.ListUnspentResult, err error) {
+	utxos, err := listUTXOs_electrs(ctx, electrsAddress, addr)
+	if err != nil {
+		return
+	}
+	for _, utxo := range utxos {
+		res, err1 := ListUnspentFromUTXO(utxo)
+		if err1 != nil {
+			return nil, err1
+		}
+		list = append(list, res)
+	}
+	return
+}
+
+func listUTXOs_electrs(ctx context.Context, electrsAddress, addr string) (list []types.UTXO, err error) {
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
+	if electrsAddress == "" {
+		err = fmt.Errorf("electrs address is not configured")
+		return
+	}
 	path := `address/` + addr + `/utxo`
-	ret, err := rpcutils.HttpGet(config.ApiGateways.BitcoinGateway.ElectrsAddress, path, nil)
+	ret, err := rpcutils.HttpGetContext(ctx, electrsAddress, path, nil)
 	if err != nil {
 		return
 	}
@@ -32,11 +65,9 @@ func listUnspent_electrs(addr string) (list []btcjson.ListUnspentResult, err err
 	if err != nil {
 		return
 	}
-	fmt.Printf("\n\n%v\n\n", string(ret))
-	fmt.Printf("\n\n%+v\n\n", utxos)
 	for _, utxo := range utxos {
 		path = `tx/` + utxo.Txid
-		txret, txerr := rpcutils.HttpGet(config.ApiGateways.BitcoinGateway.ElectrsAddress, path, nil)
+		txret, txerr := rpcutils.HttpGetContext(ctx, electrsAddress, path, nil)
 		if txerr != nil {
 			log.Debug("======== get utxo script ========", "error", txerr)
 			continue
@@ -48,13 +79,12 @@ log.Debug("======== get utxo script ========", "error", txerr)
 			continue
 		}
 		utxo.Script = tx.Vout[int(utxo.Vout)].Scriptpubkey
-		res := btcjson.ListUnspentResult{
-			TxID: utxo.Txid,
+		res := types.UTXO{
+			TxHash: utxo.Txid,
 			Vout: uint32(utxo.Vout),
 			ScriptPubKey: utxo.Script,
 			Address: addr,
-			Amount: utxo.Value/1e8,
-			Spendable: true,
+			Amount: big.NewInt(utxo.Value),
 		}
 		if utxo.Status.Confirmed {
 			res.Confirmations = 6
@@ -63,7 +93,7 @@ log.Debug("======== get utxo script ========", "error", txerr)
 		}
 		list = append(list, res)
 	}
-	sort.Sort(sortableLURSlice(list))
+	sort.Sort(sortableUTXOSlice(list))
 log.Debug("======== get utxo ========", "utxo list", list)
 	return
 }
@@ -82,7 +112,8 @@ type electrsUtxo struct {
 	Vout uint32
 	Script string
 	Status utxoStatus
-	Value float64
+	// satoshi
+	Value int64
 }
 
 type utxoStatus struct {
@@ -0,0 +1,106 @@
+package btc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwallet/wallet/txrules"
+	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// estimatesmartfee 的确认块数, 依次是 slow, normal, fast
+var FeeTargets = [3]int64{24, 6, 2}
+
+// EstimateFee 用节点的 estimatesmartfee 估计转账手续费, 节点无法估计时三档都是 GetDefaultFee
+func (h *BTCHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	return h.EstimateFeeWithFallback(ctx, fromAddress, toAddress, amount, h.GetDefaultFee())
+}
+
+// EstimateFeeWithFallback 同 EstimateFee, 节点无法估计时返回 fallback
+// 比特币的分叉币通过自己节点的 BTCHandler 调用, fallback 是分叉币的默认手续费
+func (h *BTCHandler) EstimateFeeWithFallback(ctx context.Context, fromAddress, toAddress string, amount *big.Int, fallback *big.Int) (*types.FeeEstimate, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	size := h.estimateTxSize(ctx, fromAddress, toAddress, amount)
+	c, err := rpcutils.NewClient(h.serverHost, h.serverPort, h.rpcuser, h.passwd, h.usessl, h.insecure)
+	if err != nil {
+		return types.FixedFeeEstimate(fallback, true), nil
+	}
+	var quotes [3]types.FeeQuote
+	for i, target := range FeeTargets {
+		rate, err := estimateSmartFee(ctx, c, target)
+		if err != nil {
+			return types.FixedFeeEstimate(fallback, true), nil
+		}
+		fee := txrules.FeeForSerializeSize(rate, size)
+		quotes[i] = types.FeeQuote{Fee: big.NewInt(int64(fee)), FeeRate: big.NewInt(int64(rate))}
+	}
+	return &types.FeeEstimate{Slow: quotes[0], Normal: quotes[1], Fast: quotes[2]}, nil
+}
+
+// 返回 target 个块内确认的费率, 不低于默认的最低转发费率
+func estimateSmartFee(ctx context.Context, c *rpcutils.RpcClient, target int64) (btcutil.Amount, error) {
+	req := fmt.Sprintf(`{"jsonrpc":"1.0","id":1,"method":"estimatesmartfee","params":[%d]}`, target)
+	ret, err := c.SendContext(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		Result *struct {
+			FeeRate json.Number `json:"feerate"`
+			Errors []string `json:"errors"`
+		} `json:"result"`
+		Error interface{} `json:"error"`
+	}
+	if err = json.Unmarshal([]byte(ret), &res); err != nil {
+		return 0, err
+	}
+	if res.Result == nil || res.Result.FeeRate == "" {
+		return 0, fmt.Errorf("estimatesmartfee error: %v %v", res.Error, res.Result)
+	}
+	rate, err := ParseAmount(res.Result.FeeRate.String())
+	if err != nil {
+		return 0, err
+	}
+	if rate < txrules.DefaultRelayFeePerKb {
+		rate = txrules.DefaultRelayFeePerKb
+	}
+	return rate, nil
+}
+
+// 估计转账的大小: 按 utxo 从大到小凑够 amount 需要的 p2pkh 输入, 一个收款输出和一个找零输出
+// 查不到 utxo 时按一个输入计算
+func (h *BTCHandler) estimateTxSize(ctx context.Context, fromAddress, toAddress string, amount *big.Int) int {
+	pkScript := make([]byte, 25)
+	if addr, err := btcutil.DecodeAddress(toAddress, h.chainConfig); err == nil {
+		if script, err := txscript.PayToAddrScript(addr); err == nil {
+			pkScript = script
+		}
+	}
+	txOuts := []*wire.TxOut{wire.NewTxOut(0, pkScript)}
+	inputs := 1
+	if fromAddress != "" && amount != nil {
+		if unspent, err := h.ListUTXOs(ctx, fromAddress); err == nil {
+			// ListUTXOs 按金额从大到小排序
+			total := new(big.Int)
+			n := 0
+			for _, u := range unspent {
+				total.Add(total, u.Amount)
+				n++
+				if total.Cmp(amount) >= 0 {
+					break
+				}
+			}
+			if n > 0 {
+				inputs = n
+			}
+		}
+	}
+	return EstimateVirtualSize(inputs, 0, 0, txOuts, true)
+}
@@ -0,0 +1,229 @@
+package btc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"time"
+
+	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// electrs 每页返回的已确认交易数
+const electrsPageSize = 25
+
+// HasElectrs 返回 handler 是否配置了 electrs
+func (h *BTCHandler) HasElectrs() bool {
+	return h.electrsAddress != ""
+}
+
+// GetAddressHistory 查询地址的转账历史, 优先使用 electrs, 没有配置 electrs 时使用 blockcypher
+// electrs 的页大小固定, 忽略 page.Limit
+func (h *BTCHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if h.electrsAddress != "" {
+		return h.ElectrsHistory(ctx, address, page)
+	}
+	return h.blockcypherHistory(ctx, address, page)
+}
+
+// ElectrsHistory 从 electrs 的 address/<addr>/txs 查询地址的转账历史
+// 第一页包括交易池里的交易, 游标是上一页最后一笔已确认交易的 txid
+// 比特币的分叉币通过自己节点的 BTCHandler 调用
+func (h *BTCHandler) ElectrsHistory(ctx context.Context, address string, page types.PageRequest) (ret *types.HistoryPage, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	if h.electrsAddress == "" {
+		err = types.NotSupportedError(h.chainConfig.Name, "GetAddressHistory without electrs")
+		return
+	}
+	path := `address/` + address + `/txs`
+	if page.Cursor != "" {
+		path += `/chain/` + page.Cursor
+	}
+	b, err := rpcutils.HttpGetContext(ctx, h.electrsAddress, path, nil)
+	if err != nil {
+		return
+	}
+	var txs []electrsAddressTx
+	if err = json.Unmarshal(b, &txs); err != nil {
+		err = types.ClassifyError(fmt.Errorf("electrs error: %v", string(b)))
+		return
+	}
+	ret = &types.HistoryPage{}
+	var confirmed int
+	var last string
+	for _, tx := range txs {
+		if tx.Status.Confirmed {
+			confirmed++
+			last = tx.Txid
+		}
+		if t, ok := tx.transfer(address); ok {
+			ret.Transfers = append(ret.Transfers, t)
+		}
+	}
+	if confirmed >= electrsPageSize {
+		ret.NextCursor = last
+	}
+	return
+}
+
+type electrsAddressTx struct {
+	Txid string
+	Vin []struct {
+		Prevout *electrsPrevout
+	}
+	Vout []electrsPrevout
+	Status struct {
+		Confirmed bool
+		Block_height uint64
+		Block_time int64
+	}
+}
+
+type electrsPrevout struct {
+	Scriptpubkey_address string
+	// satoshi
+	Value int64
+}
+
+// 计算交易对 address 的转账, 地址出现在输入里是转出, 金额是转给其他地址的输出之和
+func (tx *electrsAddressTx) transfer(address string) (t types.Transfer, ok bool) {
+	var spent bool
+	var counterparty string
+	for _, vin := range tx.Vin {
+		if vin.Prevout == nil {
+			continue
+		}
+		if vin.Prevout.Scriptpubkey_address == address {
+			spent = true
+		} else if counterparty == "" {
+			counterparty = vin.Prevout.Scriptpubkey_address
+		}
+	}
+	var received, sent int64
+	var receiver string
+	for _, vout := range tx.Vout {
+		if vout.Scriptpubkey_address == address {
+			received += vout.Value
+		} else {
+			sent += vout.Value
+			if receiver == "" {
+				receiver = vout.Scriptpubkey_address
+			}
+		}
+	}
+	t = types.Transfer{
+		TxHash: tx.Txid,
+		Direction: types.DirectionIn,
+		Counterparty: counterparty,
+		Amount: big.NewInt(received),
+	}
+	if spent {
+		t.Direction = types.DirectionOut
+		t.Counterparty = receiver
+		t.Amount = big.NewInt(sent)
+	} else if received == 0 {
+		return t, false
+	}
+	if tx.Status.Confirmed {
+		t.BlockHeight = tx.Status.Block_height
+		t.Timestamp = tx.Status.Block_time
+	}
+	return t, true
+}
+
+// 从 blockcypher 的 addrs 接口查询, 游标是 before 参数 (区块高度)
+// txrefs 只有地址自己的输入输出, 没有对方地址, 金额是地址余额的变化
+func (h *BTCHandler) blockcypherHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	explorer, ok := h.explorer()
+	if !ok {
+		return nil, types.NotSupportedError("BTC", "GetAddressHistory on " + h.network.String())
+	}
+	addrsUrl := explorer + "/addrs/" + address + "?limit=" + strconv.Itoa(page.PageLimit())
+	if page.Cursor != "" {
+		addrsUrl += "&before=" + page.Cursor
+	}
+	resstr, err := explorerGet(ctx, addrsUrl)
+	if err != nil {
+		return nil, err
+	}
+	res := parseAddrApiResult(resstr)
+	refs := res.Txrefs
+	ret := &types.HistoryPage{}
+	if res.HasMore && len(refs) > 0 {
+		// 最后一个区块的 txrefs 可能不完整, 留到下一页
+		lowest := refs[len(refs)-1].Block_height
+		n := len(refs)
+		for n > 0 && refs[n-1].Block_height == lowest {
+			n--
+		}
+		if n > 0 {
+			refs = refs[:n]
+			ret.NextCursor = strconv.FormatInt(lowest+1, 10)
+		} else {
+			ret.NextCursor = strconv.FormatInt(lowest, 10)
+		}
+	}
+	if page.Cursor == "" {
+		refs = append(res.Unconfirmed_txrefs, refs...)
+	}
+	ret.Transfers = txrefTransfers(refs)
+	return ret, nil
+}
+
+// 按交易合并 txrefs, 输出减去输入为正是转入, 否则是转出
+func txrefTransfers(refs []Txref) (transfers []types.Transfer) {
+	index := make(map[string]int)
+	var net []int64
+	for _, ref := range refs {
+		i, ok := index[ref.Tx_hash]
+		if !ok {
+			i = len(transfers)
+			index[ref.Tx_hash] = i
+			t := types.Transfer{TxHash: ref.Tx_hash}
+			if ref.Block_height > 0 {
+				t.BlockHeight = uint64(ref.Block_height)
+			}
+			if tm, err := time.Parse(time.RFC3339, ref.Confirmed); err == nil {
+				t.Timestamp = tm.Unix()
+			}
+			transfers = append(transfers, t)
+			net = append(net, 0)
+		}
+		if ref.Tx_output_n >= 0 {
+			net[i] += ref.Value
+		} else {
+			net[i] -= ref.Value
+		}
+	}
+	for i := range transfers {
+		if net[i] >= 0 {
+			transfers[i].Direction = types.DirectionIn
+			transfers[i].Amount = big.NewInt(net[i])
+		} else {
+			transfers[i].Direction = types.DirectionOut
+			transfers[i].Amount = big.NewInt(-net[i])
+		}
+	}
+	sort.SliceStable(transfers, func(i, j int) bool {
+		// 没有上链的排在最前面
+		if transfers[i].BlockHeight == 0 || transfers[j].BlockHeight == 0 {
+			return transfers[i].BlockHeight == 0 && transfers[j].BlockHeight != 0
+		}
+		return transfers[i].BlockHeight > transfers[j].BlockHeight
+	})
+	return
+}
@@ -1,12 +1,14 @@
 package btc
 
 import (
+	"context"
 	"encoding/json"
 	//"fmt"
 	"sort"
 	"strings"
 
 	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcutil"
 )
 
 //var addr string = "mtjq9RmBBDVne7YB4AFHYCZFn3P2AXv9D5"
@@ -28,7 +30,10 @@ import (
 }*/
 
 func listUnspent_blockchaininfo(addr string) ([]btcjson.ListUnspentResult, error) {
-	resstr := getUTXO_BlockChainInfo(addr)
+	resstr, err := getUTXO_BlockChainInfo(addr)
+	if err != nil {
+		return nil, err
+	}
 	utxoLsRes, err := parseUnspent(resstr)
 	if err != nil {
 		return nil, err
@@ -42,7 +47,7 @@ func listUnspent_blockchaininfo(addr string) ([]btcjson.ListUnspentResult, error
 			Address: addr,
 			ScriptPubKey: utxo.Script,
 			//RedeemScript:
-			Amount: utxo.Value/1e8,
+			Amount: btcutil.Amount(utxo.Value).ToBTC(),
 			Confirmations: utxo.Confirmations,
 			Spendable: true,
 		}
@@ -77,13 +82,12 @@ type UtxoRes struct {
 	Tx_hash_big_endian	string
 	Script			string
 	Tx_output_n		uint32
-	Value			float64
+	Value			int64
 	Confirmations		int64
 }
 
-func getUTXO_BlockChainInfo (addr string) string {
+func getUTXO_BlockChainInfo (addr string) (string, error) {
 	addrReceivedUrl := "https://testnet.blockchain.info/unspent?active=" + addr
-	blockchaininfores := loginPre1("GET",addrReceivedUrl)
-	return blockchaininfores
+	return explorerGet(context.Background(), addrReceivedUrl)
 }
 
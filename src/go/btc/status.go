@@ -0,0 +1,86 @@
+package btc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 比特币交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 6
+
+// GetTransactionStatus 用节点的 getrawtransaction 查询交易的确认数
+func (h *BTCHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	return h.TransactionStatus(ctx, txhash, FinalityConfirmations)
+}
+
+// TransactionStatus 同 GetTransactionStatus, threshold 是最终确认数
+// 比特币的分叉币通过自己节点的 BTCHandler 调用
+func (h *BTCHandler) TransactionStatus(ctx context.Context, txhash string, threshold uint64) (status *types.TxStatus, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	c, err := rpcutils.NewClient(h.serverHost, h.serverPort, h.rpcuser, h.passwd, h.usessl, h.insecure)
+	if err != nil {
+		return
+	}
+	req := `{"jsonrpc":"1.0","method":"getrawtransaction","params":["` + txhash + `",true],"id":1}`
+	ret, err := c.SendContext(ctx, req)
+	if errors.Is(err, types.ErrNotFound) {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	if err != nil {
+		return
+	}
+	var tx struct {
+		Result *struct {
+			Blockhash string `json:"blockhash"`
+			Confirmations uint64 `json:"confirmations"`
+		} `json:"result"`
+	}
+	if err = json.Unmarshal([]byte(ret), &tx); err != nil {
+		return
+	}
+	if tx.Result == nil {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	if tx.Result.Blockhash == "" || tx.Result.Confirmations == 0 {
+		return types.MempoolTxStatus(txhash, threshold), nil
+	}
+	height, err := blockHeight(ctx, c, tx.Result.Blockhash)
+	if err != nil {
+		return
+	}
+	return types.IncludedTxStatus(txhash, height, tx.Result.Blockhash, tx.Result.Confirmations, threshold), nil
+}
+
+// 返回区块 blockhash 的高度
+func blockHeight(ctx context.Context, c *rpcutils.RpcClient, blockhash string) (uint64, error) {
+	req := `{"jsonrpc":"1.0","method":"getblockheader","params":["` + blockhash + `"],"id":1}`
+	ret, err := c.SendContext(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	var header struct {
+		Result *struct {
+			Height uint64 `json:"height"`
+		} `json:"result"`
+	}
+	if err = json.Unmarshal([]byte(ret), &header); err != nil {
+		return 0, err
+	}
+	if header.Result == nil {
+		return 0, types.Errorf(types.ErrNotFound, "block %v: %v", blockhash, ret)
+	}
+	return header.Result.Height, nil
+}
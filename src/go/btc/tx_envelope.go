@@ -0,0 +1,124 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// AuthoredTx 在信封里的 payload, wire.MsgTx 用比特币的序列化格式, 转成 hex
+type authoredTxJson struct {
+	Tx              string   `json:"tx"`
+	PrevScripts     []string `json:"prevScripts"`
+	PrevInputValues []int64  `json:"prevInputValues"`
+	TotalInput      int64    `json:"totalInput"`
+	ChangeIndex     int      `json:"changeIndex"`
+	PubKeyData      string   `json:"pubKeyData"`
+}
+
+// 编码 AuthoredTx, ltc, dash, zcash 等用 btcHandler 构造交易的币种共用
+func MarshalAuthoredTx(tx *AuthoredTx) ([]byte, error) {
+	if tx == nil || tx.Tx == nil {
+		return nil, fmt.Errorf("nil authored transaction")
+	}
+	var buf bytes.Buffer
+	if err := tx.Tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	txjson := authoredTxJson{
+		Tx:          hex.EncodeToString(buf.Bytes()),
+		TotalInput:  int64(tx.TotalInput),
+		ChangeIndex: tx.ChangeIndex,
+		PubKeyData:  hex.EncodeToString(tx.PubKeyData),
+	}
+	for _, script := range tx.PrevScripts {
+		txjson.PrevScripts = append(txjson.PrevScripts, hex.EncodeToString(script))
+	}
+	for _, value := range tx.PrevInputValues {
+		txjson.PrevInputValues = append(txjson.PrevInputValues, int64(value))
+	}
+	return json.Marshal(txjson)
+}
+
+func UnmarshalAuthoredTx(payload []byte, digests []string) (*AuthoredTx, error) {
+	var txjson authoredTxJson
+	if err := json.Unmarshal(payload, &txjson); err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(txjson.Tx)
+	if err != nil {
+		return nil, err
+	}
+	msgtx := wire.NewMsgTx(wire.TxVersion)
+	if err := msgtx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	if len(digests) != len(msgtx.TxIn) {
+		return nil, fmt.Errorf("digests number does not match transaction inputs number")
+	}
+	if len(txjson.PrevScripts) != len(msgtx.TxIn) {
+		return nil, fmt.Errorf("previous scripts number does not match transaction inputs number")
+	}
+	pubKeyData, err := hex.DecodeString(txjson.PubKeyData)
+	if err != nil {
+		return nil, err
+	}
+	tx := &AuthoredTx{
+		Tx:          msgtx,
+		TotalInput:  btcutil.Amount(txjson.TotalInput),
+		ChangeIndex: txjson.ChangeIndex,
+		Digests:     digests,
+		PubKeyData:  pubKeyData,
+	}
+	for _, s := range txjson.PrevScripts {
+		script, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		tx.PrevScripts = append(tx.PrevScripts, script)
+	}
+	for _, value := range txjson.PrevInputValues {
+		tx.PrevInputValues = append(tx.PrevInputValues, btcutil.Amount(value))
+	}
+	return tx, nil
+}
+
+// 把 *AuthoredTx 装进信封
+func MarshalEnvelope(coinType, network string, transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	tx, ok := transaction.(*AuthoredTx)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	payload, err := MarshalAuthoredTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxEnvelope(coinType, network, digests, payload), nil
+}
+
+// 从信封里取出 *AuthoredTx
+func UnmarshalEnvelope(coinType, network string, env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check(coinType, network); err != nil {
+		return
+	}
+	tx, err := UnmarshalAuthoredTx(env.Payload, env.Digests)
+	if err != nil {
+		return
+	}
+	transaction = tx
+	return
+}
+
+func (h *BTCHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return MarshalEnvelope("BTC", h.network.String(), transaction, digests)
+}
+
+func (h *BTCHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return UnmarshalEnvelope("BTC", h.network.String(), env)
+}
@@ -3,32 +3,78 @@ package config
 
 import (
 	"github.com/BurntSushi/toml"
-	"log"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"sync"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/secrets"
 )
 
 type SimpleApiConfig struct {
 	ApiAddress string
+	// 可选, 不设置时使用网络默认的 chain id 或向节点查询
+	// ETH, ETC 是十进制的 chain id, VEN 是十进制的 chain tag, BNB 和 ATOM 是 chain-id 字符串
+	ChainID string
+	// 可选, 备用节点, 主节点不可用或落后时切换, 见 rpcutils.Transport
+	Backups []ApiEndpoint
+}
+
+// ApiEndpoint 是 api 网关的备用节点
+type ApiEndpoint struct {
+	ApiAddress string
+	// 优先级, 越小越优先, 主节点是 0, 相同时主节点优先, 然后按配置的顺序
+	Priority int
 }
 
 type RpcClientConfig struct {
+	ElectrsAddress string
+	// 可选, blockcypher 兼容的 api, 如 https://api.blockcypher.com/v1/ltc/main, 用于查询余额和历史
+	// 为空时使用 blockcypher 上网络对应的比特币链
+	ExplorerAddress string
+	Host string
+	Port int
+	User string
+	Passwd string
+	Usessl bool
+	// 节点使用自签名证书时设为 true, 不检查节点的证书, 默认检查
+	InsecureSkipVerify bool
+	// 可选, 备用节点, 见 SimpleApiConfig.Backups
+	Backups []RpcEndpoint
+}
+
+// RpcEndpoint 是 rpc 网关的备用节点, ElectrsAddress 为空时 electrs 没有备用节点
+type RpcEndpoint struct {
 	ElectrsAddress string
 	Host string
 	Port int
 	User string
 	Passwd string
 	Usessl bool
+	InsecureSkipVerify bool
+	Priority int
 }
 
 type EosConfig struct {
 	Nodeos string
 	ChainID string
 	BalanceTracker string
+	// 可选, 备用的 nodeos 节点
+	Backups []ApiEndpoint
 }
 
 type ApiGatewayConfigs struct {
+	// 每个网关请求的超时, 秒, 为 0 时使用 DefaultTimeout
 	RPCCLIENT_TIMEOUT int
+	// 有备用节点的网关检查节点健康的间隔, 秒, 为 0 时使用 DefaultHealthCheckInterval
+	HEALTH_CHECK_INTERVAL int
 	CosmosGateway *SimpleApiConfig
 	TronGateway *SimpleApiConfig
 	BitcoinGateway *RpcClientConfig
@@ -38,33 +84,390 @@ type ApiGatewayConfigs struct {
 	EosGateway *EosConfig
 	RippleGateway *SimpleApiConfig
 	EVTGateway *SimpleApiConfig
+	BinanceGateway *SimpleApiConfig
+	VechainGateway *SimpleApiConfig
+	EthereumClassicGateway *SimpleApiConfig
+	LitecoinGateway *RpcClientConfig
+	DashGateway *RpcClientConfig
+	ZcashGateway *RpcClientConfig
+	BitgoldGateway *RpcClientConfig
+	DecredGateway *RpcClientConfig
+
+	// 按网络覆盖上面的网关, 例如 [Networks.mainnet.BitcoinGateway]
+	// 没有覆盖的网关使用上面的配置
+	Networks map[string]*ApiGatewayConfigs
 }
 
-var ApiGateways *ApiGatewayConfigs
+// ForNetwork 返回 network 的网关配置, Networks[network] 里设置的网关覆盖默认配置
+func (c *ApiGatewayConfigs) ForNetwork(network string) *ApiGatewayConfigs {
+	if c == nil {
+		return nil
+	}
+	ret := *c
+	ret.Networks = nil
+	overlay := c.Networks[network]
+	if overlay == nil {
+		return &ret
+	}
+	dst := reflect.ValueOf(&ret).Elem()
+	src := reflect.ValueOf(overlay).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		f := src.Field(i)
+		switch f.Kind() {
+		case reflect.Ptr:
+			if !f.IsNil() {
+				dst.Field(i).Set(f)
+			}
+		case reflect.Int:
+			if f.Int() != 0 {
+				dst.Field(i).Set(f)
+			}
+		}
+	}
+	return &ret
+}
 
-func init () {
-	log.Print("Loading gateway configs...")
-	err := LoadApiGateways("")
-	if err != nil {
-		log.Fatal(err)
+// RPCCLIENT_TIMEOUT 没有设置时的网关请求超时, 秒
+const DefaultTimeout = 30
+
+// Timeout 返回网关请求的超时
+func (c *ApiGatewayConfigs) Timeout() time.Duration {
+	if c == nil || c.RPCCLIENT_TIMEOUT <= 0 {
+		return DefaultTimeout * time.Second
 	}
-	fmt.Printf("\n================\n%+v\n================\n\n", ApiGateways)
+	return time.Duration(c.RPCCLIENT_TIMEOUT) * time.Second
 }
 
-func LoadApiGateways (configfile string) error {
-	if ApiGateways == nil {
-		ApiGateways = new(ApiGatewayConfigs)
+// HEALTH_CHECK_INTERVAL 没有设置时检查节点健康的间隔, 秒
+const DefaultHealthCheckInterval = 30
+
+// HealthCheckInterval 返回检查节点健康的间隔
+func (c *ApiGatewayConfigs) HealthCheckInterval() time.Duration {
+	if c == nil || c.HEALTH_CHECK_INTERVAL <= 0 {
+		return DefaultHealthCheckInterval * time.Second
+	}
+	return time.Duration(c.HEALTH_CHECK_INTERVAL) * time.Second
+}
+
+// Validate 检查每个币种的网关都已配置, 地址, 端口, chain id 和超时的格式正确
+// Networks 下的配置节只检查设置了的网关, 返回的错误列出所有有问题的配置节
+func (c *ApiGatewayConfigs) Validate() error {
+	if c == nil {
+		return fmt.Errorf("invalid gateway config: no config loaded")
+	}
+	problems := c.validateSections("", true)
+	for _, network := range c.networkNames() {
+		overlay := c.Networks[network]
+		if len(overlay.Networks) > 0 {
+			problems = append(problems, fmt.Sprintf("[Networks.%v] cannot contain Networks", network))
+		}
+		problems = append(problems, overlay.validateSections("Networks." + network + ".", false)...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid gateway config:\n\t%v", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// ResolveSecrets 把网关配置里的 secret 引用 (env:, file:, keystore:, secret:) 替换成它们的值, 见 package secrets
+// Load 在检查配置之前调用它, 返回的错误列出所有不能解析的字段, 不包含 secret 的值
+func (c *ApiGatewayConfigs) ResolveSecrets() error {
+	problems := c.resolveSections("")
+	for _, network := range c.networkNames() {
+		problems = append(problems, c.Networks[network].resolveSections("Networks." + network + ".")...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid gateway config:\n\t%v", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+func (c *ApiGatewayConfigs) resolveSections(prefix string) (problems []string) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.Ptr || f.IsNil() {
+			continue
+		}
+		problems = append(problems, resolveFields(f.Elem(), prefix + t.Field(i).Name, "")...)
+	}
+	return
+}
+
+// resolveFields 解析配置节里的 secret 引用, 包括 Backups 里的字段
+func resolveFields(section reflect.Value, name, path string) (problems []string) {
+	for j := 0; j < section.NumField(); j++ {
+		field := section.Field(j)
+		fieldName := path + section.Type().Field(j).Name
+		switch field.Kind() {
+		case reflect.String:
+			if !secrets.IsRef(field.String()) {
+				continue
+			}
+			value, err := secrets.Resolve(field.String())
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("[%v] %v: %v", name, fieldName, err))
+				continue
+			}
+			field.SetString(value)
+		case reflect.Slice:
+			for k := 0; k < field.Len(); k++ {
+				if field.Index(k).Kind() == reflect.Struct {
+					problems = append(problems, resolveFields(field.Index(k), name, fmt.Sprintf("%v[%v].", fieldName, k))...)
+				}
+			}
+		}
+	}
+	return
+}
+
+// networkNames 返回设置了的 Networks 配置节, 按名字排序
+func (c *ApiGatewayConfigs) networkNames() []string {
+	names := make([]string, 0, len(c.Networks))
+	for network, overlay := range c.Networks {
+		if overlay != nil {
+			names = append(names, network)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 有格式要求的 chain id
+var chainIDFormats = map[string]func(string) error{
+	"EthereumGateway": decimalChainID,
+	"EthereumClassicGateway": decimalChainID,
+	"VechainGateway": func(s string) error {
+		if _, err := strconv.ParseUint(s, 10, 8); err != nil {
+			return fmt.Errorf("ChainID %q is not a chain tag (0-255)", s)
+		}
+		return nil
+	},
+}
+
+func decimalChainID(s string) error {
+	if n, err := strconv.ParseUint(s, 10, 64); err != nil || n == 0 {
+		return fmt.Errorf("ChainID %q is not a positive decimal chain id", s)
 	}
+	return nil
+}
 
-	if exists, _ := PathExists(configfile); exists {
-		fmt.Printf("use config file: %s\n", configfile)
-		_, err := toml.DecodeFile(configfile, ApiGateways)
+func (c *ApiGatewayConfigs) validateSections(prefix string, required bool) (problems []string) {
+	if c.RPCCLIENT_TIMEOUT < 0 {
+		problems = append(problems, fmt.Sprintf("%vRPCCLIENT_TIMEOUT must not be negative", prefix))
+	}
+	if c.HEALTH_CHECK_INTERVAL < 0 {
+		problems = append(problems, fmt.Sprintf("%vHEALTH_CHECK_INTERVAL must not be negative", prefix))
+	}
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.Ptr {
+			continue
+		}
+		name := t.Field(i).Name
+		if f.IsNil() {
+			if required {
+				problems = append(problems, fmt.Sprintf("[%v%v] is missing", prefix, name))
+			}
+			continue
+		}
+		var err error
+		switch s := f.Interface().(type) {
+		case *SimpleApiConfig:
+			err = s.validate(chainIDFormats[name])
+		case *RpcClientConfig:
+			err = s.validate()
+		case *EosConfig:
+			err = s.validate()
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("[%v%v] %v", prefix, name, err))
+		}
+	}
+	return
+}
+
+func (s *SimpleApiConfig) validate(chainID func(string) error) error {
+	if err := checkAddress("ApiAddress", s.ApiAddress, true); err != nil {
 		return err
-	} else {
-		_, err := toml.Decode(defaultConfig, ApiGateways)
+	}
+	if s.ChainID != "" && chainID != nil {
+		if err := chainID(s.ChainID); err != nil {
+			return err
+		}
+	}
+	return validateBackups(s.Backups)
+}
+
+func validateBackups(backups []ApiEndpoint) error {
+	for k, b := range backups {
+		if err := checkAddress(fmt.Sprintf("Backups[%v].ApiAddress", k), b.ApiAddress, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RpcClientConfig) validate() error {
+	if s.Host == "" {
+		return fmt.Errorf("Host is empty")
+	}
+	if s.Port <= 0 || s.Port > 65535 {
+		return fmt.Errorf("Port %v is out of range", s.Port)
+	}
+	if err := checkAddress("ElectrsAddress", s.ElectrsAddress, false); err != nil {
+		return err
+	}
+	for k, b := range s.Backups {
+		if b.Host == "" {
+			return fmt.Errorf("Backups[%v].Host is empty", k)
+		}
+		if b.Port <= 0 || b.Port > 65535 {
+			return fmt.Errorf("Backups[%v].Port %v is out of range", k, b.Port)
+		}
+		if err := checkAddress(fmt.Sprintf("Backups[%v].ElectrsAddress", k), b.ElectrsAddress, false); err != nil {
+			return err
+		}
+	}
+	return checkAddress("ExplorerAddress", s.ExplorerAddress, false)
+}
+
+func (s *EosConfig) validate() error {
+	if err := checkAddress("Nodeos", s.Nodeos, true); err != nil {
+		return err
+	}
+	if b, err := hex.DecodeString(s.ChainID); err != nil || len(b) != 32 {
+		return fmt.Errorf("ChainID %q is not a 32-byte hex chain id", s.ChainID)
+	}
+	if err := validateBackups(s.Backups); err != nil {
 		return err
 	}
+	return checkAddress("BalanceTracker", s.BalanceTracker, false)
+}
+
+// checkAddress 接受 http(s)/ws(s) 的 url, 或者不带 scheme 的 host:port (binance sdk 使用)
+func checkAddress(field, address string, required bool) error {
+	if address == "" {
+		if required {
+			return fmt.Errorf("%v is empty", field)
+		}
+		return nil
+	}
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		switch u.Scheme {
+		case "http", "https", "ws", "wss":
+			return nil
+		}
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil && host != "" {
+		if p, err := strconv.Atoi(port); err == nil && p > 0 && p <= 65535 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%v %q is not a url or host:port", field, address)
+}
+
+// 进程默认的网关配置, 见 Current 和 Set
+var (
+	currentLock sync.RWMutex
+	current *ApiGatewayConfigs
+)
+
+// Current 返回进程默认的网关配置, 还没有 Set 时返回内置的默认配置
+// 没有显式传入配置的 handler 构造函数 (NewXXXHandlerForNetwork) 和包级函数使用它
+// handler 在创建时读取配置, 之后的 Set 只影响新创建的 handler
+func Current() *ApiGatewayConfigs {
+	currentLock.RLock()
+	c := current
+	currentLock.RUnlock()
+	if c != nil {
+		return c
+	}
+	currentLock.Lock()
+	defer currentLock.Unlock()
+	if current == nil {
+		current = Default()
+	}
+	return current
+}
+
+// Set 替换进程默认的网关配置, 例如收到 SIGHUP 后重新加载配置文件
+func Set(c *ApiGatewayConfigs) {
+	currentLock.Lock()
+	current = c
+	currentLock.Unlock()
+}
 
+// Default 返回内置的默认配置, 每次返回新的副本
+func Default() *ApiGatewayConfigs {
+	c := new(ApiGatewayConfigs)
+	if _, err := toml.Decode(defaultConfig, c); err != nil {
+		panic(fmt.Sprintf("built-in gateway config: %v", err))
+	}
+	return c
+}
+
+// Load 读取配置文件, 文件里没有的配置节整节使用内置的默认配置, 解析 secret 引用并检查配置
+// 文件里有的配置节不和默认配置合并, 没有写的字段就是空的, 由 Validate 检查
+// 每次 Load 都重新读取引用的 secret, 重新加载配置文件可以换用新的密码
+// configfile 为空时返回内置的默认配置, 不修改进程默认的配置
+func Load(configfile string) (*ApiGatewayConfigs, error) {
+	if configfile == "" {
+		c := Default()
+		return c, c.Validate()
+	}
+	c := new(ApiGatewayConfigs)
+	md, err := toml.DecodeFile(configfile, c)
+	if err != nil {
+		return nil, err
+	}
+	// 拼错的配置节和字段不会报错, 只会被忽略
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return nil, fmt.Errorf("invalid gateway config: unknown keys %v", strings.Join(keys, ", "))
+	}
+	c.fillDefaults(Default())
+	if err := c.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// fillDefaults 把 c 里没有设置的配置节和超时设置成 d 里的, 已经设置的配置节整节保留, Networks 不变
+func (c *ApiGatewayConfigs) fillDefaults(d *ApiGatewayConfigs) {
+	dst := reflect.ValueOf(c).Elem()
+	src := reflect.ValueOf(d).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		f := dst.Field(i)
+		switch f.Kind() {
+		case reflect.Ptr:
+			if f.IsNil() {
+				f.Set(src.Field(i))
+			}
+		case reflect.Int:
+			if f.Int() == 0 {
+				f.Set(src.Field(i))
+			}
+		}
+	}
+}
+
+// LoadApiGateways 用 Load 读取配置文件, 成功时替换进程默认的配置, 失败时保留原来的配置
+func LoadApiGateways (configfile string) error {
+	c, err := Load(configfile)
+	if err != nil {
+		return err
+	}
+	Set(c)
 	return nil
 }
 
@@ -82,7 +485,14 @@ func PathExists(path string) (bool, error) {
 
 
 
+// 内置配置不包含节点的用户名和密码, 需要认证的节点在配置文件里用 secret 引用设置, 见 ResolveSecrets
 var defaultConfig string = `
+# 网关请求超时, 秒
+RPCCLIENT_TIMEOUT = 30
+# 有备用节点的网关检查节点健康的间隔, 秒
+HEALTH_CHECK_INTERVAL = 30
+
+
 # cosmos gaiad cosmoshub-2
 [CosmosGateway]
 ApiAddress = "https://stargate.cosmos.network"
@@ -98,8 +508,6 @@ ApiAddress = "https://api.shasta.trongrid.io"
 ElectrsAddress = "http://5.189.139.168:4000"
 Host = "5.189.139.168"
 Port = 8000
-User = "xxmm"
-Passwd = "123456"
 Usessl = false
 
 
@@ -107,8 +515,6 @@ Usessl = false
 [OmniGateway]
 Host = "5.189.139.168"
 Port = 9772
-User = "xxmm"
-Passwd = "123456"
 Usessl = false
 
 
@@ -116,8 +522,6 @@ Usessl = false
 [BitcoincashGateway]
 Host = "5.189.139.168"
 Port = 9552
-User = "xxmm"
-Passwd = "123456"
 Usessl = false
 
 
@@ -141,144 +545,58 @@ ApiAddress = "https://s.altnet.rippletest.net:51234"
 # evt testnet api
 [EVTGateway]
 ApiAddress = "https://testnet1.everitoken.io"
-`
 
 
+# binance chain testnet api, 不带 scheme 的 host:port
+[BinanceGateway]
+ApiAddress = "testnet-dex.binance.org:443"
 
 
+[VechainGateway]
+ApiAddress = "http://127.0.0.1:50505"
 
 
+[EthereumClassicGateway]
+ApiAddress = "http://127.0.0.1:50505"
 
 
+[LitecoinGateway]
+Host = "127.0.0.1"
+Port = 50505
+Usessl = false
 
 
+[DashGateway]
+Host = "127.0.0.1"
+Port = 50505
+Usessl = false
 
-// ===================== OLD CONFIGS =========================
-/*
-// eth rinkeby testnet
-const (
-	ETH_GATEWAY = "http://54.183.185.30:8018"
-)
-
-// eos kylincrypto testnet
-const (
-	//eos api nodes support get actions (filter-on=*)
-	EOS_NODEOS = "https://api.kylin.alohaeos.com"
-	EOS_CHAIN_ID = "5fff1dae8dc8e2fc4d5b23b2c7665c97f9e9d8edf2b6485a86ba311c25639191"  // cryptokylin test net
-	BALANCE_SERVER = "http://127.0.0.1:7000/"
-)
-
-// ripple testnet
-const (
-	XRP_GATEWAY = "https://s.altnet.rippletest.net:51234"
-)
-
-// cosmos atom cosmoshub-2
-var CosmosHost = "https://stargate.cosmos.network"
-
-// tron testnet
-const (
-	TRON_SOLIDITY_NODE_HTTP = "https://api.shasta.trongrid.io"
-)
-
-// bitcoin testnet
-const (
-	ELECTRSHOST            = "http://5.189.139.168:4000"
-	BTC_SERVER_HOST        = "47.107.50.83"
-	BTC_SERVER_PORT        = 8000
-	BTC_USER               = "xxmm"
-	BTC_PASSWD             = "123456"
-	BTC_USESSL             = false
-)
-
-const (
-	OMNI_SERVER_HOST        = "5.189.139.168"
-	OMNI_SERVER_PORT        = 9772
-	OMNI_USER               = "xxmm"
-	OMNI_PASSWD             = "123456"
-	OMNI_USESSL             = false
-)
-
-// bitcoin cash
-const (
-	BCH_SERVER_HOST        = "5.189.139.168"
-	BCH_SERVER_PORT        = 9552
-	BCH_USER               = "xxmm"
-	BCH_PASSWD             = "123456"
-	BCH_USESSL             = false
-)
-*/
-
-
-
-
-// ===================== EVEN OLDER CONFIGS =========================
-
-const RPCCLIENT_TIMEOUT = 30
-
-// vechain
-const (
-	VECHAIN_GATEWAY = "http://127.0.0.1:50505"
-)
 
-// etc
-const (
-	ETC_GATEWAY = "http://127.0.0.1:50505"
-)
+[ZcashGateway]
+Host = "127.0.0.1"
+Port = 50505
+Usessl = false
 
-// decred
-const (
-	DCR_SERVER_HOST        = "127.0.0.1"
-	DCR_SERVER_PORT        = 50505
-	DCR_USER               = "xxmm"
-	DCR_PASSWD             = "123456"
-	DCR_USESSL             = false
-)
 
-// tether
-//./omnicored -conf=~/.bitcoin/bitcoin.conf -datadir=/data/usdtdata_test
-//moneyqMan7uh8FqdCA2BV5yZ8qVrc9ikLP
-const (
-	TETHER_SERVER_HOST        = "127.0.0.1"
-	TETHER_SERVER_PORT        = 50505
-	TETHER_USER               = "xxmm"
-	TETHER_PASSWD             = "123456"
-	TETHER_USESSL             = false
-)
-
-// litecoin
-const (
-	LTC_SERVER_HOST        = "127.0.0.1"
-	LTC_SERVER_PORT        = 50505
-	LTC_USER               = "xxmm"
-	LTC_PASSWD             = "123456"
-	LTC_USESSL             = false
-)
+[BitgoldGateway]
+Host = "127.0.0.1"
+Port = 50505
+Usessl = false
 
-// bitgold
-const (
-	BITGOLD_SERVER_HOST        = "127.0.0.1"
-	BITGOLD_SERVER_PORT        = 50505
-	BITGOLD_USER               = "xxmm"
-	BITGOLD_PASSWD             = "123456"
-	BITGOLD_USESSL             = false
-)
 
-// dash
-const (
-	DASH_SERVER_HOST        = "127.0.0.1"
-	DASH_SERVER_PORT        = 50505
-	DASH_USER               = "xxmm"
-	DASH_PASSWD             = "123456"
-	DASH_USESSL             = false
-)
+[DecredGateway]
+Host = "127.0.0.1"
+Port = 50505
+Usessl = false
 
-// zcash
-const (
-	ZCASH_SERVER_HOST        = "127.0.0.1"
-	ZCASH_SERVER_PORT        = 50505
-	ZCASH_USER               = "xxmm"
-	ZCASH_PASSWD             = "123456"
-	ZCASH_USESSL             = false
-)
 
+# 按网络覆盖网关, 例如 mainnet 的 bitcoind
+# ChainID 只应该在按网络的配置节里设置, 例如 [Networks.testnet.EthereumClassicGateway]
+#[Networks.mainnet.BitcoinGateway]
+#ElectrsAddress = "http://127.0.0.1:4000"
+#Host = "127.0.0.1"
+#Port = 8332
+#User = "secret:BITCOIN_MAINNET_RPC_USER"
+#Passwd = "secret:BITCOIN_MAINNET_RPC_PASSWD"
+#Usessl = false
+`
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func load(t *testing.T, content string) (*ApiGatewayConfigs, error) {
+	path := filepath.Join(t.TempDir(), "gateways.toml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoadPartialSection(t *testing.T) {
+	c, err := load(t, "[BitcoinGateway]\nHost = \"10.0.0.1\"\nPort = 8332\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 文件里的配置节不和默认配置合并
+	if g := c.BitcoinGateway; g.Host != "10.0.0.1" || g.Port != 8332 || g.ElectrsAddress != "" || g.ExplorerAddress != "" {
+		t.Fatalf("got %+v, want only the fields in the file", *g)
+	}
+	// 没有写的配置节使用默认配置
+	d := Default()
+	if c.EthereumGateway == nil || c.EthereumGateway.ApiAddress != d.EthereumGateway.ApiAddress {
+		t.Fatalf("got %+v, want the default EthereumGateway", c.EthereumGateway)
+	}
+	if c.Timeout() != d.Timeout() {
+		t.Fatalf("got timeout %v, want the default", c.Timeout())
+	}
+}
+
+func TestLoadMissingField(t *testing.T) {
+	_, err := load(t, "[BitcoinGateway]\nPort = 8332\n")
+	if err == nil || !strings.Contains(err.Error(), "[BitcoinGateway] Host is empty") {
+		t.Fatalf("got %v, want the missing Host to be reported", err)
+	}
+	_, err = load(t, "[EthereumGateway]\nChainID = \"1\"\n")
+	if err == nil || !strings.Contains(err.Error(), "[EthereumGateway] ApiAddress is empty") {
+		t.Fatalf("got %v, want the missing ApiAddress to be reported", err)
+	}
+	if _, err := load(t, "[BitcoinGateway]\nHots = \"10.0.0.1\"\n"); err == nil {
+		t.Fatal("unknown key should fail")
+	}
+}
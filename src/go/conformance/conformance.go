@@ -0,0 +1,424 @@
+// Package conformance 是所有 CryptocoinHandler 都应该通过的检查
+// 新的 handler 在自己的测试里填一个 Case 调用 Run, 不需要重写 构造→签名→提交→查询 的测试
+package conformance
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	cryptocoins "github.com/gaozhengxin/cryptocoins/src/go"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// Vector 是已知的 公钥→地址
+type Vector struct {
+	PublicKey string
+	Address string
+}
+
+// Backend 是 handler 的网关指向的假节点, 见 fakenode 包
+type Backend interface {
+	// Fund 给 address 足够支付 Case.Amount 和手续费的余额
+	Fund(address string) error
+	// Mine 把已经提交的交易打包进区块
+	Mine()
+}
+
+// Balancer 由能查询余额的 Backend 实现, handler 查到的余额应该和节点上的一致
+type Balancer interface {
+	Balance(address string) *big.Int
+}
+
+// Case 是一个 handler 和检查它需要的参数
+type Case struct {
+	Handler cryptocoins.CryptocoinHandler
+	// 为空时跳过地址检查
+	Vectors []Vector
+
+	// 付款方的公钥, 付款地址由 Handler.PublicKeyToAddress 得到
+	PublicKey string
+	// 签名用的私钥, 类型和 Handler.SignTransaction 要求的一致
+	Key interface{}
+	// 另一个私钥, 它的签名应该被 MakeSignedTransaction 拒绝, 为 nil 时跳过
+	OtherKey interface{}
+	To string
+	Amount *big.Int
+	JSONString string
+
+	// Inputs 返回交易的输入个数, 每个输入一个 digest, 为 nil 时认为只有一个输入
+	Inputs func(transaction interface{}) int
+	// Hash 返回 digest 对应的被签名的 32 字节哈希, 为 nil 时 digest 就是哈希
+	// bnb 的 digest 是 sign bytes, 签名的是它的 sha256
+	Hash func(digest []byte) []byte
+
+	// 有 Backend 时用 BuildUnsignedTransaction 构造交易, 并检查提交, 查询交易和余额
+	Backend Backend
+	// 没有 Backend 时用 State 返回的 ChainState 离线构造交易, 要求 Handler 实现 OfflineTransactionBuilder
+	// 两者都为空时只检查地址和不需要交易的错误输入
+	State func(fromAddress string) *types.ChainState
+}
+
+// Run 依次检查地址, 错误输入, 构造, 错误签名, 签名, 提交查询和余额
+// handler 的 panic 记为失败, 不会中断其他检查
+func Run(t *testing.T, c *Case) {
+	t.Run("address", c.testAddress)
+	t.Run("malformed", c.testMalformed)
+
+	from, err := c.Handler.PublicKeyToAddress(c.PublicKey)
+	if err != nil {
+		t.Fatalf("public key to address: %v", err)
+	}
+	if c.Backend == nil && c.State == nil {
+		t.Logf("%T: no backend or chain state, skip transaction checks", c.Handler)
+		return
+	}
+	if c.Backend != nil {
+		if err := c.Backend.Fund(from); err != nil {
+			t.Fatalf("fund %v: %v", from, err)
+		}
+	}
+
+	var (
+		tx interface{}
+		digests []string
+	)
+	ok := t.Run("build", func(t *testing.T) {
+		tx, digests = c.testBuild(t, from)
+	})
+	if !ok || tx == nil {
+		return
+	}
+	t.Run("bad rsv", func(t *testing.T) {
+		c.testBadRSV(t, tx, digests)
+	})
+	var signed interface{}
+	ok = t.Run("sign", func(t *testing.T) {
+		signed = c.testSign(t, tx, digests)
+	})
+	if !ok || signed == nil || c.Backend == nil {
+		return
+	}
+	t.Run("lookup", func(t *testing.T) {
+		c.testLookup(t, from, signed)
+	})
+	t.Run("balance", func(t *testing.T) {
+		c.testBalance(t, from)
+	})
+}
+
+// call 调用 f, 把 panic 转成测试失败
+func call(t *testing.T, name string, f func()) (panicked bool) {
+	t.Helper()
+	defer func() {
+		if e := recover(); e != nil {
+			t.Errorf("%v panicked: %v", name, e)
+			panicked = true
+		}
+	}()
+	f()
+	return
+}
+
+func (c *Case) testAddress(t *testing.T) {
+	if len(c.Vectors) == 0 {
+		t.Skip("no address vectors")
+	}
+	for _, v := range c.Vectors {
+		var addr string
+		var err error
+		if call(t, "PublicKeyToAddress", func() { addr, err = c.Handler.PublicKeyToAddress(v.PublicKey) }) {
+			continue
+		}
+		if err != nil {
+			t.Errorf("PublicKeyToAddress(%v): %v", v.PublicKey, err)
+		} else if addr != v.Address {
+			t.Errorf("PublicKeyToAddress(%v) = %v, want %v", v.PublicKey, addr, v.Address)
+		}
+	}
+}
+
+// 不在曲线上, 长度不对或者不是 16 进制的公钥
+var malformedPublicKeys = []string{
+	"",
+	"0x",
+	"not a public key",
+	"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f817",
+	"0579be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+	"04" + strings.Repeat("11", 64),
+}
+
+func (c *Case) testMalformed(t *testing.T) {
+	h := c.Handler
+	for _, pub := range malformedPublicKeys {
+		var err error
+		if call(t, "PublicKeyToAddress", func() { _, err = h.PublicKeyToAddress(pub) }) {
+			continue
+		}
+		if !errors.Is(err, types.ErrInvalidPublicKey) {
+			t.Errorf("PublicKeyToAddress(%q) error = %v, want %v", pub, err, types.ErrInvalidPublicKey)
+		}
+	}
+
+	// 类型不对的交易在访问网络之前就应该被拒绝
+	for _, tx := range []interface{}{nil, "not a transaction", 42} {
+		var err error
+		if !call(t, "MakeSignedTransaction", func() { _, err = h.MakeSignedTransaction([]string{strings.Repeat("00", 65)}, tx) }) && err == nil {
+			t.Errorf("MakeSignedTransaction(%#v) did not fail", tx)
+		}
+		if !call(t, "SubmitTransaction", func() { _, err = h.SubmitTransaction(tx) }) && err == nil {
+			t.Errorf("SubmitTransaction(%#v) did not fail", tx)
+		}
+	}
+
+	// 构造参数在访问网络之前解析
+	var err error
+	if !call(t, "BuildUnsignedTransaction", func() { _, _, err = h.BuildUnsignedTransaction("", c.PublicKey, c.To, c.Amount, "{") }) && err == nil {
+		t.Error("BuildUnsignedTransaction with malformed jsonstring did not fail")
+	}
+
+	if c.Backend == nil && c.State == nil {
+		return
+	}
+	from, err := h.PublicKeyToAddress(c.PublicKey)
+	if err != nil {
+		t.Fatalf("public key to address: %v", err)
+	}
+	outputs := map[string]types.TxOutput{
+		"nil amount": {ToAddress: c.To},
+		"zero amount": {ToAddress: c.To, Amount: big.NewInt(0)},
+		"negative amount": {ToAddress: c.To, Amount: big.NewInt(-1)},
+		"empty address": {Amount: c.Amount},
+		"malformed address": {ToAddress: "not-an-address", Amount: c.Amount},
+	}
+	for name, out := range outputs {
+		var err error
+		if call(t, name, func() { _, _, err = c.build(from, out.ToAddress, out.Amount) }) {
+			continue
+		}
+		if err == nil {
+			t.Errorf("build with %v did not fail", name)
+		}
+	}
+
+	if c.Backend == nil {
+		return
+	}
+	for _, txhash := range []string{"", "not-a-hash", strings.Repeat("0", 64)} {
+		var err error
+		if !call(t, "GetTransactionInfo", func() { _, _, _, err = h.GetTransactionInfo(txhash) }) && err == nil {
+			t.Errorf("GetTransactionInfo(%q) did not fail", txhash)
+		}
+	}
+	var balance *big.Int
+	if !call(t, "GetAddressBalance", func() { balance, err = h.GetAddressBalance("not-an-address", c.JSONString) }) && err == nil && balance == nil {
+		t.Error("GetAddressBalance of a malformed address returned neither a balance nor an error")
+	}
+}
+
+// build 构造 from 付给 to 的交易, 有 Backend 时访问节点, 否则用 State 离线构造
+func (c *Case) build(from, to string, amount *big.Int) (transaction interface{}, digests []string, err error) {
+	if c.Backend != nil {
+		return c.Handler.BuildUnsignedTransaction(from, c.PublicKey, to, amount, c.JSONString)
+	}
+	opts, err := types.ParseBuildOptions(c.JSONString)
+	if err != nil {
+		return
+	}
+	outputs := []types.TxOutput{{ToAddress: to, Amount: amount}}
+	return cryptocoins.AssembleTransaction(c.Handler, c.State(from), from, c.PublicKey, outputs, opts)
+}
+
+func (c *Case) inputs(transaction interface{}) int {
+	if c.Inputs == nil {
+		return 1
+	}
+	return c.Inputs(transaction)
+}
+
+func (c *Case) hash(digest string) ([]byte, error) {
+	b, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, err
+	}
+	if c.Hash != nil {
+		b = c.Hash(b)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("signed hash is %v bytes", len(b))
+	}
+	return b, nil
+}
+
+func (c *Case) testBuild(t *testing.T, from string) (transaction interface{}, digests []string) {
+	transaction, digests, err := c.build(from, c.To, c.Amount)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if transaction == nil {
+		t.Fatal("build returned a nil transaction")
+	}
+	if n := c.inputs(transaction); len(digests) != n {
+		t.Errorf("build returned %v digests for %v inputs", len(digests), n)
+	}
+	for i, d := range digests {
+		if _, err := c.hash(d); err != nil {
+			t.Errorf("digest %v %q: %v", i, d, err)
+		}
+	}
+	return
+}
+
+func (c *Case) sign(t *testing.T, digests []string, key interface{}) []string {
+	t.Helper()
+	rsv, err := c.Handler.SignTransaction(digests, key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if len(rsv) != len(digests) {
+		t.Fatalf("sign returned %v signatures for %v digests", len(rsv), len(digests))
+	}
+	return rsv
+}
+
+// tamper 改掉 rsv 里 r 的最后一个字节
+func tamper(rsv string) string {
+	b, err := hex.DecodeString(rsv)
+	if err != nil || len(b) < 32 {
+		return "00" + rsv
+	}
+	b[31] ^= 0x01
+	return hex.EncodeToString(b)
+}
+
+type badRSV struct {
+	name string
+	rsv []string
+	// 能解析但不是付款方的签名, 错误应该满足 errors.Is(err, types.ErrInvalidSignature)
+	invalidSignature bool
+}
+
+// 错误的签名应该在 MakeSignedTransaction 里被拒绝, 签名不对时错误满足 errors.Is(err, types.ErrInvalidSignature)
+func (c *Case) testBadRSV(t *testing.T, transaction interface{}, digests []string) {
+	rsv := c.sign(t, digests, c.Key)
+	replace := func(i int, s string) []string {
+		bad := append([]string{}, rsv...)
+		bad[i] = s
+		return bad
+	}
+	cases := []badRSV{
+		{"tampered r", replace(len(rsv)-1, tamper(rsv[len(rsv)-1])), true},
+		{"short", replace(0, rsv[0][:len(rsv[0])-2]), false},
+		{"not hex", replace(0, strings.Repeat("zz", 65)), false},
+		{"zero", replace(0, strings.Repeat("00", 65)), false},
+		{"missing", rsv[:len(rsv)-1], false},
+		{"extra", append(append([]string{}, rsv...), rsv[0]), false},
+	}
+	if c.OtherKey != nil {
+		cases = append(cases, badRSV{"other key", c.sign(t, digests, c.OtherKey), true})
+	}
+	for _, bc := range cases {
+		var err error
+		if call(t, "MakeSignedTransaction "+bc.name, func() { _, err = c.Handler.MakeSignedTransaction(bc.rsv, transaction) }) {
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v rsv was accepted", bc.name)
+		} else if bc.invalidSignature && !errors.Is(err, types.ErrInvalidSignature) {
+			t.Errorf("%v rsv error = %v, want %v", bc.name, err, types.ErrInvalidSignature)
+		}
+	}
+}
+
+// testSign 检查签名能恢复出付款方的公钥, 并且 MakeSignedTransaction 接受它
+func (c *Case) testSign(t *testing.T, transaction interface{}, digests []string) (signed interface{}) {
+	pub, err := signature.ParsePublicKey(c.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsv := c.sign(t, digests, c.Key)
+	for i := range rsv {
+		sig, err := signature.ParseRSV(rsv[i])
+		if err != nil {
+			t.Errorf("rsv %v: %v", i, err)
+			continue
+		}
+		digest, err := c.hash(digests[i])
+		if err != nil {
+			t.Errorf("digest %v: %v", i, err)
+			continue
+		}
+		recovered, err := sig.Recover(digest)
+		if err != nil {
+			t.Errorf("rsv %v: recover: %v", i, err)
+		} else if !recovered.IsEqual(pub) {
+			t.Errorf("rsv %v: recovered %x, want %x", i, recovered.SerializeCompressed(), pub.SerializeCompressed())
+		}
+	}
+	if call(t, "MakeSignedTransaction", func() { signed, err = c.Handler.MakeSignedTransaction(rsv, transaction) }) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("make signed transaction: %v", err)
+	}
+	if signed == nil {
+		t.Fatal("make signed transaction returned nil")
+	}
+	return
+}
+
+// testLookup 提交交易, 出块后检查 GetTransactionInfo 查到的付款地址和收款输出
+// eth 系的地址有大小写 (checksum), 地址比较不区分大小写
+func (c *Case) testLookup(t *testing.T, from string, signed interface{}) {
+	h := c.Handler
+	txhash, err := h.SubmitTransaction(signed)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if txhash == "" {
+		t.Fatal("submit returned an empty hash")
+	}
+	c.Backend.Mine()
+	gotFrom, outputs, _, err := h.GetTransactionInfo(txhash)
+	if err != nil {
+		t.Fatalf("get transaction info %v: %v", txhash, err)
+	}
+	if !strings.EqualFold(gotFrom, from) {
+		t.Errorf("from = %v, want %v", gotFrom, from)
+	}
+	for _, out := range outputs {
+		if strings.EqualFold(out.ToAddress, c.To) && out.Amount != nil && out.Amount.Cmp(c.Amount) == 0 {
+			return
+		}
+	}
+	t.Errorf("outputs %v do not pay %v to %v", formatOutputs(outputs), c.Amount, c.To)
+}
+
+func formatOutputs(outputs []types.TxOutput) string {
+	var s []string
+	for _, out := range outputs {
+		s = append(s, fmt.Sprintf("%v:%v", out.ToAddress, out.Amount))
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+func (c *Case) testBalance(t *testing.T, from string) {
+	b, ok := c.Backend.(Balancer)
+	if !ok {
+		t.Skipf("%T cannot report balances", c.Backend)
+	}
+	for _, addr := range []string{from, c.To} {
+		got, err := c.Handler.GetAddressBalance(addr, c.JSONString)
+		if err != nil {
+			t.Errorf("balance of %v: %v", addr, err)
+			continue
+		}
+		if want := b.Balance(addr); got == nil || got.Cmp(want) != 0 {
+			t.Errorf("balance of %v = %v, want %v", addr, got, want)
+		}
+	}
+}
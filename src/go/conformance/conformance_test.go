@@ -0,0 +1,486 @@
+package conformance_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+
+	cryptocoins "github.com/gaozhengxin/cryptocoins/src/go"
+	"github.com/gaozhengxin/cryptocoins/src/go/btc"
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/conformance"
+	"github.com/gaozhengxin/cryptocoins/src/go/erc20"
+	"github.com/gaozhengxin/cryptocoins/src/go/eth"
+	"github.com/gaozhengxin/cryptocoins/src/go/fakenode"
+	"github.com/gaozhengxin/cryptocoins/src/go/omni"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+	"github.com/gaozhengxin/cryptocoins/src/go/xrp"
+)
+
+const (
+	eosChainID = "5fff1dae8dc8e2fc4d5b23b2c7665c97f9e9d8edf2b6485a86ba311c25639191"
+	evtChainID = "bb248d6319e51ad38502cc8ef8fe607eb5ad2cd0be2bdc0e6e30a506761b8636"
+	xrpSeed = "snoPBrXtMeMyMHUVTgbuqAfg1SUTb"
+
+	// 私钥 1 和 0x1234567890abcdef 的公钥
+	pub1 = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	pub1Uncompressed = "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
+	pub2 = "03f973a0b87062c389d125d8199e803b832b6ac6bf7867a4f6cd87506060fc4c58"
+)
+
+var ethVectors = []conformance.Vector{{pub1, "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"}, {pub1Uncompressed, "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"}, {pub2, "0xAB615A1598370C1f9756290eA874FaA4b2185abD"}}
+
+// 各币种默认网络上的地址, 独立于 handler 计算
+// BCH 的 cashaddr 前缀由 addrconv 决定, ZCASH 的地址格式是历史遗留的 "t" 加 base58, DCR 用 blake256, 这三个没有向量
+var vectors = map[string][]conformance.Vector{
+	"BTC": {{pub1, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r"}, {pub1Uncompressed, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r"}, {pub2, "mgVp6NVC2csfxpf2QoQ3oKX8deb8bS6J9F"}},
+	"OMNI": {{pub1, "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r"}, {pub2, "mgVp6NVC2csfxpf2QoQ3oKX8deb8bS6J9F"}},
+	"LTC": {{pub1, "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ"}, {pub2, "LLCp4Xi3JFgUSWsZsNQyFRNZysMhmw71e9"}},
+	"DASH": {{pub1, "XmN7PQYWKn5MJFna5fRYgP6mxT2F7xpekE"}, {pub2, "Xbfhda47BJf1LemzZ7jtpvzbbza7hchMga"}},
+	"BITGOLD": {{pub1, "GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5"}, {pub2, "GJpnDSjACT3iGBUhdB5nQAehgpnGmD6hFv"}},
+	"ETH": ethVectors,
+	"ETC": ethVectors,
+	"ERC20": ethVectors,
+	"VEN": {{pub1, "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf"}, {pub2, "0xab615a1598370c1f9756290ea874faa4b2185abd"}},
+	"TRX": {{pub1, "TMVQGm1qAQYVdetCeGRRkTWYYrLXuHK2HC"}, {pub2, "TRbPAzNkXkodFiE4LEzAkYUTBThc9z6DYR"}},
+	"XRP": {{pub1, "rBgGZ9tc4him9KBzD8fKFiQz3fSZpaSwMH"}, {pub1Uncompressed, "rBgGZ9tc4him9KBzD8fKFiQz3fSZpaSwMH"}, {pub2, "ryioKQDDbSRB5BQ6NRCyQJomezR5Ai136"}},
+	"ATOM": {{pub1, "cosmos1w508d6qejxtdg4y5r3zarvary0c5xw7k6ah60c"}, {pub2, "cosmos1ptqd6902tgrvl5zsj2dm5q4hvvdajh35j0n5cv"}},
+	"BNB": {{pub1, "tbnb1w508d6qejxtdg4y5r3zarvary0c5xw7kkvpjw8"}, {pub2, "tbnb1ptqd6902tgrvl5zsj2dm5q4hvvdajh35779uen"}},
+	// eos 的账户名和公钥的编码有关
+	"EOS": {{pub1, "dnlselxhygvqlvn4prjvtv14kj3eei3mxt"}, {pub1Uncompressed, "dqtyfi1gu4eyzyq2wgljqqgfnpcm1ripeq"}, {pub2, "d3vsv1ppg32nnn1mq2k31usqj42n1vwkm"}},
+	"EVT": {{pub1, "EVT5p78kHbL33Rn3JWkTWRE2B9uz6gy4r1KbfAKLNQGE3ovMBS5bu"}, {pub2, "EVT8j6SNL6rAf8VPGcuNZu5GRy7s2GFPApzL7iVsWFV6YnyfzatMD"}},
+}
+
+// family 返回币种所在的族, ERC20BNB 返回 ERC20
+func family(coinType string) string {
+	for _, prefix := range cryptocoins.RegisteredFamilies() {
+		if strings.HasPrefix(strings.ToUpper(coinType), prefix) {
+			return prefix
+		}
+	}
+	return coinType
+}
+
+func TestRegisteredHandlers(t *testing.T) {
+	// EVT 族没有列出成员
+	coins := append(cryptocoins.RegisteredCoins(), "EVT1")
+	for _, coinType := range coins {
+		coinType := coinType
+		t.Run(coinType, func(t *testing.T) {
+			g := startGateways(t)
+			defer g.Close()
+			h, err := cryptocoins.NewCryptocoinHandlerFromConfig(coinType, "", g.config)
+			if err != nil {
+				t.Fatalf("no handler for %v: %v", coinType, err)
+			}
+			conformance.Run(t, g.newCase(t, coinType, h))
+		})
+	}
+}
+
+// ltc, dash, bitgold 默认网络的链参数, 独立于 handler 填写
+var utxoParams = map[string]*chaincfg.Params{
+	"LTC": {Name: "mainnet", PubKeyHashAddrID: 0x30, ScriptHashAddrID: 0x32},
+	"DASH": {Name: "mainnet", PubKeyHashAddrID: 0x4c, ScriptHashAddrID: 0x10},
+	"BITGOLD": {Name: "mainnet", PubKeyHashAddrID: 0x26},
+}
+
+// TestOmniSubmit 在假 bitcoind 上构造, 签名并提交 simple send, 检查节点收到的 OP_RETURN payload
+func TestOmniSubmit(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	const coinType = "OMNITetherUS"
+	h, err := cryptocoins.NewCryptocoinHandlerFromConfig(coinType, "", g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, other := newKey(t), newKey(t)
+	from, err := h.PublicKeyToAddress(compressed(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := h.PublicKeyToAddress(compressed(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&bitcoindBackend{g.bitcoind}).Fund(from); err != nil {
+		t.Fatal(err)
+	}
+
+	amount := big.NewInt(12345)
+	tx, digests, err := h.BuildUnsignedTransaction(from, compressed(key), to, amount, "")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	rsv, err := h.SignTransaction(digests, wif(t, key, true))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	signed, err := h.MakeSignedTransaction(rsv, tx)
+	if err != nil {
+		t.Fatalf("make signed transaction: %v", err)
+	}
+	txid, err := h.SubmitTransaction(signed)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	sent := g.bitcoind.Transaction(txid)
+	if sent == nil {
+		t.Fatalf("node does not have transaction %v", txid)
+	}
+	pid, _ := strconv.ParseInt(omni.Properties[coinType], 10, 64)
+	// OP_RETURN 20 字节: "omni", 版本和类型 0, property id, 金额
+	payload := fmt.Sprintf("6a146f6d6e6900000000%08x%016x", pid, amount.Int64())
+	if got := hex.EncodeToString(sent.TxOut[0].PkScript); got != payload {
+		t.Errorf("payload = %v, want %v", got, payload)
+	}
+}
+
+// gateways 是所有假节点, config 里 mainnet 和 testnet 的网关指向它们
+type gateways struct {
+	// btc 和 omni 共用
+	bitcoind *fakenode.Bitcoind
+	// 分叉币的假节点, 按币种
+	utxoNodes map[string]*fakenode.Bitcoind
+	geth *fakenode.Geth
+	gethClassic *fakenode.Geth
+	rippled *fakenode.Rippled
+	tron *fakenode.Tron
+	nodeos *fakenode.Nodeos
+	evt *fakenode.EVT
+	cosmos *fakenode.Cosmos
+
+	config *config.ApiGatewayConfigs
+}
+
+func startGateways(t *testing.T) *gateways {
+	chainConfig, err := eth.ChainConfigForNetwork(types.Testnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &gateways{
+		bitcoind: fakenode.NewBitcoind(&chaincfg.TestNet3Params),
+		geth: fakenode.NewGeth(chainConfig.ChainID),
+		// etc 默认是 mainnet, chain id 61
+		gethClassic: fakenode.NewGeth(big.NewInt(61)),
+		rippled: fakenode.NewRippled(),
+		tron: fakenode.NewTron(),
+		nodeos: fakenode.NewNodeos(eosChainID),
+		evt: fakenode.NewEVT(evtChainID),
+		cosmos: fakenode.NewCosmos("cosmoshub-test"),
+		utxoNodes: make(map[string]*fakenode.Bitcoind),
+		config: config.Default(),
+	}
+	for coinType, params := range utxoParams {
+		g.utxoNodes[coinType] = fakenode.NewBitcoind(params)
+	}
+	fakes := &config.ApiGatewayConfigs{
+		BitcoinGateway: rpcGateway(g.bitcoind),
+		OmniGateway: rpcGateway(g.bitcoind),
+		LitecoinGateway: rpcGateway(g.utxoNodes["LTC"]),
+		DashGateway: rpcGateway(g.utxoNodes["DASH"]),
+		BitgoldGateway: rpcGateway(g.utxoNodes["BITGOLD"]),
+		EthereumGateway: &config.SimpleApiConfig{ApiAddress: g.geth.URL},
+		EthereumClassicGateway: &config.SimpleApiConfig{ApiAddress: g.gethClassic.URL},
+		RippleGateway: &config.SimpleApiConfig{ApiAddress: g.rippled.URL},
+		TronGateway: &config.SimpleApiConfig{ApiAddress: g.tron.URL},
+		EosGateway: &config.EosConfig{Nodeos: g.nodeos.URL, ChainID: eosChainID, BalanceTracker: g.nodeos.URL + "/"},
+		EVTGateway: &config.SimpleApiConfig{ApiAddress: g.evt.URL},
+		CosmosGateway: &config.SimpleApiConfig{ApiAddress: g.cosmos.URL},
+	}
+	if g.config.Networks == nil {
+		g.config.Networks = make(map[string]*config.ApiGatewayConfigs)
+	}
+	g.config.Networks[string(types.Mainnet)] = fakes
+	g.config.Networks[string(types.Testnet)] = fakes
+	return g
+}
+
+func rpcGateway(node *fakenode.Bitcoind) *config.RpcClientConfig {
+	return &config.RpcClientConfig{
+		ElectrsAddress: node.URL,
+		Host: node.Host(),
+		Port: node.Port(),
+		User: "user",
+		Passwd: "passwd",
+	}
+}
+
+func (g *gateways) Close() {
+	g.bitcoind.Close()
+	for _, node := range g.utxoNodes {
+		node.Close()
+	}
+	g.geth.Close()
+	g.gethClassic.Close()
+	g.rippled.Close()
+	g.tron.Close()
+	g.nodeos.Close()
+	g.evt.Close()
+	g.cosmos.Close()
+}
+
+func newKey(t *testing.T) *btcec.PrivateKey {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func compressed(key *btcec.PrivateKey) string {
+	return hex.EncodeToString(key.PubKey().SerializeCompressed())
+}
+
+func wif(t *testing.T, key *btcec.PrivateKey, compress bool) string {
+	w, err := btcutil.NewWIF(key, &chaincfg.MainNetParams, compress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.String()
+}
+
+func network(h cryptocoins.CryptocoinHandler) string {
+	if n, ok := h.(cryptocoins.NetworkHandler); ok {
+		return n.Network().String()
+	}
+	return ""
+}
+
+// newCase 按币种准备私钥, 收款地址和假节点, 没有假节点的币种用 ChainState 离线构造
+func (g *gateways) newCase(t *testing.T, coinType string, h cryptocoins.CryptocoinHandler) *conformance.Case {
+	key, other := newKey(t), newKey(t)
+	c := &conformance.Case{
+		Handler: h,
+		Vectors: vectors[family(coinType)],
+		PublicKey: compressed(key),
+		Amount: big.NewInt(1000000),
+	}
+	to, err := h.PublicKeyToAddress(compressed(other))
+	if err != nil {
+		t.Fatalf("public key to address: %v", err)
+	}
+	c.To = to
+
+	switch family(coinType) {
+	case "BTC", "LTC", "DASH", "BITGOLD":
+		c.Key, c.OtherKey = wif(t, key, true), wif(t, other, true)
+		c.Amount = big.NewInt(10000000)
+		c.Inputs = utxoInputs
+		node := g.bitcoind
+		if n, ok := g.utxoNodes[family(coinType)]; ok {
+			node = n
+		}
+		c.Backend = &bitcoindBackend{node}
+	case "OMNI":
+		// omni 的交易查询走 omni_gettransaction, 假节点没有实现, 提交见 TestOmniSubmit
+		c.Key, c.OtherKey = wif(t, key, true), wif(t, other, true)
+		c.Inputs = utxoInputs
+		c.State = utxoState(coinType, network(h), c.PublicKey)
+	case "ETH":
+		c.Key, c.OtherKey = key.ToECDSA(), other.ToECDSA()
+		c.Amount = big.NewInt(1000000000000000)
+		c.Backend = &gethBackend{g.geth}
+	case "ETC":
+		c.Key, c.OtherKey = key.ToECDSA(), other.ToECDSA()
+		c.Amount = big.NewInt(1000000000000000)
+		c.Backend = &gethBackend{g.gethClassic}
+	case "ERC20":
+		c.Key, c.OtherKey = key.ToECDSA(), other.ToECDSA()
+		c.Amount = big.NewInt(1000)
+		c.Backend = &tokenBackend{g.geth, erc20.Tokens[strings.ToUpper(coinType)]}
+	case "TRX":
+		c.Key, c.OtherKey = key.ToECDSA(), other.ToECDSA()
+		c.Backend = &tronBackend{g.tron}
+	case "ATOM":
+		c.Key, c.OtherKey = key.ToECDSA(), other.ToECDSA()
+		c.Backend = &cosmosBackend{g.cosmos}
+	case "VEN":
+		c.Key, c.OtherKey = key.ToECDSA(), other.ToECDSA()
+		c.State = func(string) *types.ChainState {
+			state := types.NewChainState("VEN", network(h))
+			nonce := uint64(1)
+			state.Nonce = &nonce
+			state.ChainID = "74"
+			state.RefBlock = &types.RefBlock{Number: 1, ID: "0x00000001" + strings.Repeat("ab", 28)}
+			return state
+		}
+	case "BNB":
+		c.Key, c.OtherKey = bnbKey(key), bnbKey(other)
+		// tendermint 签名的是 sign bytes 的 sha256
+		c.Hash = func(digest []byte) []byte {
+			hash := sha256.Sum256(digest)
+			return hash[:]
+		}
+		c.State = func(string) *types.ChainState {
+			state := types.NewChainState("BNB", network(h))
+			accountNumber, sequence := uint64(1), uint64(0)
+			state.AccountNumber, state.Nonce = &accountNumber, &sequence
+			return state
+		}
+	case "EOS":
+		c.Key, c.OtherKey = wif(t, key, false), wif(t, other, false)
+		c.Amount = big.NewInt(12345)
+		c.Backend = &nodeosBackend{g.nodeos}
+	case "EVT":
+		c.Key, c.OtherKey = wif(t, key, false), wif(t, other, false)
+		c.Amount = big.NewInt(100000)
+		c.Backend = &evtBackend{g.evt, 1}
+	case "XRP":
+		// ripple 的私钥从 seed 派生, 用 "seed/keyseq" 表示
+		seed := xrp.XRP_importKeyFromSeed(xrpSeed, "ecdsa")
+		seq0, seq1 := uint32(0), uint32(1)
+		c.PublicKey = hex.EncodeToString(seed.Public(&seq0))
+		c.To, err = h.PublicKeyToAddress(hex.EncodeToString(seed.Public(&seq1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Key, c.OtherKey = xrpSeed+"/0", xrpSeed+"/1"
+		c.Amount = big.NewInt(20000000)
+		c.Backend = &rippledBackend{g.rippled}
+	}
+	return c
+}
+
+func utxoInputs(transaction interface{}) int {
+	return len(transaction.(*btc.AuthoredTx).Tx.TxIn)
+}
+
+// utxoState 返回只有一个 p2pkh utxo 的 ChainState
+func utxoState(coinType, network, publicKey string) func(string) *types.ChainState {
+	return func(fromAddress string) *types.ChainState {
+		pub, _ := hex.DecodeString(publicKey)
+		state := types.NewChainState(coinType, network)
+		state.UTXOs = []types.UTXO{{
+			TxHash: strings.Repeat("ab", 32),
+			Address: fromAddress,
+			ScriptPubKey: "76a914" + hex.EncodeToString(btcutil.Hash160(pub)) + "88ac",
+			Amount: big.NewInt(100000000),
+			Confirmations: 6,
+		}}
+		return state
+	}
+}
+
+func bnbKey(key *btcec.PrivateKey) secp256k1.PrivKeySecp256k1 {
+	var k secp256k1.PrivKeySecp256k1
+	copy(k[:], key.Serialize())
+	return k
+}
+
+// bitcoindBackend 给两个 utxo, 每个都不够单独支付, 构造的交易有两个输入
+// btc 的余额查询走 blockcypher, 不实现 Balancer
+type bitcoindBackend struct {
+	node *fakenode.Bitcoind
+}
+
+func (b *bitcoindBackend) Fund(address string) error {
+	for i := 0; i < 2; i++ {
+		if _, err := b.node.Fund(address, 6000000); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bitcoindBackend) Mine() { b.node.Mine() }
+
+type gethBackend struct {
+	node *fakenode.Geth
+}
+
+func (b *gethBackend) Fund(address string) error {
+	b.node.SetBalance(address, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	return nil
+}
+
+func (b *gethBackend) Mine() { b.node.Mine() }
+
+func (b *gethBackend) Balance(address string) *big.Int { return b.node.Balance(address) }
+
+// tokenBackend 的 gas 用 ETH 支付
+type tokenBackend struct {
+	node *fakenode.Geth
+	token string
+}
+
+func (b *tokenBackend) Fund(address string) error {
+	b.node.SetBalance(address, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	b.node.SetTokenBalance(b.token, address, big.NewInt(5000))
+	return nil
+}
+
+func (b *tokenBackend) Mine() { b.node.Mine() }
+
+type rippledBackend struct {
+	node *fakenode.Rippled
+}
+
+func (b *rippledBackend) Fund(address string) error {
+	b.node.SetAccount(address, 100000000, 1)
+	return nil
+}
+
+func (b *rippledBackend) Mine() { b.node.Mine() }
+
+func (b *rippledBackend) Balance(address string) *big.Int { return big.NewInt(b.node.Balance(address)) }
+
+type tronBackend struct {
+	node *fakenode.Tron
+}
+
+func (b *tronBackend) Fund(address string) error { return b.node.SetBalance(address, 10000000) }
+
+func (b *tronBackend) Mine() { b.node.Mine() }
+
+func (b *tronBackend) Balance(address string) *big.Int { return big.NewInt(b.node.Balance(address)) }
+
+type nodeosBackend struct {
+	node *fakenode.Nodeos
+}
+
+func (b *nodeosBackend) Fund(address string) error {
+	b.node.SetBalance(address, 100000)
+	return nil
+}
+
+func (b *nodeosBackend) Mine() { b.node.Mine() }
+
+func (b *nodeosBackend) Balance(address string) *big.Int { return big.NewInt(b.node.Balance(address)) }
+
+type evtBackend struct {
+	node *fakenode.EVT
+	symID uint
+}
+
+func (b *evtBackend) Fund(address string) error {
+	b.node.SetBalance(address, b.symID, 10000000)
+	return nil
+}
+
+func (b *evtBackend) Mine() { b.node.Mine() }
+
+func (b *evtBackend) Balance(address string) *big.Int { return big.NewInt(b.node.Balance(address, b.symID)) }
+
+type cosmosBackend struct {
+	node *fakenode.Cosmos
+}
+
+func (b *cosmosBackend) Fund(address string) error {
+	b.node.SetAccount(address, 10000000, 0)
+	return nil
+}
+
+func (b *cosmosBackend) Mine() { b.node.Mine() }
+
+func (b *cosmosBackend) Balance(address string) *big.Int { return big.NewInt(b.node.Balance(address)) }
@@ -1,9 +1,14 @@
 package cryptocoins
 
 import (
+	"context"
+	"fmt"
 	"math/big"
 	"strings"
+	"time"
 
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/hdkey"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 
 	"github.com/gaozhengxin/cryptocoins/src/go/bch"
@@ -55,60 +60,493 @@ type CryptocoinHandler interface {
 	GetDefaultFee() *big.Int
 }
 
+// 带 context 的 CryptocoinHandler
+// 所有会访问网络的方法都接受 ctx, ctx 的取消和 deadline 约束该方法发出的每一次网络请求
+type CryptocoinHandlerWithContext interface {
+	CryptocoinHandler
+
+	BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error)
+
+	MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error)
+
+	SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error)
+
+	GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error)
+
+	GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error)
+}
+
+func NewCryptocoinHandlerWithContext(coinType string) CryptocoinHandlerWithContext {
+	h := NewCryptocoinHandler(coinType)
+	if h == nil {
+		return nil
+	}
+	hc, _ := h.(CryptocoinHandlerWithContext)
+	return hc
+}
+
+// 带类型化参数的交易构造
+// BuildUnsignedTransaction 的 jsonstring 会被解析成 types.BuildOptions, 再调用 BuildUnsignedTransactionWithOptions
+// handler 不支持的参数和未知参数都会返回错误
+type BuildOptionsHandler interface {
+	SupportedBuildOptions() []string
+
+	BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error)
+}
+
+// 一笔交易多个收款人
+// utxo 币种每个收款人一个输出, BNB 是 msg.Transfer 列表, ATOM 是 MsgMultiSend, EOS/EVT 是多个 action, VEN 是多个 clause
+type BatchTransactionBuilder interface {
+	BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error)
+}
+
+// 构造批量交易, handler 不支持批量时只允许一个收款人, 否则返回 types.ErrBatchNotSupported
+func BuildUnsignedBatchTransaction(ctx context.Context, h CryptocoinHandler, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if b, ok := h.(BatchTransactionBuilder); ok {
+		return b.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, outputs, opts)
+	}
+	if len(outputs) != 1 {
+		err = fmt.Errorf("%T: %w", h, types.ErrBatchNotSupported)
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	o, ok := h.(BuildOptionsHandler)
+	if !ok {
+		err = types.WrapError(types.ErrNotSupported, fmt.Errorf("handler %T does not support build options", h))
+		return
+	}
+	return o.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, outputs[0].ToAddress, outputs[0].Amount, opts)
+}
+
+// 未签名交易的序列化
+// 交易构造和 MakeSignedTransaction 可以在不同的进程里执行, 中间用 types.TxEnvelope 传递
+type TransactionMarshaler interface {
+	MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error)
+
+	UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error)
+}
+
+func MarshalUnsignedTransaction(h CryptocoinHandler, transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	m, ok := h.(TransactionMarshaler)
+	if !ok {
+		return nil, types.WrapError(types.ErrNotSupported, fmt.Errorf("handler %T does not support transaction envelope", h))
+	}
+	return m.MarshalUnsignedTransaction(transaction, digests)
+}
+
+// 根据信封里的币种创建 handler 并解出未签名交易
+func UnmarshalUnsignedTransaction(env *types.TxEnvelope) (h CryptocoinHandler, transaction interface{}, err error) {
+	if env == nil {
+		return nil, nil, fmt.Errorf("nil transaction envelope")
+	}
+	h, err = NewCryptocoinHandlerForNetwork(env.CoinType, types.Network(env.Network))
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := h.(TransactionMarshaler)
+	if !ok {
+		return nil, nil, types.WrapError(types.ErrNotSupported, fmt.Errorf("handler %T does not support transaction envelope", h))
+	}
+	transaction, err = m.UnmarshalUnsignedTransaction(env)
+	return
+}
+
+// NewCryptocoinHandler 根据币种名创建默认网络的 handler, 币种名和别名不区分大小写
+// 币种在 registry 里注册, 不支持的币种返回 nil
 func NewCryptocoinHandler(coinType string) (txHandler CryptocoinHandler) {
-	coinTypeC := strings.ToUpper(coinType)
-	switch coinTypeC {
-	case "BITGOLD":
-		return bitgold.NewBITGOLDHandler()
-	case "BCH":
-		return bch.NewBCHHandler()
-	case "BNB":
-		return bnb.NewBNBHandler()
-	case "BTC":
-		return btc.NewBTCHandler()
-	case "DASH":
-		return dash.NewDASHHandler()
-	case "DCR":
-		return dcr.NewDCRHandler()
-	case "EOS":
-		return eos.NewEOSHandler()
-	case "ETH":
-		return eth.NewETHHandler()
-	case "ETC":
-		return etc.NewETCHandler()
-	case "LTC":
-		return ltc.NewLTCHandler()
-	case "TRX":
-		return trx.NewTRXHandler()
-	case "VEN":
-		return ven.NewVENHandler()
-	case "XRP":
-		return xrp.NewXRPHandler()
-	case "ZCASH":
-		return zec.NewZECHandler()
-	case "ATOM":
-		return atom.NewAtomHandler()
-	default:
-		if isEvt(coinTypeC) {
-			return evt.NewEvtHandler(coinTypeC)
-		}
-		if isErc20(coinTypeC) {
-			return erc20.NewERC20TokenHandler(coinTypeC)
-		}
-		if isOmni(coinType) {
-			return omni.NewOMNIPropertyHandler(coinType)
+	txHandler, _ = NewCryptocoinHandlerForNetwork(coinType, "")
+	return
+}
+
+// NewCryptocoinHandlerForNetwork 创建 network 上的 handler, network 为空时使用币种的默认网络
+// 地址生成, 地址校验, chain id 和网关都由 handler 自己的网络决定, 同一进程里可以同时使用多个网络
+// 币种不支持该网络时返回的错误 errors.Is(err, types.ErrUnsupportedNetwork)
+// 网关使用进程默认的配置 config.Current()
+func NewCryptocoinHandlerForNetwork(coinType string, network types.Network) (txHandler CryptocoinHandler, err error) {
+	return NewCryptocoinHandlerFromConfig(coinType, network, config.Current())
+}
+
+// NewCryptocoinHandlerFromConfig 和 NewCryptocoinHandlerForNetwork 一样, 网关使用 gateways 里的配置
+// 同一进程里可以用不同的配置创建多个 handler
+func NewCryptocoinHandlerFromConfig(coinType string, network types.Network, gateways *config.ApiGatewayConfigs) (txHandler CryptocoinHandler, err error) {
+	if gateways == nil {
+		return nil, fmt.Errorf("new %v handler: nil gateway config", coinType)
+	}
+	factory := registry.factory(coinType)
+	if factory == nil {
+		return nil, types.Errorf(types.ErrNotSupported, "unsupported coin type: %v", coinType)
+	}
+	return factory(coinType, network, gateways)
+}
+
+// 实现了 NetworkHandler 的 handler 可以查询自己所在的网络
+type NetworkHandler interface {
+	Network() types.Network
+}
+
+// 描述 handler 实际实现了哪些功能, 不支持的功能返回 types.ErrNotSupported
+type CapabilitiesHandler interface {
+	Capabilities() types.Capabilities
+}
+
+// HandlerCapabilities 返回 handler 的功能
+// 没有实现 CapabilitiesHandler 的 handler 根据它实现的接口推断, CryptocoinHandler 的方法认为都已实现
+func HandlerCapabilities(h CryptocoinHandler) types.Capabilities {
+	if c, ok := h.(CapabilitiesHandler); ok {
+		return c.Capabilities()
+	}
+	c := types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		Balance: true,
+	}
+	if _, ok := h.(BatchTransactionBuilder); ok {
+		c.MultiOutput = true
+	}
+	if o, ok := h.(BuildOptionsHandler); ok {
+		c.BuildOptions = o.SupportedBuildOptions()
+		c.Memo = c.HasBuildOption(types.OptMemo)
+	}
+	if _, ok := h.(FeeEstimator); ok {
+		c.FeeEstimate = true
+	}
+	if _, ok := h.(TxStatusHandler); ok {
+		c.TxStatus = true
+	}
+	if _, ok := h.(HistoryHandler); ok {
+		c.History = true
+	}
+	if _, ok := h.(OfflineTransactionBuilder); ok {
+		c.OfflineBuild = true
+	}
+	if n, ok := h.(NetworkHandler); ok {
+		c.Network = n.Network()
+		c.Networks = []types.Network{c.Network}
+	}
+	return c
+}
+
+// CoinCapabilities 返回所有注册币种在 network 上的功能, network 为空时使用各币种的默认网络
+// 不支持该网络的币种不在结果里
+func CoinCapabilities(network types.Network) map[string]types.Capabilities {
+	caps := make(map[string]types.Capabilities)
+	for _, coinType := range RegisteredCoins() {
+		h, err := NewCryptocoinHandlerForNetwork(coinType, network)
+		if err != nil {
+			continue
 		}
-		return nil
+		caps[coinType] = HandlerCapabilities(h)
 	}
+	return caps
 }
 
-func isEvt(tokentype string) bool {
-	return strings.HasPrefix(tokentype, "EVT")
+// 描述币种的精度和单位, 见 types.Metadata
+type MetadataHandler interface {
+	Metadata() types.Metadata
 }
-func isErc20(tokentype string) bool {
-	return strings.HasPrefix(tokentype,"ERC20")
+
+// HandlerMetadata 返回 handler 的币种信息, 没有实现 MetadataHandler 时返回 types.ErrNotSupported
+func HandlerMetadata(h CryptocoinHandler) (types.Metadata, error) {
+	if m, ok := h.(MetadataHandler); ok {
+		return m.Metadata(), nil
+	}
+	return types.Metadata{}, types.NotSupportedError(fmt.Sprintf("%T", h), "Metadata")
 }
 
-func isOmni(propertyname string) bool {
-	return strings.HasPrefix(propertyname,"OMNI")
+// CoinMetadata 返回所有注册币种在 network 上的币种信息, network 为空时使用各币种的默认网络
+// 不支持该网络或者没有实现 MetadataHandler 的币种不在结果里
+func CoinMetadata(network types.Network) map[string]types.Metadata {
+	metadata := make(map[string]types.Metadata)
+	for _, coinType := range RegisteredCoins() {
+		h, err := NewCryptocoinHandlerForNetwork(coinType, network)
+		if err != nil {
+			continue
+		}
+		if m, err := HandlerMetadata(h); err == nil {
+			metadata[coinType] = m
+		}
+	}
+	return metadata
+}
+
+// 向节点查询一笔转账 slow/normal/fast 三档的手续费, 金额是最小单位
+// 节点无法回答时返回 GetDefaultFee 的默认值并设置 Fallback, 只有参数错误 (比如地址无效) 才返回错误
+type FeeEstimator interface {
+	EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error)
+}
+
+// EstimateFee 估计 handler 一笔转账的手续费, 没有实现 FeeEstimator 的 handler 三档都是 GetDefaultFee
+func EstimateFee(ctx context.Context, h CryptocoinHandler, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	if e, ok := h.(FeeEstimator); ok {
+		return e.EstimateFee(ctx, fromAddress, toAddress, amount)
+	}
+	return types.FixedFeeEstimate(h.GetDefaultFee(), true), nil
+}
+
+// 查询交易的状态和确认数, 见 types.TxStatus
+// 节点查不到的交易返回 types.TxUnknown, 不返回错误
+type TxStatusHandler interface {
+	GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error)
+}
+
+// GetTransactionStatus 查询 handler 上交易的状态, 没有实现 TxStatusHandler 时返回 types.ErrNotSupported
+func GetTransactionStatus(ctx context.Context, h CryptocoinHandler, txhash string) (*types.TxStatus, error) {
+	if s, ok := h.(TxStatusHandler); ok {
+		return s.GetTransactionStatus(ctx, txhash)
+	}
+	return nil, types.NotSupportedError(fmt.Sprintf("%T", h), "GetTransactionStatus")
+}
+
+// WaitForConfirmations 默认的轮询间隔
+var DefaultPollInterval = 15 * time.Second
+
+// WaitForConfirmations 每隔 interval 查询一次交易状态, 直到交易有 confirmations 个确认或者达到 TxFinal
+// confirmations 为 0 时等到 TxFinal, interval 为 0 时使用 DefaultPollInterval, timeout 为 0 时只受 ctx 限制
+// 交易失败时返回状态和 types.ErrTxFailed, 超时返回最后一次查到的状态 (可能为 nil) 和 ctx 的错误
+// 暂时的错误 (见 types.Retryable) 会继续轮询, 其他错误直接返回
+func WaitForConfirmations(ctx context.Context, h CryptocoinHandler, txhash string, confirmations uint64, interval, timeout time.Duration) (*types.TxStatus, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	var last *types.TxStatus
+	for {
+		status, err := GetTransactionStatus(ctx, h, txhash)
+		if err == nil {
+			last = status
+			if status.State == types.TxFailed {
+				return status, types.Errorf(types.ErrTxFailed, "transaction %v failed", txhash)
+			}
+			if status.State == types.TxFinal || (confirmations > 0 && status.State == types.TxIncluded && status.Confirmations >= confirmations) {
+				return status, nil
+			}
+		} else if ctx.Err() == nil && !types.Retryable(err) {
+			return last, err
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return last, fmt.Errorf("wait for confirmations of %v: %w", txhash, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// 分页查询地址的转账历史, 见 types.HistoryPage
+type HistoryHandler interface {
+	GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error)
+}
+
+// GetAddressHistory 查询 handler 上地址的一页转账历史, 没有实现 HistoryHandler 时返回 types.ErrNotSupported
+func GetAddressHistory(ctx context.Context, h CryptocoinHandler, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	if hh, ok := h.(HistoryHandler); ok {
+		return hh.GetAddressHistory(ctx, address, page)
+	}
+	return nil, types.NotSupportedError(fmt.Sprintf("%T", h), "GetAddressHistory")
+}
+
+// 把构造交易拆成两步, FetchChainState 访问节点, Assemble 只用 ChainState 构造交易
+// 相同的 ChainState 和参数总是得到相同的交易和 digests, 可以在离线的机器上调用
+type OfflineTransactionBuilder interface {
+	FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error)
+	Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error)
+}
+
+// FetchChainState 查询构造交易需要的链上状态, 没有实现 OfflineTransactionBuilder 时返回 types.ErrNotSupported
+func FetchChainState(ctx context.Context, h CryptocoinHandler, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	if b, ok := h.(OfflineTransactionBuilder); ok {
+		return b.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	}
+	return nil, types.NotSupportedError(fmt.Sprintf("%T", h), "FetchChainState")
+}
+
+// AssembleTransaction 用 state 构造未签名交易, 不访问网络, 没有实现 OfflineTransactionBuilder 时返回 types.ErrNotSupported
+func AssembleTransaction(h CryptocoinHandler, state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if b, ok := h.(OfflineTransactionBuilder); ok {
+		return b.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+	}
+	return nil, nil, types.NotSupportedError(fmt.Sprintf("%T", h), "Assemble")
+}
+
+// DerivationPath 返回 h 的币种的 BIP44 路径 m/44'/coin'/account'/change/index, coin 是 Metadata 里的 SLIP-44 coin type
+// 没有注册 SLIP-44 coin type 的币种和没有实现 MetadataHandler 的 handler 返回 types.ErrNotSupported
+func DerivationPath(h CryptocoinHandler, account, change, index uint32) (string, error) {
+	m, err := HandlerMetadata(h)
+	if err != nil {
+		return "", err
+	}
+	if m.SLIP44 == types.SLIP44Unregistered {
+		return "", types.NotSupportedError(fmt.Sprintf("%T", h), "DerivationPath")
+	}
+	return hdkey.BIP44Path(m.SLIP44, account, change, index), nil
+}
+
+// DeriveAddress 从扩展公钥 xpub 按 path 派生子公钥, 返回 h 生成的地址和 16 进制的压缩子公钥
+// 扩展公钥只能做非 hardened 派生, 通常 xpub 是账户公钥 m/44'/coin'/account', path 是 DerivationPath 的结果或者相对路径 change/index
+func DeriveAddress(h CryptocoinHandler, xpub, path string) (address, pubKeyHex string, err error) {
+	key, err := hdkey.ParseExtendedKey(xpub)
+	if err != nil {
+		return "", "", err
+	}
+	child, err := key.Derive(path)
+	if err != nil {
+		return "", "", err
+	}
+	pubKeyHex = child.PublicKeyHex()
+	address, err = h.PublicKeyToAddress(pubKeyHex)
+	if err != nil {
+		return "", "", err
+	}
+	return address, pubKeyHex, nil
+}
+
+// 内置币种
+func init() {
+	MustRegister("BITGOLD", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := bitgold.NewBITGOLDHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("BCH", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := bch.NewBCHHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("BNB", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := bnb.NewBNBHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("BTC", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := btc.NewBTCHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("DASH", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := dash.NewDASHHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("DCR", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := dcr.NewDCRHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("EOS", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := eos.NewEOSHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("ETH", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := eth.NewETHHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("ETC", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := etc.NewETCHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("LTC", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := ltc.NewLTCHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("TRX", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := trx.NewTRXHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("VEN", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := ven.NewVENHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}, "VECHAIN", "VET")
+	MustRegister("XRP", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := xrp.NewXRPHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+	MustRegister("ZCASH", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := zec.NewZECHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}, "ZEC")
+	MustRegister("ATOM", func(_ string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := atom.NewAtomHandlerFromConfig(network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	})
+
+	MustRegisterFamily("EVT", func(coinType string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := evt.NewEvtHandlerFromConfig(strings.ToUpper(coinType), network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}, nil)
+	MustRegisterFamily("ERC20", func(coinType string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := erc20.NewERC20TokenHandlerFromConfig(strings.ToUpper(coinType), network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}, func() (coins []string) {
+		for tokenType := range erc20.Tokens {
+			coins = append(coins, tokenType)
+		}
+		return
+	})
+	// omni 的 property 名区分大小写, 不转大写
+	MustRegisterFamily("OMNI", func(coinType string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error) {
+		h, err := omni.NewOMNIPropertyHandlerFromConfig(coinType, network, gateways)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}, func() (coins []string) {
+		for propertyName := range omni.Properties {
+			coins = append(coins, propertyName)
+		}
+		return
+	})
 }
@@ -1,31 +1,59 @@
 package dash
 
 import (
-	"encoding/hex"
-	"fmt"
+	"context"
 	"math/big"
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
 	"github.com/gaozhengxin/cryptocoins/src/go/btc"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
-var ChainConfig = chaincfg.Params {
-	PubKeyHashAddrID: 0x4b,
+// 默认网络
+const DefaultNetwork = types.Mainnet
+
+// 各网络的链参数
+var chainConfigs = map[types.Network]*chaincfg.Params{
+	types.Mainnet: {Name: "mainnet", PubKeyHashAddrID: 0x4c, ScriptHashAddrID: 0x10},
+	types.Testnet: {Name: "testnet3", PubKeyHashAddrID: 0x8c, ScriptHashAddrID: 0x13},
 }
 
 var allowHighFees = true
 
 type DASHHandler struct {
+	network types.Network
+	chainConfig *chaincfg.Params
 	btcHandler *btc.BTCHandler
 }
 
 func NewDASHHandler () *DASHHandler {
-	return &DASHHandler{
-		btcHandler: btc.NewBTCHandlerWithConfig(config.DASH_SERVER_HOST,config.DASH_SERVER_PORT,config.DASH_USER,config.DASH_PASSWD,config.DASH_USESSL),
+	h, _ := NewDASHHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewDASHHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewDASHHandlerForNetwork (network types.Network) (*DASHHandler, error) {
+	return NewDASHHandlerFromConfig(network, config.Current())
+}
+
+// NewDASHHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 DashGateway
+func NewDASHHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*DASHHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, ok := chainConfigs[network]
+	if !ok {
+		return nil, types.UnsupportedNetworkError("DASH", network)
 	}
+	return &DASHHandler{
+		network: network,
+		chainConfig: params,
+		btcHandler: btc.NewBTCHandlerForChain(network, params, gateways.ForNetwork(string(network)).DashGateway, gateways.HealthCheckInterval(), gateways.ForNetwork(string(network)).Timeout()),
+	}, nil
+}
+
+func (h *DASHHandler) Network() types.Network {
+	return h.network
 }
 
 var DASH_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -34,21 +62,19 @@ func (h *DASHHandler) GetDefaultFee() *big.Int {
 	return DASH_DEFAULT_FEE
 }
 
+// EstimateFee 用节点的 estimatesmartfee 估计手续费, 节点无法估计时三档都是 DASH_DEFAULT_FEE
+func (h *DASHHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	return h.btcHandler.EstimateFeeWithFallback(ctx, fromAddress, toAddress, amount, DASH_DEFAULT_FEE)
+}
+
 func (h *DASHHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error){
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed()
 	pkHash := btcutil.Hash160(b)
-	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, &ChainConfig)
+	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, h.chainConfig)
 	if err != nil {
 		return
 	}
@@ -56,32 +82,133 @@ func (h *DASHHandler) PublicKeyToAddress(pubKeyHex string) (address string, err
 	return
 }
 
-// NOT completed, may or not work
 func (h *DASHHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	return h.btcHandler.BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *DASHHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *DASHHandler) SupportedBuildOptions() []string {
+	return btc.SupportedBuildOptions
+}
+
+func (h *DASHHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: h.btcHandler.HasElectrs(),
+		MultiOutput: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: btc.SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *DASHHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "DASH",
+		Decimals: 8,
+		SLIP44: 5,
+		AddressFormat: types.AddressBase58Check,
+		SmallestUnit: "duff",
+	}
+}
+
+func (h *DASHHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("DASH", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *DASHHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("DASH", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 fromAddress 可以花费的 utxo, 见 btc.BTCHandler.FetchUTXOs
+func (h *DASHHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	if err := opts.Check("DASH", btc.SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	return h.btcHandler.FetchUTXOs(ctx, "DASH", fromAddress)
+}
+
+// Assemble 用 state 的 utxo 构造未签名交易, 不访问网络
+func (h *DASHHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.btcHandler.AssembleForCoin("DASH", state, fromAddress, fromPublicKey, outputs, opts)
 }
 
-// NOT completed, may or not work
 func (h *DASHHandler) SignTransaction(hash []string, wif interface{}) (rsv []string, err error){
 	return h.btcHandler.SignTransaction(hash, wif)
 }
 
-// NOT completed, may or not work
 func (h *DASHHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
 	return h.btcHandler.MakeSignedTransaction(rsv, transaction)
 }
 
-// NOT completed, may or not work
+func (h *DASHHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *DASHHandler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	return h.btcHandler.SubmitTransaction(signedTransaction)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *DASHHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	return h.btcHandler.SubmitTransactionContext(ctx, signedTransaction)
 }
 
 func (h *DASHHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	return h.btcHandler.GetTransactionInfo(txhash)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *DASHHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.btcHandler.GetTransactionInfoContext(ctx, txhash)
+}
+
+// DASH 交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 6
+
+func (h *DASHHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	return h.btcHandler.TransactionStatus(ctx, txhash, FinalityConfirmations)
+}
+
+// GetAddressHistory 从节点网关配置的 electrs 查询地址历史, 没有配置 electrs 时返回 types.ErrNotSupported
+func (h *DASHHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	return h.btcHandler.ElectrsHistory(ctx, address, page)
 }
 
 // TODO
 func (h *DASHHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	err = fmt.Errorf("function currently not available")
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *DASHHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	err = types.NotSupportedError("DASH", "GetAddressBalance")
 	return nil, err
 }
+
+func (h *DASHHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return btc.MarshalEnvelope("DASH", h.network.String(), transaction, digests)
+}
+
+func (h *DASHHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return btc.UnmarshalEnvelope("DASH", h.network.String(), env)
+}
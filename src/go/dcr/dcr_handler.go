@@ -1,10 +1,9 @@
 package dcr
 
 import (
-	"encoding/hex"
+	"context"
 	"math/big"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/gaozhengxin/cryptocoins/src/go/dcr/chaincfg"
 	//"github.com/gaozhengxin/cryptocoins/src/go/dcr/dcrjson"
 	"github.com/btcsuite/btcd/txscript"
@@ -13,27 +12,66 @@ import (
 
 	"github.com/gaozhengxin/cryptocoins/src/go/btc"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
-var ChainConfig = chaincfg.MainNetParams
+// 默认网络
+const DefaultNetwork = types.Mainnet
+
+// 各网络的链参数
+var chainConfigs = map[types.Network]*chaincfg.Params{
+	types.Mainnet: &chaincfg.MainNetParams,
+	types.Testnet: &chaincfg.TestNet3Params,
+	types.Regtest: &chaincfg.RegNetParams,
+}
 
 var RequiredConfirmations = int64(1)
 
 var allowHighFees = true
 
-var feeRate, _ = dcrutil.NewAmount(0.0001)
+// 默认 0.0001 DCR/kB
+var feeRate = dcrutil.Amount(10000)
 
 var hashType = txscript.SigHashAll
 
 type DCRHandler struct{
+	network types.Network
+	chainConfig *chaincfg.Params
 	btcHandler *btc.BTCHandler
 }
 
 func NewDCRHandler () *DCRHandler {
-	return &DCRHandler{
-		btcHandler: btc.NewBTCHandlerWithConfig(config.DCR_SERVER_HOST,config.DCR_SERVER_PORT,config.DCR_USER,config.DCR_PASSWD,config.DCR_USESSL),
+	h, _ := NewDCRHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewDCRHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewDCRHandlerForNetwork (network types.Network) (*DCRHandler, error) {
+	return NewDCRHandlerFromConfig(network, config.Current())
+}
+
+// NewDCRHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 DecredGateway
+func NewDCRHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*DCRHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, ok := chainConfigs[network]
+	if !ok {
+		return nil, types.UnsupportedNetworkError("DCR", network)
+	}
+	// 交易目前用 btcHandler 构造, 使用同名网络的比特币链参数
+	btcParams, err := btc.ChainConfigForNetwork(network)
+	if err != nil {
+		return nil, types.UnsupportedNetworkError("DCR", network)
 	}
+	return &DCRHandler{
+		network: network,
+		chainConfig: params,
+		btcHandler: btc.NewBTCHandlerForChain(network, btcParams, gateways.ForNetwork(string(network)).DecredGateway, gateways.HealthCheckInterval(), gateways.ForNetwork(string(network)).Timeout()),
+	}, nil
+}
+
+func (h *DCRHandler) Network() types.Network {
+	return h.network
 }
 
 var DCR_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -42,21 +80,19 @@ func (h *DCRHandler) GetDefaultFee() *big.Int {
 	return DCR_DEFAULT_FEE
 }
 
+// EstimateFee 用节点的 estimatesmartfee 估计手续费, 节点无法估计时三档都是 DCR_DEFAULT_FEE
+func (h *DCRHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	return h.btcHandler.EstimateFeeWithFallback(ctx, fromAddress, toAddress, amount, DCR_DEFAULT_FEE)
+}
+
 func (h *DCRHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed()
 	pkHash := dcrutil.Hash160(b)
-	addressPubKeyHash, err := dcrutil.NewAddressPubKeyHash(pkHash, &ChainConfig, dcrec.STEcdsaSecp256k1)
+	addressPubKeyHash, err := dcrutil.NewAddressPubKeyHash(pkHash, h.chainConfig, dcrec.STEcdsaSecp256k1)
 	if err != nil {
 		return
 	}
@@ -65,7 +101,76 @@ func (h *DCRHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 }
 
 func (h *DCRHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	return h.btcHandler.BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *DCRHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *DCRHandler) SupportedBuildOptions() []string {
+	return btc.SupportedBuildOptions
+}
+
+func (h *DCRHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: h.btcHandler.HasElectrs(),
+		MultiOutput: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: btc.SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *DCRHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "DCR",
+		Decimals: 8,
+		SLIP44: 42,
+		AddressFormat: types.AddressBase58Check,
+		SmallestUnit: "atom",
+	}
+}
+
+func (h *DCRHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("DCR", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *DCRHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("DCR", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 fromAddress 可以花费的 utxo, 见 btc.BTCHandler.FetchUTXOs
+func (h *DCRHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	if err := opts.Check("DCR", btc.SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	return h.btcHandler.FetchUTXOs(ctx, "DCR", fromAddress)
+}
+
+// Assemble 用 state 的 utxo 构造未签名交易, 不访问网络
+func (h *DCRHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.btcHandler.AssembleForCoin("DCR", state, fromAddress, fromPublicKey, outputs, opts)
 }
 
 func (h *DCRHandler) SignTransaction(hash []string, privateKey interface{}) (rsv []string, err error) {
@@ -76,15 +181,52 @@ func (h *DCRHandler) MakeSignedTransaction(rsv []string, transaction interface{}
 	return h.btcHandler.MakeSignedTransaction(rsv, transaction)
 }
 
+func (h *DCRHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *DCRHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
-	return h.btcHandler.SubmitTransaction(signedTransaction)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *DCRHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	return h.btcHandler.SubmitTransactionContext(ctx, signedTransaction)
 }
 
 func (h *DCRHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	return h.btcHandler.GetTransactionInfo(txhash)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *DCRHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.btcHandler.GetTransactionInfoContext(ctx, txhash)
+}
+
+// DCR 交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 6
+
+func (h *DCRHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	return h.btcHandler.TransactionStatus(ctx, txhash, FinalityConfirmations)
+}
+
+// GetAddressHistory 从节点网关配置的 electrs 查询地址历史, 没有配置 electrs 时返回 types.ErrNotSupported
+func (h *DCRHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	return h.btcHandler.ElectrsHistory(ctx, address, page)
 }
 
 func (h *DCRHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *DCRHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	err = types.NotSupportedError("DCR", "GetAddressBalance")
 	return
 }
 
+
+func (h *DCRHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return btc.MarshalEnvelope("DCR", h.network.String(), transaction, digests)
+}
+
+func (h *DCRHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return btc.UnmarshalEnvelope("DCR", h.network.String(), env)
+}
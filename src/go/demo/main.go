@@ -4,11 +4,14 @@ import (
 	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
+	"log"
 	"math/big"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/binance-chain/go-sdk/keys"
+	"github.com/eoscanada/eos-go/ecc"
 
 	"github.com/gaozhengxin/cryptocoins/src/go/eos"
+	"github.com/gaozhengxin/cryptocoins/src/go/secrets"
 	"github.com/gaozhengxin/cryptocoins/src/go/xrp"
 	"github.com/gaozhengxin/cryptocoins/src/go/trx"
 	api "github.com/gaozhengxin/cryptocoins/src/go"
@@ -50,6 +53,33 @@ func main() {
 
 var xx = big.NewInt(1)
 
+// 测试帐户的私钥从 secrets 读取, 见 secrets.Lookup
+const (
+	DEMO_BTC_WIF = "DEMO_BTC_WIF"
+	DEMO_ETH_PRIVKEY = "DEMO_ETH_PRIVKEY"
+	DEMO_ERC20_PRIVKEY = "DEMO_ERC20_PRIVKEY"
+	DEMO_EOS_PRIVKEY = "DEMO_EOS_PRIVKEY"
+	DEMO_XRP_SEED = "DEMO_XRP_SEED"
+	DEMO_TRX_PRIVKEY = "DEMO_TRX_PRIVKEY"
+	DEMO_BNB_MNEMONIC = "DEMO_BNB_MNEMONIC"
+)
+
+func mustSecret (name string) string {
+	v, err := secrets.Lookup(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return v
+}
+
+func mustECDSA (name string) *ecdsa.PrivateKey {
+	key, err := crypto.HexToECDSA(mustSecret(name))
+	if err != nil {
+		log.Fatalf("%v: %v", name, err)
+	}
+	return key
+}
+
 func test_common (h api.CryptocoinHandler, fromPrivateKey interface{}, fromPubKeyHex, fromAddress, toAddress string, value int64, build_tx_args string, queryTxHash, queryAddress string, query_balance_args string) {
 ///*
 	fmt.Printf("========== %s ==========\n\n", "test pubkey to address/account_name")
@@ -120,7 +150,7 @@ func test_bitgold () {
 func test_bch () {
 	fmt.Printf("=========================\n           BCH           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("BCH")
-	fromPrivateKey := "93N2nFzgr1cPRU8ppswy8HrgBMaoba8aH5sGZn9NdgG9weRFrA1"
+	fromPrivateKey := mustSecret(DEMO_BTC_WIF)
 	fromPubKeyHex := "04c1a8dd2d6acd8891bddfc02bc4970a0569756ed19a2ed75515fa458e8cf979fdef6ebc5946e90a30c3ee2c1fadf4580edb1a57ad356efd7ce3f5c13c9bb4c78f"
 	//fromPubKeyHex := "032f7d0667c2f0989dfb588dedc70edfbc5aefdc02304b10a2c58105f8fe3ce38c"
 	queryTxHash := "f6f24bd236252574c1ba7086ac1178b37abf5041653127bd6b400bae0f0a9b00"
@@ -130,7 +160,7 @@ func test_bch () {
 func test_bnb () {
 	fmt.Printf("=========================\n           BNB           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("BNB")
-	km, _ := keys.NewMnemonicKeyManager("govern cancel early excite other fox canvas satoshi social shiver version inch correct web soap always water wine grid fashion voyage finish canal subject")
+	km, _ := keys.NewMnemonicKeyManager(mustSecret(DEMO_BNB_MNEMONIC))
 	fromPrivateKey := km.GetPrivKey()
 	fromPubKeyHex := "046377500e127f76b8403aa4e15346dbcde31c54c3914939c8216271ff159fbab5b0713615dbcf7afd262a27f4f65cbf5c5c0e41e13749fcb2956a3a008fcfc939"
 	fromAddress := "tbnb1sgudr8w8kfjz0lyuf44sr0x6y29wc96hgm8r5d"
@@ -158,7 +188,7 @@ func test_omni () {
 	fmt.Printf("=========================\n           OMNI           \n=========================\n\n")
 	//h := api.NewCryptocoinHandler("OMNITetherUS") //OMNITetherUS
 	h := api.NewCryptocoinHandler("OMNIOmni")
-	fromPrivateKey := "93N2nFzgr1cPRU8ppswy8HrgBMaoba8aH5sGZn9NdgG9weRFrA1"
+	fromPrivateKey := mustSecret(DEMO_BTC_WIF)
 	fromPubKeyHex := "04c1a8dd2d6acd8891bddfc02bc4970a0569756ed19a2ed75515fa458e8cf979fdef6ebc5946e90a30c3ee2c1fadf4580edb1a57ad356efd7ce3f5c13c9bb4c78f"
 	fromAddress := "mtjq9RmBBDVne7YB4AFHYCZFn3P2AXv9D5"
 	toAddress := "mt2ciKvkbMcmeWeGWMm1mohxStKpn8SmCY"
@@ -171,7 +201,7 @@ func test_omni () {
 func test_btc () {
 	fmt.Printf("=========================\n           BTC           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("BTC")
-	fromPrivateKey := "93N2nFzgr1cPRU8ppswy8HrgBMaoba8aH5sGZn9NdgG9weRFrA1"
+	fromPrivateKey := mustSecret(DEMO_BTC_WIF)
 	fromPubKeyHex := "04c1a8dd2d6acd8891bddfc02bc4970a0569756ed19a2ed75515fa458e8cf979fdef6ebc5946e90a30c3ee2c1fadf4580edb1a57ad356efd7ce3f5c13c9bb4c78f"
 	fromAddress := "mtjq9RmBBDVne7YB4AFHYCZFn3P2AXv9D5"
 	toAddress := "mi7z7Nb9H2eWf6Do2qEZn68bAYavjm8fJ2"
@@ -201,7 +231,7 @@ func test_zcash () {
 func test_eos () {
 	fmt.Printf("=========================\n           EOS           \n=========================\n\n")
 	h := eos.NewEOSHandler()
-	fromPrivateKey := "5JqBVZS4shWHBhcht6bn3ecWDoZXPk3TRSVpsLriQz5J3BKZtqH"
+	fromPrivateKey := mustSecret(DEMO_EOS_PRIVKEY)
 	//fromPubKeyHex := "04c1a8dd2d6acd8891bddfc02bc4970a0569756ed19a2ed75515fa458e8cf979fdef6ebc5946e90a30c3ee2c1fadf4580edb1a57ad356efd7ce3f5c13c9bb4c78f"
 	fromAcctName := "gzx123454321"
 	//toAcctName := "eosdcrm11144"
@@ -224,7 +254,15 @@ func test_eos () {
 ///*
 	// 构建lockin交易
 	fmt.Printf("========== %s ==========\n\n", "test build unsigned transfer transaction")
-	transaction, digest, err := h.BuildUnsignedLockinTransaction(fromAcctName, toUserKey, toAcctName, big.NewInt(100), "")
+	fromKey, err := ecc.NewPrivateKey(fromPrivateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fromPubKeyHex, err := eos.PubKeyToHex(fromKey.PublicKey().String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	transaction, digest, err := h.BuildUnsignedLockinTransaction(fromAcctName, fromPubKeyHex, toUserKey, toAcctName, big.NewInt(100), "")
 	if err != nil {
 		fmt.Printf("Error: %v\n\n", err.Error())
 	}
@@ -279,13 +317,10 @@ func test_eth () {
 	fmt.Printf("=========================\n           ETH           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("ETH")
 
-	//fromPrivateKey, _ := crypto.HexToECDSA("a751c37b0a6e4b7605512fefb28cd4bd141bc3c06863557624800140eddf13be")
-fromPrivateKey, _ := crypto.HexToECDSA("a751c37b0a6e4b7605512fefb28cd4bd141bc3c06863557624800140eddf13be")
+fromPrivateKey := mustECDSA(DEMO_ERC20_PRIVKEY)
 
-	//fromPrivateKey, _ := crypto.HexToECDSA("d55b502bd4867b2c1b505af9b7cefeeb910b6cfbb570e2e47680bc89ee123eab")
 
 
-//fromPrivateKey, _ := crypto.HexToECDSA("0ea7b1364bc2d1d58f35324b4c0deaa129cc9bd2728e0942e7592f2836cbb530")
 	pub := crypto.FromECDSAPub(&fromPrivateKey.PublicKey)
 	fromPubKeyHex := hex.EncodeToString(pub)
 	// test 724
@@ -311,7 +346,7 @@ func test_etc () {
 	fmt.Printf("=========================\n           ETC           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("ETC")
 
-	fromPrivateKey, _ := crypto.HexToECDSA("d55b502bd4867b2c1b505af9b7cefeeb910b6cfbb570e2e47680bc89ee123eab")
+	fromPrivateKey := mustECDSA(DEMO_ETH_PRIVKEY)
 	pub := crypto.FromECDSAPub(&fromPrivateKey.PublicKey)
 	fromPubKeyHex := hex.EncodeToString(pub)
 
@@ -324,7 +359,7 @@ func test_vechain () {
 	fmt.Printf("=========================\n           VECHAIN           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("VECHAIN")
 
-	fromPrivateKey, _ := crypto.HexToECDSA("d55b502bd4867b2c1b505af9b7cefeeb910b6cfbb570e2e47680bc89ee123eab")
+	fromPrivateKey := mustECDSA(DEMO_ETH_PRIVKEY)
 	pub := crypto.FromECDSAPub(&fromPrivateKey.PublicKey)
 	fromPubKeyHex := hex.EncodeToString(pub)
 
@@ -337,9 +372,7 @@ func test_erc20 () {
 	fmt.Printf("=========================\n           ERC20           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("ERC20GUSD")
 
-	fromPrivateKey, _ := crypto.HexToECDSA("a751c37b0a6e4b7605512fefb28cd4bd141bc3c06863557624800140eddf13be")
-//fromPrivateKey, _ := crypto.HexToECDSA("40d6e64ce085269869b178c23a786e499ff2d6a5334fe45964211d25bea973bf")
-//fromPrivateKey, _ := crypto.HexToECDSA("0ea7b1364bc2d1d58f35324b4c0deaa129cc9bd2728e0942e7592f2836cbb530")
+	fromPrivateKey := mustECDSA(DEMO_ERC20_PRIVKEY)
 
 	pub := crypto.FromECDSAPub(&fromPrivateKey.PublicKey)
 	fromPubKeyHex := hex.EncodeToString(pub)
@@ -348,7 +381,7 @@ func test_erc20 () {
 
 	toAddress := "0x426B635fD6CdAf5E4e7Bf5B2A2Dd7bc6c7360FBd"
 
-	build_tx_args := `"gasPrice":10000000000,"gasLimit":100000,"tokenType":"BNB"`
+	build_tx_args := `{"gasPrice":10000000000,"gasLimit":100000,"tokenType":"ERC20GUSD"}`
 
 	queryTxHash := "0xf9e16303a1b5a59b12e18be82aaed2363621844d8b78961db57d1af7aa89419f"
 
@@ -366,8 +399,8 @@ func test_erc20 () {
 func test_xrp () {
 	fmt.Printf("=========================\n           XRP           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("XRP")
-	fromKey := xrp.XRP_importKeyFromSeed("ssfL5tmpTTqCw5sHjnRHQ4yyUCQKf", "ecdsa")
-//fromKey := xrp.XRP_importKeyFromSeed("snVn7ZZnuQ5YjAGPZMD8xikMfE58z", "ecdsa")
+	seed := mustSecret(DEMO_XRP_SEED)
+	fromKey := xrp.XRP_importKeyFromSeed(seed, "ecdsa")
 	keyseq := uint32(0)
 	fromPubKeyHex := hex.EncodeToString(fromKey.Public(&keyseq))
 fmt.Printf("++++++++++++\nfromPubKeyHex is %v\n++++++++++++\n", fromPubKeyHex)
@@ -377,8 +410,7 @@ fmt.Printf("++++++++++++\nfromPubKeyHex is %v\n++++++++++++\n", fromPubKeyHex)
 //toAddress := "ran6MwG2XT4N7d5d35YUhPLZK8WVoe9tnV"
 //toAddress := "rwLc28nRV7WZiBv6vsHnpxUGAVcj8qpAtE"
 	build_tx_args := `{"fee":10}`
-	fromPrivateKey := "ssfL5tmpTTqCw5sHjnRHQ4yyUCQKf/0"
-//fromPrivateKey := "snVn7ZZnuQ5YjAGPZMD8xikMfE58z/0"
+	fromPrivateKey := seed + "/0"
 	queryTxHash := "48ED82C7B3DAD0B86533B18CB5CE2BEDCE8CD841AD8930C79F428AB053FBB41C"
 //queryTxHash := "50D0DA51DEB64590011D0BEDB852A811A96E5C9D3E8F162321777F31BBB30246" // lockin 100 drops
 	//queryAddress := "raF1e6TSKtB34MZ9USrKphQAW5hYbARFWK"
@@ -387,17 +419,10 @@ fmt.Printf("++++++++++++\nfromPubKeyHex is %v\n++++++++++++\n", fromPubKeyHex)
 	test_common (h, fromPrivateKey, fromPubKeyHex, fromAddress, toAddress, 100000000, build_tx_args, queryTxHash, queryAddress, "")
 }
 
-type Seed struct {}
-
-func (s *Seed) Read(p []byte) (n int, err error) {
-	n = 5
-	return
-}
-
 func test_tron() {
 	fmt.Printf("=========================\n           TRX           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("TRX")
-	fromPrivateKey, _ := ecdsa.GenerateKey(crypto.S256(), &Seed{})
+	fromPrivateKey := mustECDSA(DEMO_TRX_PRIVKEY)
 	fromPubKeyHex := trx.PublicKeyToHex(&trx.PublicKey{&fromPrivateKey.PublicKey})
 	fromAddress := "417e5f4552091a69125d5dfcb7b8c2659029395bdf"
 	toAddress := "41368832d8820cf4bc4f0115975e3399348c8e0249"
@@ -411,7 +436,7 @@ func test_tron() {
 func test_atom() {
 	fmt.Printf("=========================\n           COSMOSATOM           \n=========================\n\n")
 	h := api.NewCryptocoinHandler("ATOM")
-	fromPrivateKey, _ := crypto.HexToECDSA("d55b502bd4867b2c1b505af9b7cefeeb910b6cfbb570e2e47680bc89ee123eab")
+	fromPrivateKey := mustECDSA(DEMO_ETH_PRIVKEY)
 	pub := crypto.FromECDSAPub(&fromPrivateKey.PublicKey)
 	fromPubKeyHex := hex.EncodeToString(pub)
 	queryTxHash := "2A5BDD86133119F3CC3AD7BFAB986BCF8B5B7F25AA92A2A644D6B481DBBAC765"
@@ -421,7 +446,7 @@ func test_atom() {
 
 func test_evt() {
 	h := api.NewCryptocoinHandler("EVT1")
-	fromPrivateKey := "93N2nFzgr1cPRU8ppswy8HrgBMaoba8aH5sGZn9NdgG9weRFrA1"
+	fromPrivateKey := mustSecret(DEMO_BTC_WIF)
 	fromPubKeyHex := "04c1a8dd2d6acd8891bddfc02bc4970a0569756ed19a2ed75515fa458e8cf979fdef6ebc5946e90a30c3ee2c1fadf4580edb1a57ad356efd7ce3f5c13c9bb4c78f"
 	fromAddress := "EVT8JXJf7nuBEs8dZ8Pc5NpS8BJJLt6bMAmthWHE8CSqzX4VEFKtq"
 	//toAddress := "EVT8PqiA7nqhaEoPXkb3zD14XK4TGugKBw3HqnkhZsvS69KrveXam"
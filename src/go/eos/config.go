@@ -1,37 +1,62 @@
 package eos
 import (
+	"time"
+
 	eos "github.com/eoscanada/eos-go"
 
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/secrets"
 )
 
-var (
-	nodeos = config.ApiGateways.EosGateway.Nodeos
+// 包级函数 (BuyRAM, CreateNewAccount 等) 使用默认网关, handler 使用自己网络的网关
+// 每次调用时读取, 之后加载的配置文件也会生效
+func defaultNodeos() string {
+	return config.Current().EosGateway.Nodeos
+}
 
-	opts = &eos.TxOptions{
-		ChainID: hexToChecksum256(config.ApiGateways.EosGateway.ChainID),
+// 每笔交易新建 TxOptions, HeadBlockID 不在交易之间共享
+func newTxOptions(chainID string) *eos.TxOptions {
+	return &eos.TxOptions{
+		ChainID: hexToChecksum256(chainID),
 		MaxNetUsageWords: uint32(999),
 		//DelaySecs: uint32(120),
 		MaxCPUUsageMS: uint8(200),
 		Compress: eos.CompressionNone,
 	}
-)
+}
 
+func defaultTxOptions() *eos.TxOptions {
+	return newTxOptions(config.Current().EosGateway.ChainID)
+}
+
+// 创建账户使用的 creator 账户, 它的 active 私钥从 secret CREATOR_PRIVKEY_SECRET 读取
 const CREATOR_ACCOUNT = "gzx123454321"
 
-const CREATOR_PRIVKEY = "5JqBVZS4shWHBhcht6bn3ecWDoZXPk3TRSVpsLriQz5J3BKZtqH"
+const CREATOR_PRIVKEY_SECRET = "EOS_CREATOR_PRIVKEY"
+
+// CreatorPrivKey 返回 creator 账户的 active 私钥 (WIF), 见 secrets.Lookup
+func CreatorPrivKey() (string, error) {
+	return secrets.Lookup(CREATOR_PRIVKEY_SECRET)
+}
+
+// 金额的小数位数, EOS_ACCURACY = 10^Decimals
+const Decimals = 4
 
 const EOS_ACCURACY = 10000
 
 const ALPHABET = "defghijklmnopqrstuvwxyz12345abcdefghijklmnopqrstuvwxyz12345abc"
 
-var BALANCE_SERVER = config.ApiGateways.EosGateway.BalanceTracker
-
 var InitialRam = uint32(256)
 
 var InitialCPU = int64(1000)
 
 var InitialStakeNet = int64(1000)
 
+// 交易的过期时间从引用区块的时间算起, 离线签名需要更长时间时调大, nodeos 最多接受 1 小时
+var TxExpiration = 30 * time.Second
+
+// get_info 返回的 head_block_time 格式, UTC
+const HeadBlockTimeLayout = "2006-01-02T15:04:05.999999999"
+
 
 
@@ -1,16 +1,16 @@
 package eos
 import (
+	"context"
 	//"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
-	"io/ioutil"
 	"fmt"
 	"math/big"
-	"net/http"
-	"strconv"
-	//"strings"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcutil"
 	eos "github.com/eoscanada/eos-go"
 	"github.com/eoscanada/eos-go/ecc"
@@ -18,15 +18,59 @@ import (
 	"github.com/eoscanada/eos-go/token"
 	"github.com/rubblelabs/ripple/crypto"
 
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
 	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
+// 默认网络
+const DefaultNetwork = types.Testnet
+
+// 账户名和网络无关, 网络决定 nodeos 和 chain id
+var networks = map[types.Network]bool{
+	types.Mainnet: true,
+	types.Testnet: true,
+}
+
 type EOSHandler struct {
+	network types.Network
+	nodeos string
+	chainID string
+	balanceServer string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
 }
 
 func NewEOSHandler () *EOSHandler {
-	return &EOSHandler{}
+	h, _ := NewEOSHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewEOSHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewEOSHandlerForNetwork (network types.Network) (*EOSHandler, error) {
+	return NewEOSHandlerFromConfig(network, config.Current())
+}
+
+// NewEOSHandlerFromConfig 创建 network 的 handler, nodeos, chain id 使用 gateways 里 network 的 EosGateway
+func NewEOSHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*EOSHandler, error) {
+	network = network.Or(DefaultNetwork)
+	if !networks[network] {
+		return nil, types.UnsupportedNetworkError("EOS", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).EosGateway
+	rpcutils.RegisterEosGateway(gateway, gateways.HealthCheckInterval())
+	return &EOSHandler{
+		network: network,
+		nodeos: gateway.Nodeos,
+		chainID: gateway.ChainID,
+		balanceServer: gateway.BalanceTracker,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *EOSHandler) Network() types.Network {
+	return h.network
 }
 
 var EOS_DEFAULT_FEE, _ = new(big.Int).SetString("1",10)
@@ -37,92 +81,281 @@ func (h *EOSHandler) GetDefaultFee() *big.Int {
 
 // 用一个大账户存钱，用交易备注区分用户，交易备注是公钥hash+base58
 func (h *EOSHandler) PublicKeyToAddress(pubKeyHex string) (acctName string, err error) {
+	// 账户名是公钥编码的 hash160, 压缩和非压缩公钥得到不同的账户名
+	pubKeyHex, err = signature.NormalizePublicKey(pubKeyHex)
+	if err != nil {
+		return
+	}
 	acctName = GenAccountName(pubKeyHex)
 	return
 }
 
 // 构造交易
 func (h *EOSHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAcctName string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAcctName, amount, jsonstring)
+}
+
+func (h *EOSHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAcctName string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAcctName, amount, opts)
+}
+
+var SupportedBuildOptions = []string{types.OptMemo}
+
+func (h *EOSHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *EOSHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: true,
+		Balance: true,
+		MultiOutput: true,
+		Memo: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			return networks[n]
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *EOSHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "EOS",
+		Decimals: Decimals,
+		SLIP44: 194,
+		AddressFormat: types.AddressEOSAccount,
+	}
+}
+
+// 默认的 memo 是 fromPublicKey 生成的用户名, 用来区分大账户下的用户
+func (h *EOSHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAcctName string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, []types.TxOutput{{ToAddress: toAcctName, Amount: amount}}, opts)
+}
+
+func (h *EOSHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		return
+	}
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 head block 作为交易的引用区块
+func (h *EOSHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if err := opts.Check("EOS", SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	ref, err := getRefBlock(ctx, h.nodeos)
+	if err != nil {
+		return nil, err
+	}
+	state := types.NewChainState("EOS", h.network.String())
+	state.ChainID = h.chainID
+	state.RefBlock = ref
+	return state, nil
+}
+
+// Assemble 用 state 的引用区块构造交易, 过期时间是区块时间加 TxExpiration, 不访问网络
+func (h *EOSHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	if err = state.Check("EOS", h.network.String()); err != nil {
+		return
+	}
+	if err = opts.Check("EOS", SupportedBuildOptions...); err != nil {
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	for i, out := range outputs {
+		if err = checkAccountName(out.ToAddress); err != nil {
+			err = fmt.Errorf("output %v: %w", i, err)
+			return
+		}
+	}
+	if state.ChainID != "" && state.ChainID != h.chainID {
+		err = fmt.Errorf("chain state chain id mismatch: got %v, want %v", state.ChainID, h.chainID)
+		return
+	}
 	memo := GenAccountName(fromPublicKey)
-	digest, transaction, err := EOS_newUnsignedTransaction(fromAddress, toAcctName, amount, memo)
+	if opts != nil && opts.Memo != nil {
+		memo = *opts.Memo
+	}
+	digest, stx, err := assembleBatchTransaction(h.chainID, state.RefBlock, fromAddress, outputs, memo)
+	if err != nil {
+		return
+	}
+	transaction = &UnsignedTransaction{Tx: stx, PublicKey: fromPublicKey}
 	digests = append(digests, digest)
 	return
 }
 
-// 构造Lockin交易, 开发用
-func (h *EOSHandler) BuildUnsignedLockinTransaction(fromAddress, toUserKey, toAcctName string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+// checkAccountName 检查账户名只包含 eos 账户名的字符, GenAccountName 生成的账户名超过 12 个字符, 不检查长度
+func checkAccountName(name string) error {
+	if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz12345.") != "" {
+		return types.Errorf(types.ErrInvalidAddress, "invalid account name %v", name)
+	}
+	return nil
+}
+
+// 构造Lockin交易, 开发用, fromPublicKey 用于 MakeSignedTransaction 校验签名
+func (h *EOSHandler) BuildUnsignedLockinTransaction(fromAddress, fromPublicKey, toUserKey, toAcctName string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
 	memo := toUserKey
-	digest, transaction, err := EOS_newUnsignedTransaction(fromAddress, toAcctName, amount, memo)
+	digest, stx, err := newUnsignedBatchTransaction(context.Background(), h.nodeos, h.chainID, fromAddress, []types.TxOutput{{ToAddress: toAcctName, Amount: amount}}, memo)
+	if err != nil {
+		return
+	}
+	transaction = &UnsignedTransaction{Tx: stx, PublicKey: fromPublicKey}
 	digests = append(digests, digest)
 	return
 }
 
 func (h *EOSHandler) SignTransaction(hash []string, privateKey interface{}) (rsv []string, err error) {
-	signature, err := SignDigestWithPrivKey(hash[0], privateKey.(string))
+	eccsig, err := SignDigestWithPrivKey(hash[0], privateKey.(string))
+	if err != nil {
+		return
+	}
+	sig, err := signature.ParseEOS(eccsig)
 	if err != nil {
 		return
 	}
-	vrs := signature.Content
-	v := vrs[0] - byte(31)
-	rsvBytes := append(vrs[1:], v)
-	rsv = append(rsv, hex.EncodeToString(rsvBytes))
+	rsv = append(rsv, sig.String())
 	return
 }
 
+// MakeSignedTransaction 校验签名是构造交易时的公钥签的, 失败返回 *types.SignatureError
 func (h *EOSHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
-	signature, err := RSVToSignature(rsv[0])
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", transaction)
+		return
+	}
+	rs, err := utx.checkSignature(h.chainID, rsv)
 	if err != nil {
 		return
 	}
-	signedTransaction = MakeSignedTransaction(transaction.(*eos.SignedTransaction), signature)
+	sig, err := rs.EOS()
+	if err != nil {
+		return
+	}
+	signedTransaction = MakeSignedTransaction(utx.Tx, sig)
 	return
 }
 
+func (h *EOSHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *EOSHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
-	txhash = SubmitTransaction(signedTransaction.(*eos.SignedTransaction))
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *EOSHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	stx, ok := signedTransaction.(*eos.SignedTransaction)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	ret, err := submitTransaction(ctx, h.nodeos, stx)
+	if err != nil {
+		return
+	}
+	var res struct {
+		TransactionID string `json:"transaction_id"`
+	}
+	if err = json.Unmarshal([]byte(ret), &res); err != nil {
+		return
+	}
+	txhash = res.TransactionID
 	return
 }
 
 func (h *EOSHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+// GetTransactionInfoContext 解析 history 插件的 get_transaction, 交易在 trx.trx 里
+// 只返回 eosio.token 的 EOS transfer, 每个 action 一个输出
+func (h *EOSHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
 	api := "v1/history/get_transaction"
 	data := `{"id":"` + txhash + `","block_num_hint":"0"}`
-	ret := rpcutils.DoCurlRequest(nodeos, api, data)
+	ret, err := nodeosCall(ctx, h.nodeos, api, data)
+	if err != nil {
+		return
+	}
 	var retStruct map[string]interface{}
 	json.Unmarshal([]byte(ret), &retStruct)
 	if retStruct["trx"] == nil {
-		if reterr := retStruct["error"]; reterr != nil {
-			name := reterr.(map[string]interface{})["name"]
-			details := reterr.(map[string]interface{})["details"].([]interface{})
-			var message string
-			if details != nil {
-				message = details[0].(map[string]interface{})["message"].(string)
-			}
-			err = fmt.Errorf("%v, message: %v", name, message)
+		if reterr, ok := retStruct["error"].(map[string]interface{}); ok && len(reterr) > 0 {
+			err = apiError(reterr)
 			return
 		}
-		err = fmt.Errorf("  %v", ret)
+		err = types.ClassifyError(fmt.Errorf("  %v", ret))
 		return
 	}
-	tfData := retStruct["trx"].(map[string]interface{})["actions"].([]interface{})[0].(map[string]interface{})["data"].(map[string]interface{})
-	fromAddress = tfData["from"].(string)
-	toAddress := tfData["receiver"].(string)
-	transferAmount := big.NewInt(int64(tfData["transfer"].(float64)))
-	txOutput := types.TxOutput{
-		ToAddress: toAddress,
-		Amount: transferAmount,
+	// 批量交易有多个 action, 每个 action 一个输出
+	actions := retStruct["trx"].(map[string]interface{})["trx"].(map[string]interface{})["actions"].([]interface{})
+	for _, act := range actions {
+		actm := act.(map[string]interface{})
+		if actm["account"] != "eosio.token" || actm["name"] != "transfer" {
+			continue
+		}
+		tfData := actm["data"].(map[string]interface{})
+		quantity := tfData["quantity"].(string)
+		if !strings.HasSuffix(quantity, " EOS") {
+			continue
+		}
+		transferAmount, e := types.ParseUnits(strings.TrimSuffix(quantity, " EOS"), Decimals)
+		if e != nil {
+			err = e
+			return
+		}
+		fromAddress = tfData["from"].(string)
+		txOutput := types.TxOutput{
+			ToAddress: tfData["to"].(string),
+			Amount: transferAmount,
+		}
+		txOutputs = append(txOutputs, txOutput)
 	}
-	txOutputs = append(txOutputs, txOutput)
 	return
 }
 
 func (h *EOSHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	req := BALANCE_SERVER + "get_balance?user_key=" + address
-	resp, err := http.Get(req)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *EOSHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	body, err := rpcutils.Get(ctx, h.balanceServer, "get_balance?user_key=" + url.QueryEscape(address))
 	if err != nil {
 		return
 	}
@@ -131,11 +364,13 @@ func (h *EOSHandler) GetAddressBalance(address string, jsonstring string) (balan
 	if err != nil {
 		return
 	}
-	bal := b.(map[string]interface{})["balance"]
-	if bal == nil {
+	m, _ := b.(map[string]interface{})
+	bal, _ := m["balance"].(string)
+	if bal == "" {
+		err = types.Errorf(types.ErrNotFound, "cannot get balance of %v: %s", address, body)
 		return
 	}
-	balance, ok := new(big.Int).SetString(bal.(string), 10)
+	balance, ok := new(big.Int).SetString(bal, 10)
 	if !ok {
 		err = fmt.Errorf("parse balance error, got: %+v", bal)
 	}
@@ -149,6 +384,22 @@ func checkErr(err error) {
 	}
 }
 
+// nodeosCall 把 json 请求 data POST 到 nodeos 的 api
+// nodeos 出错时返回 500 和 json 格式的 error, 这时返回 apiError 分类后的错误
+func nodeosCall(ctx context.Context, nodeos, api, data string) (string, error) {
+	ret, err := rpcutils.PostJSON(ctx, nodeos, api, data)
+	if err != nil {
+		var res struct {
+			Error map[string]interface{} `json:"error"`
+		}
+		if json.Unmarshal(ret, &res) == nil && len(res.Error) > 0 {
+			return "", apiError(res.Error)
+		}
+		return "", err
+	}
+	return string(ret), nil
+}
+
 func checkAPIErr(res string) error {
 	var v interface{}
 	err := json.Unmarshal([]byte(res), &v)
@@ -158,37 +409,54 @@ func checkAPIErr(res string) error {
 	m := v.(map[string]interface{})
 	if m["error"] != nil {
 		if errm := m["error"].(map[string]interface{}); len(errm) > 0 {
-			err = fmt.Errorf(errm["name"].(string), errm)
-			return err
+			return apiError(errm)
 		}
 	}
 	return nil
 }
 
-func IsCanonical(compactSig []byte) bool {
-	fmt.Printf("========= IsCanonical =========\n%v\n", compactSig)
-	// From EOS's codebase, our way of doing Canonical sigs.
-	// https://steemit.com/steem/@dantheman/steem-and-bitshares-cryptographic-security-update
-	//
-	// !(c.data[1] & 0x80)
-	// && !(c.data[1] == 0 && !(c.data[2] & 0x80))
-	// && !(c.data[33] & 0x80)
-	// && !(c.data[33] == 0 && !(c.data[34] & 0x80));
+// nodeos 的错误名
+var apiErrorKinds = map[string]error{
+	"tx_duplicate": types.ErrAlreadyKnown,
+	"tx_cpu_usage_exceeded": types.ErrInsufficientFunds,
+	"tx_net_usage_exceeded": types.ErrInsufficientFunds,
+	"ram_usage_exceeded": types.ErrInsufficientFunds,
+	"tx_not_found": types.ErrNotFound,
+}
 
-	d := compactSig
-	fmt.Printf("d is %v\n", d)
-	t1 := (d[1] & 0x80) == 0
-	t2 := !(d[1] == 0 && ((d[2] & 0x80) == 0))
-	t3 := (d[33] & 0x80) == 0
-	t4 := !(d[33] == 0 && ((d[34] & 0x80) == 0))
+// errm 形如 {"code":3040008,"name":"tx_duplicate","what":"Duplicate transaction","details":[{"message":..}]}
+func apiError(errm map[string]interface{}) error {
+	name, _ := errm["name"].(string)
+	var message string
+	if details, ok := errm["details"].([]interface{}); ok && len(details) > 0 {
+		if d, ok := details[0].(map[string]interface{}); ok {
+			message, _ = d["message"].(string)
+		}
+	}
+	if message == "" {
+		message, _ = errm["what"].(string)
+	}
+	err := fmt.Errorf("%v, message: %v", name, message)
+	if kind, ok := apiErrorKinds[name]; ok {
+		return types.WrapError(kind, err)
+	}
+	return types.ClassifyError(err)
+}
 
-	return t1 && t2 && t3 && t4
+// IsCanonical 检查紧凑签名是否满足 eos 节点的 canonical 规则, 见 signature.RSV.IsEOSCanonical
+func IsCanonical(compactSig []byte) bool {
+	sig, err := signature.ParseCompact(compactSig)
+	return err == nil && sig.IsEOSCanonical()
 }
 
 func GetHeadBlockID(nodeos string) (chainID string, err error) {
+	return GetHeadBlockIDContext(context.Background(), nodeos)
+}
+
+func GetHeadBlockIDContext(ctx context.Context, nodeos string) (chainID string, err error) {
 	api := "v1/chain/get_info"
-	res := rpcutils.DoCurlRequest(nodeos, api, "")
-	if err = checkAPIErr(res); err != nil {
+	res, err := nodeosCall(ctx, nodeos, api, "")
+	if err != nil {
 		return "", err
 	}
 	var v interface{}
@@ -197,6 +465,27 @@ func GetHeadBlockID(nodeos string) (chainID string, err error) {
 	return fmt.Sprintf("%v",m["head_block_id"]), nil
 }
 
+// getRefBlock 用 get_info 查询 head block 的 id, 高度和时间
+func getRefBlock(ctx context.Context, nodeos string) (*types.RefBlock, error) {
+	res, err := nodeosCall(ctx, nodeos, "v1/chain/get_info", "")
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		HeadBlockNum uint64 `json:"head_block_num"`
+		HeadBlockID string `json:"head_block_id"`
+		HeadBlockTime string `json:"head_block_time"`
+	}
+	if err := json.Unmarshal([]byte(res), &info); err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(HeadBlockTimeLayout, info.HeadBlockTime)
+	if err != nil {
+		return nil, fmt.Errorf("parse head block time error: %v", err)
+	}
+	return &types.RefBlock{Number: info.HeadBlockNum, ID: info.HeadBlockID, Timestamp: t.Unix()}, nil
+}
+
 func PubKeyToHex(pk string) (pubKeyHex string, _ error) {
 	pubKey, err := ecc.NewPublicKey(pk)
 	if err != nil {
@@ -207,38 +496,17 @@ func PubKeyToHex(pk string) (pubKeyHex string, _ error) {
 }
 
 func HexToPubKey(pubKeyHex string) (ecc.PublicKey, error) {
-	fmt.Printf("hex is %v\nlen(hex) is %v\n\n", pubKeyHex, len(pubKeyHex))
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	// TODO 判断长度
-	if len(pubKeyHex) == 130 {
-		uBytes, err := hex.DecodeString(pubKeyHex)
-		if err != nil {
-			return ecc.PublicKey{}, err
-		}
-		pubkey, err := btcec.ParsePubKey(uBytes, btcec.S256())
-		if err != nil {
-			return ecc.PublicKey{}, err
-		}
-		pubkeyBytes := pubkey.SerializeCompressed()
-		pubkeyBytes = append([]byte{0}, pubkeyBytes...)  // byte{0} 表示 curve K1, byte{1} 表示 curve R1
-		return ecc.NewPublicKeyFromData(pubkeyBytes)
-	}
-
-	if len(pubKeyHex) == 66 {
-		pubkeyBytes, _ := hex.DecodeString(pubKeyHex)
-		pubkeyBytes = append([]byte{0}, pubkeyBytes...)
-		return ecc.NewPublicKeyFromData(pubkeyBytes)
+	pubkey, err := signature.ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return ecc.PublicKey{}, err
 	}
-
-	return ecc.PublicKey{}, fmt.Errorf("unexpected public key length  %v", len(pubKeyHex))
+	pubkeyBytes := append([]byte{0}, pubkey.SerializeCompressed()...)  // byte{0} 表示 curve K1, byte{1} 表示 curve R1
+	return ecc.NewPublicKeyFromData(pubkeyBytes)
 }
 
 func SignDigestWithPrivKey(hash, wif string) (ecc.Signature, error) {
 	digest := hexToChecksum256(hash)
 	privKey, err := ecc.NewPrivateKey(wif)
-fmt.Printf("private key is %+v\n\n", privKey)
 	checkErr(err)
 	return privKey.Sign(digest)
 }
@@ -246,8 +514,8 @@ fmt.Printf("private key is %+v\n\n", privKey)
 func GetAccountNameByPubKey(pubKey string) ([]string, error) {
 	api := "v1/history/get_key_accounts"
 	data := "{\"public_key\":\"" + pubKey + "\"}"
-	res := rpcutils.DoCurlRequest(nodeos, api, data)
-	if err := checkAPIErr(res); err != nil {
+	res, err := nodeosCall(context.Background(), defaultNodeos(), api, data)
+	if err != nil {
 		return nil, err
 	}
 	var v interface{}
@@ -263,17 +531,11 @@ func GetAccountNameByPubKey(pubKey string) ([]string, error) {
 
 // dcrm签的rsv转传换成eos签名
 func RSVToSignature (rsvStr string) (ecc.Signature, error) {
-//fmt.Printf("1111 rsvStr is %v\n\n", rsvStr)
-	rsv, _ := hex.DecodeString(rsvStr)
-	rsv[64] += byte(31)
-//fmt.Printf("rsv is %v\n\n", rsv)
-	v := rsv[64]
-//fmt.Printf("v is %v\n\n", v)
-	rs := rsv[:64]
-	vrs := append([]byte{v}, rs...)
-//fmt.Printf("1111 vrs is %v\n\n", hex.EncodeToString(vrs))
-	data := append([]byte{0}, vrs...)
-	return ecc.NewSignatureFromData(data)
+	sig, err := signature.ParseRSV(rsvStr)
+	if err != nil {
+		return ecc.Signature{}, err
+	}
+	return sig.EOS()
 }
 
 func HexToChecksum256(data string) eos.Checksum256 {
@@ -289,7 +551,6 @@ func hexToChecksum256(data string) eos.Checksum256 {
 // 根据公钥生成地址
 func GenAccountName(pubKeyHex string) string {
 	b, _ := hex.DecodeString(pubKeyHex)
-	fmt.Printf("!!! %v \n!!! %v\n\n", pubKeyHex, b)
 
 	b = btcutil.Hash160(b)
 
@@ -298,38 +559,66 @@ func GenAccountName(pubKeyHex string) string {
 }
 
 func EOS_newUnsignedTransaction(fromAcctName, toAcctName string, amount *big.Int, memo string) (string, *eos.SignedTransaction, error) {
-	from := eos.AccountName(fromAcctName)
-	to := eos.AccountName(toAcctName)
-	s := strconv.FormatFloat(float64(amount.Int64())/10000, 'f', 4, 64) + " EOS"
-	quantity, _ := eos.NewAsset(s)
+	return EOS_newUnsignedTransactionContext(context.Background(), fromAcctName, toAcctName, amount, memo)
+}
 
-	transfer := &eos.Action{
-		Account: eos.AN("eosio.token"),
-		Name:    eos.ActN("transfer"),
-		Authorization: []eos.PermissionLevel{
-			{
-				Actor: from,
-				Permission: eos.PN("active"),
-			},
-		},
-		ActionData: eos.NewActionData(token.Transfer{
-			From:     from,
-			To:       to,
-			Quantity: quantity,
-			Memo:     memo,
-		}),
-	}
+func EOS_newUnsignedTransactionContext(ctx context.Context, fromAcctName, toAcctName string, amount *big.Int, memo string) (string, *eos.SignedTransaction, error) {
+	return EOS_newUnsignedBatchTransactionContext(ctx, fromAcctName, []types.TxOutput{{ToAddress: toAcctName, Amount: amount}}, memo)
+}
 
-        var actions []*eos.Action
-        actions = append(actions, transfer)
+// 每个收款人一个 eosio.token transfer action, 放在同一笔交易里
+func EOS_newUnsignedBatchTransactionContext(ctx context.Context, fromAcctName string, outputs []types.TxOutput, memo string) (string, *eos.SignedTransaction, error) {
+	return newUnsignedBatchTransaction(ctx, defaultNodeos(), config.Current().EosGateway.ChainID, fromAcctName, outputs, memo)
+}
 
-	// 获取 head block id
-	hbid, err := GetHeadBlockID(nodeos)
+func newUnsignedBatchTransaction(ctx context.Context, nodeos, chainID string, fromAcctName string, outputs []types.TxOutput, memo string) (string, *eos.SignedTransaction, error) {
+	// 获取 head block
+	ref, err := getRefBlock(ctx, nodeos)
 	if err != nil {
 		return "", nil, err
 	}
-	opts.HeadBlockID = hexToChecksum256(hbid)
+	return assembleBatchTransaction(chainID, ref, fromAcctName, outputs, memo)
+}
+
+// assembleBatchTransaction 用 ref 作为引用区块构造交易, 不访问网络
+func assembleBatchTransaction(chainID string, ref *types.RefBlock, fromAcctName string, outputs []types.TxOutput, memo string) (string, *eos.SignedTransaction, error) {
+	if ref == nil {
+		return "", nil, types.MissingStateError("ref block")
+	}
+	from := eos.AccountName(fromAcctName)
+
+        var actions []*eos.Action
+	for _, out := range outputs {
+		to := eos.AccountName(out.ToAddress)
+		s := types.FormatUnits(out.Amount, Decimals) + " EOS"
+		quantity, err := eos.NewAsset(s)
+		if err != nil {
+			return "", nil, err
+		}
+
+		transfer := &eos.Action{
+			Account: eos.AN("eosio.token"),
+			Name:    eos.ActN("transfer"),
+			Authorization: []eos.PermissionLevel{
+				{
+					Actor: from,
+					Permission: eos.PN("active"),
+				},
+			},
+			ActionData: eos.NewActionData(token.Transfer{
+				From:     from,
+				To:       to,
+				Quantity: quantity,
+				Memo:     memo,
+			}),
+		}
+		actions = append(actions, transfer)
+	}
+
+	opts := newTxOptions(chainID)
+	opts.HeadBlockID = hexToChecksum256(ref.ID)
         tx := eos.NewTransaction(actions, opts)
+	tx.Expiration = eos.JSONTime{Time: time.Unix(ref.Timestamp, 0).UTC().Add(TxExpiration)}
 
 	stx := eos.NewSignedTransaction(tx)
 
@@ -345,14 +634,22 @@ func MakeSignedTransaction(stx *eos.SignedTransaction, signature ecc.Signature)
 	return stx
 }
 
-func SubmitTransaction (stx *eos.SignedTransaction) string {
+// SubmitTransaction 把交易发给默认配置的 nodeos, 返回 push_transaction 的响应
+func SubmitTransaction (stx *eos.SignedTransaction) (string, error) {
+	return SubmitTransactionContext(context.Background(), stx)
+}
+
+func SubmitTransactionContext (ctx context.Context, stx *eos.SignedTransaction) (string, error) {
+	return submitTransaction(ctx, defaultNodeos(), stx)
+}
+
+func submitTransaction (ctx context.Context, nodeos string, stx *eos.SignedTransaction) (string, error) {
 
 	txjson := stx.String()
 
 	b := "{\"signatures\":[\"" + stx.Signatures[0].String() + "\"], \"compression\":\"none\", \"transaction\":" + txjson + "}"
 
-	res := rpcutils.DoCurlRequest(nodeos, "v1/chain/push_transaction", b)
-	return res
+	return nodeosCall(ctx, nodeos, "v1/chain/push_transaction", b)
 }
 
 func BuyRAM(creatorName string, creatorActivePrivKey string, accountName string, buyram uint32) (bool, error) {
@@ -361,8 +658,9 @@ func BuyRAM(creatorName string, creatorActivePrivKey string, accountName string,
 	action := system.NewBuyRAMBytes(eos.AccountName(creatorName), eos.AccountName(accountName), buyram)
 
 	// 获取 head block id
-	hbid, err := GetHeadBlockID(nodeos)
+	hbid, err := GetHeadBlockID(defaultNodeos())
 	checkErr(err)
+	opts := defaultTxOptions()
 	opts.HeadBlockID = hexToChecksum256(hbid)
 
 	// 创建账户和买内存一定要同时执行
@@ -388,13 +686,21 @@ func BuyRAM(creatorName string, creatorActivePrivKey string, accountName string,
 
         b := "{\"signatures\":[\"" + stx.Signatures[0].String() + "\"], \"compression\":\"none\", \"transaction\":" + txjson + "}"
 
-        res := rpcutils.DoPostRequest(nodeos, "v1/chain/push_transaction", b)
-	if err = checkAPIErr(res); err != nil {
+        if _, err = nodeosCall(context.Background(), defaultNodeos(), "v1/chain/push_transaction", b); err != nil {
 		return false, err
 	}
 return true, nil
 }
 
+// CreateAccount 用 CREATOR_ACCOUNT 创建eos账户, creator 的私钥见 CreatorPrivKey
+func CreateAccount(accountName, ownerkey, activekey string, buyram uint32) (bool, error) {
+	privKey, err := CreatorPrivKey()
+	if err != nil {
+		return false, err
+	}
+	return CreateNewAccount(CREATOR_ACCOUNT, privKey, accountName, ownerkey, activekey, buyram)
+}
+
 // 创建eos账户
 // 需要一个creator账户, creator要有余额用于购买内存
 func CreateNewAccount(creatorName, creatorActivePrivKey, accountName, ownerkey, activekey string, buyram uint32) (bool, error) {
@@ -443,8 +749,9 @@ func CreateNewAccount(creatorName, creatorActivePrivKey, accountName, ownerkey,
 	action2 := system.NewBuyRAMBytes(eos.AccountName(creatorName), eos.AccountName(accountName), buyram)
 
 	// 获取 head block id
-	hbid, err := GetHeadBlockID(nodeos)
+	hbid, err := GetHeadBlockID(defaultNodeos())
 	checkErr(err)
+	opts := defaultTxOptions()
 	opts.HeadBlockID = hexToChecksum256(hbid)
 
 	// 创建账户和买内存一定要同时执行
@@ -470,8 +777,7 @@ func CreateNewAccount(creatorName, creatorActivePrivKey, accountName, ownerkey,
 
         b := "{\"signatures\":[\"" + stx.Signatures[0].String() + "\"], \"compression\":\"none\", \"transaction\":" + txjson + "}"
 
-        res := rpcutils.DoPostRequest(nodeos, "v1/chain/push_transaction", b)
-	if err = checkAPIErr(res); err != nil {
+        if _, err = nodeosCall(context.Background(), defaultNodeos(), "v1/chain/push_transaction", b); err != nil {
 		return false, err
 	}
 return true, nil
@@ -485,8 +791,9 @@ func DelegateBW (fromAcctName, fromActivePrivKey, receiverName string, stakeCPU,
 	action := system.NewDelegateBW(from, receiver, eos.NewEOSAsset(stakeCPU), eos.NewEOSAsset(stakeNet), transfer)
 
 	// 获取 head block id
-	hbid, err := GetHeadBlockID(nodeos)
+	hbid, err := GetHeadBlockID(defaultNodeos())
 	checkErr(err)
+	opts := defaultTxOptions()
 	opts.HeadBlockID = hexToChecksum256(hbid)
 
 	actions := []*eos.Action{action}
@@ -504,8 +811,7 @@ func DelegateBW (fromAcctName, fromActivePrivKey, receiverName string, stakeCPU,
 
 	txjson := stx.String()
 	b := "{\"signatures\":[\"" + stx.Signatures[0].String() + "\"], \"compression\":\"none\", \"transaction\":" + txjson + "}"
-	res := rpcutils.DoPostRequest(nodeos, "v1/chain/push_transaction", b)
-	if err = checkAPIErr(res); err != nil {
+	if _, err = nodeosCall(context.Background(), defaultNodeos(), "v1/chain/push_transaction", b); err != nil {
 		return false, err
 	}
 return true, nil
@@ -517,3 +823,27 @@ func AddActivePubkey (accountName,owner,ownerprivate string) string {
 	
 	return ""
 }
+
+// payload 是 eos 二进制编码的 UnsignedTransaction, 包括构造交易的公钥
+func (h *EOSHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	payload, err := encodeUnsignedTransaction(transaction)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxEnvelope("EOS", h.network.String(), digests, payload), nil
+}
+
+func (h *EOSHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("EOS", h.network.String()); err != nil {
+		return
+	}
+	if err = env.CheckMinVersion(types.TxEnvelopeSignerVersion); err != nil {
+		return
+	}
+	utx, err := decodeUnsignedTransaction(env.Payload)
+	if err != nil {
+		return
+	}
+	transaction = utx
+	return
+}
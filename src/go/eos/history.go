@@ -0,0 +1,127 @@
+package eos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetAddressHistory 用 history 插件的 get_actions 查询账户的 eosio.token EOS 转账
+// address 可以是账户名, 也可以是公钥, 公钥用 get_key_accounts 找到第一个账户
+// 游标是下一页最新一条 action 的 account_action_seq
+func (h *EOSHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	account, err := h.accountName(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	pos := int64(-1)
+	if page.Cursor != "" {
+		if pos, err = strconv.ParseInt(page.Cursor, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid cursor %v", page.Cursor)
+		}
+	}
+	// offset 为负时返回 pos+offset 到 pos 的 action
+	offset := 1 - page.PageLimit()
+	data := fmt.Sprintf(`{"account_name":"%v","pos":%d,"offset":%d}`, account, pos, offset)
+	ret, err := nodeosCall(ctx, h.nodeos, "v1/history/get_actions", data)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Actions []struct {
+			AccountActionSeq int64 `json:"account_action_seq"`
+			BlockNum uint64 `json:"block_num"`
+			BlockTime string `json:"block_time"`
+			ActionTrace struct {
+				TrxId string `json:"trx_id"`
+				Act struct {
+					Account string `json:"account"`
+					Name string `json:"name"`
+					Data json.RawMessage `json:"data"`
+				} `json:"act"`
+			} `json:"action_trace"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return nil, err
+	}
+	hist := &types.HistoryPage{}
+	// get_actions 从旧到新排列, 同一笔转账会通知多个账户, 按交易和序号去重
+	seen := make(map[string]bool)
+	for i := len(res.Actions) - 1; i >= 0; i-- {
+		a := res.Actions[i]
+		act := a.ActionTrace.Act
+		if act.Account != "eosio.token" || act.Name != "transfer" {
+			continue
+		}
+		var tf struct {
+			From string `json:"from"`
+			To string `json:"to"`
+			Quantity string `json:"quantity"`
+		}
+		if json.Unmarshal(act.Data, &tf) != nil || !strings.HasSuffix(tf.Quantity, " EOS") {
+			continue
+		}
+		key := a.ActionTrace.TrxId + string(act.Data)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		amount, err := types.ParseUnits(strings.TrimSuffix(tf.Quantity, " EOS"), Decimals)
+		if err != nil {
+			continue
+		}
+		t := types.Transfer{
+			TxHash: a.ActionTrace.TrxId,
+			Direction: types.DirectionIn,
+			Counterparty: tf.From,
+			Amount: amount,
+			BlockHeight: a.BlockNum,
+		}
+		if tf.From == account {
+			t.Direction = types.DirectionOut
+			t.Counterparty = tf.To
+		} else if tf.To != account {
+			continue
+		}
+		if tm, err := time.Parse("2006-01-02T15:04:05", a.BlockTime); err == nil {
+			t.Timestamp = tm.Unix()
+		}
+		hist.Transfers = append(hist.Transfers, t)
+	}
+	if len(res.Actions) > 0 {
+		if oldest := res.Actions[0].AccountActionSeq; oldest > 0 {
+			hist.NextCursor = strconv.FormatInt(oldest-1, 10)
+		}
+	}
+	return hist, nil
+}
+
+// 公钥转成账户名, 其他原样返回
+func (h *EOSHandler) accountName(ctx context.Context, address string) (string, error) {
+	if !strings.HasPrefix(address, "EOS") || len(address) <= 12 {
+		return address, nil
+	}
+	ret, err := nodeosCall(ctx, h.nodeos, "v1/history/get_key_accounts", `{"public_key":"` + address + `"}`)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		AccountNames []string `json:"account_names"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return "", err
+	}
+	if len(res.AccountNames) == 0 {
+		return "", types.Errorf(types.ErrNotFound, "no account for key %v", address)
+	}
+	return res.AccountNames[0], nil
+}
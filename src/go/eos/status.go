@@ -0,0 +1,89 @@
+package eos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetTransactionStatus 用 history 插件的 get_transaction 查询交易所在的区块
+// 区块不高于 last irreversible block 时交易不会被回滚, 所以 FinalityThreshold 是 head 到 lib 的距离, 随节点变化
+// receipt 的 status 不是 executed (soft_fail, hard_fail, expired) 的交易是 TxFailed
+func (h *EOSHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	head, lib, err := h.chainInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	threshold := types.Confirmations(lib, head)
+	data := `{"id":"` + txhash + `","block_num_hint":"0"}`
+	ret, err := nodeosCall(ctx, h.nodeos, "v1/history/get_transaction", data)
+	if errors.Is(err, types.ErrNotFound) {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	} else if err != nil {
+		return nil, err
+	}
+	var tx struct {
+		BlockNum uint64 `json:"block_num"`
+		Trx *struct {
+			Receipt struct {
+				Status string `json:"status"`
+			} `json:"receipt"`
+		} `json:"trx"`
+	}
+	if err := json.Unmarshal([]byte(ret), &tx); err != nil {
+		return nil, err
+	}
+	if tx.Trx == nil || tx.BlockNum == 0 {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	blockID, err := h.blockID(ctx, tx.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	status := types.IncludedTxStatus(txhash, tx.BlockNum, blockID, types.Confirmations(tx.BlockNum, head), threshold)
+	if tx.Trx.Receipt.Status != "executed" {
+		status.State = types.TxFailed
+	}
+	return status, nil
+}
+
+// 返回 head block 和 last irreversible block 的高度
+func (h *EOSHandler) chainInfo(ctx context.Context) (head, lib uint64, err error) {
+	ret, err := nodeosCall(ctx, h.nodeos, "v1/chain/get_info", "")
+	if err != nil {
+		return
+	}
+	var info struct {
+		HeadBlockNum uint64 `json:"head_block_num"`
+		LastIrreversibleBlockNum uint64 `json:"last_irreversible_block_num"`
+	}
+	if err = json.Unmarshal([]byte(ret), &info); err != nil {
+		return
+	}
+	if info.HeadBlockNum == 0 {
+		err = types.ClassifyError(fmt.Errorf("get_info error: %v", ret))
+		return
+	}
+	return info.HeadBlockNum, info.LastIrreversibleBlockNum, nil
+}
+
+// 返回高度为 num 的区块的 id
+func (h *EOSHandler) blockID(ctx context.Context, num uint64) (string, error) {
+	ret, err := nodeosCall(ctx, h.nodeos, "v1/chain/get_block", fmt.Sprintf(`{"block_num_or_id":%d}`, num))
+	if err != nil {
+		return "", err
+	}
+	var blk struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(ret), &blk); err != nil || blk.Id == "" {
+		return "", types.ClassifyError(fmt.Errorf("get_block error: %v", ret))
+	}
+	return blk.Id, nil
+}
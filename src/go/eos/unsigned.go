@@ -0,0 +1,54 @@
+package eos
+
+import (
+	"fmt"
+
+	eos "github.com/eoscanada/eos-go"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// UnsignedTransaction 是未签名交易和构造交易的公钥 (16 进制), MakeSignedTransaction 用公钥校验签名
+type UnsignedTransaction struct {
+	Tx *eos.SignedTransaction
+	PublicKey string
+}
+
+// 信封的 payload 是 eos 二进制编码的 UnsignedTransaction
+func encodeUnsignedTransaction(transaction interface{}) ([]byte, error) {
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	return eos.MarshalBinary(utx)
+}
+
+func decodeUnsignedTransaction(payload []byte) (*UnsignedTransaction, error) {
+	utx := new(UnsignedTransaction)
+	if err := eos.UnmarshalBinary(payload, utx); err != nil {
+		return nil, err
+	}
+	return utx, nil
+}
+
+// checkSignature 校验 rsv 是 PublicKey 对交易的 digest 的签名, 并且满足 eos 节点的 canonical 规则
+// PublicKey 为空时无法校验签名者, 返回 ErrInvalidSignature
+func (utx *UnsignedTransaction) checkSignature(chainID string, rsv []string) (*signature.RSV, error) {
+	if len(rsv) != 1 {
+		return nil, fmt.Errorf("expect 1 signature, got %v", len(rsv))
+	}
+	if utx.PublicKey == "" {
+		return nil, types.Errorf(types.ErrInvalidSignature, "unsigned transaction has no public key")
+	}
+	txdata, cfd, err := utx.Tx.PackedTransactionAndCFD()
+	if err != nil {
+		return nil, err
+	}
+	digest := eos.SigDigest(newTxOptions(chainID).ChainID, txdata, cfd)
+	rules := signature.Rules{Recovery: true, EOSCanonical: true}
+	pub, err := signature.ParsePublicKey(utx.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction public key: %v", err)
+	}
+	return signature.Check(0, rsv[0], digest, pub, rules)
+}
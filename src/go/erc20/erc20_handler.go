@@ -2,13 +2,13 @@ package erc20
 
 import  (
 	"context"
+	"time"
 	"crypto/ecdsa"
 	//"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"runtime/debug"
 	"strings"
@@ -18,29 +18,30 @@ import  (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 
+	"github.com/gaozhengxin/cryptocoins/src/go/eth"
 	"github.com/gaozhengxin/cryptocoins/src/go/eth/sha3"
-	"github.com/gaozhengxin/cryptocoins/src/go/erc20/token"
 	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
 var (
 	gasPrice = big.NewInt(80000000)
 	gasLimit uint64 = 100000
-	url = config.ApiGateways.EthereumGateway.ApiAddress
 	err error
-	chainConfig = params.RinkebyChainConfig
-	//chainID = big.NewInt(40400)
 )
 
+// 默认网络
+const DefaultNetwork = ctypes.Testnet
+
+// testnet (rinkeby) 的合约地址
 var Tokens map[string]string = map[string]string{
 	"ERC20GUSD":"0x28a79f9b0fe54a39a0ff4c10feeefa832eeceb78",
 	"ERC20BNB":"0x7f30B414A814a6326d38535CA8eb7b9A62Bceae2",
@@ -49,21 +50,97 @@ var Tokens map[string]string = map[string]string{
 	"ERC20BNT":"0x14D5913C8396d43aB979D4B29F2102c1C65E18Db",
 }
 
+var MainnetTokens map[string]string = map[string]string{
+	"ERC20GUSD":"0x056Fd409E1d7A124BD7017459dFEa2F387b6d5Cd",
+	"ERC20BNB":"0xB8c77482e45F1F44dE1745F52C74426C631bDD52",
+	"ERC20MKR":"0x9f8F72aA9304c8B593d555F12eF6589cC3A579A2",
+	"ERC20HT":"0x6f259637dcD74C767781E37Bc6133cd6A68aa161",
+	"ERC20BNT":"0x1F573D6Fb3F13d689FF844B4cE37794d79a7FF1C",
+}
+
+// token 的小数位数, 各网络相同
+var TokenDecimals map[string]int = map[string]int{
+	"ERC20GUSD":2,
+	"ERC20BNB":18,
+	"ERC20MKR":18,
+	"ERC20HT":18,
+	"ERC20BNT":18,
+}
+
+// 各网络的合约地址
+func tokensForNetwork(network ctypes.Network) map[string]string {
+	switch network {
+	case ctypes.Mainnet:
+		return MainnetTokens
+	case ctypes.Testnet:
+		return Tokens
+	}
+	return nil
+}
+
 type ERC20Handler struct {
 	TokenType string
+	network ctypes.Network
+	chainConfig *params.ChainConfig
+	tokenAddress string
+	url string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
 }
 
 func NewERC20Handler () *ERC20Handler {
-	return &ERC20Handler{}
+	h, _ := newERC20Handler(DefaultNetwork, config.Current())
+	return h
 }
 
 func NewERC20TokenHandler (tokenType string) *ERC20Handler {
-	if Tokens[tokenType] == "" {
-		return nil
+	h, _ := NewERC20TokenHandlerForNetwork(tokenType, DefaultNetwork)
+	return h
+}
+
+// NewERC20TokenHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewERC20TokenHandlerForNetwork (tokenType string, network ctypes.Network) (*ERC20Handler, error) {
+	return NewERC20TokenHandlerFromConfig(tokenType, network, config.Current())
+}
+
+// NewERC20TokenHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 EthereumGateway
+func NewERC20TokenHandlerFromConfig (tokenType string, network ctypes.Network, gateways *config.ApiGatewayConfigs) (*ERC20Handler, error) {
+	network = network.Or(DefaultNetwork)
+	tokenAddress := tokensForNetwork(network)[tokenType]
+	if tokenAddress == "" {
+		return nil, fmt.Errorf("unknown erc20 token %v on %v", tokenType, network)
 	}
-	return &ERC20Handler{
-		TokenType: tokenType,
+	h, err := newERC20Handler(network, gateways)
+	if err != nil {
+		return nil, err
+	}
+	h.TokenType = tokenType
+	h.tokenAddress = tokenAddress
+	return h, nil
+}
+
+func newERC20Handler (network ctypes.Network, gateways *config.ApiGatewayConfigs) (*ERC20Handler, error) {
+	network = network.Or(DefaultNetwork)
+	chainConfig, err := eth.ChainConfigForNetwork(network)
+	if err != nil {
+		return nil, ctypes.UnsupportedNetworkError("ERC20", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).EthereumGateway
+	rpcutils.RegisterApiGateway(gateway, rpcutils.EthereumProbe, gateways.HealthCheckInterval())
+	chainConfig, err = eth.WithChainID(chainConfig, gateway.ChainID)
+	if err != nil {
+		return nil, err
 	}
+	return &ERC20Handler{
+		network: network,
+		chainConfig: chainConfig,
+		url: gateway.ApiAddress,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *ERC20Handler) Network() ctypes.Network {
+	return h.network
 }
 
 var ERC20_DEFAULT_FEE, _ = new(big.Int).SetString("10000000000000000",10)
@@ -73,56 +150,165 @@ func (h *ERC20Handler) GetDefaultFee() *big.Int {
 }
 
 func (h *ERC20Handler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	data := hexEncPubkey(pubKeyHex[2:])
-
-	pub, err := decodePubkey(data)
-
-	address = ethcrypto.PubkeyToAddress(*pub).Hex()
+	pub, err := signature.ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return
+	}
+	address = ethcrypto.PubkeyToAddress(*pub.ToECDSA()).Hex()
 	return
 }
 
-// jsonstring '{"gasPrice":8000000000,"gasLimit":50000,"tokenType":"BNB"}'
+// jsonstring '{"gasPrice":8000000000,"gasLimit":50000,"tokenType":"ERC20BNB"}'
+// handler 只处理创建时的 token, tokenType 可以省略, 不是 handler 的 token 时返回错误
 func (h *ERC20Handler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *ERC20Handler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := h.parseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+// parseBuildOptions 检查并去掉 jsonstring 里的 tokenType 后用 ctypes.ParseBuildOptions 解析
+func (h *ERC20Handler) parseBuildOptions(jsonstring string) (*ctypes.BuildOptions, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(jsonstring), &fields) == nil {
+		if raw, ok := fields["tokenType"]; ok {
+			var tokenType string
+			if err := json.Unmarshal(raw, &tokenType); err != nil {
+				return nil, fmt.Errorf("invalid build options: tokenType: %v", err)
+			}
+			if !strings.EqualFold(tokenType, h.TokenType) {
+				return nil, fmt.Errorf("invalid build options: tokenType %v does not match the handler's token %v", tokenType, h.TokenType)
+			}
+			delete(fields, "tokenType")
+			b, err := json.Marshal(fields)
+			if err != nil {
+				return nil, err
+			}
+			jsonstring = string(b)
+		}
+	}
+	return ctypes.ParseBuildOptions(jsonstring)
+}
+
+var SupportedBuildOptions = []string{ctypes.OptGasPrice, ctypes.OptGasLimit, ctypes.OptNonce}
+
+func (h *ERC20Handler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *ERC20Handler) Capabilities() ctypes.Capabilities {
+	return ctypes.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		Balance: true,
+		Tokens: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: ctypes.Networks(func(n ctypes.Network) bool {
+			_, err := eth.ChainConfigForNetwork(n)
+			return err == nil && tokensForNetwork(n)[h.TokenType] != ""
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *ERC20Handler) Metadata() ctypes.Metadata {
+	return ctypes.Metadata{
+		Symbol: strings.TrimPrefix(h.TokenType, "ERC20"),
+		Decimals: TokenDecimals[h.TokenType],
+		SLIP44: 60,
+		AddressFormat: ctypes.AddressHex,
+	}
+}
+
+func (h *ERC20Handler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *ctypes.BuildOptions) (transaction interface{}, digests []string, err error) {
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
-/*	var args interface{}
-	json.Unmarshal([]byte(jsonstring), &args)
-	userGasPrice := args.(map[string]interface{})["gasPrice"]
-	userGasLimit := args.(map[string]interface{})["gasLimit"]
-	userTokenType := args.(map[string]interface{})["tokenType"]
-	var tokenType string
-	if userTokenType == nil {
-		tokenType = h.TokenType
-		if tokenType == "" {
-			err = fmt.Errorf("token type not specified.")
-			return
-		}
-		if Tokens[tokenType] == "" {
-			err = fmt.Errorf("token not supported")
-			return
-		}
+	outputs := []ctypes.TxOutput{{ToAddress: toAddress, Amount: amount}}
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		err = ctypes.ClassifyError(err)
+		return
 	}
-	if userGasPrice != nil {
-		gasPrice = big.NewInt(int64(userGasPrice.(float64)))
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 nonce, 构造参数没有指定 gas price 和 gas limit 时也向节点查询
+func (h *ERC20Handler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []ctypes.TxOutput, opts *ctypes.BuildOptions) (*ctypes.ChainState, error) {
+	p, err := h.txParams(fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		return nil, err
+	}
+	state := ctypes.NewChainState(h.TokenType, h.network.String())
+	state.ChainID = h.chainConfig.ChainID.String()
+	if err := eth.FetchChainState(ctx, h.url, h.timeout, state, p); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Assemble 用 state 的 nonce 构造调用 token 合约 transfer 的未签名交易, 不访问网络
+func (h *ERC20Handler) Assemble(state *ctypes.ChainState, fromAddress, fromPublicKey string, outputs []ctypes.TxOutput, opts *ctypes.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = state.Check(h.TokenType, h.network.String()); err != nil {
+		return
 	}
-	if userGasLimit != nil {
-		gasLimit = uint64(userGasLimit.(float64))
-	}*/
-	client, err := ethclient.Dial(url)
+	p, err := h.txParams(fromAddress, fromPublicKey, outputs, opts)
 	if err != nil {
 		return
 	}
-	transaction, hash, err := erc20_newUnsignedTransaction(client, fromAddress, toAddress, amount, gasPrice, gasLimit, h.TokenType)
-	hashStr := hash.Hex()
-	if hashStr[:2] == "0x" {
-		hashStr = hashStr[2:]
+	return eth.Assemble(state, h.chainConfig.ChainID, p)
+}
+
+// txParams 的接收地址是 token 合约, 收款人和金额编码在 data 里
+func (h *ERC20Handler) txParams(fromAddress, fromPublicKey string, outputs []ctypes.TxOutput, opts *ctypes.BuildOptions) (*eth.TxParams, error) {
+	if err := opts.Check(h.TokenType, SupportedBuildOptions...); err != nil {
+		return nil, err
 	}
-	digests = append(digests, hashStr)
-	return
+	if len(outputs) != 1 {
+		return nil, fmt.Errorf("%v: %w", h.TokenType, ctypes.ErrBatchNotSupported)
+	}
+	if h.tokenAddress == "" {
+		return nil, errors.New("token not supported")
+	}
+	if !common.IsHexAddress(outputs[0].ToAddress) {
+		return nil, ctypes.Errorf(ctypes.ErrInvalidAddress, "invalid address %v", outputs[0].ToAddress)
+	}
+	// From 用公钥推导, 签名时校验签名者
+	from, err := eth.FromAddress(fromAddress, fromPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	p := &eth.TxParams{
+		From: from,
+		To: h.tokenAddress,
+		Value: big.NewInt(0),
+		Data: transferData(common.HexToAddress(outputs[0].ToAddress), outputs[0].Amount),
+		GasPrice: gasPrice,
+		GasLimit: gasLimit,
+	}
+	if opts != nil {
+		if opts.GasPrice != nil {
+			p.GasPrice = opts.GasPrice
+		}
+		if opts.GasLimit != nil {
+			p.GasLimit = *opts.GasLimit
+		}
+		p.Nonce = opts.Nonce
+	}
+	return p, nil
 }
 
 /*
@@ -140,7 +326,6 @@ func (h *ERC20Handler) SignTransaction(hash []string, privateKey interface{}) (r
 	if err != nil {
 		return
 	}
-	fmt.Printf("r: %v\ns: %v\n\n", r, s)
 	rx := fmt.Sprintf("%X", r)
 	sx := fmt.Sprintf("%X", s)
 	rsv = append(rsv, rx + sx + "00")*/
@@ -153,31 +338,56 @@ func (h *ERC20Handler) SignTransaction(hash []string, privateKey interface{}) (r
 }
 
 func (h *ERC20Handler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
-	client, err := ethclient.Dial(url)
-	if err != nil {
-		return
-	}
-	return makeSignedTransaction(client, transaction.(*types.Transaction), rsv[0])
+	return h.MakeSignedTransactionContext(context.Background(), rsv, transaction)
+}
+
+func (h *ERC20Handler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return eth.MakeSignedTransaction(transaction, rsv, h.chainConfig.ChainID)
 }
 
 func (h *ERC20Handler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	client, err := ethclient.Dial(url)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *ERC20Handler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	stx, ok := signedTransaction.(*types.Transaction)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	client, err := eth.Dial(ctx, h.url)
 	if err != nil {
 		return
 	}
-	return erc20_sendTx(client, signedTransaction.(*types.Transaction))
+	return erc20_sendTx(ctx, client, stx)
 }
 
 func (h *ERC20Handler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []ctypes.TxOutput, jsonstring string, err error) {
-	client, err := ethclient.Dial(url)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *ERC20Handler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []ctypes.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	client, err := eth.Dial(ctx, h.url)
 	if err != nil {
 		return
 	}
 	hash := common.HexToHash(txhash)
-	tx, isPending, err1 := client.TransactionByHash(context.Background(), hash)
+	tx, isPending, err1 := client.TransactionByHash(ctx, hash)
 	if err1 == nil && isPending == false && tx != nil {
-		msg, err2 := tx.AsMessage(types.MakeSigner(chainConfig, GetLastBlock()))
-		err = err2
+		blockNumber, err2 := h.GetLastBlockContext(ctx)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		msg, err2 := tx.AsMessage(types.MakeSigner(h.chainConfig, blockNumber))
+		if err2 != nil {
+			err = err2
+			return
+		}
 		fromAddress = msg.From().Hex()
 		data := msg.Data()
 
@@ -192,17 +402,27 @@ func (h *ERC20Handler) GetTransactionInfo(txhash string) (fromAddress string, tx
 			return
 		}
 	} else if err1 != nil {
-		err = err1
+		err = ctypes.ClassifyError(err1)
 	} else if isPending {
-		err = fmt.Errorf("Transaction is pending")
+		err = ctypes.ErrPending
 	} else {
 		err = fmt.Errorf("Unknown error")
 	}
 	return
 }
 
-// jsonstring:'{"tokenType":"BNB"}'
+// GetTransactionStatus 用 eth_getTransactionReceipt 查询交易的确认数, 见 eth.TransactionStatus
+// token 转账失败时交易仍会上链, 收据的 status 为 0
+func (h *ERC20Handler) GetTransactionStatus(ctx context.Context, txhash string) (*ctypes.TxStatus, error) {
+	return eth.TransactionStatus(ctx, h.url, h.timeout, txhash, eth.FinalityConfirmations)
+}
+
+// jsonstring:'{"tokenType":"BNB"}', 查询的是创建 handler 时的 token, tokenType 被忽略
 func (h *ERC20Handler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *ERC20Handler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
@@ -224,9 +444,7 @@ func (h *ERC20Handler) GetAddressBalance(address string, jsonstring string) (bal
 		return
 	}
 */
-	tokenAddr := Tokens[h.TokenType]
-fmt.Printf("token type is %v \n", h.TokenType)
-fmt.Printf("tokenAddr is %v \n", tokenAddr)
+	tokenAddr := h.tokenAddress
 	if tokenAddr == "" {
 		err = fmt.Errorf("Token not supported")
 		return
@@ -243,76 +461,52 @@ fmt.Printf("tokenAddr is %v \n", tokenAddr)
 		return
 	}
 	dataHex := "0x" + hex.EncodeToString(data)
-	fmt.Printf("data is %v\n\n", dataHex)
 
 	reqJson := `{"jsonrpc": "2.0","method": "eth_call","params": [{"to": "` + tokenAddr + `","data": "` + dataHex + `"},"latest"],"id": 1}`
-	fmt.Printf("reqJson: %v\n\n", reqJson)
 
-	ret := rpcutils.DoPostRequest2(url, reqJson)
-	fmt.Printf("ret: %v\n\n", ret)
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	retBytes, err := rpcutils.PostJSON(ctx, h.url, "", reqJson)
+	if err != nil {
+		return
+	}
+	ret := string(retBytes)
 
 	var retStruct map[string]interface{}
 	json.Unmarshal([]byte(ret), &retStruct)
 	if retStruct["result"] == nil {
 		if retStruct["error"] != nil {
-			err = fmt.Errorf(retStruct["error"].(map[string]interface{})["message"].(string))
+			err = ctypes.ClassifyError(errors.New(retStruct["error"].(map[string]interface{})["message"].(string)))
 			return
 		}
-		err = fmt.Errorf(ret)
+		err = ctypes.ClassifyError(errors.New(ret))
 		return
 	}
 	balanceStr := retStruct["result"].(string)[2:]
 	balanceHex, _ := new(big.Int).SetString(balanceStr, 16)
 	balance, _ = new(big.Int).SetString(fmt.Sprintf("%d",balanceHex), 10)
 
-	client, err := ethclient.Dial(url)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	tokenAddress := common.HexToAddress(tokenAddr)
-	instance, err := token.NewToken(tokenAddress, client)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	balance1, _ := instance.BalanceOf(&bind.CallOpts{}, common.HexToAddress(address))
-	fmt.Printf("balance1: %v\n\n", balance1)
-
 	return
 }
 
-func GetLastBlock() *big.Int {
-	client, err := ethclient.Dial(url)
-	if err != nil {
-		return nil
-	}
-	blk, _ := client.BlockByNumber(context.Background(), nil)
-	return blk.Number()
+// GetLastBlock 返回节点最新区块的高度
+func (h *ERC20Handler) GetLastBlock() (*big.Int, error) {
+	return h.GetLastBlockContext(context.Background())
 }
 
-func hexEncPubkey(h string) (ret [64]byte) {
-	b, err := hex.DecodeString(h)
+// GetLastBlockContext 返回 handler 网关上最新区块的高度, 节点出错或者 ctx 取消时返回错误
+func (h *ERC20Handler) GetLastBlockContext(ctx context.Context) (*big.Int, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	client, err := eth.Dial(ctx, h.url)
 	if err != nil {
-		panic(err)
-	}
-	if len(b) != len(ret) {
-		panic("invalid length")
+		return nil, err
 	}
-	copy(ret[:], b)
-	return ret
-}
-
-
-func decodePubkey(e [64]byte) (*ecdsa.PublicKey, error) {
-	p := &ecdsa.PublicKey{Curve: ethcrypto.S256(), X: new(big.Int), Y: new(big.Int)}
-	half := len(e) / 2
-	p.X.SetBytes(e[:half])
-	p.Y.SetBytes(e[half:])
-	if !p.Curve.IsOnCurve(p.X, p.Y) {
-		return nil, errors.New("invalid secp256k1 curve point")
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, ctypes.ClassifyError(err)
 	}
-	return p, nil
+	return header.Number, nil
 }
 
 func DecodeTransferData(data []byte) (toAddress string, transferAmount *big.Int, err error) {
@@ -331,44 +525,8 @@ func DecodeTransferData(data []byte) (toAddress string, transferAmount *big.Int,
 	return
 }
 
-func erc20_newUnsignedTransaction (client *ethclient.Client, dcrmAddress string, toAddressHex string, amount *big.Int, gasPrice *big.Int, gasLimit uint64, tokenType string) (*types.Transaction, *common.Hash, error) {
-
-	chainID, err := client.NetworkID(context.Background())
-
-	if err != nil {
-		return nil, nil, err
-	}
-
-	tokenAddressHex, ok := Tokens[tokenType]
-	if ok {
-	} else {
-		err = errors.New("token not supported")
-		return nil, nil, err
-	}
-
-	if gasPrice == nil {
-		gasPrice, err = client.SuggestGasPrice(context.Background())
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	fromAddress := common.HexToAddress(dcrmAddress)
-/*
-	nonce or pending nonce
-*/
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
-	//nonce, err := client.NonceAt(context.Background(), fromAddress, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-fmt.Printf("pending nonce is %v\n", nonce)
-
-	value := big.NewInt(0)
-
-	toAddress := common.HexToAddress(toAddressHex)
-	tokenAddress := common.HexToAddress(tokenAddressHex)
-
+// transfer(address,uint256) 的调用数据
+func transferData(toAddress common.Address, amount *big.Int) []byte {
 	transferFnSignature := []byte("transfer(address,uint256)")
 	hash := sha3.NewKeccak256()
 	hash.Write(transferFnSignature)
@@ -381,48 +539,56 @@ fmt.Printf("pending nonce is %v\n", nonce)
 	data = append(data, methodID...)
 	data = append(data, paddedAddress...)
 	data = append(data, paddedAmount...)
+	return data
+}
 
-	if gasLimit <= 0 {
-		gasLimit, err = client.EstimateGas(context.Background(), ethereum.CallMsg{
-			To:   &tokenAddress,
-			Data: data,
-		})
-		gasLimit = gasLimit * 4
-		if err != nil {
-			return nil, nil, err
-		}
+// EstimateFee 用 eth_gasPrice 和 eth_estimateGas 估计 token 转账的手续费
+// 节点无法估计时三档都是 ERC20_DEFAULT_FEE, gas limit 是默认的 gasLimit
+func (h *ERC20Handler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*ctypes.FeeEstimate, error) {
+	if !common.IsHexAddress(toAddress) {
+		return nil, ctypes.Errorf(ctypes.ErrInvalidAddress, "invalid address %v", toAddress)
 	}
-
-	fmt.Println("gasLimit is ", gasLimit)
-	fmt.Println("gasPrice is ", gasPrice)
-	tx := types.NewTransaction(nonce, tokenAddress, value, gasLimit, gasPrice, data)
-
-	signer := types.NewEIP155Signer(chainID)
-	txhash := signer.Hash(tx)
-	return tx, &txhash, nil
+	if amount == nil {
+		amount = new(big.Int)
+	}
+	tokenAddress := common.HexToAddress(h.tokenAddress)
+	msg := ethereum.CallMsg{
+		From: common.HexToAddress(fromAddress),
+		To: &tokenAddress,
+		Data: transferData(common.HexToAddress(toAddress), amount),
+	}
+	fallbackPrice := new(big.Int).Div(ERC20_DEFAULT_FEE, new(big.Int).SetUint64(gasLimit))
+	return eth.EstimateGasFee(ctx, h.url, h.timeout, msg, eth.FixedGasFeeEstimate(fallbackPrice, gasLimit)), nil
 }
 
-func makeSignedTransaction(client *ethclient.Client, tx *types.Transaction, rsv string) (*types.Transaction, error) {
-	chainID, err := client.NetworkID(context.Background())
+func erc20_sendTx (ctx context.Context, client *ethclient.Client, signedTx *types.Transaction) (string, error) {
+	err := client.SendTransaction(ctx, signedTx)
 	if err != nil {
-		return nil, err
+		return "", ctypes.ClassifyError(err)
 	}
-	message, err := hex.DecodeString(rsv)
-	if err != nil {
-		return nil, err
-	}
-	signer := types.NewEIP155Signer(chainID)
-	signedtx, err := tx.WithSignature(signer, message)
+	return signedTx.Hash().Hex(), nil
+}
+
+// payload 是 rlp 编码的未签名交易和构造交易的地址, 见 eth.EncodeUnsignedTransaction
+func (h *ERC20Handler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*ctypes.TxEnvelope, error) {
+	payload, err := eth.EncodeUnsignedTransaction(transaction)
 	if err != nil {
 		return nil, err
 	}
-	return signedtx, nil
+	return ctypes.NewTxEnvelope(h.TokenType, h.network.String(), digests, payload), nil
 }
 
-func erc20_sendTx (client *ethclient.Client, signedTx *types.Transaction) (string, error) {
-	err := client.SendTransaction(context.Background(), signedTx)
+func (h *ERC20Handler) UnmarshalUnsignedTransaction(env *ctypes.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check(h.TokenType, h.network.String()); err != nil {
+		return
+	}
+	if err = env.CheckMinVersion(ctypes.TxEnvelopeSignerVersion); err != nil {
+		return
+	}
+	utx, err := eth.DecodeUnsignedTransaction(env.Payload)
 	if err != nil {
-		return "", err
+		return
 	}
-	return signedTx.Hash().Hex(), nil
+	transaction = utx
+	return
 }
@@ -2,25 +2,25 @@ package etc
 
 import  (
 	"context"
+	"time"
 	"crypto/ecdsa"
 	//"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"math/big"
 	"runtime/debug"
 
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
-	"github.com/gaozhengxin/cryptocoins/src/go/eth/sha3"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
 
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
+	"github.com/gaozhengxin/cryptocoins/src/go/eth"
 	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
 
 )
@@ -28,16 +28,66 @@ import  (
 var (
 	gasPrice = big.NewInt(8000000000)
 	gasLimit uint64 = 50000
-	url = config.ETC_GATEWAY
 	err error
-	chainConfig = params.MainnetChainConfig
 )
 
+// 默认网络
+const DefaultNetwork = ctypes.Mainnet
+
+// 各网络的链参数, 签名使用其中的 chain id
+// mainnet chain id 61, testnet 是 mordor, chain id 63
+var chainConfigs = map[ctypes.Network]*params.ChainConfig{
+	ctypes.Mainnet: etcChainConfig(61),
+	ctypes.Testnet: etcChainConfig(63),
+}
+
+func etcChainConfig(chainID int64) *params.ChainConfig {
+	chainConfig := *params.MainnetChainConfig
+	chainConfig.ChainID = big.NewInt(chainID)
+	return &chainConfig
+}
+
 type ETCHandler struct {
+	network ctypes.Network
+	chainConfig *params.ChainConfig
+	url string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
 }
 
 func NewETCHandler () *ETCHandler {
-	return &ETCHandler{}
+	h, _ := NewETCHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewETCHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewETCHandlerForNetwork (network ctypes.Network) (*ETCHandler, error) {
+	return NewETCHandlerFromConfig(network, config.Current())
+}
+
+// NewETCHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 EthereumClassicGateway
+func NewETCHandlerFromConfig (network ctypes.Network, gateways *config.ApiGatewayConfigs) (*ETCHandler, error) {
+	network = network.Or(DefaultNetwork)
+	chainConfig, ok := chainConfigs[network]
+	if !ok {
+		return nil, ctypes.UnsupportedNetworkError("ETC", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).EthereumClassicGateway
+	rpcutils.RegisterApiGateway(gateway, rpcutils.EthereumProbe, gateways.HealthCheckInterval())
+	chainConfig, err := eth.WithChainID(chainConfig, gateway.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	return &ETCHandler{
+		network: network,
+		chainConfig: chainConfig,
+		url: gateway.ApiAddress,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *ETCHandler) Network() ctypes.Network {
+	return h.network
 }
 
 var ETC_DEFAULT_FEE, _ = new(big.Int).SetString("10000000000",10)
@@ -47,46 +97,133 @@ func (h *ETCHandler) GetDefaultFee() *big.Int {
 }
 
 func (h *ETCHandler) PublicKeyToAddress (pubKeyHex string) (address string, err error) {
-	data := hexEncPubkey(pubKeyHex[2:])
-
-	pub, err := decodePubkey(data)
-
-	address = ethcrypto.PubkeyToAddress(*pub).Hex()
+	pub, err := signature.ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return
+	}
+	address = ethcrypto.PubkeyToAddress(*pub.ToECDSA()).Hex()
 	return
 }
 
 // jsonstring '{"gasPrice":8000000000,"gasLimit":50000}'
 func (h *ETCHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *ETCHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := ctypes.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+var SupportedBuildOptions = []string{ctypes.OptGasPrice, ctypes.OptGasLimit, ctypes.OptNonce}
+
+func (h *ETCHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *ETCHandler) Capabilities() ctypes.Capabilities {
+	return ctypes.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		Balance: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: ctypes.Networks(func(n ctypes.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *ETCHandler) Metadata() ctypes.Metadata {
+	return ctypes.Metadata{
+		Symbol: "ETC",
+		Decimals: 18,
+		SLIP44: 61,
+		AddressFormat: ctypes.AddressHex,
+		SmallestUnit: "wei",
+	}
+}
+
+func (h *ETCHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *ctypes.BuildOptions) (transaction interface{}, digests []string, err error) {
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
-	client, err := ethclient.Dial(url)
+	outputs := []ctypes.TxOutput{{ToAddress: toAddress, Amount: amount}}
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		err = ctypes.ClassifyError(err)
+		return
+	}
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 nonce, 构造参数没有指定 gas price 和 gas limit 时也向节点查询
+func (h *ETCHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []ctypes.TxOutput, opts *ctypes.BuildOptions) (*ctypes.ChainState, error) {
+	p, err := h.txParams(fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		return nil, err
+	}
+	state := ctypes.NewChainState("ETC", h.network.String())
+	state.ChainID = h.chainConfig.ChainID.String()
+	if err := eth.FetchChainState(ctx, h.url, h.timeout, state, p); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Assemble 用 state 的 nonce 构造未签名交易, 不访问网络
+func (h *ETCHandler) Assemble(state *ctypes.ChainState, fromAddress, fromPublicKey string, outputs []ctypes.TxOutput, opts *ctypes.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = state.Check("ETC", h.network.String()); err != nil {
+		return
+	}
+	p, err := h.txParams(fromAddress, fromPublicKey, outputs, opts)
 	if err != nil {
 		return
 	}
-	var args interface{}
-	json.Unmarshal([]byte(jsonstring), &args)
-	json.Unmarshal([]byte(jsonstring), &args)
-	if args != nil {
-		userGasPrice := args.(map[string]interface{})["gasPrice"]
-		userGasLimit := args.(map[string]interface{})["gasLimit"]
-		if userGasPrice != nil {
-			gasPrice = big.NewInt(int64(userGasPrice.(float64)))
+	return eth.Assemble(state, h.chainConfig.ChainID, p)
+}
+
+func (h *ETCHandler) txParams(fromAddress, fromPublicKey string, outputs []ctypes.TxOutput, opts *ctypes.BuildOptions) (*eth.TxParams, error) {
+	if err := opts.Check("ETC", SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	if len(outputs) != 1 {
+		return nil, fmt.Errorf("ETC: %w", ctypes.ErrBatchNotSupported)
+	}
+	// From 用公钥推导, 签名时校验签名者
+	from, err := eth.FromAddress(fromAddress, fromPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	p := &eth.TxParams{
+		From: from,
+		To: outputs[0].ToAddress,
+		Value: outputs[0].Amount,
+		GasPrice: gasPrice,
+		GasLimit: gasLimit,
+	}
+	if opts != nil {
+		if opts.GasPrice != nil {
+			p.GasPrice = opts.GasPrice
 		}
-		if userGasLimit != nil {
-			gasLimit = uint64(userGasLimit.(float64))
+		if opts.GasLimit != nil {
+			p.GasLimit = *opts.GasLimit
 		}
+		p.Nonce = opts.Nonce
 	}
-	transaction, hash, err := eth_newUnsignedTransaction(client, fromAddress, toAddress, amount, gasPrice, gasLimit)
-	hashStr := hash.Hex()
-	if hashStr[:2] == "0x" {
-		hashStr = hashStr[2:]
-	}
-	digests = append(digests, hashStr)
-	return
+	return p, nil
 }
 
 func (h *ETCHandler) SignTransaction(hash []string, privateKey interface{}) (rsv []string, err error) {
@@ -111,31 +248,56 @@ func (h *ETCHandler) SignTransaction(hash []string, privateKey interface{}) (rsv
 }
 
 func (h *ETCHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
-	client, err := ethclient.Dial(url)
-	if err != nil {
-		return
-	}
-	return makeSignedTransaction(client, transaction.(*types.Transaction), rsv[0])
+	return h.MakeSignedTransactionContext(context.Background(), rsv, transaction)
+}
+
+func (h *ETCHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return eth.MakeSignedTransaction(transaction, rsv, h.chainConfig.ChainID)
 }
 
 func (h *ETCHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
-	client, err := ethclient.Dial(url)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *ETCHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	stx, ok := signedTransaction.(*types.Transaction)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	client, err := eth.Dial(ctx, h.url)
 	if err != nil {
 		return
 	}
-	return eth_sendTx(client, signedTransaction.(*types.Transaction))
+	return eth_sendTx(ctx, client, stx)
 }
 
 func (h *ETCHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []ctypes.TxOutput, jsonstring string, err error) {
-	client, err := ethclient.Dial(url)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *ETCHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []ctypes.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	client, err := eth.Dial(ctx, h.url)
 	if err != nil {
 		return
 	}
 	hash := common.HexToHash(txhash)
-	tx, isPending, err1 := client.TransactionByHash(context.Background(), hash)
+	tx, isPending, err1 := client.TransactionByHash(ctx, hash)
 	if err1 == nil && isPending == false && tx != nil {
-		msg, err2 := tx.AsMessage(types.MakeSigner((*params.ChainConfig)(chainConfig), GetLastBlock()))
-		err = err2
+		blockNumber, err2 := h.GetLastBlockContext(ctx)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		msg, err2 := tx.AsMessage(types.MakeSigner(h.chainConfig, blockNumber))
+		if err2 != nil {
+			err = err2
+			return
+		}
 		fromAddress = msg.From().Hex()
 		toAddress := msg.To().Hex()
 		transferAmount := msg.Value()
@@ -145,9 +307,9 @@ func (h *ETCHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 		}
 		txOutputs = append(txOutputs, txOutput)
 	} else if err1 != nil {
-		err = err1
+		err = ctypes.ClassifyError(err1)
 	} else if isPending {
-		err = fmt.Errorf("Transaction is pending")
+		err = ctypes.ErrPending
 	} else {
 		err = fmt.Errorf("Unknown error")
 	}
@@ -155,117 +317,78 @@ func (h *ETCHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 }
 
 // args[0] coinType string
+// 以太坊经典出现过 51% 攻击, 需要比以太坊多得多的确认
+var FinalityConfirmations uint64 = 120
+
+// GetTransactionStatus 用 eth_getTransactionReceipt 查询交易的确认数, 见 eth.TransactionStatus
+func (h *ETCHandler) GetTransactionStatus(ctx context.Context, txhash string) (*ctypes.TxStatus, error) {
+	return eth.TransactionStatus(ctx, h.url, h.timeout, txhash, FinalityConfirmations)
+}
+
 func (h *ETCHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *ETCHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
 	// TODO
-	client, err := ethclient.Dial(url)
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	client, err := eth.Dial(ctx, h.url)
 	if err != nil {
 		return
 	}
 	account := common.HexToAddress(address)
-	return client.BalanceAt(context.Background(), account, nil)
+	return client.BalanceAt(ctx, account, nil)
 }
 
-func GetLastBlock() *big.Int {
-	client, err := ethclient.Dial(url)
-	if err != nil {
-		return nil
-	}
-	blk, _ := client.BlockByNumber(context.Background(), nil)
-	return blk.Number()
+// GetLastBlock 返回节点最新区块的高度
+func (h *ETCHandler) GetLastBlock() (*big.Int, error) {
+	return h.GetLastBlockContext(context.Background())
 }
 
-func hexEncPubkey(h string) (ret [64]byte) {
-	b, err := hex.DecodeString(h)
+// GetLastBlockContext 返回 handler 网关上最新区块的高度, 节点出错或者 ctx 取消时返回错误
+func (h *ETCHandler) GetLastBlockContext(ctx context.Context) (*big.Int, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	client, err := eth.Dial(ctx, h.url)
 	if err != nil {
-		panic(err)
-	}
-	if len(b) != len(ret) {
-		panic("invalid length")
-	}
-	copy(ret[:], b)
-	return ret
-}
-
-
-func decodePubkey(e [64]byte) (*ecdsa.PublicKey, error) {
-	p := &ecdsa.PublicKey{Curve: ethcrypto.S256(), X: new(big.Int), Y: new(big.Int)}
-	half := len(e) / 2
-	p.X.SetBytes(e[:half])
-	p.Y.SetBytes(e[half:])
-	if !p.Curve.IsOnCurve(p.X, p.Y) {
-		return nil, errors.New("invalid secp256k1 curve point")
+		return nil, err
 	}
-	return p, nil
-}
-
-func eth_newUnsignedTransaction (client *ethclient.Client, dcrmAddress string, toAddressHex string, amount *big.Int, gasPrice *big.Int, gasLimit uint64) (*types.Transaction, *common.Hash, error) {
-
-	chainID, err := client.NetworkID(context.Background())
+	header, err := client.HeaderByNumber(ctx, nil)
 	if err != nil {
-		return nil, nil, err
-	}
-
-	if gasPrice == nil {
-		gasPrice, err = client.SuggestGasPrice(context.Background())
-		if err != nil {
-			return nil, nil, err
-		}
+		return nil, ctypes.ClassifyError(err)
 	}
+	return header.Number, nil
+}
 
-	fromAddress := common.HexToAddress(dcrmAddress)
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+func eth_sendTx (ctx context.Context, client *ethclient.Client, signedTx *types.Transaction) (string, error) {
+	err := client.SendTransaction(ctx, signedTx)
 	if err != nil {
-		return nil, nil, err
+		return "", ctypes.ClassifyError(err)
 	}
-
-	value := amount
-
-	toAddress := common.HexToAddress(toAddressHex)
-
-	transferFnSignature := []byte("transfer(address,uint256)")
-	hash := sha3.NewKeccak256()
-	hash.Write(transferFnSignature)
-
-	if gasLimit <= 0 {
-		gasLimit, err = client.EstimateGas(context.Background(), ethereum.CallMsg{
-			To:   &toAddress,
-		})
-		gasLimit = gasLimit * 4
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	fmt.Println("gasLimit is ", gasLimit)
-	fmt.Println("gasPrice is ", gasPrice)
-	tx := types.NewTransaction(nonce, toAddress, value, gasLimit, gasPrice, nil)
-
-	signer := types.NewEIP155Signer(chainID)
-	txhash := signer.Hash(tx)
-	return tx, &txhash, nil
+	return signedTx.Hash().Hex(), nil
 }
 
-func makeSignedTransaction(client *ethclient.Client, tx *types.Transaction, rsv string) (*types.Transaction, error) {
-	chainID, err := client.NetworkID(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	message, err := hex.DecodeString(rsv)
-	if err != nil {
-		return nil, err
-	}
-	signer := types.NewEIP155Signer(chainID)
-	signedtx, err := tx.WithSignature(signer, message)
+// payload 是 rlp 编码的未签名交易和构造交易的地址, 见 eth.EncodeUnsignedTransaction
+func (h *ETCHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*ctypes.TxEnvelope, error) {
+	payload, err := eth.EncodeUnsignedTransaction(transaction)
 	if err != nil {
 		return nil, err
 	}
-	return signedtx, nil
+	return ctypes.NewTxEnvelope("ETC", h.network.String(), digests, payload), nil
 }
 
-func eth_sendTx (client *ethclient.Client, signedTx *types.Transaction) (string, error) {
-	err := client.SendTransaction(context.Background(), signedTx)
+func (h *ETCHandler) UnmarshalUnsignedTransaction(env *ctypes.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("ETC", h.network.String()); err != nil {
+		return
+	}
+	if err = env.CheckMinVersion(ctypes.TxEnvelopeSignerVersion); err != nil {
+		return
+	}
+	utx, err := eth.DecodeUnsignedTransaction(env.Payload)
 	if err != nil {
-		return "", err
+		return
 	}
-	return signedTx.Hash().Hex(), nil
+	transaction = utx
+	return
 }
@@ -0,0 +1,26 @@
+package etc
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gaozhengxin/cryptocoins/src/go/eth"
+	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// EstimateFee 用 eth_gasPrice 和 eth_estimateGas 估计转账手续费
+// 节点无法估计时三档的 gas price 都是 ETC_DEFAULT_FEE, gas limit 是默认的 gasLimit
+func (h *ETCHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*ctypes.FeeEstimate, error) {
+	if !common.IsHexAddress(toAddress) {
+		return nil, ctypes.Errorf(ctypes.ErrInvalidAddress, "invalid address %v", toAddress)
+	}
+	to := common.HexToAddress(toAddress)
+	msg := ethereum.CallMsg{
+		From: common.HexToAddress(fromAddress),
+		To: &to,
+		Value: amount,
+	}
+	return eth.EstimateGasFee(ctx, h.url, h.timeout, msg, eth.FixedGasFeeEstimate(ETC_DEFAULT_FEE, gasLimit)), nil
+}
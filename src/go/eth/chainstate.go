@@ -0,0 +1,105 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// TxParams 是 eth 系交易中不依赖链上状态的参数
+// Nonce, GasPrice, GasLimit 为空时使用 ChainState 里的值
+type TxParams struct {
+	From string
+	// 接收地址, erc20 是 token 合约地址
+	To string
+	Value *big.Int
+	// 合约调用的 data, erc20 是 transfer(to, amount)
+	Data []byte
+	Nonce *uint64
+	GasPrice *big.Int
+	GasLimit uint64
+}
+
+// FetchChainState 向节点查询 p 缺少的 nonce, gas price 和 gas limit, 写入 state
+func FetchChainState(ctx context.Context, url string, timeout time.Duration, state *ctypes.ChainState, p *TxParams) error {
+	ctx, cancel := rpcutils.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := Dial(ctx, url)
+	if err != nil {
+		return err
+	}
+	if p.Nonce == nil {
+		nonce, err := client.PendingNonceAt(ctx, common.HexToAddress(p.From))
+		if err != nil {
+			return err
+		}
+		state.Nonce = &nonce
+	}
+	if p.GasPrice == nil {
+		gasPrice, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return err
+		}
+		state.GasPrice = gasPrice
+	}
+	if p.GasLimit == 0 {
+		to := common.HexToAddress(p.To)
+		gasLimit, err := client.EstimateGas(ctx, ethereum.CallMsg{
+			To: &to,
+			Data: p.Data,
+		})
+		if err != nil {
+			return err
+		}
+		gasLimit = gasLimit * 4
+		state.GasLimit = &gasLimit
+	}
+	return nil
+}
+
+// Assemble 用 state 和 p 构造 eth 系的未签名交易, 不访问网络
+// state.ChainID 不为空时必须等于 chainID
+func Assemble(state *ctypes.ChainState, chainID *big.Int, p *TxParams) (*UnsignedTransaction, []string, error) {
+	if state.ChainID != "" && state.ChainID != chainID.String() {
+		return nil, nil, fmt.Errorf("chain state chain id mismatch: got %v, want %v", state.ChainID, chainID)
+	}
+	if !common.IsHexAddress(p.To) {
+		return nil, nil, ctypes.Errorf(ctypes.ErrInvalidAddress, "invalid address %v", p.To)
+	}
+	nonce := p.Nonce
+	if nonce == nil {
+		nonce = state.Nonce
+	}
+	if nonce == nil {
+		return nil, nil, ctypes.MissingStateError("nonce")
+	}
+	gasPrice := p.GasPrice
+	if gasPrice == nil {
+		gasPrice = state.GasPrice
+	}
+	if gasPrice == nil {
+		return nil, nil, ctypes.MissingStateError("gas price")
+	}
+	gasLimit := p.GasLimit
+	if gasLimit == 0 && state.GasLimit != nil {
+		gasLimit = *state.GasLimit
+	}
+	if gasLimit == 0 {
+		return nil, nil, ctypes.MissingStateError("gas limit")
+	}
+	value := p.Value
+	if value == nil {
+		value = big.NewInt(0)
+	}
+	tx := types.NewTransaction(*nonce, common.HexToAddress(p.To), value, gasLimit, gasPrice, p.Data)
+	hash := types.NewEIP155Signer(chainID).Hash(tx)
+	utx := &UnsignedTransaction{Tx: tx, From: common.HexToAddress(p.From)}
+	return utx, []string{hash.Hex()[2:]}, nil
+}
@@ -0,0 +1,32 @@
+package eth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+)
+
+// http(s) 节点的请求经过 rpcutils.Transport, 网关配置了备用节点时发给健康的节点, 查询失败时换节点重试
+var httpClient = &http.Client{Transport: rpcutils.Transport(nil)}
+
+// DialRPC 连接以太坊系节点 url, etc 和 erc20 也用它
+func DialRPC(ctx context.Context, url string) (*rpc.Client, error) {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return rpc.DialHTTPWithClient(url, httpClient)
+	}
+	return rpc.DialContext(ctx, url)
+}
+
+// Dial 和 DialRPC 一样, 返回 ethclient
+func Dial(ctx context.Context, url string) (*ethclient.Client, error) {
+	c, err := DialRPC(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(c), nil
+}
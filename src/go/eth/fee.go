@@ -0,0 +1,74 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// slow, normal, fast 的 gas price 相对 eth_gasPrice 的百分比
+var GasPricePercents = [3]int64{80, 100, 125}
+
+// EstimateFee 用 eth_gasPrice 和 eth_estimateGas 估计转账手续费
+// 节点无法估计时三档的 gas price 都是 ETH_DEFAULT_FEE, gas limit 是默认的 gasLimit
+func (h *ETHHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*ctypes.FeeEstimate, error) {
+	if !common.IsHexAddress(toAddress) {
+		return nil, ctypes.Errorf(ctypes.ErrInvalidAddress, "invalid address %v", toAddress)
+	}
+	to := common.HexToAddress(toAddress)
+	msg := ethereum.CallMsg{
+		From: common.HexToAddress(fromAddress),
+		To: &to,
+		Value: amount,
+	}
+	return EstimateGasFee(ctx, h.url, h.timeout, msg, FixedGasFeeEstimate(ETH_DEFAULT_FEE, gasLimit)), nil
+}
+
+// EstimateGasFee 估计调用 msg 的手续费, 节点无法估计时返回 fallback
+func EstimateGasFee(ctx context.Context, url string, timeout time.Duration, msg ethereum.CallMsg, fallback *ctypes.FeeEstimate) *ctypes.FeeEstimate {
+	ctx, cancel := rpcutils.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := Dial(ctx, url)
+	if err != nil {
+		return fallback
+	}
+	price, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return fallback
+	}
+	limit, err := client.EstimateGas(ctx, msg)
+	if err != nil {
+		return fallback
+	}
+	return GasFeeEstimate(price, limit)
+}
+
+// GasFeeEstimate 返回 gas price 为 price 时三档的手续费, 各档按 GasPricePercents 调整
+func GasFeeEstimate(price *big.Int, limit uint64) *ctypes.FeeEstimate {
+	var quotes [3]ctypes.FeeQuote
+	for i, percent := range GasPricePercents {
+		p := new(big.Int).Mul(price, big.NewInt(percent))
+		p.Div(p, big.NewInt(100))
+		quotes[i] = gasFeeQuote(p, limit)
+	}
+	return &ctypes.FeeEstimate{Slow: quotes[0], Normal: quotes[1], Fast: quotes[2]}
+}
+
+// FixedGasFeeEstimate 返回三档 gas price 相同的默认手续费, Fallback 为 true
+func FixedGasFeeEstimate(price *big.Int, limit uint64) *ctypes.FeeEstimate {
+	q := gasFeeQuote(new(big.Int).Set(price), limit)
+	return &ctypes.FeeEstimate{Slow: q, Normal: q, Fast: q, Fallback: true}
+}
+
+func gasFeeQuote(price *big.Int, limit uint64) ctypes.FeeQuote {
+	return ctypes.FeeQuote{
+		Fee: new(big.Int).Mul(price, new(big.Int).SetUint64(limit)),
+		FeeRate: price,
+		GasLimit: limit,
+	}
+}
@@ -0,0 +1,141 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetAddressHistory 每页扫描的区块数
+var HistoryScanBlocks uint64 = 100
+
+// GetAddressHistory 从最新区块 (或游标指定的区块) 往前扫描 HistoryScanBlocks 个区块, 列出地址的 ETH 转账
+// 节点没有地址索引, 一页可能没有转账, 忽略 page.Limit; 合约内部转账和执行失败的交易不列出
+func (h *ETHHandler) GetAddressHistory(ctx context.Context, address string, page ctypes.PageRequest) (*ctypes.HistoryPage, error) {
+	return ScanHistory(ctx, h.url, h.timeout, address, page)
+}
+
+// ScanHistory 扫描以太坊系节点 url 上地址 address 的转账, 游标是下一个要扫描的区块高度
+func ScanHistory(ctx context.Context, url string, timeout time.Duration, address string, page ctypes.PageRequest) (*ctypes.HistoryPage, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := DialRPC(ctx, url)
+	if err != nil {
+		return nil, ctypes.WrapError(ctypes.ErrGatewayUnavailable, err)
+	}
+	defer client.Close()
+	var from uint64
+	if page.Cursor != "" {
+		if from, err = strconv.ParseUint(page.Cursor, 10, 64); err != nil {
+			return nil, err
+		}
+	} else {
+		var best hexutil.Uint64
+		if err := client.CallContext(ctx, &best, "eth_blockNumber"); err != nil {
+			return nil, ctypes.ClassifyError(err)
+		}
+		from = uint64(best)
+	}
+	n := HistoryScanBlocks
+	if n > from+1 {
+		n = from + 1
+	}
+	blocks := make([]*scanBlock, n)
+	reqs := make([]rpc.BatchElem, n)
+	for i := range reqs {
+		reqs[i] = rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args: []interface{}{hexutil.Uint64(from - uint64(i)), true},
+			Result: &blocks[i],
+		}
+	}
+	if err := client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, ctypes.ClassifyError(err)
+	}
+	address = strings.ToLower(address)
+	ret := &ctypes.HistoryPage{}
+	for i, blk := range blocks {
+		if reqs[i].Error != nil {
+			return nil, ctypes.ClassifyError(reqs[i].Error)
+		}
+		if blk == nil {
+			continue
+		}
+		for _, tx := range blk.Transactions {
+			t := ctypes.Transfer{
+				TxHash: tx.Hash,
+				Amount: (*big.Int)(tx.Value),
+				BlockHeight: uint64(blk.Number),
+				Timestamp: int64(blk.Timestamp),
+			}
+			if strings.ToLower(tx.From) == address {
+				t.Direction = ctypes.DirectionOut
+				t.Counterparty = tx.To
+			} else if strings.ToLower(tx.To) == address {
+				t.Direction = ctypes.DirectionIn
+				t.Counterparty = tx.From
+			} else {
+				continue
+			}
+			ret.Transfers = append(ret.Transfers, t)
+		}
+	}
+	if ret.Transfers, err = dropFailed(ctx, client, ret.Transfers); err != nil {
+		return nil, err
+	}
+	if from >= n {
+		ret.NextCursor = strconv.FormatUint(from - n, 10)
+	}
+	return ret, nil
+}
+
+type scanBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+	Transactions []struct {
+		Hash string `json:"hash"`
+		From string `json:"from"`
+		// 创建合约的交易为空
+		To string `json:"to"`
+		Value *hexutil.Big `json:"value"`
+	} `json:"transactions"`
+}
+
+// 去掉收据 status 为 0 的交易, 这些交易没有转出 ETH
+func dropFailed(ctx context.Context, client *rpc.Client, transfers []ctypes.Transfer) ([]ctypes.Transfer, error) {
+	if len(transfers) == 0 {
+		return transfers, nil
+	}
+	receipts := make([]*struct {
+		Status *hexutil.Uint64 `json:"status"`
+	}, len(transfers))
+	reqs := make([]rpc.BatchElem, len(transfers))
+	for i, t := range transfers {
+		reqs[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args: []interface{}{t.TxHash},
+			Result: &receipts[i],
+		}
+	}
+	if err := client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, ctypes.ClassifyError(err)
+	}
+	var ret []ctypes.Transfer
+	for i, t := range transfers {
+		if reqs[i].Error != nil {
+			return nil, ctypes.ClassifyError(reqs[i].Error)
+		}
+		if r := receipts[i]; r != nil && r.Status != nil && *r.Status == 0 {
+			continue
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
@@ -0,0 +1,62 @@
+package eth
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 以太坊交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 12
+
+// GetTransactionStatus 用 eth_getTransactionReceipt 查询交易的确认数, status 为 0 (revert) 的交易是 TxFailed
+func (h *ETHHandler) GetTransactionStatus(ctx context.Context, txhash string) (*ctypes.TxStatus, error) {
+	return TransactionStatus(ctx, h.url, h.timeout, txhash, FinalityConfirmations)
+}
+
+// TransactionStatus 查询以太坊系节点 url 上交易的状态, threshold 是最终确认数, timeout 见 rpcutils.WithTimeout
+// etc 和 erc20 也用这个函数
+func TransactionStatus(ctx context.Context, url string, timeout time.Duration, txhash string, threshold uint64) (*ctypes.TxStatus, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, timeout)
+	defer cancel()
+	client, err := DialRPC(ctx, url)
+	if err != nil {
+		return nil, ctypes.WrapError(ctypes.ErrGatewayUnavailable, err)
+	}
+	defer client.Close()
+	var receipt *struct {
+		BlockHash string `json:"blockHash"`
+		BlockNumber *hexutil.Uint64 `json:"blockNumber"`
+		// 拜占庭分叉之前的收据没有 status
+		Status *hexutil.Uint64 `json:"status"`
+	}
+	if err := client.CallContext(ctx, &receipt, "eth_getTransactionReceipt", txhash); err != nil {
+		return nil, ctypes.ClassifyError(err)
+	}
+	if receipt == nil || receipt.BlockNumber == nil {
+		// 没有收据, 看交易是不是还在交易池里
+		var tx *struct {
+			Hash string `json:"hash"`
+		}
+		if err := client.CallContext(ctx, &tx, "eth_getTransactionByHash", txhash); err != nil {
+			return nil, ctypes.ClassifyError(err)
+		}
+		if tx == nil {
+			return ctypes.UnknownTxStatus(txhash, threshold), nil
+		}
+		return ctypes.MempoolTxStatus(txhash, threshold), nil
+	}
+	var best hexutil.Uint64
+	if err := client.CallContext(ctx, &best, "eth_blockNumber"); err != nil {
+		return nil, ctypes.ClassifyError(err)
+	}
+	height := uint64(*receipt.BlockNumber)
+	status := ctypes.IncludedTxStatus(txhash, height, receipt.BlockHash, ctypes.Confirmations(height, uint64(best)), threshold)
+	if receipt.Status != nil && *receipt.Status == 0 {
+		status.State = ctypes.TxFailed
+	}
+	return status, nil
+}
@@ -0,0 +1,82 @@
+package eth
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
+	ctypes "github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// UnsignedTransaction 是 eth 系 (eth, etc, erc20) 的未签名交易和构造交易的地址
+// MakeSignedTransaction 校验签名者是 From
+type UnsignedTransaction struct {
+	Tx *types.Transaction
+	From common.Address
+}
+
+// EncodeUnsignedTransaction 是信封的 payload, rlp 编码的 [tx, from]
+func EncodeUnsignedTransaction(transaction interface{}) ([]byte, error) {
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	return rlp.EncodeToBytes(utx)
+}
+
+// DecodeUnsignedTransaction 解码 EncodeUnsignedTransaction 的结果
+func DecodeUnsignedTransaction(payload []byte) (*UnsignedTransaction, error) {
+	utx := new(UnsignedTransaction)
+	if err := rlp.DecodeBytes(payload, utx); err != nil {
+		return nil, err
+	}
+	return utx, nil
+}
+
+// FromAddress 返回构造交易的公钥 fromPublicKey 的地址, 作为 UnsignedTransaction 的 From
+// fromAddress 可以为空, 不为空时必须是公钥的地址, 否则返回 ErrInvalidAddress
+func FromAddress(fromAddress, fromPublicKey string) (string, error) {
+	pub, err := signature.ParsePublicKey(fromPublicKey)
+	if err != nil {
+		return "", err
+	}
+	from := ethcrypto.PubkeyToAddress(*pub.ToECDSA())
+	if fromAddress != "" && (!common.IsHexAddress(fromAddress) || common.HexToAddress(fromAddress) != from) {
+		return "", ctypes.Errorf(ctypes.ErrInvalidAddress, "from address %v does not match public key address %v", fromAddress, from.Hex())
+	}
+	return from.Hex(), nil
+}
+
+// MakeSignedTransaction 组装 eth 系的签名交易, transaction 是 *UnsignedTransaction
+// 签名必须是 low S, 并且用 v 恢复出的地址是 From, 否则返回 *ctypes.SignatureError
+// From 为空时无法校验签名者, 返回 ErrInvalidSignature
+func MakeSignedTransaction(transaction interface{}, rsv []string, chainID *big.Int) (*types.Transaction, error) {
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	if len(rsv) != 1 {
+		return nil, fmt.Errorf("expect 1 signature, got %v", len(rsv))
+	}
+	if utx.From == (common.Address{}) {
+		return nil, ctypes.Errorf(ctypes.ErrInvalidSignature, "unsigned transaction has no from address")
+	}
+	signer := types.NewEIP155Signer(chainID)
+	digest := signer.Hash(utx.Tx)
+	sig, err := signature.CheckSigner(0, rsv[0], digest[:], func(pub *btcec.PublicKey) bool {
+		return ethcrypto.PubkeyToAddress(*pub.ToECDSA()) == utx.From
+	}, signature.Rules{LowS: true, Recovery: true})
+	if err != nil {
+		return nil, err
+	}
+	b, err := sig.Ethereum()
+	if err != nil {
+		return nil, &ctypes.SignatureError{Index: 0, Err: err}
+	}
+	return utx.Tx.WithSignature(signer, b)
+}
@@ -1,9 +1,9 @@
 package evt
 
 import (
+	"context"
 	"crypto/elliptic"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -11,9 +11,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"github.com/gaozhengxin/cryptocoins/src/go/eos"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcutil"
 	"github.com/ellsol/evt/ecc"
@@ -25,25 +26,64 @@ import (
 	"github.com/ellsol/evt/evttypes"
 	//"github.com/ellsol/evt/transaction/fungible"
 	//ethcrypto "github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/crypto/secp256k1"
 	"github.com/sirupsen/logrus"
 )
 
+// 默认网络
+const DefaultNetwork = types.Testnet
+
+// fungible token 金额的小数位数
+const Decimals = 5
+
+// evt 地址就是公钥, 网络只决定网关
+var networks = map[types.Network]bool{
+	types.Mainnet: true,
+	types.Testnet: true,
+}
+
 type EvtHandler struct {
 	TokenId uint
+	network types.Network
+	apiAddress string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
 }
 
 var r *rand.Rand
 
 // 只支持fungible token
 func NewEvtHandler (tokenId string) *EvtHandler {
+	h, _ := NewEvtHandlerForNetwork(tokenId, DefaultNetwork)
+	return h
+}
+
+// NewEvtHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewEvtHandlerForNetwork (tokenId string, network types.Network) (*EvtHandler, error) {
+	return NewEvtHandlerFromConfig(tokenId, network, config.Current())
+}
+
+// NewEvtHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 EVTGateway
+func NewEvtHandlerFromConfig (tokenId string, network types.Network, gateways *config.ApiGatewayConfigs) (*EvtHandler, error) {
 	tid, err := strconv.Atoi(strings.TrimPrefix(tokenId,"EVT"))
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("invalid evt token %v", tokenId)
 	}
+	network = network.Or(DefaultNetwork)
+	if !networks[network] {
+		return nil, types.UnsupportedNetworkError("EVT", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).EVTGateway
+	rpcutils.RegisterApiGateway(gateway, nil, gateways.HealthCheckInterval())
 	return &EvtHandler{
 		TokenId: uint(tid),
-	}
+		network: network,
+		apiAddress: gateway.ApiAddress,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *EvtHandler) Network() types.Network {
+	return h.network
 }
 
 // EVT地址就是EVT格式的pubkey
@@ -57,40 +97,114 @@ func (h *EvtHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 }
 
 func (h *EvtHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
 
-	key := strconv.Itoa(int(h.TokenId))
-	//number := "0.00010 S#1001"
-	number := makeEVTFTNumber(amount, key)
-
-	// 1. abi_json_to_bin https://www.everitoken.io/developers/apis,_sdks_and_tools/abi_reference
-	args := chain.Args{
-		Transfer:chain.ActionType{
-			Name:"transfer",
-			Threshold:1,
-			Authorizers:[]chain.Authorizers{chain.Authorizers{Ref:"[A] "+fromAddress,Weight:1}},
-		},
-		From:fromAddress,
-		To:toAddress,
-		Number:number,
-		Memo:"this is a dcrm lockout (^_^)",
-	}
-	actarg := chain.ActionArguments{
-		Action:"transferft",
-		Args:args,
-	}
-	bb, _ := json.Marshal(actarg)
-	fmt.Printf("\n%+v\n",string(bb))
-
-	evtcfg := evtconfig.New(config.ApiGateways.EVTGateway.ApiAddress)
-	clt := client.New(evtcfg, logrus.New())
-	apichain := chain.New(evtcfg, clt)
+// evt sdk 不支持 context, 整个请求过程放到 rpcutils.DoContext 里执行
+func (h *EvtHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
 
-	res, apierr := apichain.AbiJsonToBin(&actarg)
-	if apierr != nil {
-		err = apierr.Error()
+var SupportedBuildOptions = []string{types.OptMemo}
+
+func (h *EvtHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *EvtHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: true,
+		Balance: true,
+		MultiOutput: true,
+		Memo: true,
+		Tokens: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			return networks[n]
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *EvtHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "EVT"+strconv.Itoa(int(h.TokenId)),
+		Decimals: Decimals,
+		SLIP44: types.SLIP44Unregistered,
+		AddressFormat: types.AddressEVT,
+	}
+}
+
+func (h *EvtHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("EVT"+strconv.Itoa(int(h.TokenId)), SupportedBuildOptions...); err != nil {
 		return
 	}
-	fmt.Printf("%v\n",res)
+	memo := "this is a dcrm lockout (^_^)"
+	if opts != nil && opts.Memo != nil {
+		memo = *opts.Memo
+	}
+	var trx interface{}
+	var ds []string
+	err = rpcutils.DoContext(ctx, h.timeout, func() (e error) {
+		trx, ds, e = h.buildUnsignedTransaction(fromAddress, fromPublicKey, toAddress, amount, memo)
+		return
+	})
+	if err != nil {
+		return
+	}
+	return trx, ds, nil
+}
+
+func (h *EvtHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("EVT"+strconv.Itoa(int(h.TokenId)), SupportedBuildOptions...); err != nil {
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	for i, out := range outputs {
+		if _, err1 := ecc.NewPublicKey(out.ToAddress); err1 != nil {
+			err = types.Errorf(types.ErrInvalidAddress, "output %v: invalid address %v: %v", i, out.ToAddress, err1)
+			return
+		}
+	}
+	memo := "this is a dcrm lockout (^_^)"
+	if opts != nil && opts.Memo != nil {
+		memo = *opts.Memo
+	}
+	var trx interface{}
+	var ds []string
+	err = rpcutils.DoContext(ctx, h.timeout, func() (e error) {
+		trx, ds, e = h.buildUnsignedBatchTransaction(fromAddress, fromPublicKey, outputs, memo)
+		return
+	})
+	if err != nil {
+		return
+	}
+	return trx, ds, nil
+}
+
+func (h *EvtHandler) buildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, memo string) (transaction interface{}, digests []string, err error) {
+	return h.buildUnsignedBatchTransaction(fromAddress, fromPublicKey, []types.TxOutput{{ToAddress: toAddress, Amount: amount}}, memo)
+}
+
+// 每个收款人一个 transferft action
+func (h *EvtHandler) buildUnsignedBatchTransaction(fromAddress, fromPublicKey string, outputs []types.TxOutput, memo string) (transaction interface{}, digests []string, err error) {
+
+	key := strconv.Itoa(int(h.TokenId))
+
+	evtcfg := evtconfig.New(h.apiAddress)
+	clt := client.New(evtcfg, logrus.New())
+	apichain := chain.New(evtcfg, clt)
 
 	// 2. evttypes.Trxjson
 	action := evttypes.Action{
@@ -103,9 +217,39 @@ func (h *EvtHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddr
 		Key:key,
 		//Key:"1001",
 	}
+
+	var actions []evttypes.SimpleAction
+	for _, out := range outputs {
+		//number := "0.00010 S#1001"
+		number := makeEVTFTNumber(out.Amount, key)
+
+		// 1. abi_json_to_bin https://www.everitoken.io/developers/apis,_sdks_and_tools/abi_reference
+		args := chain.Args{
+			Transfer:chain.ActionType{
+				Name:"transfer",
+				Threshold:1,
+				Authorizers:[]chain.Authorizers{chain.Authorizers{Ref:"[A] "+fromAddress,Weight:1}},
+			},
+			From:fromAddress,
+			To:out.ToAddress,
+			Number:number,
+			Memo:memo,
+		}
+		actarg := chain.ActionArguments{
+			Action:"transferft",
+			Args:args,
+		}
+		res, apierr := apichain.AbiJsonToBin(&actarg)
+		if apierr != nil {
+			err = apierr.Error()
+			return
+		}
+		actions = append(actions, evttypes.SimpleAction{Action:action,Data:res.Binargs})
+	}
+
 	trx := &evttypes.TRXJson{
 		MaxCharge: 10000,
-		Actions: []evttypes.SimpleAction{evttypes.SimpleAction{Action:action,Data:res.Binargs}},
+		Actions: actions,
 		//Actions: []evttypes.SimpleAction{evttypes.SimpleAction{Action:action,Data:"010003c1a8dd2d6acd8891bddfc02bc4970a0569756ed19a2ed75515fa458e8cf979fd00e1f50500000000e903000005000000116920697373756520746f206d7973656c66"}},
 		Payer: fromAddress,
 		TransactionExtensions: make([]interface{},0),
@@ -118,7 +262,6 @@ func (h *EvtHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddr
 		err = apierr.Error()
 		return
 	}
-	fmt.Printf("\n\ncnm\ngetinfo result\n%+v\nmsln\n\n",res2)
 
 	headtime, _ := time.Parse(layout,res2.HeadBlockTime)
 	exptime := headtime.Add(time.Duration(60)*time.Minute)
@@ -135,20 +278,14 @@ func (h *EvtHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddr
 	}
 	trx.RefBlockPrefix = res3.RefBlockPrefix
 
-	b, _ := json.Marshal(trx)
-	fmt.Printf("\ncnm\ntrx is \n%+v\n\n%v\nnmsl\n\n",trx,string(b))
-
 	// 4. TRXJsonToDigest
 	res4, apierr := apichain.TRXJsonToDigest(trx)
 	if apierr != nil {
 		err = apierr.Error()
 		return
 	}
-	fmt.Printf("\ncnm\nnmsl\nres is \n%+v\n\n",res3)
 
-	transaction = trx
-	fmt.Printf("transaction:\n%+v\n",transaction)
-	fmt.Printf("digests:\n%+v\n",digests)
+	transaction = &UnsignedTransaction{Trx: trx, Digest: res4.Digest}
 	digests = append(digests,res4.Digest)
 	return
 }
@@ -173,65 +310,33 @@ func (h *EvtHandler) SignTransaction (hash []string, wif interface{}) (rsv []str
 */
 
 
-///*
-	var rsvBytes []byte
-	for i:=0; i<25; i++ {
-		fmt.Printf("\ntry %v\n", i)
-		src := rand.NewSource(time.Now().UnixNano())
-		r = rand.New(src)
-		pkwif, err1 :=  btcutil.DecodeWIF(wif.(string))
+	pkwif, err := btcutil.DecodeWIF(wif.(string))
+	if err != nil {
+		return
+	}
+	privateKey := pkwif.PrivKey
+	hashBytes, err := hex.DecodeString(hash[0])
+	if err != nil {
+		return
+	}
+	// 随机 nonce 签名, 直到签名满足 evt 节点的 canonical 规则
+	for i := 0; i < 25; i++ {
+		rs, err1 := RandNonceSign(privateKey, hashBytes)
 		if err1 != nil {
 			err = err1
 			return
 		}
-		privateKey := pkwif.PrivKey
-		hashBytes, err2 := hex.DecodeString(hash[0])
+		sig, err2 := signature.New(rs.R, rs.S, hashBytes, privateKey.PubKey())
 		if err2 != nil {
 			err = err2
 			return
 		}
-		//rsvBytes1, err3 := ethcrypto.Sign(hashBytes, privateKey.ToECDSA())
-		sig, err3 := RandNonceSign(privateKey, hashBytes)
-		if err3 != nil {
-			err = err3
+		if sig.IsEOSCanonical() {
+			rsv = append(rsv, sig.String())
 			return
 		}
-		rsvBytes1 := append(sig.R.Bytes(), sig.S.Bytes()...)
-		pk := privateKey.PubKey().SerializeUncompressed()
-		v := byte(0)
-		fmt.Printf("msg length is %v\n",len(hashBytes))
-		for j := 0; j < (btcec.S256().H+1)*2; j ++ {
-			rsvBytes2 := append(rsvBytes1, byte(j))
-			pkr, e := secp256k1.RecoverPubkey(hashBytes,rsvBytes2)
-			if e == nil && Equal(pk, pkr) {
-				fmt.Printf("v = %v, ojbk\n",j)
-				v = byte(j)
-				break
-			}
-			fmt.Printf("%v\n",e)
-			fmt.Printf("pk is %v\npkr is %v\n", pk, pkr)
-			fmt.Printf("v = %v, not ok\n",j)
-		}
-		rsvBytes1 = append(rsvBytes1, v)
-		fmt.Printf("\nrsvBytes1 is %v\n\n", rsvBytes1)
-		compactSig, err4 := eos.RSVToSignature(hex.EncodeToString(rsvBytes1))
-		if err4 != nil {
-			err = err4
-			return
-		}
-		fmt.Printf("%v\n", compactSig)
-		if eos.IsCanonical(compactSig.Content) {
-			rsvBytes = rsvBytes1
-			fmt.Println("is canonical!")
-			break
-		}
 	}
-	if len(rsvBytes) == 0 {
-		return nil, fmt.Errorf("!!!!\nfail to produce a canonical signature\n!!!!")
-	}
-	rsv = append(rsv, hex.EncodeToString(rsvBytes))
-//*/
-
+	return nil, fmt.Errorf("fail to produce a canonical signature")
 
 	// 用eoscanada/eos-go的方法签名, 不会报is not canonical
 /*
@@ -249,13 +354,10 @@ func (h *EvtHandler) SignTransaction (hash []string, wif interface{}) (rsv []str
 	rsvBytes := append(vrs[1:], v)
 	rsv = append(rsv, hex.EncodeToString(rsvBytes))
 */
-
-	fmt.Printf("!!!!!!!! Sign Transaction !!!!!!!!!    rsv is %v\n\n",rsv)
-	return
 }
 
 func makeEVTFTNumber (amt *big.Int, tokenid string) string {
-	return strconv.FormatFloat(float64(amt.Int64()) / 100000, 'f', 5, 64) + " S#" + tokenid
+	return types.FormatUnits(amt, Decimals) + " S#" + tokenid
 }
 
 func Equal(x []byte, y []byte) bool {
@@ -320,8 +422,18 @@ func hashToInt(hash []byte, c elliptic.Curve) *big.Int {
 	return ret
 }
 
+// MakeSignedTransaction 校验签名是 Payer 对 digest 的签名, 失败返回 *types.SignatureError
 func (h *EvtHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
-	sig, err := eos.RSVToSignature(rsv[0])
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", transaction)
+		return
+	}
+	rs, err := utx.checkSignature(rsv)
+	if err != nil {
+		return
+	}
+	sig, err := rs.EOS()
 	if err != nil {
 		return
 	}
@@ -329,31 +441,70 @@ func (h *EvtHandler) MakeSignedTransaction(rsv []string, transaction interface{}
 	signedTransaction = &evttypes.SignedTRXJson{
 		Signatures: []string{sig.String()},
 		Compression: "none",
-		Transaction: transaction.(*evttypes.TRXJson),
+		Transaction: utx.Trx,
 	}
 	return
 }
 
+func (h *EvtHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *EvtHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *EvtHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	var hash string
+	err = rpcutils.DoContext(ctx, h.timeout, func() (e error) {
+		hash, e = h.submitTransaction(signedTransaction)
+		return
+	})
+	if err != nil {
+		err = types.ClassifyError(err)
+		return
+	}
+	return hash, nil
+}
+
+func (h *EvtHandler) submitTransaction(signedTransaction interface{}) (txhash string, err error) {
 	// chain/push_transaction
-	fmt.Println("!!!!!!!! SubmitTransaction !!!!!!!!")
-	evtcfg := evtconfig.New(config.ApiGateways.EVTGateway.ApiAddress)
+	stx, ok := signedTransaction.(*evttypes.SignedTRXJson)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	evtcfg := evtconfig.New(h.apiAddress)
 	clt := client.New(evtcfg, logrus.New())
 	apichain := chain.New(evtcfg, clt)
-	b, _ := json.Marshal(signedTransaction)
-	fmt.Println(string(b))
-	res, apierr := apichain.PushTransaction(signedTransaction.(*evttypes.SignedTRXJson))
+	res, apierr := apichain.PushTransaction(stx)
 	if apierr != nil {
 		err = apierr.Error()
-		fmt.Println(err)
 		return
 	}
 	txhash = res.TransactionId
-	fmt.Println(txhash)
 	return
 }
 
 func (h *EvtHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *EvtHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	var from, js string
+	var outs []types.TxOutput
+	err = rpcutils.DoContext(ctx, h.timeout, func() (e error) {
+		from, outs, js, e = h.getTransactionInfo(txhash)
+		return
+	})
+	if err != nil {
+		err = types.ClassifyError(err)
+		return
+	}
+	return from, outs, js, nil
+}
+
+func (h *EvtHandler) getTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
@@ -361,7 +512,7 @@ func (h *EvtHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 		}
 	} ()
 
-	evtcfg := evtconfig.New(config.ApiGateways.EVTGateway.ApiAddress)
+	evtcfg := evtconfig.New(h.apiAddress)
 	clt := client.New(evtcfg, logrus.New())
 	apihistory := history.New(evtcfg, clt)
 	res, apierr := apihistory.GetTransaction(txhash)
@@ -392,24 +543,20 @@ func parseAction (tarid uint, transfer *chain.Action) (*types.TxOutput, error) {
 		if uint(symid) != tarid {
 			return nil, fmt.Errorf("sym id is %v, want %v", symid, tarid)
 		}
-		amtstr := strings.Replace(strings.Split(transfer.Data.Number," ")[0],".","",-1)
-		fmt.Printf("amtstr is %s\n", amtstr)
-		amt, ok := new(big.Int).SetString(amtstr, 10)
-		if !ok {
-			err := fmt.Errorf("transfer amount error: %s", transfer.Data.Number)
+		amt, err := types.ParseUnits(strings.Split(transfer.Data.Number," ")[0], Decimals)
+		if err != nil {
+			err = fmt.Errorf("transfer amount error: %s", transfer.Data.Number)
 			return nil, err
 		}
 		txout := &types.TxOutput{ToAddress:transfer.Data.To,Amount:amt}
-		fmt.Printf("txout is %+v\n", txout)
 		return txout, nil
 	}
 	if transfer.Name == "issuefungible" {
-		amtstr := strings.Replace(strings.Split(transfer.Data.Number," ")[0],".","",-1)
-                amt, ok := new(big.Int).SetString(amtstr, 10)
-                if !ok {
-			err := fmt.Errorf("transfer amount error: %s", transfer.Data.Number)
-                        return nil, err
-                }
+		amt, err := types.ParseUnits(strings.Split(transfer.Data.Number," ")[0], Decimals)
+		if err != nil {
+			err = fmt.Errorf("transfer amount error: %s", transfer.Data.Number)
+			return nil, err
+		}
 		txout := &types.TxOutput{ToAddress:transfer.Data.Address,Amount:amt}
 		return txout, nil
 	}
@@ -417,6 +564,22 @@ func parseAction (tarid uint, transfer *chain.Action) (*types.TxOutput, error) {
 }
 
 func (h *EvtHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *EvtHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	var bal *big.Int
+	err = rpcutils.DoContext(ctx, h.timeout, func() (e error) {
+		bal, e = h.getAddressBalance(address, jsonstring)
+		return
+	})
+	if err != nil {
+		return
+	}
+	return bal, nil
+}
+
+func (h *EvtHandler) getAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
@@ -424,7 +587,7 @@ func (h *EvtHandler) GetAddressBalance(address string, jsonstring string) (balan
 		}
 	} ()
 
-	evtcfg := evtconfig.New(config.ApiGateways.EVTGateway.ApiAddress)
+	evtcfg := evtconfig.New(h.apiAddress)
 	clt := client.New(evtcfg, logrus.New())
 	apievt := evt.New(evtcfg, clt)
 	res, apierr := apievt.GetFungibleBalance(h.TokenId, address)
@@ -432,9 +595,8 @@ func (h *EvtHandler) GetAddressBalance(address string, jsonstring string) (balan
 		err = apierr.Error()
 		return
 	}
-	amtstr := strings.Replace(strings.Split((*res)[0]," ")[0],".","",-1)
-	balance, ok := new(big.Int).SetString(amtstr, 10)
-	if !ok {
+	balance, err = types.ParseUnits(strings.Split((*res)[0]," ")[0], Decimals)
+	if err != nil {
 		err = fmt.Errorf("transfer amount error: %s", (*res)[0])
 		return
 	}
@@ -455,30 +617,34 @@ func PubKeyToHex(pk string) (pubKeyHex string, _ error) {
 }
 
 func HexToPubKey(pubKeyHex string) (ecc.PublicKey, error) {
-	fmt.Printf("hex is %v\nlen(hex) is %v\n\n", pubKeyHex, len(pubKeyHex))
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	// TODO 判断长度
-	if len(pubKeyHex) == 130 {
-		uBytes, err := hex.DecodeString(pubKeyHex)
-		if err != nil {
-			return ecc.PublicKey{}, err
-		}
-		pubkey, err := btcec.ParsePubKey(uBytes, btcec.S256())
-		if err != nil {
-			return ecc.PublicKey{}, err
-		}
-		pubkeyBytes := pubkey.SerializeCompressed()
-		pubkeyBytes = append([]byte{0}, pubkeyBytes...)  // byte{0} 表示 curve K1, byte{1} 表示 curve R1
-		return ecc.NewPublicKeyFromData(pubkeyBytes)
+	pubkey, err := signature.ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return ecc.PublicKey{}, err
 	}
+	pubkeyBytes := append([]byte{0}, pubkey.SerializeCompressed()...)  // byte{0} 表示 curve K1, byte{1} 表示 curve R1
+	return ecc.NewPublicKeyFromData(pubkeyBytes)
+}
 
-	if len(pubKeyHex) == 66 {
-		pubkeyBytes, _ := hex.DecodeString(pubKeyHex)
-		pubkeyBytes = append([]byte{0}, pubkeyBytes...)
-		return ecc.NewPublicKeyFromData(pubkeyBytes)
+// payload 是 UnsignedTransaction 的 json, 包括 evttypes.TRXJson 和 digest
+func (h *EvtHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	payload, err := encodeUnsignedTransaction(transaction)
+	if err != nil {
+		return nil, err
 	}
+	return types.NewTxEnvelope("EVT"+strconv.Itoa(int(h.TokenId)), h.network.String(), digests, payload), nil
+}
 
-	return ecc.PublicKey{}, fmt.Errorf("unexpected public key length  %v", len(pubKeyHex))
+func (h *EvtHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("EVT"+strconv.Itoa(int(h.TokenId)), h.network.String()); err != nil {
+		return
+	}
+	if err = env.CheckMinVersion(types.TxEnvelopeSignerVersion); err != nil {
+		return
+	}
+	utx, err := decodeUnsignedTransaction(env.Payload)
+	if err != nil {
+		return
+	}
+	transaction = utx
+	return
 }
@@ -0,0 +1,79 @@
+package evt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetAddressHistory 用 history 的 get_fungible_actions 查询地址在 handler 的 token 上的转账和发行
+// 游标是已经返回的 action 数 (skip), 接口不返回区块高度
+func (h *EvtHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	skip := 0
+	if page.Cursor != "" {
+		var err error
+		if skip, err = strconv.Atoi(page.Cursor); err != nil {
+			return nil, fmt.Errorf("invalid cursor %v", page.Cursor)
+		}
+	}
+	limit := page.PageLimit()
+	req := map[string]interface{}{"sym_id": h.TokenId, "addr": address, "dire": "desc", "skip": skip, "take": limit}
+	ret, err := h.apiCall(ctx, "v1/history/get_fungible_actions", req)
+	if err != nil {
+		return nil, err
+	}
+	var actions []struct {
+		Name string `json:"name"`
+		TrxId string `json:"trx_id"`
+		CreatedAt string `json:"created_at"`
+		Data struct {
+			From string `json:"from"`
+			To string `json:"to"`
+			// issuefungible 的收款地址
+			Address string `json:"address"`
+			Number string `json:"number"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(ret, &actions); err != nil {
+		return nil, types.Errorf(types.ErrGatewayUnavailable, "get_fungible_actions error: %v", string(ret))
+	}
+	hist := &types.HistoryPage{}
+	for _, act := range actions {
+		// number 形如 "1.00000 S#1"
+		amount, err := types.ParseUnits(strings.Split(act.Data.Number, " ")[0], Decimals)
+		if err != nil {
+			continue
+		}
+		t := types.Transfer{
+			TxHash: act.TrxId,
+			Direction: types.DirectionIn,
+			Amount: amount,
+		}
+		switch {
+		case act.Name == "issuefungible" && act.Data.Address == address:
+		case act.Name == "transferft" && act.Data.From == address:
+			t.Direction = types.DirectionOut
+			t.Counterparty = act.Data.To
+		case act.Name == "transferft" && act.Data.To == address:
+			t.Counterparty = act.Data.From
+		default:
+			continue
+		}
+		if tm, err := time.Parse("2006-01-02T15:04:05", act.CreatedAt); err == nil {
+			t.Timestamp = tm.Unix()
+		}
+		hist.Transfers = append(hist.Transfers, t)
+	}
+	if len(actions) >= limit {
+		hist.NextCursor = strconv.Itoa(skip + len(actions))
+	}
+	return hist, nil
+}
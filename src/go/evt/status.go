@@ -0,0 +1,103 @@
+package evt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetTransactionStatus 用 history 的 get_transaction 查询交易所在的区块
+// 和 eos 一样, 区块不高于 last irreversible block 时交易不会被回滚, FinalityThreshold 是 head 到 lib 的距离
+// evt 只保存执行成功的交易, 没有 TxFailed
+func (h *EvtHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	head, lib, err := h.chainInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	threshold := types.Confirmations(lib, head)
+	ret, err := h.apiCall(ctx, "v1/history/get_transaction", map[string]string{"id": txhash})
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			return types.UnknownTxStatus(txhash, threshold), nil
+		}
+		return nil, err
+	}
+	var tx struct {
+		BlockNum uint64 `json:"block_num"`
+	}
+	if err := json.Unmarshal(ret, &tx); err != nil {
+		return nil, types.Errorf(types.ErrGatewayUnavailable, "get_transaction error: %v", string(ret))
+	}
+	if tx.BlockNum == 0 {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	blockID, err := h.blockID(ctx, tx.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	return types.IncludedTxStatus(txhash, tx.BlockNum, blockID, types.Confirmations(tx.BlockNum, head), threshold), nil
+}
+
+// 返回 head block 和 last irreversible block 的高度
+func (h *EvtHandler) chainInfo(ctx context.Context) (head, lib uint64, err error) {
+	ret, err := h.apiCall(ctx, "v1/chain/get_info", nil)
+	if err != nil {
+		return
+	}
+	var info struct {
+		HeadBlockNum uint64 `json:"head_block_num"`
+		LastIrreversibleBlockNum uint64 `json:"last_irreversible_block_num"`
+	}
+	if err = json.Unmarshal(ret, &info); err != nil || info.HeadBlockNum == 0 {
+		err = types.Errorf(types.ErrGatewayUnavailable, "get_info error: %v", string(ret))
+		return
+	}
+	return info.HeadBlockNum, info.LastIrreversibleBlockNum, nil
+}
+
+// 返回高度为 num 的区块的 id
+func (h *EvtHandler) blockID(ctx context.Context, num uint64) (string, error) {
+	ret, err := h.apiCall(ctx, "v1/chain/get_block", map[string]uint64{"block_num_or_id": num})
+	if err != nil {
+		return "", err
+	}
+	var blk struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(ret, &blk); err != nil || blk.Id == "" {
+		return "", types.ClassifyError(fmt.Errorf("get_block error: %v", string(ret)))
+	}
+	return blk.Id, nil
+}
+
+// apiCall 把 req 编码成 json POST 到网关的 api, req 为 nil 时不带请求内容
+// 节点出错时返回非 2xx 和 {"error":{"name":..,"what":..}}, 这时返回分类后的错误
+func (h *EvtHandler) apiCall(ctx context.Context, api string, req interface{}) ([]byte, error) {
+	var data []byte
+	if req != nil {
+		var err error
+		if data, err = json.Marshal(req); err != nil {
+			return nil, err
+		}
+	}
+	ret, err := rpcutils.PostJSON(ctx, h.apiAddress, api, string(data))
+	if err != nil {
+		var res struct {
+			Error *struct {
+				Name string `json:"name"`
+				What string `json:"what"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(ret, &res) == nil && res.Error != nil {
+			return nil, types.ClassifyError(fmt.Errorf("%v, message: %v", res.Error.Name, res.Error.What))
+		}
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,74 @@
+package evt
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/ellsol/evt/evttypes"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// UnsignedTransaction 是未签名交易和节点算出的 digest
+// MakeSignedTransaction 校验签名是 Payer 对 Digest 的签名
+type UnsignedTransaction struct {
+	Trx *evttypes.TRXJson `json:"trx"`
+	Digest string `json:"digest"`
+}
+
+// 信封的 payload 是 UnsignedTransaction 的 json
+func encodeUnsignedTransaction(transaction interface{}) ([]byte, error) {
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	return json.Marshal(utx)
+}
+
+func decodeUnsignedTransaction(payload []byte) (*UnsignedTransaction, error) {
+	utx := new(UnsignedTransaction)
+	if err := json.Unmarshal(payload, utx); err != nil {
+		return nil, err
+	}
+	if utx.Trx == nil {
+		return nil, fmt.Errorf("payload has no trx")
+	}
+	return utx, nil
+}
+
+// payerKey 解析 EVT 开头的公钥
+func payerKey(payer string) (*btcec.PublicKey, error) {
+	if !strings.HasPrefix(payer, "EVT") {
+		return nil, fmt.Errorf("payer %v is not a public key", payer)
+	}
+	b := base58.Decode(payer[3:])
+	if len(b) != 37 {
+		return nil, fmt.Errorf("payer %v is not a public key", payer)
+	}
+	return btcec.ParsePubKey(b[:33], btcec.S256())
+}
+
+// checkSignature 校验 rsv 是 Payer 对 Digest 的签名, 并且满足 evt 节点的 canonical 规则
+// Digest 为空时无法校验签名者, 返回 ErrInvalidSignature
+func (utx *UnsignedTransaction) checkSignature(rsv []string) (*signature.RSV, error) {
+	if len(rsv) != 1 {
+		return nil, fmt.Errorf("expect 1 signature, got %v", len(rsv))
+	}
+	if utx.Digest == "" {
+		return nil, types.Errorf(types.ErrInvalidSignature, "unsigned transaction has no digest")
+	}
+	rules := signature.Rules{Recovery: true, EOSCanonical: true}
+	digest, err := hex.DecodeString(utx.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest %v: %v", utx.Digest, err)
+	}
+	pub, err := payerKey(utx.Trx.Payer)
+	if err != nil {
+		return nil, err
+	}
+	return signature.Check(0, rsv[0], digest, pub, rules)
+}
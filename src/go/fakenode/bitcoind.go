@@ -0,0 +1,457 @@
+package fakenode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// 假链的起始时间, 每个区块 10 分钟, 保证每次运行的区块时间相同
+var genesisTime = time.Unix(1600000000, 0).UTC()
+
+// Bitcoind 是假的 bitcoind, 同时提供 electrs 的 REST 接口
+// json-rpc: getrawtransaction, decoderawtransaction, sendrawtransaction, getblockheader, estimatesmartfee
+// electrs: address/<a>/utxo, tx/<id>
+// sendrawtransaction 接受的交易进入交易池, Mine 把交易池里的交易打包进新区块
+// ltc, bch 等分叉币的 handler 使用相同的协议, 用各自的链参数创建
+type Bitcoind struct {
+	*Server
+
+	// estimatesmartfee 返回的费率, BTC/kB
+	FeeRate float64
+
+	params *chaincfg.Params
+	lock sync.Mutex
+	txs map[string]*bitcoindTx
+	// 按加入的顺序, 用于计算 utxo
+	order []string
+	height int64
+}
+
+type bitcoindTx struct {
+	tx *wire.MsgTx
+	// 所在区块的高度, 0 表示在交易池
+	height int64
+}
+
+// NewBitcoind 启动使用 params 地址格式的假 bitcoind, 用完后调用 Close
+func NewBitcoind(params *chaincfg.Params) *Bitcoind {
+	b := &Bitcoind{
+		FeeRate: 0.0001,
+		params: params,
+		txs: make(map[string]*bitcoindTx),
+		height: 100,
+	}
+	b.Server = newServer(map[string]Handler{
+		"getrawtransaction": b.getRawTransaction,
+		"decoderawtransaction": b.decodeRawTransaction,
+		"sendrawtransaction": b.sendRawTransaction,
+		"getblockheader": b.getBlockHeader,
+		"estimatesmartfee": b.estimateSmartFee,
+		"address/*/utxo": b.addressUtxo,
+		"tx/*": b.electrsTx,
+	})
+	b.start(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			b.serveREST(w, r)
+			return
+		}
+		b.serveRPC(w, r, "", http.StatusInternalServerError)
+	})
+	return b
+}
+
+// electrs 出错时返回 http 状态码和纯文本
+func (b *Bitcoind) serveREST(w http.ResponseWriter, r *http.Request) {
+	req, err := restRequest(r)
+	if err == nil {
+		var result interface{}
+		result, err = b.dispatch(req)
+		if err == nil {
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+	}
+	e := asError(err)
+	if e.Status == 0 {
+		e.Status = http.StatusBadRequest
+	}
+	w.WriteHeader(e.Status)
+	w.Write([]byte(e.Message))
+}
+
+// Fund 在新区块里加一笔给 address 转 amount 聪的交易, 返回交易 id
+func (b *Bitcoind) Fund(address string, amount int64) (string, error) {
+	addr, err := btcutil.DecodeAddress(address, b.params)
+	if err != nil {
+		return "", err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return "", err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	// 和 coinbase 一样没有真实的输入, 用区块高度区分不同的资金交易
+	coinbase := make([]byte, 8)
+	binary.LittleEndian.PutUint64(coinbase, uint64(b.height+1))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), coinbase, nil))
+	tx.AddTxOut(wire.NewTxOut(amount, pkScript))
+	txid := b.add(tx)
+	b.mine()
+	return txid, nil
+}
+
+// AddTransaction 把 tx 直接加入交易池, 不做任何检查
+func (b *Bitcoind) AddTransaction(tx *wire.MsgTx) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.add(tx)
+}
+
+// Transaction 返回 txid 对应的交易, 不存在时返回 nil
+func (b *Bitcoind) Transaction(txid string) *wire.MsgTx {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if t, ok := b.txs[txid]; ok {
+		return t.tx
+	}
+	return nil
+}
+
+// Mine 把交易池里的交易打包进一个新区块, 返回新区块的高度
+func (b *Bitcoind) Mine() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.mine()
+	return b.height
+}
+
+func (b *Bitcoind) mine() {
+	b.height++
+	for _, t := range b.txs {
+		if t.height == 0 {
+			t.height = b.height
+		}
+	}
+}
+
+func (b *Bitcoind) add(tx *wire.MsgTx) string {
+	txid := tx.TxHash().String()
+	b.txs[txid] = &bitcoindTx{tx: tx}
+	b.order = append(b.order, txid)
+	return txid
+}
+
+// 假区块的 hash 由高度决定
+func blockHash(height int64) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(height))
+	h := chainhash.DoubleHashH(b[:])
+	return h.String()
+}
+
+func blockTime(height int64) int64 {
+	return genesisTime.Add(time.Duration(height) * 10 * time.Minute).Unix()
+}
+
+// 被已知交易 (包括交易池里的) 花费的输出
+func (b *Bitcoind) spent() map[wire.OutPoint]string {
+	spent := make(map[wire.OutPoint]string)
+	for txid, t := range b.txs {
+		for _, in := range t.tx.TxIn {
+			spent[in.PreviousOutPoint] = txid
+		}
+	}
+	return spent
+}
+
+func (b *Bitcoind) lookupTx(txid string) (*bitcoindTx, error) {
+	t, ok := b.txs[txid]
+	if !ok {
+		return nil, &Error{Code: -5, Message: "No such mempool or blockchain transaction. Use gettransaction for wallet transactions."}
+	}
+	return t, nil
+}
+
+func (b *Bitcoind) getRawTransaction(req *Request) (interface{}, error) {
+	var txid string
+	var verboseArg interface{}
+	if err := bindArgs(req, &txid, &verboseArg); err != nil {
+		return nil, err
+	}
+	// 新版 bitcoind 的 verbose 是 bool, 旧版是 0 和 1
+	verbose := false
+	switch v := verboseArg.(type) {
+	case bool:
+		verbose = v
+	case float64:
+		verbose = v != 0
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	t, err := b.lookupTx(txid)
+	if err != nil {
+		return nil, err
+	}
+	if !verbose {
+		return serializeTx(t.tx), nil
+	}
+	res := b.txResult(t.tx)
+	res["hex"] = serializeTx(t.tx)
+	if t.height > 0 {
+		res["blockhash"] = blockHash(t.height)
+		res["confirmations"] = b.height - t.height + 1
+		res["time"] = blockTime(t.height)
+		res["blocktime"] = blockTime(t.height)
+	}
+	return res, nil
+}
+
+func (b *Bitcoind) decodeRawTransaction(req *Request) (interface{}, error) {
+	var txHex string
+	if err := bindArgs(req, &txHex); err != nil {
+		return nil, err
+	}
+	tx, err := deserializeTx(txHex)
+	if err != nil {
+		return nil, err
+	}
+	return b.txResult(tx), nil
+}
+
+func (b *Bitcoind) sendRawTransaction(req *Request) (interface{}, error) {
+	var txHex string
+	if err := bindArgs(req, &txHex); err != nil {
+		return nil, err
+	}
+	tx, err := deserializeTx(txHex)
+	if err != nil {
+		return nil, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	txid := tx.TxHash().String()
+	if t, ok := b.txs[txid]; ok {
+		if t.height > 0 {
+			return nil, &Error{Code: -27, Message: "transaction already in block chain"}
+		}
+		return nil, &Error{Code: -26, Message: "txn-already-in-mempool"}
+	}
+	spent := b.spent()
+	var in int64
+	for _, txIn := range tx.TxIn {
+		prev, ok := b.txs[txIn.PreviousOutPoint.Hash.String()]
+		if !ok || int(txIn.PreviousOutPoint.Index) >= len(prev.tx.TxOut) {
+			return nil, &Error{Code: -25, Message: "bad-txns-inputs-missingorspent"}
+		}
+		if _, ok := spent[txIn.PreviousOutPoint]; ok {
+			return nil, &Error{Code: -26, Message: "txn-mempool-conflict"}
+		}
+		if len(txIn.SignatureScript) == 0 && len(txIn.Witness) == 0 {
+			return nil, &Error{Code: -26, Message: "mandatory-script-verify-flag-failed (Operation not valid with the current stack size)"}
+		}
+		in += prev.tx.TxOut[txIn.PreviousOutPoint.Index].Value
+	}
+	var out int64
+	for _, txOut := range tx.TxOut {
+		out += txOut.Value
+	}
+	if out > in {
+		return nil, &Error{Code: -26, Message: "bad-txns-in-belowout"}
+	}
+	return b.add(tx), nil
+}
+
+func (b *Bitcoind) getBlockHeader(req *Request) (interface{}, error) {
+	var hash string
+	if err := bindArgs(req, &hash); err != nil {
+		return nil, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for height := int64(1); height <= b.height; height++ {
+		if blockHash(height) == hash {
+			return map[string]interface{}{
+				"hash": hash,
+				"height": height,
+				"confirmations": b.height - height + 1,
+				"time": blockTime(height),
+			}, nil
+		}
+	}
+	return nil, &Error{Code: -5, Message: "Block not found"}
+}
+
+func (b *Bitcoind) estimateSmartFee(req *Request) (interface{}, error) {
+	var target int64
+	if err := bindArgs(req, &target); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"feerate": b.FeeRate, "blocks": target}, nil
+}
+
+// address/<a>/utxo, 和 electrs 一样不包括被交易池里的交易花费的输出
+func (b *Bitcoind) addressUtxo(req *Request) (interface{}, error) {
+	address := req.Args[0]
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	spent := b.spent()
+	utxos := []interface{}{}
+	for _, txid := range b.order {
+		t := b.txs[txid]
+		for i, out := range t.tx.TxOut {
+			if b.outputAddress(out.PkScript) != address {
+				continue
+			}
+			if _, ok := spent[wire.OutPoint{Hash: t.tx.TxHash(), Index: uint32(i)}]; ok {
+				continue
+			}
+			utxos = append(utxos, map[string]interface{}{
+				"txid": txid,
+				"vout": i,
+				"status": b.electrsStatus(t),
+				"value": out.Value,
+			})
+		}
+	}
+	return utxos, nil
+}
+
+// tx/<id>
+func (b *Bitcoind) electrsTx(req *Request) (interface{}, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	t, ok := b.txs[req.Args[0]]
+	if !ok {
+		return nil, &Error{Status: http.StatusNotFound, Message: "Transaction not found"}
+	}
+	var vout []interface{}
+	for _, out := range t.tx.TxOut {
+		vout = append(vout, map[string]interface{}{
+			"scriptpubkey": hex.EncodeToString(out.PkScript),
+			"scriptpubkey_address": b.outputAddress(out.PkScript),
+			"value": out.Value,
+		})
+	}
+	return map[string]interface{}{
+		"txid": req.Args[0],
+		"version": t.tx.Version,
+		"locktime": t.tx.LockTime,
+		"vout": vout,
+		"status": b.electrsStatus(t),
+	}, nil
+}
+
+func (b *Bitcoind) electrsStatus(t *bitcoindTx) map[string]interface{} {
+	if t.height == 0 {
+		return map[string]interface{}{"confirmed": false}
+	}
+	return map[string]interface{}{
+		"confirmed": true,
+		"block_height": t.height,
+		"block_hash": blockHash(t.height),
+		"block_time": blockTime(t.height),
+	}
+}
+
+func (b *Bitcoind) outputAddress(pkScript []byte) string {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, b.params)
+	if err != nil || len(addrs) == 0 {
+		return ""
+	}
+	return addrs[0].EncodeAddress()
+}
+
+// decoderawtransaction 的结果, 金额是 BTC
+func (b *Bitcoind) txResult(tx *wire.MsgTx) map[string]interface{} {
+	var vin []interface{}
+	for _, in := range tx.TxIn {
+		if in.PreviousOutPoint.Index == wire.MaxPrevOutIndex && in.PreviousOutPoint.Hash == (chainhash.Hash{}) {
+			vin = append(vin, map[string]interface{}{
+				"coinbase": hex.EncodeToString(in.SignatureScript),
+				"sequence": in.Sequence,
+			})
+			continue
+		}
+		asm, _ := txscript.DisasmString(in.SignatureScript)
+		vin = append(vin, map[string]interface{}{
+			"txid": in.PreviousOutPoint.Hash.String(),
+			"vout": in.PreviousOutPoint.Index,
+			"scriptSig": map[string]interface{}{"asm": asm, "hex": hex.EncodeToString(in.SignatureScript)},
+			"sequence": in.Sequence,
+		})
+	}
+	var vout []interface{}
+	for i, out := range tx.TxOut {
+		class, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(out.PkScript, b.params)
+		asm, _ := txscript.DisasmString(out.PkScript)
+		scriptPubKey := map[string]interface{}{
+			"asm": asm,
+			"hex": hex.EncodeToString(out.PkScript),
+			"type": class.String(),
+		}
+		if len(addrs) > 0 {
+			var addresses []string
+			for _, addr := range addrs {
+				addresses = append(addresses, addr.EncodeAddress())
+			}
+			scriptPubKey["reqSigs"] = reqSigs
+			scriptPubKey["addresses"] = addresses
+		}
+		vout = append(vout, map[string]interface{}{
+			"value": btcValue(out.Value),
+			"n": i,
+			"scriptPubKey": scriptPubKey,
+		})
+	}
+	return map[string]interface{}{
+		"txid": tx.TxHash().String(),
+		"hash": tx.WitnessHash().String(),
+		"version": tx.Version,
+		"size": tx.SerializeSize(),
+		"locktime": tx.LockTime,
+		"vin": vin,
+		"vout": vout,
+	}
+}
+
+// 和 bitcoind 一样固定 8 位小数, 不经过 float64
+func btcValue(satoshi int64) json.Number {
+	sign := ""
+	if satoshi < 0 {
+		sign = "-"
+		satoshi = -satoshi
+	}
+	return json.Number(fmt.Sprintf("%v%d.%08d", sign, satoshi/btcutil.SatoshiPerBitcoin, satoshi%btcutil.SatoshiPerBitcoin))
+}
+
+func serializeTx(tx *wire.MsgTx) string {
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func deserializeTx(txHex string) (*wire.MsgTx, error) {
+	b, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, &Error{Code: -22, Message: "TX decode failed"}
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err = tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, &Error{Code: -22, Message: "TX decode failed"}
+	}
+	return tx, nil
+}
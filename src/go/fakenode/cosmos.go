@@ -0,0 +1,480 @@
+package fakenode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/bech32"
+)
+
+// Cosmos 是假的 cosmos-sdk lcd (rest server), 只处理 uatom
+// 支持 GET node_info, auth/accounts/<a>, bank/balances/<a>, txs/<hash>, txs?action=send, blocks/latest, blocks/<n>,
+// 以及 POST txs. 广播时按 account number 和 sequence 验证签名, 签名的公钥必须是 msg 的付款地址
+// 路由带 http 方法, Script 时写 "POST txs", "GET txs/*"
+// 交易哈希是交易 json 的 sha256, 和真实节点 (amino 编码的 sha256) 不同, 测试只应该使用节点返回的哈希
+type Cosmos struct {
+	*Server
+
+	ChainID string
+
+	lock sync.Mutex
+	accounts map[string]*cosmosAccount
+	txs map[string]*cosmosTx
+	// 按接受的顺序排列
+	order []*cosmosTx
+	height int64
+}
+
+type cosmosAccount struct {
+	number uint64
+	sequence uint64
+	balance int64
+}
+
+type cosmosTx struct {
+	hash string
+	tx json.RawMessage
+	action string
+	signer string
+	recipients []string
+	// 所在区块, 0 表示还没有进入区块
+	height int64
+}
+
+// NewCosmos 启动假 lcd, chainID 是 node_info 返回的 network, 用完后调用 Close
+func NewCosmos(chainID string) *Cosmos {
+	c := &Cosmos{
+		ChainID: chainID,
+		accounts: make(map[string]*cosmosAccount),
+		txs: make(map[string]*cosmosTx),
+		height: 1000,
+	}
+	c.Server = newServer(map[string]Handler{
+		"GET node_info": c.nodeInfo,
+		"GET auth/accounts/*": c.account,
+		"GET bank/balances/*": c.balances,
+		"GET txs/*": c.tx,
+		"GET txs": c.searchTxs,
+		"GET blocks/*": c.block,
+		"POST txs": c.broadcast,
+	})
+	c.start(c.serve)
+	return c
+}
+
+// 路由带上 http 方法, GET txs 和 POST txs 是不同的接口, 出错时返回 {"error": ...}
+func (c *Cosmos) serve(w http.ResponseWriter, r *http.Request) {
+	req, err := restRequest(r)
+	if err == nil {
+		req.Route = r.Method + " " + req.Route
+		var result interface{}
+		result, err = c.dispatch(req)
+		if err == nil {
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+	}
+	e := asError(err)
+	status := e.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, map[string]interface{}{"error": e.Message})
+}
+
+// SetAccount 创建或修改账户, balance 以 uatom 为单位, 新账户的 account number 按创建顺序分配
+func (c *Cosmos) SetAccount(address string, balance int64, sequence uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if acc, ok := c.accounts[address]; ok {
+		acc.balance, acc.sequence = balance, sequence
+		return
+	}
+	c.accounts[address] = &cosmosAccount{number: uint64(len(c.accounts) + 1), sequence: sequence, balance: balance}
+}
+
+// Balance 返回账户的 uatom 余额
+func (c *Cosmos) Balance(address string) int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if acc, ok := c.accounts[address]; ok {
+		return acc.balance
+	}
+	return 0
+}
+
+// Mine 出一个新区块, 之前接受的交易进入这个区块, 返回新区块的高度
+func (c *Cosmos) Mine() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.height++
+	for _, tx := range c.order {
+		if tx.height == 0 {
+			tx.height = c.height
+		}
+	}
+	return c.height
+}
+
+func (c *Cosmos) nodeInfo(req *Request) (interface{}, error) {
+	return map[string]interface{}{
+		"node_info": map[string]interface{}{"network": c.ChainID, "version": "fakenode"},
+	}, nil
+}
+
+func uatom(amount int64) []interface{} {
+	return []interface{}{map[string]interface{}{"denom": "uatom", "amount": strconv.FormatInt(amount, 10)}}
+}
+
+func (c *Cosmos) account(req *Request) (interface{}, error) {
+	address := req.Args[0]
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	acc, ok := c.accounts[address]
+	if !ok {
+		return nil, &Error{Status: http.StatusNotFound, Message: "account " + address + " does not exist"}
+	}
+	return map[string]interface{}{
+		"type": "auth/Account",
+		"value": map[string]interface{}{
+			"address": address,
+			"coins": uatom(acc.balance),
+			"public_key": nil,
+			"account_number": strconv.FormatUint(acc.number, 10),
+			"sequence": strconv.FormatUint(acc.sequence, 10),
+		},
+	}, nil
+}
+
+// 老版本的 lcd 直接返回 Coins
+func (c *Cosmos) balances(req *Request) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	acc, ok := c.accounts[req.Args[0]]
+	if !ok {
+		return []interface{}{}, nil
+	}
+	return uatom(acc.balance), nil
+}
+
+func blockHashHex(height int64) string {
+	h := sha256.Sum256([]byte(strconv.FormatInt(height, 10)))
+	return strings.ToUpper(hex.EncodeToString(h[:]))
+}
+
+func (c *Cosmos) block(req *Request) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	height := c.height
+	if req.Args[0] != "latest" {
+		n, err := strconv.ParseInt(req.Args[0], 10, 64)
+		if err != nil || n <= 0 || n > c.height {
+			return nil, &Error{Status: http.StatusBadRequest, Message: "requested block height is bigger then the chain length"}
+		}
+		height = n
+	}
+	return map[string]interface{}{
+		"block_meta": map[string]interface{}{
+			"block_id": map[string]interface{}{"hash": blockHashHex(height)},
+			"header": map[string]interface{}{
+				"chain_id": c.ChainID,
+				"height": strconv.FormatInt(height, 10),
+				"time": genesisTime.Add(time.Duration(height) * 5 * time.Second).UTC().Format(time.RFC3339),
+			},
+		},
+	}, nil
+}
+
+type cosmosMsg struct {
+	Type string `json:"type"`
+	Value struct {
+		FromAddress string `json:"from_address"`
+		ToAddress string `json:"to_address"`
+		Amount []cosmosCoin `json:"amount"`
+		Inputs []struct {
+			Address string `json:"address"`
+			Coins []cosmosCoin `json:"coins"`
+		} `json:"inputs"`
+		Outputs []struct {
+			Address string `json:"address"`
+			Coins []cosmosCoin `json:"coins"`
+		} `json:"outputs"`
+	} `json:"value"`
+}
+
+type cosmosCoin struct {
+	Denom string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+func uatomAmount(coins []cosmosCoin) (int64, bool) {
+	var total int64
+	for _, coin := range coins {
+		if coin.Denom != "uatom" {
+			return 0, false
+		}
+		v, err := strconv.ParseInt(coin.Amount, 10, 64)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		total += v
+	}
+	return total, true
+}
+
+// 广播结果, code 是 cosmos-sdk 的错误码
+func broadcastResult(hash string, code int, log string) map[string]interface{} {
+	return map[string]interface{}{
+		"height": "0",
+		"txhash": hash,
+		"code": code,
+		"raw_log": log,
+	}
+}
+
+func (c *Cosmos) broadcast(req *Request) (interface{}, error) {
+	var params struct {
+		Tx json.RawMessage `json:"tx"`
+		Mode string `json:"mode"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	var tx struct {
+		Msg []json.RawMessage `json:"msg"`
+		Fee struct {
+			Amount []cosmosCoin `json:"amount"`
+			Gas string `json:"gas"`
+		} `json:"fee"`
+		Signatures []struct {
+			PubKey struct {
+				Type string `json:"type"`
+				Value []byte `json:"value"`
+			} `json:"pub_key"`
+			Signature []byte `json:"signature"`
+		} `json:"signatures"`
+		Memo string `json:"memo"`
+	}
+	if err := json.Unmarshal(params.Tx, &tx); err != nil || len(tx.Msg) != 1 {
+		return nil, &Error{Status: http.StatusBadRequest, Message: "the fake node accepts exactly one bank msg"}
+	}
+	sum := sha256.Sum256(params.Tx)
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	var msg cosmosMsg
+	if err := json.Unmarshal(tx.Msg[0], &msg); err != nil {
+		return broadcastResult(hash, 1, "invalid msg: "+err.Error()), nil
+	}
+	// 付款地址, 收款地址和金额
+	var from string
+	var recipients []string
+	var amount int64
+	amounts := make(map[string]int64)
+	switch msg.Type {
+	case "cosmos-sdk/MsgSend":
+		from = msg.Value.FromAddress
+		a, ok := uatomAmount(msg.Value.Amount)
+		if !ok {
+			return broadcastResult(hash, 10, "invalid coins"), nil
+		}
+		amount = a
+		recipients = []string{msg.Value.ToAddress}
+		amounts[msg.Value.ToAddress] += a
+	case "cosmos-sdk/MsgMultiSend":
+		if len(msg.Value.Inputs) != 1 {
+			return broadcastResult(hash, 1, "the fake node accepts exactly one input"), nil
+		}
+		from = msg.Value.Inputs[0].Address
+		in, ok := uatomAmount(msg.Value.Inputs[0].Coins)
+		for _, out := range msg.Value.Outputs {
+			a, ok1 := uatomAmount(out.Coins)
+			ok = ok && ok1
+			amount += a
+			recipients = append(recipients, out.Address)
+			amounts[out.Address] += a
+		}
+		if !ok || in != amount {
+			return broadcastResult(hash, 10, "sum inputs != sum outputs"), nil
+		}
+	default:
+		return broadcastResult(hash, 6, "unrecognized msg type "+msg.Type), nil
+	}
+	fee, ok := uatomAmount(tx.Fee.Amount)
+	if !ok {
+		return broadcastResult(hash, 10, "invalid fee"), nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.txs[hash]; ok {
+		return broadcastResult(hash, 19, "tx already in mempool"), nil
+	}
+	acc, ok := c.accounts[from]
+	if !ok {
+		return broadcastResult(hash, 9, "account "+from+" does not exist"), nil
+	}
+	if len(tx.Signatures) != 1 {
+		return broadcastResult(hash, 4, "wrong number of signers"), nil
+	}
+	sig := tx.Signatures[0]
+	if !cosmosSigner(sig.PubKey.Value, from) {
+		return broadcastResult(hash, 7, "pubkey does not match signer address "+from), nil
+	}
+	signBytes := cosmosSignBytes(c.ChainID, acc.number, acc.sequence, params.Tx)
+	if !cosmosVerify(sig.PubKey.Value, sig.Signature, signBytes) {
+		return broadcastResult(hash, 4, "signature verification failed; verify correct account sequence and chain-id"), nil
+	}
+	if acc.balance < amount+fee {
+		return broadcastResult(hash, 5, "insufficient funds: insufficient account funds"), nil
+	}
+	acc.balance -= amount + fee
+	acc.sequence++
+	for to, a := range amounts {
+		if dst, ok := c.accounts[to]; ok {
+			dst.balance += a
+		} else {
+			c.accounts[to] = &cosmosAccount{number: uint64(len(c.accounts) + 1), balance: a}
+		}
+	}
+	action := "send"
+	if msg.Type == "cosmos-sdk/MsgMultiSend" {
+		action = "multisend"
+	}
+	t := &cosmosTx{hash: hash, tx: params.Tx, action: action, signer: from, recipients: recipients}
+	c.txs[hash] = t
+	c.order = append(c.order, t)
+	return broadcastResult(hash, 0, "[]"), nil
+}
+
+// cosmosSignBytes 按 auth.StdSignBytes 的规则从交易 json 生成签名原文, key 排序, 整数是字符串
+func cosmosSignBytes(chainID string, accountNumber, sequence uint64, tx json.RawMessage) []byte {
+	var v struct {
+		Msg []json.RawMessage `json:"msg"`
+		Fee json.RawMessage `json:"fee"`
+		Memo string `json:"memo"`
+	}
+	json.Unmarshal(tx, &v)
+	doc, _ := json.Marshal(map[string]interface{}{
+		"account_number": strconv.FormatUint(accountNumber, 10),
+		"chain_id": chainID,
+		"fee": v.Fee,
+		"memo": v.Memo,
+		"msgs": v.Msg,
+		"sequence": strconv.FormatUint(sequence, 10),
+	})
+	// 和 sdk.MustSortJSON 一样, 解码再编码使所有对象的 key 有序
+	var sorted interface{}
+	json.Unmarshal(doc, &sorted)
+	b, _ := json.Marshal(sorted)
+	return b
+}
+
+// cosmosSigner 检查压缩公钥的 hash160 就是 bech32 地址的内容
+func cosmosSigner(pub []byte, address string) bool {
+	_, data, err := bech32.Decode(address)
+	if err != nil {
+		return false
+	}
+	hash, err := bech32.ConvertBits(data, 5, 8, false)
+	return err == nil && bytes.Equal(hash, btcutil.Hash160(pub))
+}
+
+// tendermint 的 secp256k1 签名是对 sha256(msg) 的 64 字节 r s
+func cosmosVerify(pub, sig, msg []byte) bool {
+	pk, err := btcec.ParsePubKey(pub, btcec.S256())
+	if err != nil || len(sig) != 64 {
+		return false
+	}
+	s := &btcec.Signature{R: new(big.Int).SetBytes(sig[:32]), S: new(big.Int).SetBytes(sig[32:])}
+	digest := sha256.Sum256(msg)
+	return s.Verify(digest[:], pk)
+}
+
+// txResponse 和 lcd 一样用 amino json 编码, 整数是字符串
+func (c *Cosmos) txResponse(t *cosmosTx) map[string]interface{} {
+	return map[string]interface{}{
+		"height": strconv.FormatInt(t.height, 10),
+		"txhash": t.hash,
+		"raw_log": `[{"msg_index":0,"success":true,"log":""}]`,
+		"logs": []interface{}{map[string]interface{}{"msg_index": 0, "success": true, "log": ""}},
+		"gas_wanted": "200000",
+		"gas_used": "50000",
+		"tags": []interface{}{
+			map[string]interface{}{"key": "action", "value": t.action},
+			map[string]interface{}{"key": "sender", "value": t.signer},
+		},
+		"tx": map[string]interface{}{"type": "auth/StdTx", "value": t.tx},
+		"timestamp": genesisTime.Add(time.Duration(t.height) * 5 * time.Second).UTC().Format(time.RFC3339),
+	}
+}
+
+// lcd 查不到交易池, 没有进入区块的交易也是 not found
+func (c *Cosmos) tx(req *Request) (interface{}, error) {
+	hash := strings.ToUpper(req.Args[0])
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t, ok := c.txs[hash]
+	if !ok || t.height == 0 {
+		return nil, &Error{Status: http.StatusInternalServerError, Message: "Tx: Response error: RPC error -32603 - Internal error: Tx (" + hash + ") not found"}
+	}
+	return c.txResponse(t), nil
+}
+
+// 支持 action, sender, recipient, page, limit, 按区块从旧到新排列
+func (c *Cosmos) searchTxs(req *Request) (interface{}, error) {
+	q := req.Query
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 {
+		limit = 30
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var all []*cosmosTx
+	for _, t := range c.order {
+		if t.height == 0 {
+			continue
+		}
+		if a := q.Get("action"); a != "" && a != t.action {
+			continue
+		}
+		if s := q.Get("sender"); s != "" && s != t.signer {
+			continue
+		}
+		if r := q.Get("recipient"); r != "" {
+			found := false
+			for _, to := range t.recipients {
+				found = found || to == r
+			}
+			if !found {
+				continue
+			}
+		}
+		all = append(all, t)
+	}
+	txs := []interface{}{}
+	for i := (page - 1) * limit; i < len(all) && i < page*limit; i++ {
+		txs = append(txs, c.txResponse(all[i]))
+	}
+	return map[string]interface{}{
+		"total_count": strconv.Itoa(len(all)),
+		"count": strconv.Itoa(len(txs)),
+		"page_number": strconv.Itoa(page),
+		"page_total": strconv.Itoa((len(all) + limit - 1) / limit),
+		"limit": strconv.Itoa(limit),
+		"txs": txs,
+	}, nil
+}
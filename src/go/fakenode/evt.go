@@ -0,0 +1,401 @@
+package fakenode
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// evt fungible token 金额的小数位数
+const evtDecimals = 5
+
+// EVT 是假的 everiToken 节点 api, 错误格式和 nodeos 相同
+// 支持 chain 的 abi_json_to_bin, get_info, get_block, trx_json_to_digest, push_transaction,
+// history 的 get_transaction, get_fungible_actions 和 evt 的 get_fungible_balance
+// abi_json_to_bin 返回的 binargs 是参数 json 的 16 进制, digest 是交易 json 的 sha256, 都和真实节点不同,
+// 测试只应该把它们原样传回节点. push_transaction 不验证签名, 只执行 transferft
+type EVT struct {
+	*Server
+
+	ChainID string
+
+	lock sync.Mutex
+	// key 是 地址#sym_id, 单位是 10^-5
+	balances map[string]int64
+	txs map[string]*evtTx
+	// 按接受的顺序排列
+	order []*evtTx
+	height uint64
+}
+
+type evtTx struct {
+	id string
+	trx map[string]interface{}
+	actions []evtAction
+	// 所在区块, 0 表示还没有进入区块
+	blockNum uint64
+}
+
+type evtAction struct {
+	Name string `json:"name"`
+	Domain string `json:"domain"`
+	Key string `json:"key"`
+	Data evtActionData `json:"data"`
+}
+
+type evtActionData struct {
+	From string `json:"from,omitempty"`
+	To string `json:"to,omitempty"`
+	Address string `json:"address,omitempty"`
+	Number string `json:"number"`
+	Memo string `json:"memo"`
+}
+
+// NewEVT 启动假 evt 节点, 用完后调用 Close
+func NewEVT(chainID string) *EVT {
+	e := &EVT{
+		ChainID: chainID,
+		balances: make(map[string]int64),
+		txs: make(map[string]*evtTx),
+		height: 1000,
+	}
+	e.Server = newServer(map[string]Handler{
+		"v1/chain/abi_json_to_bin": e.abiJSONToBin,
+		"v1/chain/get_info": e.getInfo,
+		"v1/chain/get_block": e.getBlock,
+		"v1/chain/trx_json_to_digest": e.trxJSONToDigest,
+		"v1/chain/push_transaction": e.pushTransaction,
+		"v1/history/get_transaction": e.getTransaction,
+		"v1/history/get_fungible_actions": e.getFungibleActions,
+		"v1/evt/get_fungible_balance": e.getFungibleBalance,
+	})
+	e.start(e.serve)
+	return e
+}
+
+func (e *EVT) serve(w http.ResponseWriter, r *http.Request) {
+	serveNodeosAPI(e.Server, w, r)
+}
+
+func evtBalanceKey(address string, symID uint) string {
+	return address + "#" + strconv.FormatUint(uint64(symID), 10)
+}
+
+// SetBalance 设置 address 在 token symID 上的余额, 单位 10^-5
+func (e *EVT) SetBalance(address string, symID uint, balance int64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.balances[evtBalanceKey(address, symID)] = balance
+}
+
+// Balance 返回 address 在 token symID 上的余额
+func (e *EVT) Balance(address string, symID uint) int64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.balances[evtBalanceKey(address, symID)]
+}
+
+// Mine 出一个新区块, 之前接受的交易进入这个区块, 返回新区块的高度
+func (e *EVT) Mine() uint64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.height++
+	for _, tx := range e.order {
+		if tx.blockNum == 0 {
+			tx.blockNum = e.height
+		}
+	}
+	return e.height
+}
+
+func (e *EVT) lib() uint64 {
+	if e.height > 100 {
+		return e.height - 100
+	}
+	return 1
+}
+
+// 和真实节点一样, 参数是 {"action":..,"args":{..}}
+func (e *EVT) abiJSONToBin(req *Request) (interface{}, error) {
+	var params struct {
+		Action string `json:"action"`
+		Args json.RawMessage `json:"args"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	if params.Action == "" || len(params.Args) == 0 {
+		return nil, &Error{Code: 3030000, Name: "action_type_exception", Message: "action and args are required"}
+	}
+	return map[string]interface{}{"binargs": hex.EncodeToString(params.Args)}, nil
+}
+
+func (e *EVT) getInfo(req *Request) (interface{}, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return map[string]interface{}{
+		"server_version": "fakenode",
+		"chain_id": e.ChainID,
+		"evt_api_version": "fakenode",
+		"head_block_num": e.height,
+		"head_block_id": hex.EncodeToString(eosBlockID(e.height)),
+		"head_block_time": eosBlockTime(e.height).Format(nodeosTimeLayout),
+		"head_block_producer": "evt",
+		"last_irreversible_block_num": e.lib(),
+		"last_irreversible_block_id": hex.EncodeToString(eosBlockID(e.lib())),
+	}, nil
+}
+
+// block_num_or_id 只支持高度, 可以是数字或字符串
+func (e *EVT) getBlock(req *Request) (interface{}, error) {
+	var params struct {
+		BlockNumOrID json.RawMessage `json:"block_num_or_id"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	s := strings.Trim(string(params.BlockNumOrID), `"`)
+	num, _ := strconv.ParseUint(s, 10, 64)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if num == 0 || num > e.height {
+		return nil, &Error{Code: 3100002, Name: "unknown_block_exception", Message: "Could not find block: " + s}
+	}
+	id := eosBlockID(num)
+	return map[string]interface{}{
+		"id": hex.EncodeToString(id),
+		"block_num": num,
+		"timestamp": eosBlockTime(num).Format(nodeosTimeLayout),
+		"producer": "evt",
+		"ref_block_prefix": binary.LittleEndian.Uint32(id[8:12]),
+		"transactions": []interface{}{},
+	}, nil
+}
+
+func (e *EVT) trxJSONToDigest(req *Request) (interface{}, error) {
+	var trx map[string]interface{}
+	if err := req.Bind(&trx); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"digest": evtDigest(req.Params)}, nil
+}
+
+// 先规范化 json, 客户端重新编码交易时 digest 不变
+func evtDigest(trx json.RawMessage) string {
+	var v interface{}
+	json.Unmarshal(trx, &v)
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (e *EVT) pushTransaction(req *Request) (interface{}, error) {
+	var params struct {
+		Signatures []string `json:"signatures"`
+		Transaction json.RawMessage `json:"transaction"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	var trx struct {
+		Expiration string `json:"expiration"`
+		RefBlockNum uint64 `json:"ref_block_num"`
+		RefBlockPrefix uint32 `json:"ref_block_prefix"`
+		Payer string `json:"payer"`
+		Actions []struct {
+			Name string `json:"name"`
+			Domain string `json:"domain"`
+			Key string `json:"key"`
+			Data string `json:"data"`
+		} `json:"actions"`
+	}
+	var trxJSON map[string]interface{}
+	if err := json.Unmarshal(params.Transaction, &trx); err != nil {
+		return nil, &Error{Code: 3010008, Name: "packed_transaction_type_exception", Message: err.Error()}
+	}
+	json.Unmarshal(params.Transaction, &trxJSON)
+	expiration, err := time.Parse(eosExpirationLayout, strings.TrimSuffix(trx.Expiration, "Z"))
+	if err != nil {
+		return nil, &Error{Code: 3010008, Name: "packed_transaction_type_exception", Message: "invalid expiration " + trx.Expiration}
+	}
+	// 把 abi_json_to_bin 编码的参数解回来, history 返回解码后的 action
+	var actions []evtAction
+	for _, act := range trx.Actions {
+		a := evtAction{Name: act.Name, Domain: act.Domain, Key: act.Key}
+		b, err := hex.DecodeString(act.Data)
+		if err == nil {
+			err = json.Unmarshal(b, &a.Data)
+		}
+		if err != nil {
+			return nil, &Error{Code: 3030000, Name: "action_type_exception", Message: "action data was not encoded by this node"}
+		}
+		actions = append(actions, a)
+	}
+	id := evtDigest(params.Transaction)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if _, ok := e.txs[id]; ok {
+		return nil, &Error{Code: 3040008, Name: "tx_duplicate", Message: "duplicate transaction " + id}
+	}
+	known := false
+	for num := e.height; num > 0 && num+65536 > e.height; num-- {
+		if uint16(num) == uint16(trx.RefBlockNum) && binary.LittleEndian.Uint32(eosBlockID(num)[8:12]) == trx.RefBlockPrefix {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, &Error{Code: 3040007, Name: "invalid_ref_block_exception", Message: "Transaction's reference block did not match."}
+	}
+	if !expiration.After(eosBlockTime(e.height)) {
+		return nil, &Error{Code: 3040005, Name: "expired_tx_exception", Message: "Expired Transaction"}
+	}
+	if len(params.Signatures) == 0 {
+		return nil, &Error{Code: 3090003, Name: "unsatisfied_authorization", Message: "transaction declares authority but does not have signatures for it."}
+	}
+	// 先检查余额再转账, 交易里的 action 要么全部执行, 要么都不执行
+	balances := make(map[string]int64)
+	for _, act := range actions {
+		if act.Name != "transferft" {
+			continue
+		}
+		amount, symID, ok := evtNumber(act.Data.Number)
+		if !ok {
+			return nil, &Error{Code: 3030000, Name: "action_type_exception", Message: "invalid number " + act.Data.Number}
+		}
+		from, to := evtBalanceKey(act.Data.From, symID), evtBalanceKey(act.Data.To, symID)
+		for _, k := range []string{from, to} {
+			if _, ok := balances[k]; !ok {
+				balances[k] = e.balances[k]
+			}
+		}
+		if balances[from] < amount {
+			return nil, &Error{Code: 3120010, Name: "balance_exception", Message: "Address does not have enough balance left."}
+		}
+		balances[from] -= amount
+		balances[to] += amount
+	}
+	for k, balance := range balances {
+		e.balances[k] = balance
+	}
+	tx := &evtTx{id: id, trx: trxJSON, actions: actions}
+	e.txs[id] = tx
+	e.order = append(e.order, tx)
+	return map[string]interface{}{"transaction_id": id}, nil
+}
+
+// evtNumber 解析 "1.00000 S#1" 形式的金额
+func evtNumber(number string) (amount int64, symID uint, ok bool) {
+	parts := strings.Split(number, " S#")
+	if len(parts) != 2 {
+		return
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return
+	}
+	amount, ok = parseAsset(parts[0], evtDecimals)
+	return amount, uint(id), ok
+}
+
+func (e *EVT) getTransaction(req *Request) (interface{}, error) {
+	var params struct {
+		Id string `json:"id"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	tx, ok := e.txs[strings.ToLower(params.Id)]
+	if !ok || tx.blockNum == 0 {
+		return nil, &Error{Code: 3040011, Name: "tx_not_found", Message: "Transaction " + params.Id + " not found"}
+	}
+	inner := make(map[string]interface{})
+	for k, v := range tx.trx {
+		inner[k] = v
+	}
+	inner["actions"] = tx.actions
+	return map[string]interface{}{
+		"id": tx.id,
+		"block_num": tx.blockNum,
+		"transaction": inner,
+	}, nil
+}
+
+// 返回 addr 在 sym_id 上的 transferft, dire 为 desc 时从新到旧
+func (e *EVT) getFungibleActions(req *Request) (interface{}, error) {
+	var params struct {
+		SymID uint `json:"sym_id"`
+		Addr string `json:"addr"`
+		Dire string `json:"dire"`
+		Skip int `json:"skip"`
+		Take int `json:"take"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	var all []map[string]interface{}
+	for _, tx := range e.order {
+		if tx.blockNum == 0 {
+			continue
+		}
+		for _, act := range tx.actions {
+			_, symID, ok := evtNumber(act.Data.Number)
+			if !ok || symID != params.SymID || (act.Data.From != params.Addr && act.Data.To != params.Addr && act.Data.Address != params.Addr) {
+				continue
+			}
+			all = append(all, map[string]interface{}{
+				"name": act.Name,
+				"domain": act.Domain,
+				"key": act.Key,
+				"trx_id": tx.id,
+				"data": act.Data,
+				"created_at": eosBlockTime(tx.blockNum).Format(eosExpirationLayout),
+				"block_num": tx.blockNum,
+			})
+		}
+	}
+	if params.Dire != "asc" {
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+	}
+	res := []interface{}{}
+	for i := params.Skip; i < len(all) && (params.Take <= 0 || len(res) < params.Take); i++ {
+		res = append(res, all[i])
+	}
+	return res, nil
+}
+
+// 返回 ["1.00000 S#1"], 没有余额时返回空数组
+func (e *EVT) getFungibleBalance(req *Request) (interface{}, error) {
+	var params struct {
+		Address string `json:"address"`
+		SymID uint `json:"sym_id"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	balance, ok := e.balances[evtBalanceKey(params.Address, params.SymID)]
+	if !ok {
+		return []string{}, nil
+	}
+	s := strconv.FormatInt(balance, 10)
+	if len(s) <= evtDecimals {
+		s = strings.Repeat("0", evtDecimals-len(s)+1) + s
+	}
+	number := s[:len(s)-evtDecimals] + "." + s[len(s)-evtDecimals:] + " S#" + strconv.FormatUint(uint64(params.SymID), 10)
+	return []string{number}, nil
+}
@@ -0,0 +1,510 @@
+package fakenode_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+
+	cryptocoins "github.com/gaozhengxin/cryptocoins/src/go"
+	"github.com/gaozhengxin/cryptocoins/src/go/atom"
+	"github.com/gaozhengxin/cryptocoins/src/go/btc"
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/eos"
+	"github.com/gaozhengxin/cryptocoins/src/go/erc20"
+	"github.com/gaozhengxin/cryptocoins/src/go/eth"
+	"github.com/gaozhengxin/cryptocoins/src/go/evt"
+	"github.com/gaozhengxin/cryptocoins/src/go/fakenode"
+	"github.com/gaozhengxin/cryptocoins/src/go/trx"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+	"github.com/gaozhengxin/cryptocoins/src/go/xrp"
+)
+
+const (
+	eosChainID = "5fff1dae8dc8e2fc4d5b23b2c7665c97f9e9d8edf2b6485a86ba311c25639191"
+	evtChainID = "bb248d6319e51ad38502cc8ef8fe607eb5ad2cd0be2bdc0e6e30a506761b8636"
+	xrpSeed = "snoPBrXtMeMyMHUVTgbuqAfg1SUTb"
+)
+
+// gateways 是所有假节点, config 里 testnet 的网关指向它们
+type gateways struct {
+	bitcoind *fakenode.Bitcoind
+	geth *fakenode.Geth
+	rippled *fakenode.Rippled
+	tron *fakenode.Tron
+	nodeos *fakenode.Nodeos
+	evt *fakenode.EVT
+	cosmos *fakenode.Cosmos
+
+	config *config.ApiGatewayConfigs
+}
+
+func startGateways(t *testing.T) *gateways {
+	chainConfig, err := eth.ChainConfigForNetwork(types.Testnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &gateways{
+		bitcoind: fakenode.NewBitcoind(&chaincfg.TestNet3Params),
+		geth: fakenode.NewGeth(chainConfig.ChainID),
+		rippled: fakenode.NewRippled(),
+		tron: fakenode.NewTron(),
+		nodeos: fakenode.NewNodeos(eosChainID),
+		evt: fakenode.NewEVT(evtChainID),
+		cosmos: fakenode.NewCosmos("cosmoshub-test"),
+		config: config.Default(),
+	}
+	if g.config.Networks == nil {
+		g.config.Networks = make(map[string]*config.ApiGatewayConfigs)
+	}
+	g.config.Networks[string(types.Testnet)] = &config.ApiGatewayConfigs{
+		BitcoinGateway: &config.RpcClientConfig{
+			ElectrsAddress: g.bitcoind.URL,
+			Host: g.bitcoind.Host(),
+			Port: g.bitcoind.Port(),
+			User: "user",
+			Passwd: "passwd",
+		},
+		EthereumGateway: &config.SimpleApiConfig{ApiAddress: g.geth.URL},
+		RippleGateway: &config.SimpleApiConfig{ApiAddress: g.rippled.URL},
+		TronGateway: &config.SimpleApiConfig{ApiAddress: g.tron.URL},
+		EosGateway: &config.EosConfig{Nodeos: g.nodeos.URL, ChainID: eosChainID, BalanceTracker: g.nodeos.URL + "/"},
+		EVTGateway: &config.SimpleApiConfig{ApiAddress: g.evt.URL},
+		CosmosGateway: &config.SimpleApiConfig{ApiAddress: g.cosmos.URL},
+	}
+	return g
+}
+
+func (g *gateways) Close() {
+	g.bitcoind.Close()
+	g.geth.Close()
+	g.rippled.Close()
+	g.tron.Close()
+	g.nodeos.Close()
+	g.evt.Close()
+	g.cosmos.Close()
+}
+
+// transfer 是一次 构造→签名→提交→出块→查询 要用到的参数
+type transfer struct {
+	handler cryptocoins.CryptocoinHandler
+	from string
+	publicKey string
+	to string
+	amount *big.Int
+	jsonstring string
+	// 签名用的私钥, 类型和 handler 的 SignTransaction 要求的一致
+	key interface{}
+	mine func()
+}
+
+// run 走完整个流程, 返回交易哈希, 并检查 GetTransactionInfo 查到的付款地址和收款输出
+// eth 系的地址大小写可能不同 (checksum), 地址比较不区分大小写
+func (tf *transfer) run(t *testing.T) string {
+	h := tf.handler
+	tx, digests, err := h.BuildUnsignedTransaction(tf.from, tf.publicKey, tf.to, tf.amount, tf.jsonstring)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	rsv, err := h.SignTransaction(digests, tf.key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	signed, err := h.MakeSignedTransaction(rsv, tx)
+	if err != nil {
+		t.Fatalf("make signed transaction: %v", err)
+	}
+	txhash, err := h.SubmitTransaction(signed)
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if txhash == "" {
+		t.Fatal("submit returned an empty hash")
+	}
+	tf.mine()
+	from, outputs, _, err := h.GetTransactionInfo(txhash)
+	if err != nil {
+		t.Fatalf("get transaction info %v: %v", txhash, err)
+	}
+	if !strings.EqualFold(from, tf.from) {
+		t.Errorf("from = %v, want %v", from, tf.from)
+	}
+	found := false
+	for _, out := range outputs {
+		if strings.EqualFold(out.ToAddress, tf.to) && out.Amount != nil && out.Amount.Cmp(tf.amount) == 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("outputs %+v do not pay %v to %v", outputs, tf.amount, tf.to)
+	}
+	return txhash
+}
+
+func newKey(t *testing.T) *btcec.PrivateKey {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func compressed(key *btcec.PrivateKey) string {
+	return hex.EncodeToString(key.PubKey().SerializeCompressed())
+}
+
+func ecdsaPublicKey(key *ecdsa.PrivateKey) string {
+	return hex.EncodeToString(ethcrypto.FromECDSAPub(&key.PublicKey))
+}
+
+func address(t *testing.T, h cryptocoins.CryptocoinHandler, publicKey string) string {
+	addr, err := h.PublicKeyToAddress(publicKey)
+	if err != nil {
+		t.Fatalf("public key to address: %v", err)
+	}
+	return addr
+}
+
+func TestBTCCycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := btc.NewBTCHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newKey(t)
+	wif, err := btcutil.NewWIF(key, &chaincfg.TestNet3Params, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := address(t, h, compressed(key))
+	to := address(t, h, compressed(newKey(t)))
+	if _, err := g.bitcoind.Fund(from, 100000000); err != nil {
+		t.Fatal(err)
+	}
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: compressed(key),
+		to: to,
+		amount: big.NewInt(10000000),
+		key: wif.String(),
+		mine: func() { g.bitcoind.Mine() },
+	}
+	txid := tf.run(t)
+	if g.bitcoind.Transaction(txid) == nil {
+		t.Errorf("bitcoind does not have %v", txid)
+	}
+}
+
+// 信封里的 digest 被替换后, 即使签名是付款方的私钥签的也要被拒绝
+func TestBTCTamperedDigest(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := btc.NewBTCHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newKey(t)
+	wif, err := btcutil.NewWIF(key, &chaincfg.TestNet3Params, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := address(t, h, compressed(key))
+	if _, err := g.bitcoind.Fund(from, 100000000); err != nil {
+		t.Fatal(err)
+	}
+	tx, digests, err := h.BuildUnsignedTransaction(from, compressed(key), address(t, h, compressed(newKey(t))), big.NewInt(10000000), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := h.MarshalUnsignedTransaction(tx, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Digests[0] = strings.Repeat("11", 32)
+	tampered, err := h.UnmarshalUnsignedTransaction(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsv, err := h.SignTransaction(env.Digests, wif.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.MakeSignedTransaction(rsv, tampered); err == nil {
+		t.Fatal("make signed transaction accepted a tampered digest")
+	}
+}
+
+func TestETHCycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := eth.NewETHHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ethcrypto.GenerateKey()
+	other, _ := ethcrypto.GenerateKey()
+	from := address(t, h, ecdsaPublicKey(key))
+	to := address(t, h, ecdsaPublicKey(other))
+	g.geth.SetBalance(from, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	amount := big.NewInt(1000000000000000)
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: ecdsaPublicKey(key),
+		to: to,
+		amount: amount,
+		key: key,
+		mine: func() { g.geth.Mine() },
+	}
+	tf.run(t)
+	if g.geth.Balance(to).Cmp(amount) != 0 {
+		t.Errorf("balance of %v = %v, want %v", to, g.geth.Balance(to), amount)
+	}
+}
+
+func TestERC20Cycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := erc20.NewERC20TokenHandlerFromConfig("ERC20BNB", types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ethcrypto.GenerateKey()
+	other, _ := ethcrypto.GenerateKey()
+	from := address(t, h, ecdsaPublicKey(key))
+	to := address(t, h, ecdsaPublicKey(other))
+	// gas 用 ETH 支付
+	g.geth.SetBalance(from, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	g.geth.SetTokenBalance(erc20.Tokens["ERC20BNB"], from, big.NewInt(5000))
+	// tokenType 不是 handler 的 token 时不能构造交易
+	if _, _, err := h.BuildUnsignedTransaction(from, ecdsaPublicKey(key), to, big.NewInt(1000), `{"tokenType":"ERC20GUSD"}`); err == nil {
+		t.Fatal("build with another token's tokenType should fail")
+	}
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: ecdsaPublicKey(key),
+		to: to,
+		amount: big.NewInt(1000),
+		// 文档里的 jsonstring 格式, tokenType 是 handler 的 token
+		jsonstring: `{"gasPrice":8000000000,"gasLimit":50000,"tokenType":"ERC20BNB"}`,
+		key: key,
+		mine: func() { g.geth.Mine() },
+	}
+	tf.run(t)
+}
+
+func TestXRPCycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := xrp.NewXRPHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := xrp.XRP_importKeyFromSeed(xrpSeed, "ecdsa")
+	seq0, seq1 := uint32(0), uint32(1)
+	pub := hex.EncodeToString(key.Public(&seq0))
+	from := address(t, h, pub)
+	to := address(t, h, hex.EncodeToString(key.Public(&seq1)))
+	g.rippled.SetAccount(from, 100000000, 1)
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: pub,
+		to: to,
+		amount: big.NewInt(20000000),
+		key: xrpSeed + "/0",
+		mine: func() { g.rippled.Mine() },
+	}
+	tf.run(t)
+	if g.rippled.Balance(to) != 20000000 {
+		t.Errorf("balance of %v = %v", to, g.rippled.Balance(to))
+	}
+}
+
+// 没有激活的帐户查不到 sequence, 不能用 0 构造交易
+func TestXRPAccountNotFound(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := xrp.NewXRPHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := xrp.XRP_importKeyFromSeed(xrpSeed, "ecdsa")
+	seq := uint32(2)
+	pub := hex.EncodeToString(key.Public(&seq))
+	from := address(t, h, pub)
+	outputs := []types.TxOutput{{ToAddress: from, Amount: big.NewInt(1)}}
+	if _, err := h.FetchChainState(context.Background(), from, pub, outputs, nil); !errors.Is(err, types.ErrNotFound) {
+		t.Errorf("fetch chain state error = %v, want %v", err, types.ErrNotFound)
+	}
+	if _, err := h.GetAddressBalance(from, ""); !errors.Is(err, types.ErrNotFound) {
+		t.Errorf("get balance error = %v, want %v", err, types.ErrNotFound)
+	}
+}
+
+func TestTRXCycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := trx.NewTRXHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ethcrypto.GenerateKey()
+	other, _ := ethcrypto.GenerateKey()
+	from := address(t, h, ecdsaPublicKey(key))
+	to := address(t, h, ecdsaPublicKey(other))
+	if err := g.tron.SetBalance(from, 10000000); err != nil {
+		t.Fatal(err)
+	}
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: ecdsaPublicKey(key),
+		to: to,
+		amount: big.NewInt(1000000),
+		key: key,
+		mine: func() { g.tron.Mine() },
+	}
+	tf.run(t)
+	if g.tron.Balance(to) != 1000000 {
+		t.Errorf("balance of %v = %v", to, g.tron.Balance(to))
+	}
+}
+
+func TestEOSCycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := eos.NewEOSHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newKey(t)
+	wif, err := btcutil.NewWIF(key, &chaincfg.MainNetParams, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := address(t, h, compressed(key))
+	to := address(t, h, compressed(newKey(t)))
+	g.nodeos.SetBalance(from, 100000)
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: compressed(key),
+		to: to,
+		amount: big.NewInt(12345),
+		key: wif.String(),
+		mine: func() { g.nodeos.Mine() },
+	}
+	tf.run(t)
+	if g.nodeos.Balance(to) != 12345 {
+		t.Errorf("balance of %v = %v", to, g.nodeos.Balance(to))
+	}
+}
+
+func TestEVTCycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := evt.NewEvtHandlerFromConfig("EVT1", types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newKey(t)
+	wif, err := btcutil.NewWIF(key, &chaincfg.MainNetParams, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := address(t, h, compressed(key))
+	to := address(t, h, compressed(newKey(t)))
+	g.evt.SetBalance(from, 1, 10000000)
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: compressed(key),
+		to: to,
+		amount: big.NewInt(100000),
+		key: wif.String(),
+		mine: func() { g.evt.Mine() },
+	}
+	tf.run(t)
+	if g.evt.Balance(to, 1) != 100000 {
+		t.Errorf("balance of %v = %v", to, g.evt.Balance(to, 1))
+	}
+}
+
+func TestATOMCycle(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := atom.NewAtomHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ethcrypto.GenerateKey()
+	other, _ := ethcrypto.GenerateKey()
+	from := address(t, h, ecdsaPublicKey(key))
+	to := address(t, h, ecdsaPublicKey(other))
+	g.cosmos.SetAccount(from, 10000000, 0)
+	tf := &transfer{
+		handler: h,
+		from: from,
+		publicKey: ecdsaPublicKey(key),
+		to: to,
+		amount: big.NewInt(1000000),
+		key: key,
+		mine: func() { g.cosmos.Mine() },
+	}
+	tf.run(t)
+	if g.cosmos.Balance(to) != 1000000 {
+		t.Errorf("balance of %v = %v", to, g.cosmos.Balance(to))
+	}
+	// 第二笔交易使用节点更新后的 sequence
+	tf.run(t)
+}
+
+// Script 替换节点的返回值, handler 应该把节点的拒绝归到对应的错误类别
+func TestScriptedRejection(t *testing.T) {
+	g := startGateways(t)
+	defer g.Close()
+	h, err := eth.NewETHHandlerFromConfig(types.Testnet, g.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ethcrypto.GenerateKey()
+	other, _ := ethcrypto.GenerateKey()
+	from := address(t, h, ecdsaPublicKey(key))
+	to := address(t, h, ecdsaPublicKey(other))
+	g.geth.SetBalance(from, big.NewInt(1000000000000000000))
+	tx, digests, err := h.BuildUnsignedTransaction(from, ecdsaPublicKey(key), to, big.NewInt(1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsv, err := h.SignTransaction(digests, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := h.MakeSignedTransaction(rsv, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.geth.Fail("eth_sendRawTransaction", &fakenode.Error{Code: -32000, Message: "nonce too low"})
+	if _, err := h.SubmitTransaction(signed); !errors.Is(err, types.ErrNonceConflict) {
+		t.Errorf("submit error = %v, want %v", err, types.ErrNonceConflict)
+	}
+	if n := g.geth.Calls("eth_sendRawTransaction"); n != 1 {
+		t.Errorf("eth_sendRawTransaction called %v times", n)
+	}
+	g.geth.Script("eth_sendRawTransaction", nil)
+	if _, err := h.SubmitTransaction(signed); err != nil {
+		t.Errorf("submit after restoring the built-in handler: %v", err)
+	}
+}
@@ -0,0 +1,398 @@
+package fakenode
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// erc20 balanceOf(address) 和 transfer(address,uint256) 的方法选择器
+const (
+	balanceOfSelector = "0x70a08231"
+	transferSelector = "a9059cbb"
+)
+
+// Geth 是假的以太坊节点 (geth json-rpc), etc 和 erc20 的 handler 也使用它
+// 支持 eth_chainId, net_version, eth_blockNumber, eth_getBlockByNumber, eth_getTransactionCount, eth_gasPrice,
+// eth_estimateGas, eth_getBalance, eth_call (只支持 erc20 的 balanceOf), eth_sendRawTransaction,
+// eth_getTransactionByHash, eth_getTransactionReceipt
+// 接受交易时立即扣款并增加 nonce, Mine 之前交易是 pending, 没有收据
+// 调用用 SetTokenBalance 设置过的合约的 transfer 时会转移代币余额, 其他合约调用只扣 gas
+type Geth struct {
+	*Server
+
+	GasPrice *big.Int
+	// 没有 data 的转账用 21000, 合约调用用 ContractGas
+	ContractGas uint64
+
+	chainID *big.Int
+	signer types.Signer
+	lock sync.Mutex
+	balances map[common.Address]*big.Int
+	nonces map[common.Address]uint64
+	tokens map[common.Address]map[common.Address]*big.Int
+	txs map[common.Hash]*gethTx
+	height uint64
+}
+
+type gethTx struct {
+	tx *types.Transaction
+	from common.Address
+	// 所在区块的高度, 0 表示 pending
+	height uint64
+	// erc20 转账余额不足, 收据的 status 是 0
+	failed bool
+}
+
+// NewGeth 启动链 id 为 chainID 的假节点, 用完后调用 Close
+func NewGeth(chainID *big.Int) *Geth {
+	g := &Geth{
+		GasPrice: big.NewInt(1000000000),
+		ContractGas: 60000,
+		chainID: chainID,
+		signer: types.NewEIP155Signer(chainID),
+		balances: make(map[common.Address]*big.Int),
+		nonces: make(map[common.Address]uint64),
+		tokens: make(map[common.Address]map[common.Address]*big.Int),
+		txs: make(map[common.Hash]*gethTx),
+		// 高于测试网的分叉高度, handler 按区块高度选择签名规则
+		height: 10000000,
+	}
+	g.Server = newServer(map[string]Handler{
+		"eth_chainId": g.chainId,
+		"net_version": g.netVersion,
+		"eth_blockNumber": g.blockNumber,
+		"eth_getBlockByNumber": g.getBlockByNumber,
+		"eth_getTransactionCount": g.getTransactionCount,
+		"eth_gasPrice": g.gasPrice,
+		"eth_estimateGas": g.estimateGas,
+		"eth_getBalance": g.getBalance,
+		"eth_call": g.call,
+		"eth_sendRawTransaction": g.sendRawTransaction,
+		"eth_getTransactionByHash": g.getTransactionByHash,
+		"eth_getTransactionReceipt": g.getTransactionReceipt,
+	})
+	g.start(func(w http.ResponseWriter, r *http.Request) {
+		g.serveRPC(w, r, "2.0", http.StatusOK)
+	})
+	return g
+}
+
+// SetBalance 设置 address 的余额, 单位 wei
+func (g *Geth) SetBalance(address string, wei *big.Int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.balances[common.HexToAddress(address)] = new(big.Int).Set(wei)
+}
+
+// SetTokenBalance 设置 erc20 合约 token 里 holder 的余额
+func (g *Geth) SetTokenBalance(token, holder string, amount *big.Int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	t := common.HexToAddress(token)
+	if g.tokens[t] == nil {
+		g.tokens[t] = make(map[common.Address]*big.Int)
+	}
+	g.tokens[t][common.HexToAddress(holder)] = new(big.Int).Set(amount)
+}
+
+// Balance 返回 address 的余额
+func (g *Geth) Balance(address string) *big.Int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.balance(common.HexToAddress(address))
+}
+
+// Transaction 返回 hash 对应的交易, 不存在时返回 nil
+func (g *Geth) Transaction(hash string) *types.Transaction {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if t, ok := g.txs[common.HexToHash(hash)]; ok {
+		return t.tx
+	}
+	return nil
+}
+
+// Mine 把 pending 的交易打包进一个新区块, 返回新区块的高度
+func (g *Geth) Mine() uint64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.height++
+	for _, t := range g.txs {
+		if t.height == 0 {
+			t.height = g.height
+		}
+	}
+	return g.height
+}
+
+func (g *Geth) balance(addr common.Address) *big.Int {
+	if b, ok := g.balances[addr]; ok {
+		return b
+	}
+	return new(big.Int)
+}
+
+// 假区块的 hash 由高度决定
+func gethBlockHash(height uint64) common.Hash {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], height)
+	return crypto.Keccak256Hash(b[:])
+}
+
+func (g *Geth) chainId(req *Request) (interface{}, error) {
+	return (*hexutil.Big)(g.chainID), nil
+}
+
+func (g *Geth) netVersion(req *Request) (interface{}, error) {
+	return g.chainID.String(), nil
+}
+
+func (g *Geth) blockNumber(req *Request) (interface{}, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return hexutil.Uint64(g.height), nil
+}
+
+// 只返回区块头, transactions 和 uncles 总是空的
+func (g *Geth) getBlockByNumber(req *Request) (interface{}, error) {
+	var tag string
+	if err := bindArgs(req, &tag); err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	height := g.height
+	g.lock.Unlock()
+	if tag != "latest" && tag != "pending" {
+		n, err := hexutil.DecodeUint64(tag)
+		if err != nil {
+			return nil, &Error{Code: -32602, Message: "invalid block number " + tag}
+		}
+		if n > height {
+			return nil, nil
+		}
+		height = n
+	}
+	zero := common.Hash{}.Hex()
+	return map[string]interface{}{
+		"hash": gethBlockHash(height).Hex(),
+		"parentHash": gethBlockHash(height - 1).Hex(),
+		"sha3Uncles": types.EmptyUncleHash.Hex(),
+		"miner": common.Address{}.Hex(),
+		"stateRoot": zero,
+		"transactionsRoot": types.EmptyRootHash.Hex(),
+		"receiptsRoot": types.EmptyRootHash.Hex(),
+		"logsBloom": hexutil.Bytes(make([]byte, types.BloomByteLength)),
+		"difficulty": "0x1",
+		"number": hexutil.Uint64(height),
+		"gasLimit": hexutil.Uint64(8000000),
+		"gasUsed": "0x0",
+		"timestamp": hexutil.Uint64(genesisTime.Add(time.Duration(height) * 15 * time.Second).Unix()),
+		"extraData": "0x",
+		"mixHash": zero,
+		"nonce": "0x0000000000000000",
+		"transactions": []interface{}{},
+		"uncles": []interface{}{},
+	}, nil
+}
+
+func (g *Geth) getTransactionCount(req *Request) (interface{}, error) {
+	var address common.Address
+	if err := bindArgs(req, &address); err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return hexutil.Uint64(g.nonces[address]), nil
+}
+
+func (g *Geth) gasPrice(req *Request) (interface{}, error) {
+	return (*hexutil.Big)(g.GasPrice), nil
+}
+
+func (g *Geth) estimateGas(req *Request) (interface{}, error) {
+	var msg struct {
+		Data hexutil.Bytes `json:"data"`
+		Input hexutil.Bytes `json:"input"`
+	}
+	if err := bindArgs(req, &msg); err != nil {
+		return nil, err
+	}
+	if len(msg.Data) == 0 && len(msg.Input) == 0 {
+		return hexutil.Uint64(21000), nil
+	}
+	return hexutil.Uint64(g.ContractGas), nil
+}
+
+func (g *Geth) getBalance(req *Request) (interface{}, error) {
+	var address common.Address
+	if err := bindArgs(req, &address); err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return (*hexutil.Big)(g.balance(address)), nil
+}
+
+func (g *Geth) call(req *Request) (interface{}, error) {
+	var msg struct {
+		To common.Address `json:"to"`
+		Data string `json:"data"`
+	}
+	if err := bindArgs(req, &msg); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(msg.Data, balanceOfSelector) || len(msg.Data) != len(balanceOfSelector)+64 {
+		return nil, &Error{Code: -32000, Message: "execution reverted"}
+	}
+	holder := common.HexToAddress(msg.Data[len(balanceOfSelector):])
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	amount := new(big.Int)
+	if b, ok := g.tokens[msg.To][holder]; ok {
+		amount = b
+	}
+	return hexutil.Bytes(common.LeftPadBytes(amount.Bytes(), 32)), nil
+}
+
+func (g *Geth) sendRawTransaction(req *Request) (interface{}, error) {
+	var raw hexutil.Bytes
+	if err := bindArgs(req, &raw); err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		return nil, &Error{Code: -32000, Message: "rlp: " + err.Error()}
+	}
+	from, err := types.Sender(g.signer, tx)
+	if err != nil {
+		return nil, &Error{Code: -32000, Message: "invalid sender"}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, ok := g.txs[tx.Hash()]; ok {
+		return nil, &Error{Code: -32000, Message: "already known"}
+	}
+	switch nonce := g.nonces[from]; {
+	case tx.Nonce() < nonce:
+		return nil, &Error{Code: -32000, Message: "nonce too low"}
+	case tx.Nonce() > nonce:
+		// 真实节点会放进 queued, 这里直接拒绝, 避免交易永远不上链
+		return nil, &Error{Code: -32000, Message: fmt.Sprintf("nonce too high: next nonce %v, tx nonce %v", nonce, tx.Nonce())}
+	}
+	if tx.GasPrice().Cmp(g.GasPrice) < 0 {
+		return nil, &Error{Code: -32000, Message: "transaction underpriced"}
+	}
+	cost := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.Gas()))
+	cost.Add(cost, tx.Value())
+	balance := g.balance(from)
+	if balance.Cmp(cost) < 0 {
+		return nil, &Error{Code: -32000, Message: "insufficient funds for gas * price + value"}
+	}
+	g.balances[from] = new(big.Int).Sub(balance, cost)
+	t := &gethTx{tx: tx, from: from}
+	if to := tx.To(); to != nil {
+		g.balances[*to] = new(big.Int).Add(g.balance(*to), tx.Value())
+		t.failed = !g.applyTokenTransfer(*to, from, tx.Data())
+	}
+	g.nonces[from]++
+	g.txs[tx.Hash()] = t
+	return tx.Hash(), nil
+}
+
+func (g *Geth) getTransactionByHash(req *Request) (interface{}, error) {
+	var hash common.Hash
+	if err := bindArgs(req, &hash); err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	t, ok := g.txs[hash]
+	if !ok {
+		return nil, nil
+	}
+	b, err := json.Marshal(t.tx)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]interface{}
+	if err = json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	res["from"] = t.from
+	res["blockHash"] = nil
+	res["blockNumber"] = nil
+	res["transactionIndex"] = nil
+	if t.height > 0 {
+		res["blockHash"] = gethBlockHash(t.height)
+		res["blockNumber"] = hexutil.Uint64(t.height)
+		res["transactionIndex"] = "0x0"
+	}
+	return res, nil
+}
+
+// 假节点不执行合约, 只有余额不足的 erc20 转账 status 是 0, gasUsed 是交易的 gas limit
+func (g *Geth) getTransactionReceipt(req *Request) (interface{}, error) {
+	var hash common.Hash
+	if err := bindArgs(req, &hash); err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	t, ok := g.txs[hash]
+	if !ok || t.height == 0 {
+		return nil, nil
+	}
+	status := "0x1"
+	if t.failed {
+		status = "0x0"
+	}
+	return map[string]interface{}{
+		"transactionHash": hash,
+		"transactionIndex": "0x0",
+		"blockHash": gethBlockHash(t.height),
+		"blockNumber": hexutil.Uint64(t.height),
+		"from": t.from,
+		"to": t.tx.To(),
+		"gasUsed": hexutil.Uint64(t.tx.Gas()),
+		"cumulativeGasUsed": hexutil.Uint64(t.tx.Gas()),
+		"contractAddress": nil,
+		"logs": []interface{}{},
+		"logsBloom": hexutil.Bytes(make([]byte, types.BloomByteLength)),
+		"status": status,
+	}, nil
+}
+
+// applyTokenTransfer 执行 erc20 合约 token 的 transfer, 不是已知合约的 transfer 时什么都不做
+// 余额不足时返回 false
+func (g *Geth) applyTokenTransfer(token, from common.Address, data []byte) bool {
+	balances, ok := g.tokens[token]
+	if !ok || len(data) != 4+32+32 || hex.EncodeToString(data[:4]) != transferSelector {
+		return true
+	}
+	to := common.BytesToAddress(data[4:36])
+	amount := new(big.Int).SetBytes(data[36:68])
+	balance, ok := balances[from]
+	if !ok || balance.Cmp(amount) < 0 {
+		return false
+	}
+	balances[from] = new(big.Int).Sub(balance, amount)
+	if b, ok := balances[to]; ok {
+		balances[to] = new(big.Int).Add(b, amount)
+	} else {
+		balances[to] = new(big.Int).Set(amount)
+	}
+	return true
+}
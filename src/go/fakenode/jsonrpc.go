@@ -0,0 +1,77 @@
+package fakenode
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+type rpcRequest struct {
+	Method string `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Id json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code int `json:"code"`
+	Message string `json:"message"`
+}
+
+// serveRPC 处理一次 json-rpc 请求, version 为空时是 bitcoind 的 1.0 格式, 出错时返回 errStatus
+// 1.0 的响应总是带 result 和 error 两个字段, 2.0 只带其中一个
+func (s *Server) serveRPC(w http.ResponseWriter, r *http.Request, version string, errStatus int) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"result": nil, "error": rpcError{-32700, err.Error()}, "id": nil})
+		return
+	}
+	var req rpcRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"result": nil, "error": rpcError{-32700, "parse error"}, "id": nil})
+		return
+	}
+	result, err := s.dispatch(&Request{Route: req.Method, Params: req.Params})
+	if raw, ok := result.(Raw); ok && err == nil {
+		writeJSON(w, http.StatusOK, raw)
+		return
+	}
+	res := map[string]interface{}{"id": req.Id}
+	if version != "" {
+		res["jsonrpc"] = version
+	}
+	if err != nil {
+		e := asError(err)
+		status := errStatus
+		if version == "" && e.Status == http.StatusNotFound {
+			status = e.Status
+		}
+		res["error"] = rpcError{e.Code, e.Message}
+		if version == "" {
+			res["result"] = nil
+		}
+		writeJSON(w, status, res)
+		return
+	}
+	res["result"] = result
+	if version == "" {
+		res["error"] = nil
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// 解析位置参数, args 依次对应 params 里的元素, 多出的 args 保持原值
+func bindArgs(req *Request, args ...interface{}) error {
+	var params []json.RawMessage
+	if err := req.Bind(&params); err != nil {
+		return err
+	}
+	for i := range args {
+		if i >= len(params) {
+			break
+		}
+		if err := json.Unmarshal(params[i], args[i]); err != nil {
+			return &Error{Code: -8, Message: "invalid parameter: " + err.Error()}
+		}
+	}
+	return nil
+}
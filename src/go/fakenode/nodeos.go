@@ -0,0 +1,448 @@
+package fakenode
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nodeos 的时间格式, UTC, 不带时区
+const (
+	nodeosTimeLayout = "2006-01-02T15:04:05.000"
+	eosExpirationLayout = "2006-01-02T15:04:05"
+)
+
+// Nodeos 是假的 nodeos http api, 带 history 插件和 eos handler 查余额用的 balance tracker
+// 支持 chain 的 get_info, get_block, push_transaction, history 的 get_transaction, get_actions, get_key_accounts,
+// 以及 GET get_balance?user_key=
+// push_transaction 检查引用区块, 过期时间和是否带签名, 不验证签名, 只执行 eosio.token 的 EOS transfer
+// 交易 id 是 transaction json 的 sha256, 和真实节点 (打包后交易的 sha256) 不同, 测试只应该使用节点返回的 id
+type Nodeos struct {
+	*Server
+
+	ChainID string
+
+	lock sync.Mutex
+	// 单位是 0.0001 EOS
+	balances map[string]int64
+	keys map[string][]string
+	txs map[string]*eosTx
+	// 每个账户收到的 action, 下标是 account_action_seq
+	actions map[string][]*eosAction
+	height uint64
+	seq uint64
+}
+
+type eosTx struct {
+	id string
+	trx map[string]interface{}
+	// 所在区块, 0 表示还没有进入区块
+	blockNum uint64
+}
+
+type eosAction struct {
+	globalSeq uint64
+	tx *eosTx
+	act map[string]interface{}
+}
+
+// NewNodeos 启动假 nodeos, chainID 是 get_info 返回的 chain_id, 用完后调用 Close
+func NewNodeos(chainID string) *Nodeos {
+	n := &Nodeos{
+		ChainID: chainID,
+		balances: make(map[string]int64),
+		keys: make(map[string][]string),
+		txs: make(map[string]*eosTx),
+		actions: make(map[string][]*eosAction),
+		height: 1000,
+	}
+	n.Server = newServer(map[string]Handler{
+		"v1/chain/get_info": n.getInfo,
+		"v1/chain/get_block": n.getBlock,
+		"v1/chain/push_transaction": n.pushTransaction,
+		"v1/history/get_transaction": n.getTransaction,
+		"v1/history/get_actions": n.getActions,
+		"v1/history/get_key_accounts": n.getKeyAccounts,
+		"get_balance": n.getBalance,
+	})
+	n.start(n.serve)
+	return n
+}
+
+func (n *Nodeos) serve(w http.ResponseWriter, r *http.Request) {
+	serveNodeosAPI(n.Server, w, r)
+}
+
+// serveNodeosAPI 按 nodeos 的格式返回结果和错误, evt 节点的 api 和 nodeos 相同
+func serveNodeosAPI(s *Server, w http.ResponseWriter, r *http.Request) {
+	req, err := restRequest(r)
+	if err == nil {
+		var result interface{}
+		result, err = s.dispatch(req)
+		if err == nil {
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+	}
+	e := asError(err)
+	status := e.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	name := e.Name
+	if name == "" {
+		name = "exception"
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"code": status,
+		"message": http.StatusText(status),
+		"error": map[string]interface{}{
+			"code": e.Code,
+			"name": name,
+			"what": e.Message,
+			"details": []interface{}{map[string]interface{}{"message": e.Message}},
+		},
+	})
+}
+
+// SetBalance 设置 account 的 EOS 余额, 单位 0.0001 EOS
+func (n *Nodeos) SetBalance(account string, balance int64) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.balances[account] = balance
+}
+
+// Balance 返回 account 的 EOS 余额
+func (n *Nodeos) Balance(account string) int64 {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.balances[account]
+}
+
+// AddKey 让 get_key_accounts 对 publicKey 返回 account
+func (n *Nodeos) AddKey(publicKey, account string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.keys[publicKey] = append(n.keys[publicKey], account)
+}
+
+// Mine 出一个新区块, 之前接受的交易进入这个区块, 返回新区块的高度
+func (n *Nodeos) Mine() uint64 {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.height++
+	for _, tx := range n.txs {
+		if tx.blockNum == 0 {
+			tx.blockNum = n.height
+		}
+	}
+	return n.height
+}
+
+// 区块 id 的前 4 字节是高度, 和真实节点相同
+func eosBlockID(num uint64) []byte {
+	id := make([]byte, 32)
+	binary.BigEndian.PutUint32(id, uint32(num))
+	h := sha256.Sum256(id[:4])
+	copy(id[4:], h[:28])
+	return id
+}
+
+// 每 0.5 秒一个区块
+func eosBlockTime(num uint64) time.Time {
+	return genesisTime.Add(time.Duration(num) * 500 * time.Millisecond).UTC()
+}
+
+// 不可逆区块落后 head 325 个区块
+func (n *Nodeos) lib() uint64 {
+	if n.height > 325 {
+		return n.height - 325
+	}
+	return 1
+}
+
+func (n *Nodeos) getInfo(req *Request) (interface{}, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return map[string]interface{}{
+		"server_version": "fakenode",
+		"chain_id": n.ChainID,
+		"head_block_num": n.height,
+		"head_block_id": hex.EncodeToString(eosBlockID(n.height)),
+		"head_block_time": eosBlockTime(n.height).Format(nodeosTimeLayout),
+		"head_block_producer": "eosio",
+		"last_irreversible_block_num": n.lib(),
+		"last_irreversible_block_id": hex.EncodeToString(eosBlockID(n.lib())),
+	}, nil
+}
+
+// block_num_or_id 可以是高度或区块 id
+func (n *Nodeos) getBlock(req *Request) (interface{}, error) {
+	var params struct {
+		BlockNumOrID json.RawMessage `json:"block_num_or_id"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	s := strings.Trim(string(params.BlockNumOrID), `"`)
+	num, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		if id, err := hex.DecodeString(s); err == nil && len(id) == 32 {
+			num = uint64(binary.BigEndian.Uint32(id))
+		}
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if num == 0 || num > n.height || (err != nil && hex.EncodeToString(eosBlockID(num)) != s) {
+		return nil, &Error{Code: 3100002, Name: "unknown_block_exception", Message: "Could not find block: " + s}
+	}
+	id := eosBlockID(num)
+	return map[string]interface{}{
+		"id": hex.EncodeToString(id),
+		"block_num": num,
+		"timestamp": eosBlockTime(num).Format(nodeosTimeLayout),
+		"producer": "eosio",
+		"previous": hex.EncodeToString(eosBlockID(num - 1)),
+		"ref_block_prefix": binary.LittleEndian.Uint32(id[8:12]),
+		"transactions": []interface{}{},
+	}, nil
+}
+
+// 引用区块必须是最近 65536 个区块之一, ref_block_num 是高度的低 16 位
+func (n *Nodeos) refBlockKnown(refBlockNum uint16, refBlockPrefix uint32) bool {
+	for num := n.height; num > 0 && num+65536 > n.height; num-- {
+		id := eosBlockID(num)
+		if uint16(num) == refBlockNum && binary.LittleEndian.Uint32(id[8:12]) == refBlockPrefix {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Nodeos) pushTransaction(req *Request) (interface{}, error) {
+	var params struct {
+		Signatures []string `json:"signatures"`
+		Transaction json.RawMessage `json:"transaction"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	var trx struct {
+		Expiration string `json:"expiration"`
+		RefBlockNum uint16 `json:"ref_block_num"`
+		RefBlockPrefix uint32 `json:"ref_block_prefix"`
+		Actions []map[string]interface{} `json:"actions"`
+	}
+	var trxJSON map[string]interface{}
+	if err := json.Unmarshal(params.Transaction, &trx); err != nil {
+		return nil, &Error{Code: 3010008, Name: "packed_transaction_type_exception", Message: err.Error()}
+	}
+	json.Unmarshal(params.Transaction, &trxJSON)
+	expiration, err := time.Parse(eosExpirationLayout, strings.TrimSuffix(trx.Expiration, "Z"))
+	if err != nil {
+		return nil, &Error{Code: 3010008, Name: "packed_transaction_type_exception", Message: "invalid expiration " + trx.Expiration}
+	}
+	sum := sha256.Sum256(params.Transaction)
+	id := hex.EncodeToString(sum[:])
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if _, ok := n.txs[id]; ok {
+		return nil, &Error{Code: 3040008, Name: "tx_duplicate", Message: "duplicate transaction " + id}
+	}
+	if !n.refBlockKnown(trx.RefBlockNum, trx.RefBlockPrefix) {
+		return nil, &Error{Code: 3040007, Name: "invalid_ref_block_exception", Message: "Transaction's reference block did not match."}
+	}
+	if !expiration.After(eosBlockTime(n.height)) {
+		return nil, &Error{Code: 3040005, Name: "expired_tx_exception", Message: "Expired Transaction"}
+	}
+	if expiration.After(eosBlockTime(n.height).Add(time.Hour)) {
+		return nil, &Error{Code: 3040006, Name: "tx_exp_too_far_exception", Message: "Transaction Expiration Too Far"}
+	}
+	if len(params.Signatures) == 0 {
+		return nil, &Error{Code: 3090003, Name: "unsatisfied_authorization", Message: "transaction declares authority but does not have signatures for it."}
+	}
+	// 先检查余额再转账, 交易里的 action 要么全部执行, 要么都不执行
+	balances := make(map[string]int64)
+	for _, act := range trx.Actions {
+		from, to, amount, ok := eosTransfer(act)
+		if !ok {
+			continue
+		}
+		if _, ok := balances[from]; !ok {
+			balances[from] = n.balances[from]
+		}
+		if _, ok := balances[to]; !ok {
+			balances[to] = n.balances[to]
+		}
+		if balances[from] < amount {
+			return nil, &Error{Code: 3050003, Name: "eosio_assert_message_exception", Message: "assertion failure with message: overdrawn balance"}
+		}
+		balances[from] -= amount
+		balances[to] += amount
+	}
+	for account, balance := range balances {
+		n.balances[account] = balance
+	}
+	tx := &eosTx{id: id, trx: trxJSON}
+	n.txs[id] = tx
+	for _, act := range trx.Actions {
+		n.seq++
+		a := &eosAction{globalSeq: n.seq, tx: tx, act: act}
+		// transfer 通知付款人和收款人, 其他 action 只记在合约账户下
+		if from, to, _, ok := eosTransfer(act); ok {
+			n.actions[from] = append(n.actions[from], a)
+			if to != from {
+				n.actions[to] = append(n.actions[to], a)
+			}
+		} else if account, _ := act["account"].(string); account != "" {
+			n.actions[account] = append(n.actions[account], a)
+		}
+	}
+	return map[string]interface{}{
+		"transaction_id": id,
+		"processed": map[string]interface{}{
+			"id": id,
+			"receipt": map[string]interface{}{"status": "executed"},
+		},
+	}, nil
+}
+
+// eosTransfer 解析 eosio.token 的 EOS transfer, 金额单位 0.0001 EOS
+func eosTransfer(act map[string]interface{}) (from, to string, amount int64, ok bool) {
+	if act["account"] != "eosio.token" || act["name"] != "transfer" {
+		return
+	}
+	data, _ := act["data"].(map[string]interface{})
+	from, _ = data["from"].(string)
+	to, _ = data["to"].(string)
+	quantity, _ := data["quantity"].(string)
+	if from == "" || to == "" || !strings.HasSuffix(quantity, " EOS") {
+		return
+	}
+	amount, ok = parseAsset(strings.TrimSuffix(quantity, " EOS"), 4)
+	return
+}
+
+// parseAsset 把小数位数是 decimals 的金额转成最小单位
+func parseAsset(s string, decimals int) (int64, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) > 2 || (len(parts) == 2 && len(parts[1]) != decimals) {
+		return 0, false
+	}
+	digits := parts[0]
+	if len(parts) == 2 {
+		digits += parts[1]
+	} else {
+		digits += strings.Repeat("0", decimals)
+	}
+	v, err := strconv.ParseInt(digits, 10, 64)
+	return v, err == nil && v > 0
+}
+
+// 找不到交易时和 history 插件一样返回 tx_not_found
+func (n *Nodeos) getTransaction(req *Request) (interface{}, error) {
+	var params struct {
+		Id string `json:"id"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	tx, ok := n.txs[strings.ToLower(params.Id)]
+	if !ok || tx.blockNum == 0 {
+		return nil, &Error{Code: 3040011, Name: "tx_not_found", Message: fmt.Sprintf("Transaction %v not found in history and no block hint was given", params.Id)}
+	}
+	return map[string]interface{}{
+		"id": tx.id,
+		"block_num": tx.blockNum,
+		"block_time": eosBlockTime(tx.blockNum).Format(nodeosTimeLayout),
+		"last_irreversible_block": n.lib(),
+		"trx": map[string]interface{}{
+			"receipt": map[string]interface{}{
+				"status": "executed",
+				"cpu_usage_us": 100,
+				"net_usage_words": 16,
+			},
+			"trx": tx.trx,
+		},
+	}, nil
+}
+
+// pos 为 -1 时从最新的 action 开始, offset 为负时返回 pos+offset 到 pos, 从旧到新排列
+// 和 history 插件一样, 还没进入区块的交易的 action 不返回
+func (n *Nodeos) getActions(req *Request) (interface{}, error) {
+	var params struct {
+		AccountName string `json:"account_name"`
+		Pos int64 `json:"pos"`
+		Offset int64 `json:"offset"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	var all []*eosAction
+	for _, a := range n.actions[params.AccountName] {
+		if a.tx.blockNum > 0 {
+			all = append(all, a)
+		}
+	}
+	pos := params.Pos
+	if pos < 0 || pos >= int64(len(all)) {
+		pos = int64(len(all)) - 1
+	}
+	start, end := pos, pos+params.Offset
+	if params.Offset < 0 {
+		start, end = pos+params.Offset, pos
+	}
+	if start < 0 {
+		start = 0
+	}
+	actions := []interface{}{}
+	for i := start; i <= end && i < int64(len(all)); i++ {
+		a := all[i]
+		actions = append(actions, map[string]interface{}{
+			"global_action_seq": a.globalSeq,
+			"account_action_seq": i,
+			"block_num": a.tx.blockNum,
+			"block_time": eosBlockTime(a.tx.blockNum).Format(nodeosTimeLayout),
+			"action_trace": map[string]interface{}{
+				"trx_id": a.tx.id,
+				"act": a.act,
+			},
+		})
+	}
+	return map[string]interface{}{
+		"actions": actions,
+		"last_irreversible_block": n.lib(),
+	}, nil
+}
+
+func (n *Nodeos) getKeyAccounts(req *Request) (interface{}, error) {
+	var params struct {
+		PublicKey string `json:"public_key"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	accounts := append([]string{}, n.keys[params.PublicKey]...)
+	return map[string]interface{}{"account_names": accounts}, nil
+}
+
+// balance tracker 的接口, user_key 就是账户名, 余额是 0.0001 EOS 为单位的十进制字符串
+func (n *Nodeos) getBalance(req *Request) (interface{}, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return map[string]interface{}{"balance": strconv.FormatInt(n.balances[req.Query.Get("user_key")], 10)}, nil
+}
@@ -0,0 +1,313 @@
+package fakenode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/rubblelabs/ripple/data"
+)
+
+// rippled 接受交易时返回的 engine_result_message, xrp handler 用它判断是否成功
+const tesSUCCESSMessage = "The transaction was applied. Only final in a validated ledger."
+
+// Rippled 是假的 rippled json-rpc 节点
+// 支持 account_info, submit, tx, fee, server_info, submit 只接受 XRP 的 Payment
+// 接受交易时立即更新余额和 Sequence, Mine 关闭账本后交易才是 validated
+type Rippled struct {
+	*Server
+
+	// 以 drops 为单位的基础费用
+	BaseFee int64
+
+	lock sync.Mutex
+	accounts map[string]*rippleAccount
+	txs map[string]*rippleTx
+	ledger uint64
+}
+
+type rippleAccount struct {
+	balance int64
+	sequence uint32
+}
+
+type rippleTx struct {
+	json map[string]interface{}
+	// 所在账本, 0 表示还没有进入账本
+	ledger uint64
+}
+
+// NewRippled 启动假 rippled, 用完后调用 Close
+func NewRippled() *Rippled {
+	x := &Rippled{
+		BaseFee: 10,
+		accounts: make(map[string]*rippleAccount),
+		txs: make(map[string]*rippleTx),
+		ledger: 1000,
+	}
+	x.Server = newServer(map[string]Handler{
+		"account_info": x.accountInfo,
+		"submit": x.submit,
+		"tx": x.tx,
+		"fee": x.fee,
+		"server_info": x.serverInfo,
+	})
+	x.start(x.serve)
+	return x
+}
+
+// rippled 的方法名在请求体里, 参数是只有一个对象的数组, 错误也在 result 里
+func (x *Rippled) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	var req struct {
+		Method string `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Raw("Unable to parse request: "+err.Error()))
+		return
+	}
+	params := json.RawMessage("{}")
+	if len(req.Params) > 0 {
+		params = req.Params[0]
+	}
+	result, err := x.dispatch(&Request{Route: req.Method, Params: params})
+	if raw, ok := result.(Raw); ok && err == nil {
+		writeJSON(w, http.StatusOK, raw)
+		return
+	}
+	if err != nil {
+		e := asError(err)
+		name := e.Name
+		if name == "" {
+			name = "internal"
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"result": map[string]interface{}{
+			"error": name,
+			"error_code": e.Code,
+			"error_message": e.Message,
+			"status": "error",
+		}})
+		return
+	}
+	res, _ := result.(map[string]interface{})
+	if res == nil {
+		res = map[string]interface{}{}
+	}
+	res["status"] = "success"
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": res})
+}
+
+// SetAccount 创建或修改账户, balance 以 drops 为单位
+func (x *Rippled) SetAccount(address string, balance int64, sequence uint32) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.accounts[address] = &rippleAccount{balance: balance, sequence: sequence}
+}
+
+// Balance 返回账户的余额, 账户不存在时返回 0
+func (x *Rippled) Balance(address string) int64 {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if acc, ok := x.accounts[address]; ok {
+		return acc.balance
+	}
+	return 0
+}
+
+// Mine 关闭当前账本, 之前接受的交易进入账本并且是 validated, 返回账本序号
+func (x *Rippled) Mine() uint64 {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.ledger++
+	for _, t := range x.txs {
+		if t.ledger == 0 {
+			t.ledger = x.ledger
+		}
+	}
+	return x.ledger
+}
+
+func (x *Rippled) accountInfo(req *Request) (interface{}, error) {
+	var params struct {
+		Account string `json:"account"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	acc, ok := x.accounts[params.Account]
+	if !ok {
+		return nil, &Error{Name: "actNotFound", Code: 19, Message: "Account not found."}
+	}
+	return map[string]interface{}{
+		"account_data": map[string]interface{}{
+			"Account": params.Account,
+			"Balance": strconv.FormatInt(acc.balance, 10),
+			"Sequence": acc.sequence,
+			"Flags": 0,
+			"OwnerCount": 0,
+			"LedgerEntryType": "AccountRoot",
+		},
+		"ledger_current_index": x.ledger + 1,
+		"validated": false,
+	}, nil
+}
+
+func (x *Rippled) submit(req *Request) (interface{}, error) {
+	var params struct {
+		TxBlob string `json:"tx_blob"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	blob, err := hex.DecodeString(params.TxBlob)
+	if err != nil {
+		return nil, &Error{Name: "invalidParams", Code: 31, Message: "Invalid field 'tx_blob'."}
+	}
+	tx, err := data.ReadTransaction(bytes.NewReader(blob))
+	if err != nil {
+		return nil, &Error{Name: "invalidTransaction", Code: 31, Message: err.Error()}
+	}
+	hash, _, err := data.Raw(tx)
+	if err != nil {
+		return nil, &Error{Name: "invalidTransaction", Code: 31, Message: err.Error()}
+	}
+	copy(tx.GetHash().Bytes(), hash.Bytes())
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	var txJSON map[string]interface{}
+	if err = json.Unmarshal(b, &txJSON); err != nil {
+		return nil, err
+	}
+	res := map[string]interface{}{
+		"tx_blob": params.TxBlob,
+		"tx_json": txJSON,
+	}
+	engineResult := func(code string, n int, message string) (interface{}, error) {
+		res["engine_result"] = code
+		res["engine_result_code"] = n
+		res["engine_result_message"] = message
+		return res, nil
+	}
+
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if _, ok := x.txs[hash.String()]; ok {
+		return engineResult("tefALREADY", -198, "The exact transaction was already in this ledger.")
+	}
+	if txJSON["TransactionType"] != "Payment" {
+		return engineResult("temUNKNOWN", -264, "The transaction requires logic that is not implemented yet.")
+	}
+	if s, _ := txJSON["TxnSignature"].(string); s == "" {
+		return engineResult("temBAD_SIGNATURE", -281, "Malformed: Bad signature.")
+	}
+	account, _ := txJSON["Account"].(string)
+	destination, _ := txJSON["Destination"].(string)
+	acc, ok := x.accounts[account]
+	if !ok {
+		return engineResult("terNO_ACCOUNT", -96, "The source account does not exist.")
+	}
+	sequence, _ := txJSON["Sequence"].(float64)
+	switch {
+	case uint32(sequence) < acc.sequence:
+		return engineResult("tefPAST_SEQ", -190, "This sequence number has already passed.")
+	case uint32(sequence) > acc.sequence:
+		return engineResult("terPRE_SEQ", -92, "Missing/inapplicable prior transaction.")
+	}
+	// 只支持 XRP, 金额和费用都是 drops 字符串
+	amountStr, _ := txJSON["Amount"].(string)
+	amount, err1 := strconv.ParseInt(amountStr, 10, 64)
+	feeStr, _ := txJSON["Fee"].(string)
+	fee, err2 := strconv.ParseInt(feeStr, 10, 64)
+	if err1 != nil || err2 != nil || amount <= 0 || fee < 0 {
+		return engineResult("temBAD_AMOUNT", -298, "Can only send positive amounts.")
+	}
+	if fee < x.BaseFee {
+		return engineResult("telINSUF_FEE_P", -394, "Fee insufficient.")
+	}
+	if acc.balance < amount+fee {
+		return engineResult("tecUNFUNDED_PAYMENT", 104, "Insufficient XRP balance to send.")
+	}
+	acc.balance -= amount + fee
+	acc.sequence++
+	if dst, ok := x.accounts[destination]; ok {
+		dst.balance += amount
+	} else {
+		x.accounts[destination] = &rippleAccount{balance: amount, sequence: 1}
+	}
+	x.txs[hash.String()] = &rippleTx{json: txJSON}
+	return engineResult("tesSUCCESS", 0, tesSUCCESSMessage)
+}
+
+func (x *Rippled) tx(req *Request) (interface{}, error) {
+	var params struct {
+		Transaction string `json:"transaction"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	hash, err := data.NewHash256(params.Transaction)
+	if err != nil {
+		return nil, &Error{Name: "notImpl", Code: 2, Message: "Not implemented."}
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	t, ok := x.txs[hash.String()]
+	if !ok {
+		return nil, &Error{Name: "txnNotFound", Code: 29, Message: "Transaction not found."}
+	}
+	res := make(map[string]interface{})
+	for k, v := range t.json {
+		res[k] = v
+	}
+	res["validated"] = t.ledger > 0
+	if t.ledger > 0 {
+		res["ledger_index"] = t.ledger
+		res["meta"] = map[string]interface{}{
+			"TransactionIndex": 0,
+			"TransactionResult": "tesSUCCESS",
+			"delivered_amount": t.json["Amount"],
+		}
+	}
+	return res, nil
+}
+
+func (x *Rippled) fee(req *Request) (interface{}, error) {
+	base := strconv.FormatInt(x.BaseFee, 10)
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return map[string]interface{}{
+		"drops": map[string]interface{}{
+			"base_fee": base,
+			"minimum_fee": base,
+			"open_ledger_fee": base,
+			"median_fee": strconv.FormatInt(x.BaseFee*500, 10),
+		},
+		"ledger_current_index": x.ledger + 1,
+	}, nil
+}
+
+func (x *Rippled) serverInfo(req *Request) (interface{}, error) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return map[string]interface{}{
+		"info": map[string]interface{}{
+			"load_factor": 1,
+			"validated_ledger": map[string]interface{}{
+				"seq": x.ledger,
+				"base_fee_xrp": json.Number(strconv.FormatFloat(float64(x.BaseFee)/1e6, 'f', -1, 64)),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,203 @@
+// Package fakenode 提供进程内的假节点, 只实现 handler 用到的那部分节点协议
+// 测试用指向假节点的网关配置创建 handler, 不访问网络就能跑完 构造→签名→提交→查询 的流程
+// 每个假节点都可以用 Script 替换某个方法或路由的返回值, 模拟节点出错, 交易被拒绝等情况
+package fakenode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Request 是假节点收到的一次请求
+// json-rpc 的 Route 是方法名, Params 是 params 字段; REST 的 Route 是去掉首尾 / 的路径, Params 是请求体
+type Request struct {
+	Route string
+	Params json.RawMessage
+	Query url.Values
+	// 路由模式里 * 匹配到的路径段, 例如 "tx/*" 匹配 "tx/<id>" 时是 [<id>]
+	Args []string
+}
+
+// Bind 把 Params 解析到 v
+func (req *Request) Bind(v interface{}) error {
+	if len(req.Params) == 0 {
+		return &Error{Status: http.StatusBadRequest, Message: "empty request"}
+	}
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
+
+// Handler 处理一次请求, 返回值编码成 json 作为结果, 出错时按假节点的协议格式返回错误
+type Handler func(req *Request) (interface{}, error)
+
+// Error 是节点返回的错误
+// json-rpc 节点把 Code 和 Message 放进 error 字段, REST 节点按各自 API 的格式返回
+// Name 是 rippled, nodeos 等节点的错误名, Status 是 http 状态码, 为 0 时使用节点的默认值
+type Error struct {
+	Status int
+	Code int
+	Name string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Name != "" {
+		return e.Name + ": " + e.Message
+	}
+	return e.Message
+}
+
+// Raw 是原样返回的响应体, Script 用它返回格式错误或任意内容的响应
+type Raw string
+
+// Server 是假节点共用的 http 服务, 记录每个路由被调用的次数, 并允许用 Script 替换内置的处理函数
+// 路由是 json-rpc 的方法名或 REST 的路由模式, 模式里的 * 匹配一个路径段, 例如 "address/*/utxo"
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	routes map[string]Handler
+	scripts map[string]Handler
+	calls map[string]int
+}
+
+func newServer(routes map[string]Handler) *Server {
+	return &Server{
+		routes: routes,
+		scripts: make(map[string]Handler),
+		calls: make(map[string]int),
+	}
+}
+
+// start 启动 http 服务, serve 负责解析请求和编码响应
+func (s *Server) start(serve http.HandlerFunc) {
+	s.Server = httptest.NewServer(serve)
+}
+
+// Script 用 h 替换 route 的处理函数, h 为 nil 时恢复内置的处理函数
+// route 和内置路由的写法相同, 例如 "sendrawtransaction", "wallet/broadcasttransaction", "tx/*"
+func (s *Server) Script(route string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h == nil {
+		delete(s.scripts, route)
+		return
+	}
+	s.scripts[route] = h
+}
+
+// Fail 让 route 之后的请求都返回 err
+func (s *Server) Fail(route string, err *Error) {
+	s.Script(route, func(*Request) (interface{}, error) {
+		return nil, err
+	})
+}
+
+// Calls 返回 route 被调用的次数
+func (s *Server) Calls(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[route]
+}
+
+// Host 返回监听的地址, 不带端口, 给 bitcoind 这类按 host 和 port 配置的网关
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Hostname()
+}
+
+// Port 返回监听的端口
+func (s *Server) Port() int {
+	u, _ := url.Parse(s.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
+
+// dispatch 调用匹配 req.Route 的处理函数, Script 设置的优先
+func (s *Server) dispatch(req *Request) (interface{}, error) {
+	s.mu.Lock()
+	pattern, h, args, ok := lookup(s.scripts, req.Route)
+	if !ok {
+		pattern, h, args, ok = lookup(s.routes, req.Route)
+	}
+	if ok {
+		s.calls[pattern]++
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, &Error{Status: http.StatusNotFound, Code: -32601, Message: "method not found: " + req.Route}
+	}
+	req.Args = args
+	return h(req)
+}
+
+func lookup(routes map[string]Handler, route string) (string, Handler, []string, bool) {
+	if h, ok := routes[route]; ok {
+		return route, h, nil, true
+	}
+	for pattern, h := range routes {
+		if args, ok := match(pattern, route); ok {
+			return pattern, h, args, true
+		}
+	}
+	return "", nil, nil, false
+}
+
+// match 按路径段匹配, 返回 * 匹配到的段
+func match(pattern, route string) ([]string, bool) {
+	ps := strings.Split(pattern, "/")
+	rs := strings.Split(route, "/")
+	if len(ps) != len(rs) {
+		return nil, false
+	}
+	var args []string
+	for i := range ps {
+		switch {
+		case ps[i] == "*" && rs[i] != "":
+			args = append(args, rs[i])
+		case ps[i] != rs[i]:
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// 把 http 请求转成 REST 的 Request
+func restRequest(r *http.Request) (*Request, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		Route: strings.Trim(r.URL.Path, "/"),
+		Params: body,
+		Query: r.URL.Query(),
+	}, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if raw, ok := v.(Raw); ok {
+		w.Write([]byte(raw))
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// 把 err 转成 *Error, 不是 *Error 的当作节点内部错误
+func asError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: -32603, Message: err.Error()}
+}
@@ -0,0 +1,371 @@
+package fakenode
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// tron 地址的版本字节
+const tronAddressPrefix = 0x41
+
+// Tron 是假的 TRON 全节点 http api, wallet/* 和 walletsolidity/* 的路由相同, 没有固化延迟
+// 支持 getnowblock, getblockbynum, broadcasttransaction, gettransactionbyid, gettransactioninfobyid, getaccount,
+// getaccountresource, getchainparameters, broadcasttransaction 只接受 TransferContract
+// 广播时检查引用区块, 过期时间和签名, 通过后立即转账, Mine 之后交易才进入区块
+type Tron struct {
+	*Server
+
+	// getaccountresource 返回的免费带宽
+	FreeNetLimit int64
+	// getchainparameters 返回的 getTransactionFee, 每字节带宽燃烧的 sun
+	TransactionFee int64
+
+	lock sync.Mutex
+	// key 是 16 进制地址
+	balances map[string]int64
+	txs map[string]*tronTx
+	height uint64
+}
+
+type tronTx struct {
+	json map[string]interface{}
+	// 所在区块的高度, 0 表示还没有进入区块
+	height uint64
+}
+
+// NewTron 启动假 TRON 节点, 用完后调用 Close
+func NewTron() *Tron {
+	t := &Tron{
+		FreeNetLimit: 5000,
+		TransactionFee: 1000,
+		balances: make(map[string]int64),
+		txs: make(map[string]*tronTx),
+		height: 1000,
+	}
+	routes := map[string]Handler{}
+	for _, api := range []string{"wallet", "walletsolidity"} {
+		routes[api+"/getnowblock"] = t.getNowBlock
+		routes[api+"/getblockbynum"] = t.getBlockByNum
+		routes[api+"/gettransactionbyid"] = t.getTransactionByID
+		routes[api+"/gettransactioninfobyid"] = t.getTransactionInfoByID
+		routes[api+"/getaccount"] = t.getAccount
+	}
+	routes["wallet/broadcasttransaction"] = t.broadcastTransaction
+	routes["wallet/getaccountresource"] = t.getAccountResource
+	routes["wallet/getchainparameters"] = t.getChainParameters
+	t.Server = newServer(routes)
+	t.start(t.serve)
+	return t
+}
+
+// 出错时和 java-tron 一样返回 200 和 {"Error": ...}
+func (t *Tron) serve(w http.ResponseWriter, r *http.Request) {
+	req, err := restRequest(r)
+	if err == nil {
+		var result interface{}
+		result, err = t.dispatch(req)
+		if err == nil {
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+	}
+	e := asError(err)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"Error": e.Error()})
+}
+
+// SetBalance 设置 address 的余额, 单位 sun, address 可以是 base58check 或 16 进制
+func (t *Tron) SetBalance(address string, sun int64) error {
+	addr, err := tronHexAddress(address)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.balances[addr] = sun
+	return nil
+}
+
+// Balance 返回 address 的余额
+func (t *Tron) Balance(address string) int64 {
+	addr, err := tronHexAddress(address)
+	if err != nil {
+		return 0
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.balances[addr]
+}
+
+// Mine 出一个新区块, 之前广播的交易进入这个区块, 返回新区块的高度
+func (t *Tron) Mine() uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.height++
+	for _, tx := range t.txs {
+		if tx.height == 0 {
+			tx.height = t.height
+		}
+	}
+	return t.height
+}
+
+// 区块 id 的前 8 字节是高度, 和真实节点相同
+func tronBlockID(height uint64) []byte {
+	id := make([]byte, 32)
+	binary.BigEndian.PutUint64(id, height)
+	h := sha256.Sum256(id[:8])
+	copy(id[8:], h[:24])
+	return id
+}
+
+// 毫秒, 每 3 秒一个区块
+func tronBlockTime(height uint64) int64 {
+	return genesisTime.Add(time.Duration(height) * 3 * time.Second).UnixNano() / int64(time.Millisecond)
+}
+
+func (t *Tron) block(height uint64) map[string]interface{} {
+	return map[string]interface{}{
+		"blockID": hex.EncodeToString(tronBlockID(height)),
+		"block_header": map[string]interface{}{
+			"raw_data": map[string]interface{}{
+				"number": height,
+				"timestamp": tronBlockTime(height),
+				"parentHash": hex.EncodeToString(tronBlockID(height - 1)),
+				"version": 9,
+			},
+		},
+	}
+}
+
+func (t *Tron) getNowBlock(req *Request) (interface{}, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.block(t.height), nil
+}
+
+func (t *Tron) getBlockByNum(req *Request) (interface{}, error) {
+	var params struct {
+		Num uint64 `json:"num"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if params.Num == 0 || params.Num > t.height {
+		return map[string]interface{}{}, nil
+	}
+	return t.block(params.Num), nil
+}
+
+// tron 节点广播失败时返回的错误, message 是 16 进制编码的文本
+func tronBroadcastError(code, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"code": code,
+		"message": hex.EncodeToString([]byte(message)),
+	}
+}
+
+func (t *Tron) broadcastTransaction(req *Request) (interface{}, error) {
+	var tx struct {
+		TxID string `json:"txID"`
+		Signature json.RawMessage `json:"signature"`
+		RawData struct {
+			Contract []struct {
+				Type string `json:"type"`
+				Parameter struct {
+					Value struct {
+						Amount int64 `json:"amount"`
+						OwnerAddress string `json:"owner_address"`
+						ToAddress string `json:"to_address"`
+					} `json:"value"`
+				} `json:"parameter"`
+			} `json:"contract"`
+			RefBlockBytes string `json:"ref_block_bytes"`
+			RefBlockHash string `json:"ref_block_hash"`
+			Expiration int64 `json:"expiration"`
+		} `json:"raw_data"`
+	}
+	if err := req.Bind(&tx); err != nil {
+		return nil, err
+	}
+	var txJSON map[string]interface{}
+	if err := json.Unmarshal(req.Params, &txJSON); err != nil {
+		return nil, err
+	}
+	raw := tx.RawData
+	if len(raw.Contract) != 1 || raw.Contract[0].Type != "TransferContract" {
+		return tronBroadcastError("CONTRACT_VALIDATE_ERROR", "contract type not supported by fake node"), nil
+	}
+	transfer := raw.Contract[0].Parameter.Value
+	id := strings.ToLower(tx.TxID)
+	txID, err := hex.DecodeString(id)
+	if err != nil || len(txID) != 32 {
+		return tronBroadcastError("OTHER_ERROR", "invalid txID"), nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.txs[id]; ok {
+		return tronBroadcastError("DUP_TRANSACTION_ERROR", "dup trans"), nil
+	}
+	if !t.refBlockKnown(raw.RefBlockBytes, raw.RefBlockHash) {
+		return tronBroadcastError("TAPOS_ERROR", "Tapos check error"), nil
+	}
+	if raw.Expiration <= tronBlockTime(t.height) {
+		return tronBroadcastError("TRANSACTION_EXPIRATION_ERROR", "transaction expired"), nil
+	}
+	// 签名可以是字符串或字符串数组, 只检查第一个签名
+	var sigs []string
+	if json.Unmarshal(tx.Signature, &sigs) != nil {
+		var sig string
+		json.Unmarshal(tx.Signature, &sig)
+		sigs = []string{sig}
+	}
+	if len(sigs) == 0 || !tronSigner(txID, sigs[0], transfer.OwnerAddress) {
+		return tronBroadcastError("SIGERROR", "validate signature error"), nil
+	}
+	owner, err1 := tronHexAddress(transfer.OwnerAddress)
+	to, err2 := tronHexAddress(transfer.ToAddress)
+	if err1 != nil || err2 != nil || transfer.Amount <= 0 {
+		return tronBroadcastError("CONTRACT_VALIDATE_ERROR", "Invalid address or amount"), nil
+	}
+	if t.balances[owner] < transfer.Amount {
+		return tronBroadcastError("CONTRACT_VALIDATE_ERROR", "Validate TransferContract error, balance is not sufficient."), nil
+	}
+	t.balances[owner] -= transfer.Amount
+	t.balances[to] += transfer.Amount
+	t.txs[id] = &tronTx{json: txJSON}
+	return map[string]interface{}{"result": true, "txid": id}, nil
+}
+
+// 引用区块必须是最近 65536 个区块之一
+func (t *Tron) refBlockKnown(refBlockBytes, refBlockHash string) bool {
+	for h := t.height; h > 0 && h+65536 > t.height; h-- {
+		id := tronBlockID(h)
+		if hex.EncodeToString(id[6:8]) == refBlockBytes && hex.EncodeToString(id[8:16]) == refBlockHash {
+			return true
+		}
+	}
+	return false
+}
+
+// tronSigner 检查 sig 是 owner 对 txID 的 65 字节可恢复签名
+func tronSigner(txID []byte, sig, owner string) bool {
+	b, err := hex.DecodeString(sig)
+	if err != nil || len(b) != 65 {
+		return false
+	}
+	if b[64] >= 27 {
+		b[64] -= 27
+	}
+	pub, err := crypto.Ecrecover(txID, b)
+	if err != nil {
+		return false
+	}
+	addr := append([]byte{tronAddressPrefix}, crypto.Keccak256(pub[1:])[12:]...)
+	owner, err = tronHexAddress(owner)
+	return err == nil && owner == hex.EncodeToString(addr)
+}
+
+// tronHexAddress 把 base58check 或 16 进制的地址转成小写的 16 进制地址
+func tronHexAddress(address string) (string, error) {
+	if len(address) == 42 {
+		b, err := hex.DecodeString(address)
+		if err != nil || b[0] != tronAddressPrefix {
+			return "", &Error{Message: "invalid address " + address}
+		}
+		return strings.ToLower(address), nil
+	}
+	b, version, err := base58.CheckDecode(address)
+	if err != nil || version != tronAddressPrefix || len(b) != 20 {
+		return "", &Error{Message: "invalid address " + address}
+	}
+	return hex.EncodeToString(append([]byte{version}, b...)), nil
+}
+
+func (t *Tron) lookupTx(req *Request) (*tronTx, error) {
+	var params struct {
+		Value string `json:"value"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	return t.txs[strings.ToLower(params.Value)], nil
+}
+
+// 找不到交易时和真实节点一样返回 {}
+func (t *Tron) getTransactionByID(req *Request) (interface{}, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	tx, err := t.lookupTx(req)
+	if err != nil || tx == nil {
+		return map[string]interface{}{}, err
+	}
+	res := make(map[string]interface{})
+	for k, v := range tx.json {
+		res[k] = v
+	}
+	if tx.height > 0 {
+		res["ret"] = []interface{}{map[string]interface{}{"contractRet": "SUCCESS"}}
+	}
+	return res, nil
+}
+
+func (t *Tron) getTransactionInfoByID(req *Request) (interface{}, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	tx, err := t.lookupTx(req)
+	if err != nil || tx == nil || tx.height == 0 {
+		return map[string]interface{}{}, err
+	}
+	return map[string]interface{}{
+		"id": tx.json["txID"],
+		"blockNumber": tx.height,
+		"blockTimeStamp": tronBlockTime(tx.height),
+		"contractResult": []string{""},
+		"receipt": map[string]interface{}{"net_usage": 267},
+	}, nil
+}
+
+// 账户不存在时返回 {}
+func (t *Tron) getAccount(req *Request) (interface{}, error) {
+	var params struct {
+		Address string `json:"address"`
+	}
+	if err := req.Bind(&params); err != nil {
+		return nil, err
+	}
+	addr, err := tronHexAddress(params.Address)
+	if err != nil {
+		return nil, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	balance, ok := t.balances[addr]
+	if !ok {
+		return map[string]interface{}{}, nil
+	}
+	return map[string]interface{}{"address": addr, "balance": balance}, nil
+}
+
+func (t *Tron) getAccountResource(req *Request) (interface{}, error) {
+	return map[string]interface{}{"freeNetLimit": t.FreeNetLimit, "freeNetUsed": 0}, nil
+}
+
+func (t *Tron) getChainParameters(req *Request) (interface{}, error) {
+	return map[string]interface{}{
+		"chainParameter": []interface{}{
+			map[string]interface{}{"key": "getTransactionFee", "value": t.TransactionFee},
+		},
+	}, nil
+}
@@ -0,0 +1,234 @@
+// Package hdkey 解析 BIP32 扩展公钥 (xpub) 并按非 hardened 路径派生子公钥
+// 用于从一个 dcrm 主公钥给每个用户派生充值地址, 不需要重新生成 dcrm 密钥
+package hdkey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// HardenedKeyStart 是第一个 hardened 的子密钥编号, 扩展公钥不能派生 hardened 的子密钥
+const HardenedKeyStart uint32 = 0x80000000
+
+var (
+	// 按 BIP32, 极小概率下编号 i 没有有效的子密钥, 调用方应该跳到 i+1
+	ErrInvalidChild = errors.New("invalid child key")
+	// 派生路径格式错误, 或者路径不经过扩展公钥
+	ErrInvalidPath = errors.New("invalid derivation path")
+)
+
+// 序列化后的扩展公钥长度, 不含 4 字节校验和
+const serializedKeyLen = 78
+
+// 扩展公钥的版本号, 版本号只决定字符串的前缀, 派生时不区分
+var publicVersions = map[[4]byte]string{
+	{0x04, 0x88, 0xb2, 0x1e}: "xpub",
+	{0x04, 0x35, 0x87, 0xcf}: "tpub",
+	{0x04, 0x9d, 0x7c, 0xb2}: "ypub",
+	{0x04, 0x4a, 0x52, 0x62}: "upub",
+	{0x04, 0xb2, 0x47, 0x46}: "zpub",
+	{0x04, 0x5f, 0x1c, 0xf6}: "vpub",
+}
+
+// ExtendedKey 是 BIP32 扩展公钥
+type ExtendedKey struct {
+	Version [4]byte
+	// 主密钥的深度是 0, BIP44 的账户公钥 m/44'/coin'/account' 深度是 3
+	Depth byte
+	ParentFingerprint [4]byte
+	// 该密钥在父密钥下的编号, hardened 的编号大于等于 HardenedKeyStart
+	ChildNumber uint32
+	ChainCode [32]byte
+	PublicKey *btcec.PublicKey
+}
+
+// ParseExtendedKey 解析 base58check 编码的扩展公钥, 如 xpub6... tpubD...
+// 扩展私钥和格式错误返回的错误满足 errors.Is(err, types.ErrInvalidPublicKey)
+func ParseExtendedKey(xpub string) (*ExtendedKey, error) {
+	b := base58.Decode(xpub)
+	if len(b) != serializedKeyLen+4 {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "extended key must be %v bytes, got %v", serializedKeyLen+4, len(b))
+	}
+	payload, checksum := b[:serializedKeyLen], b[serializedKeyLen:]
+	if !bytes.Equal(doubleSHA256(payload)[:4], checksum) {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "extended key checksum mismatch")
+	}
+	k := &ExtendedKey{}
+	copy(k.Version[:], payload[0:4])
+	if _, ok := publicVersions[k.Version]; !ok {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "unknown extended public key version %x", k.Version)
+	}
+	k.Depth = payload[4]
+	copy(k.ParentFingerprint[:], payload[5:9])
+	k.ChildNumber = binary.BigEndian.Uint32(payload[9:13])
+	copy(k.ChainCode[:], payload[13:45])
+	if k.Depth == 0 && (k.ChildNumber != 0 || k.ParentFingerprint != [4]byte{}) {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "master key with non-zero parent fingerprint or child number")
+	}
+	if payload[45] != 0x02 && payload[45] != 0x03 {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "extended key must hold a compressed public key, extended private keys are not accepted")
+	}
+	pub, err := btcec.ParsePubKey(payload[45:78], btcec.S256())
+	if err != nil {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "extended key has invalid public key: %v", err)
+	}
+	k.PublicKey = pub
+	return k, nil
+}
+
+// String 返回 base58check 编码的扩展公钥
+func (k *ExtendedKey) String() string {
+	payload := make([]byte, 0, serializedKeyLen+4)
+	payload = append(payload, k.Version[:]...)
+	payload = append(payload, k.Depth)
+	payload = append(payload, k.ParentFingerprint[:]...)
+	payload = append(payload, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(payload[9:13], k.ChildNumber)
+	payload = append(payload, k.ChainCode[:]...)
+	payload = append(payload, k.PublicKey.SerializeCompressed()...)
+	payload = append(payload, doubleSHA256(payload)[:4]...)
+	return base58.Encode(payload)
+}
+
+// PublicKeyHex 返回 16 进制的压缩公钥, 可以直接传给 handler 的 PublicKeyToAddress
+func (k *ExtendedKey) PublicKeyHex() string {
+	return hex.EncodeToString(k.PublicKey.SerializeCompressed())
+}
+
+// Fingerprint 是公钥 hash160 的前 4 字节, 子密钥的 ParentFingerprint
+func (k *ExtendedKey) Fingerprint() (fp [4]byte) {
+	copy(fp[:], btcutil.Hash160(k.PublicKey.SerializeCompressed()))
+	return
+}
+
+// Child 派生编号为 i 的子公钥, i 不能是 hardened
+// hardened 的编号和超过 255 的深度返回 types.ErrNotSupported, 编号 i 没有有效的子密钥时返回 ErrInvalidChild
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	if i >= HardenedKeyStart {
+		return nil, types.Errorf(types.ErrNotSupported, "cannot derive hardened child %v from an extended public key", ChildString(i))
+	}
+	if k.Depth == 0xff {
+		return nil, types.Errorf(types.ErrNotSupported, "cannot derive beyond depth 255")
+	}
+	data := make([]byte, 0, 37)
+	data = append(data, k.PublicKey.SerializeCompressed()...)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], i)
+	mac := hmac.New(sha512.New, k.ChainCode[:])
+	mac.Write(data)
+	return k.child(i, mac.Sum(nil))
+}
+
+// child 用 HMAC-SHA512 的结果 I 计算编号为 i 的子公钥, 左半部分是 tweak, 右半部分是子密钥的 chain code
+func (k *ExtendedKey) child(i uint32, I []byte) (*ExtendedKey, error) {
+	curve := btcec.S256()
+	il := new(big.Int).SetBytes(I[:32])
+	if il.Cmp(curve.N) >= 0 {
+		return nil, types.Errorf(ErrInvalidChild, "child %v: tweak is not less than the curve order, use the next index", i)
+	}
+	x, y := curve.ScalarBaseMult(I[:32])
+	x, y = curve.Add(x, y, k.PublicKey.X, k.PublicKey.Y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, types.Errorf(ErrInvalidChild, "child %v is the point at infinity, use the next index", i)
+	}
+	child := &ExtendedKey{
+		Version: k.Version,
+		Depth: k.Depth + 1,
+		ParentFingerprint: k.Fingerprint(),
+		ChildNumber: i,
+		PublicKey: &btcec.PublicKey{Curve: curve, X: x, Y: y},
+	}
+	copy(child.ChainCode[:], I[32:])
+	return child, nil
+}
+
+// Derive 按路径派生子公钥, 见 ParsePath
+// 绝对路径 (以 m 开头) 的前 Depth 级由 k 本身代替: 它们可以是 hardened, 但最后一级必须等于 k 的 ChildNumber
+// 例如账户公钥 m/44'/0'/0' 可以派生 m/44'/0'/0'/0/5, 也可以派生相对路径 0/5
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, absolute, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if absolute {
+		depth := int(k.Depth)
+		if len(indexes) < depth {
+			return nil, types.Errorf(ErrInvalidPath, "path %v is shallower than the extended key (depth %v)", path, depth)
+		}
+		if depth > 0 && indexes[depth-1] != k.ChildNumber {
+			return nil, types.Errorf(ErrInvalidPath, "path %v does not pass through the extended key (child %v at depth %v)", path, ChildString(k.ChildNumber), depth)
+		}
+		indexes = indexes[depth:]
+	}
+	for _, i := range indexes {
+		if k, err = k.Child(i); err != nil {
+			return nil, fmt.Errorf("derive %v: %w", path, err)
+		}
+	}
+	return k, nil
+}
+
+// ParsePath 解析派生路径, 如 m/44'/60'/0'/0/5 或相对路径 0/5, hardened 用 ' 或 h 表示
+func ParsePath(path string) (indexes []uint32, absolute bool, err error) {
+	path = strings.TrimSpace(path)
+	if path == "m" || path == "M" {
+		return nil, true, nil
+	}
+	if strings.HasPrefix(path, "m/") || strings.HasPrefix(path, "M/") {
+		absolute = true
+		path = path[2:]
+	}
+	if path == "" {
+		return nil, absolute, nil
+	}
+	for _, s := range strings.Split(path, "/") {
+		hardened := false
+		if strings.HasSuffix(s, "'") || strings.HasSuffix(s, "h") || strings.HasSuffix(s, "H") {
+			hardened = true
+			s = s[:len(s)-1]
+		}
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || uint32(n) >= HardenedKeyStart {
+			return nil, false, types.Errorf(ErrInvalidPath, "invalid path element %q in %v", s, path)
+		}
+		i := uint32(n)
+		if hardened {
+			i += HardenedKeyStart
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes, absolute, nil
+}
+
+// BIP44Path 返回 m/44'/coin'/account'/change/index, coin 是 SLIP-44 coin type
+func BIP44Path(coin, account, change, index uint32) string {
+	return fmt.Sprintf("m/44'/%v'/%v'/%v/%v", coin, account, change, index)
+}
+
+// ChildString 返回子密钥编号的路径写法, hardened 的加 '
+func ChildString(i uint32) string {
+	if i >= HardenedKeyStart {
+		return fmt.Sprintf("%v'", i-HardenedKeyStart)
+	}
+	return fmt.Sprintf("%v", i)
+}
+
+func doubleSHA256(b []byte) []byte {
+	h := sha256.Sum256(b)
+	h = sha256.Sum256(h[:])
+	return h[:]
+}
@@ -0,0 +1,98 @@
+package hdkey
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// BIP32 的测试向量 1 和 2, 扩展公钥只能做非 hardened 派生,
+// 每一步从上一级的扩展公钥 parent 派生 path, 和向量里的 want 比较
+var bip32Vectors = []struct {
+	name string
+	parent string
+	path string
+	want string
+}{
+	// 向量 1, seed 000102030405060708090a0b0c0d0e0f
+	{"1 m/0H/1", "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw", "1",
+		"xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"},
+	{"1 m/0H/1/2H/2", "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5", "2",
+		"xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV"},
+	{"1 m/0H/1/2H/2/1000000000", "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5", "2/1000000000",
+		"xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy"},
+	// 向量 2
+	{"2 m/0", "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB", "m/0",
+		"xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"},
+	{"2 m/0/2147483647H/1", "xpub6ASAVgeehLbnwdqV6UKMHVzgqAG8Gr6riv3Fxxpj8ksbH9ebxaEyBLZ85ySDhKiLDBrQSARLq1uNRts8RuJiHjaDMBU4Zn9h8LZNnBC5y4a", "m/0/2147483647'/1",
+		"xpub6DF8uhdarytz3FWdA8TvFSvvAh8dP3283MY7p2V4SeE2wyWmG5mg5EwVvmdMVCQcoNJxGoWaU9DCWh89LojfZ537wTfunKau47EL2dhHKon"},
+	{"2 m/0/2147483647H/1/2147483646H/2", "xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL", "2",
+		"xpub6FnCn6nSzZAw5Tw7cgR9bi15UV96gLZhjDstkXXxvCLsUXBGXPdSnLFbdpq8p9HmGsApME5hQTZ3emM2rnY5agb9rXpVGyy3bdW6EEgAtqt"},
+}
+
+func TestBIP32Vectors(t *testing.T) {
+	for _, v := range bip32Vectors {
+		parent, err := ParseExtendedKey(v.parent)
+		if err != nil {
+			t.Fatalf("%v: %v", v.name, err)
+		}
+		if parent.String() != v.parent {
+			t.Fatalf("%v: parent does not round trip: %v", v.name, parent.String())
+		}
+		child, err := parent.Derive(v.path)
+		if err != nil {
+			t.Fatalf("%v: %v", v.name, err)
+		}
+		if child.String() != v.want {
+			t.Fatalf("%v: got %v, want %v", v.name, child.String(), v.want)
+		}
+	}
+}
+
+func TestHardenedChild(t *testing.T) {
+	// 向量 1 的主公钥
+	master, err := ParseExtendedKey("xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.Child(HardenedKeyStart); !errors.Is(err, types.ErrNotSupported) {
+		t.Fatalf("got %v, want ErrNotSupported for a hardened child", err)
+	}
+	if _, err := master.Derive("m/0'/1"); !errors.Is(err, types.ErrNotSupported) {
+		t.Fatalf("got %v, want ErrNotSupported for a hardened path", err)
+	}
+	if _, err := master.Derive("0/x"); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("got %v, want ErrInvalidPath", err)
+	}
+}
+
+func TestInvalidChild(t *testing.T) {
+	curve := btcec.S256()
+	// 私钥为 1 的公钥是生成元 G
+	k := &ExtendedKey{PublicKey: &btcec.PublicKey{Curve: curve, X: curve.Gx, Y: curve.Gy}}
+	I := make([]byte, 64)
+
+	// tweak 不小于曲线的阶
+	curve.N.FillBytes(I[:32])
+	if _, err := k.child(0, I); !errors.Is(err, ErrInvalidChild) {
+		t.Fatalf("got %v, want ErrInvalidChild when the tweak is n", err)
+	}
+	// tweak 是 n-1, 子公钥 (n-1)G + G 是无穷远点
+	new(big.Int).Sub(curve.N, big.NewInt(1)).FillBytes(I[:32])
+	if _, err := k.child(0, I); !errors.Is(err, ErrInvalidChild) {
+		t.Fatalf("got %v, want ErrInvalidChild for the point at infinity", err)
+	}
+	// tweak 是 1, 子公钥是 2G
+	big.NewInt(1).FillBytes(I[:32])
+	child, err := k.child(0, I)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := curve.Double(curve.Gx, curve.Gy)
+	if child.PublicKey.X.Cmp(x) != 0 || child.PublicKey.Y.Cmp(y) != 0 {
+		t.Fatal("child of G with tweak 1 should be 2G")
+	}
+}
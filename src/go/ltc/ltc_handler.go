@@ -1,32 +1,59 @@
 package ltc
 
 import (
-	"encoding/hex"
-	"fmt"
+	"context"
 	"math/big"
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
-	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 	"github.com/gaozhengxin/cryptocoins/src/go/btc"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
-var ChainConfig = chaincfg.Params {
-	PubKeyHashAddrID: 0x30,
+// 默认网络
+const DefaultNetwork = types.Mainnet
+
+// 各网络的链参数
+var chainConfigs = map[types.Network]*chaincfg.Params{
+	types.Mainnet: {Name: "mainnet", PubKeyHashAddrID: 0x30, ScriptHashAddrID: 0x32},
+	types.Testnet: {Name: "testnet4", PubKeyHashAddrID: 0x6f, ScriptHashAddrID: 0x3a},
 }
 
 var allowHighFees = true
 
 type LTCHandler struct {
+	network types.Network
+	chainConfig *chaincfg.Params
 	btcHandler *btc.BTCHandler
 }
 
 func NewLTCHandler () *LTCHandler {
-	return &LTCHandler{
-		btcHandler: btc.NewBTCHandlerWithConfig(config.LTC_SERVER_HOST,config.LTC_SERVER_PORT,config.LTC_USER,config.LTC_PASSWD,config.LTC_USESSL),
+	h, _ := NewLTCHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewLTCHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewLTCHandlerForNetwork (network types.Network) (*LTCHandler, error) {
+	return NewLTCHandlerFromConfig(network, config.Current())
+}
+
+// NewLTCHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 LitecoinGateway
+func NewLTCHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*LTCHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, ok := chainConfigs[network]
+	if !ok {
+		return nil, types.UnsupportedNetworkError("LTC", network)
 	}
+	return &LTCHandler{
+		network: network,
+		chainConfig: params,
+		btcHandler: btc.NewBTCHandlerForChain(network, params, gateways.ForNetwork(string(network)).LitecoinGateway, gateways.HealthCheckInterval(), gateways.ForNetwork(string(network)).Timeout()),
+	}, nil
+}
+
+func (h *LTCHandler) Network() types.Network {
+	return h.network
 }
 
 var LTC_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -35,21 +62,19 @@ func (h *LTCHandler) GetDefaultFee() *big.Int {
 	return LTC_DEFAULT_FEE
 }
 
+// EstimateFee 用节点的 estimatesmartfee 估计手续费, 节点无法估计时三档都是 LTC_DEFAULT_FEE
+func (h *LTCHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	return h.btcHandler.EstimateFeeWithFallback(ctx, fromAddress, toAddress, amount, LTC_DEFAULT_FEE)
+}
+
 func (h *LTCHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed()
 	pkHash := btcutil.Hash160(b)
-	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, &ChainConfig)
+	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, h.chainConfig)
 	if err != nil {
 		return
 	}
@@ -57,34 +82,133 @@ func (h *LTCHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 	return
 }
 
-// NOT completed, may or not work
 func (h *LTCHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	return h.btcHandler.BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *LTCHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *LTCHandler) SupportedBuildOptions() []string {
+	return btc.SupportedBuildOptions
+}
+
+func (h *LTCHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: h.btcHandler.HasElectrs(),
+		MultiOutput: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: btc.SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *LTCHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "LTC",
+		Decimals: 8,
+		SLIP44: 2,
+		AddressFormat: types.AddressBase58Check,
+		SmallestUnit: "litoshi",
+	}
+}
+
+func (h *LTCHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("LTC", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *LTCHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = opts.Check("LTC", btc.SupportedBuildOptions...); err != nil {
+		return
+	}
+	return h.btcHandler.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 fromAddress 可以花费的 utxo, 见 btc.BTCHandler.FetchUTXOs
+func (h *LTCHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	if err := opts.Check("LTC", btc.SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	return h.btcHandler.FetchUTXOs(ctx, "LTC", fromAddress)
+}
+
+// Assemble 用 state 的 utxo 构造未签名交易, 不访问网络
+func (h *LTCHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.btcHandler.AssembleForCoin("LTC", state, fromAddress, fromPublicKey, outputs, opts)
 }
 
-// NOT completed, may or not work
 func (h *LTCHandler) SignTransaction(hash []string, wif interface{}) (rsv []string, err error) {
 	return h.btcHandler.SignTransaction(hash, wif)
 }
 
-// NOT completed, may or not work
 func (h *LTCHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
 	return h.btcHandler.MakeSignedTransaction(rsv, transaction)
 }
 
-// NOT completed, may or not work
+func (h *LTCHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *LTCHandler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	c, _ := rpcutils.NewClient(config.LTC_SERVER_HOST,config.LTC_SERVER_PORT,config.LTC_USER,config.LTC_PASSWD,config.LTC_USESSL)
-	ret, err= btc.SendRawTransaction (c, signedTransaction.(*btc.AuthoredTx).Tx, allowHighFees)
-	return h.SubmitTransaction(signedTransaction)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *LTCHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	return h.btcHandler.SubmitTransactionContext(ctx, signedTransaction)
 }
 
 func (h *LTCHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	return h.GetTransactionInfo(txhash)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *LTCHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.btcHandler.GetTransactionInfoContext(ctx, txhash)
+}
+
+// LTC 交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 12
+
+func (h *LTCHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	return h.btcHandler.TransactionStatus(ctx, txhash, FinalityConfirmations)
+}
+
+// GetAddressHistory 从节点网关配置的 electrs 查询地址历史, 没有配置 electrs 时返回 types.ErrNotSupported
+func (h *LTCHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	return h.btcHandler.ElectrsHistory(ctx, address, page)
 }
 
 // TODO
 func (h *LTCHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	err = fmt.Errorf("function currently not available")
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *LTCHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	err = types.NotSupportedError("LTC", "GetAddressBalance")
 	return nil, err
 }
+
+func (h *LTCHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return btc.MarshalEnvelope("LTC", h.network.String(), transaction, digests)
+}
+
+func (h *LTCHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return btc.UnmarshalEnvelope("LTC", h.network.String(), env)
+}
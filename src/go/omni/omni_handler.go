@@ -1,6 +1,8 @@
 package omni
 
 import (
+	"context"
+	"time"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -8,61 +10,120 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
-	"github.com/btcsuite/btcd/btcec"
-	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
-	"github.com/btcsuite/btcwallet/wallet/txauthor"
-	"github.com/btcsuite/btcwallet/wallet/txrules"
 	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 	"github.com/gaozhengxin/cryptocoins/src/go/btc"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
 var allowHighFees = true
 
-var chainconfig = &chaincfg.TestNet3Params
-
-var feeRate, _ = btcutil.NewAmount(0.0001)
-
-var hashType = txscript.SigHashAll
+// 默认网络
+const DefaultNetwork = types.Testnet
 
+// testnet 的 property id
 var Properties map[string]string = map[string]string{
 	"OMNIOmni":"1",
 	"OMNITest Omni":"2",
 	"OMNITetherUS":"112",  // TetherUS id on testnet
 }
 
-var (
-	omnihost = config.ApiGateways.OmniGateway.Host
-	omniport = config.ApiGateways.OmniGateway.Port
-	omniuser = config.ApiGateways.OmniGateway.User
-	omnipasswd = config.ApiGateways.OmniGateway.Passwd
-	omniusessl = config.ApiGateways.OmniGateway.Usessl
-)
+var MainnetProperties map[string]string = map[string]string{
+	"OMNIOmni":"1",
+	"OMNITest Omni":"2",
+	"OMNITetherUS":"31",
+}
+
+// property 的符号, 这些 property 都是可分割的, 8 位小数
+var PropertySymbols map[string]string = map[string]string{
+	"OMNIOmni":"OMNI",
+	"OMNITest Omni":"TOMNI",
+	"OMNITetherUS":"USDT",
+}
+
+// 各网络的 property id, regtest 和 testnet 相同
+func propertiesForNetwork(network types.Network) map[string]string {
+	if network == types.Mainnet {
+		return MainnetProperties
+	}
+	return Properties
+}
 
 type OmniHandler struct {
+	network types.Network
+	chainConfig *chaincfg.Params
 	propertyName string
+	propertyId string
+	gateway *config.RpcClientConfig
 	btcHandler *btc.BTCHandler
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
 }
 
 func NewOMNIHandler () *OmniHandler {
-	return &OmniHandler{
-		btcHandler: btc.NewBTCHandlerWithConfig(config.ApiGateways.OmniGateway.Host,config.ApiGateways.OmniGateway.Port,config.ApiGateways.OmniGateway.User,config.ApiGateways.OmniGateway.Passwd,config.ApiGateways.OmniGateway.Usessl),
-	}
+	h, _ := newOmniHandler(DefaultNetwork, config.Current())
+	return h
 }
 
 func NewOMNIPropertyHandler (propertyname string) *OmniHandler {
-	if Properties[propertyname] == "" {
-		return nil
+	h, _ := NewOMNIPropertyHandlerForNetwork(propertyname, DefaultNetwork)
+	return h
+}
+
+// NewOMNIPropertyHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewOMNIPropertyHandlerForNetwork (propertyname string, network types.Network) (*OmniHandler, error) {
+	return NewOMNIPropertyHandlerFromConfig(propertyname, network, config.Current())
+}
+
+// NewOMNIPropertyHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 OmniGateway
+func NewOMNIPropertyHandlerFromConfig (propertyname string, network types.Network, gateways *config.ApiGatewayConfigs) (*OmniHandler, error) {
+	network = network.Or(DefaultNetwork)
+	propertyId := propertiesForNetwork(network)[propertyname]
+	if propertyId == "" {
+		return nil, fmt.Errorf("unknown omni property %v on %v", propertyname, network)
 	}
-	return &OmniHandler{
-		propertyName: propertyname,
-		btcHandler: btc.NewBTCHandlerWithConfig(config.ApiGateways.OmniGateway.Host,config.ApiGateways.OmniGateway.Port,config.ApiGateways.OmniGateway.User,config.ApiGateways.OmniGateway.Passwd,config.ApiGateways.OmniGateway.Usessl),
+	h, err := newOmniHandler(network, gateways)
+	if err != nil {
+		return nil, err
 	}
+	h.propertyName = propertyname
+	h.propertyId = propertyId
+	return h, nil
+}
+
+func newOmniHandler (network types.Network, gateways *config.ApiGatewayConfigs) (*OmniHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, err := btc.ChainConfigForNetwork(network)
+	if err != nil {
+		return nil, types.UnsupportedNetworkError("OMNI", network)
+	}
+	gateways = gateways.ForNetwork(string(network))
+	gateway := *gateways.OmniGateway
+	// utxo 从同一网络比特币节点的 electrs 查询
+	if gateway.ElectrsAddress == "" {
+		gateway.ElectrsAddress = gateways.BitcoinGateway.ElectrsAddress
+		rpcutils.RegisterRpcGateway(gateways.BitcoinGateway, gateways.HealthCheckInterval())
+	}
+	return &OmniHandler{
+		network: network,
+		chainConfig: params,
+		gateway: &gateway,
+		btcHandler: btc.NewBTCHandlerForChain(network, params, &gateway, gateways.HealthCheckInterval(), gateways.Timeout()),
+		timeout: gateways.Timeout(),
+	}, nil
+}
+
+func (h *OmniHandler) Network() types.Network {
+	return h.network
+}
+
+func (h *OmniHandler) newClient() (*rpcutils.RpcClient, error) {
+	return rpcutils.NewClient(h.gateway.Host, h.gateway.Port, h.gateway.User, h.gateway.Passwd, h.gateway.Usessl, h.gateway.InsecureSkipVerify)
 }
 
 var OMNI_DEFAULT_FEE, _ = new(big.Int).SetString("10",10)
@@ -71,21 +132,22 @@ func (h *OmniHandler) GetDefaultFee() *big.Int {
 	return OMNI_DEFAULT_FEE
 }
 
+// EstimateFee 用 omni 节点的 estimatesmartfee 估计手续费, 节点无法估计时三档都是 OMNI_DEFAULT_FEE
+// amount 是 token 数量, 不影响比特币输入的个数, 按一个输入估计
+func (h *OmniHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	return h.btcHandler.EstimateFeeWithFallback(ctx, fromAddress, toAddress, nil, OMNI_DEFAULT_FEE)
+}
+
 func (h *OmniHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed()
 	pkHash := btcutil.Hash160(b)
-	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, chainconfig)
+	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, h.chainConfig)
 	if err != nil {
 		return
 	}
@@ -95,172 +157,165 @@ func (h *OmniHandler) PublicKeyToAddress(pubKeyHex string) (address string, err
 
 // Not Supported
 func (h *OmniHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *OmniHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *OmniHandler) SupportedBuildOptions() []string {
+	return btc.SupportedBuildOptions
+}
+
+func (h *OmniHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		Balance: true,
+		Tokens: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: btc.SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, err := btc.ChainConfigForNetwork(n)
+			return err == nil && propertiesForNetwork(n)[h.propertyName] != ""
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *OmniHandler) symbol() string {
+	if s, ok := PropertySymbols[h.propertyName]; ok {
+		return s
+	}
+	return "OMNI"
+}
+
+func (h *OmniHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: h.symbol(),
+		Decimals: 8,
+		SLIP44: 200,
+		AddressFormat: types.AddressBase58Check,
+		SmallestUnit: "willet",
+	}
+}
+
+func (h *OmniHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	outputs := []types.TxOutput{{ToAddress: toAddress, Amount: amount}}
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		return
+	}
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 fromAddress 可以花费的 utxo, 用来支付手续费和给接收地址的 1 satoshi
+func (h *OmniHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if err := opts.Check(h.propertyName, btc.SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	return h.btcHandler.FetchUTXOs(ctx, h.propertyName, fromAddress)
+}
+
+// Assemble 构造 simple send 交易, 第一个输出是 OP_RETURN 的 omni payload, 第二个输出给接收地址 1 satoshi, 不访问网络
+func (h *OmniHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
 	defer func() {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v\n", e, string(debug.Stack()))
 		}
 	} ()
-	changeAddress := fromAddress
-	unspentOutputs, err := btc.ListUnspent_electrs(fromAddress)
-	if err != nil {
+	if err = state.Check(h.propertyName, h.network.String()); err != nil {
 		return
 	}
-	sourceOutputs := make(map[string][]btcjson.ListUnspentResult)
-	for _, unspentOutput := range unspentOutputs {
-		if !unspentOutput.Spendable {
-			continue
-		}
-		if unspentOutput.Confirmations < btc.RequiredConfirmations {
-			continue
-		}
-		b, _ := hex.DecodeString(unspentOutput.ScriptPubKey)
-		pkScript, err := txscript.ParsePkScript(b)
-		if err != nil {
-			continue
-		}
-		class := pkScript.Class().String()
-		if class != "pubkeyhash" {
-			continue
-		}
-		sourceAddressOutputs := sourceOutputs[unspentOutput.Address]
-		sourceOutputs[unspentOutput.Address] = append(sourceAddressOutputs, unspentOutput)
+	if err = opts.Check(h.propertyName, btc.SupportedBuildOptions...); err != nil {
+		return
 	}
+	if len(outputs) != 1 {
+		err = fmt.Errorf("%v: %w", h.propertyName, types.ErrBatchNotSupported)
+		return
+	}
+	toAddress, amount := outputs[0].ToAddress, outputs[0].Amount
 
 	// 设置交易输出
 	var txOuts []*wire.TxOut
 
-	//c, _ := rpcutils.NewClient(omnihost, omniport, omniuser, omnipasswd, omniusessl)
 	// Vout 0
 	// 1. omni_createpayload_simplesend
-	propertyId := Properties[h.propertyName]
-	amt := ""
-	if amount.Cmp(big.NewInt(100000000)) == 1 {
-		tmp := amount.String()
-		amt = new(big.Int).Div(amount, big.NewInt(100000000)).String() + "." + tmp[len(tmp)-8:]
-	} else {
-		amt = strconv.FormatFloat(float64(amount.Int64())/100000000,'f',-1,64)
-	}
-	fmt.Printf("amount is %v\namt is %v\n",amount,amt)
-	/*req1 := `{"jsonrpc":"1.0","id":"1","method":"omni_createpayload_simplesend","params":[` + propertyId + `,"` + amt + `"]}`
-	fmt.Printf("======== req1 is %v ========\n", req1)
-	retJSON1, err := c.Send(req1)
-	fmt.Printf("======== retJSON1 is %v ========\n", retJSON1)
-	var ret1 interface{}
-	err = json.Unmarshal([]byte(retJSON1), &ret1)
-	if err != nil {
-		return
-	}
-	payload := ret1.(map[string]interface{})["result"].(string)*/
-	pid, _ := strconv.Atoi(propertyId)
+	pid, _ := strconv.Atoi(h.propertyId)
 	pidhex := strconv.FormatInt(int64(pid), 16)
 	amthex := strconv.FormatUint(amount.Uint64(), 16)
-	pidScript := make16(pidhex)
-	amtScript := make16(amthex)
-	payload := pidScript + amtScript
-	fmt.Printf("payload: %v\n", payload)
-	if payload == "" {
-		err = fmt.Errorf("create payload error")
-		return
-	}
+	payload := make16(pidhex) + make16(amthex)
 	// 2. omni_createrawtx_opreturn
-	scriptStr := "6a146f6d6e69" + payload
-	script, _ := hex.DecodeString(scriptStr)
-	txOut := wire.NewTxOut(0, script)
-	txOuts = append(txOuts,txOut)
+	script, _ := hex.DecodeString("6a146f6d6e69" + payload)
+	txOuts = append(txOuts, wire.NewTxOut(0, script))
 
 	// 3. 发送 1 satoshi
-	toAddr, _ := btcutil.DecodeAddress(toAddress, chainconfig)
-	pkscript0, _ := txscript.PayToAddrScript(toAddr)
-	txOut0 := wire.NewTxOut(1, pkscript0)
-	txOuts = append(txOuts, txOut0)
-
-	if len(sourceOutputs) < 1 {
-		err = fmt.Errorf("cannot find p2pkh utxo")
-		return
-	}
-	previousOutputs := sourceOutputs[fromAddress]
-	targetAmount := btc.SumOutputValues(txOuts)
-	estimatedSize := btc.EstimateVirtualSize(0, 1, 0, txOuts, true)
-	targetFee := txrules.FeeForSerializeSize(feeRate, estimatedSize)
-	// 选择utxo作为交易输入
-	// *************************************************
-	var inputSource txauthor.InputSource
-	for i, _ := range previousOutputs {
-		inputSource = btc.MakeInputSource(previousOutputs[:i+1])
-		inputAmount, _, _, _, err1 := inputSource(targetAmount + targetFee)
-		if err1 != nil {
-			err = err1
-			return
-		}
-		if inputAmount < targetAmount+targetFee {
-			fmt.Printf("=========inputAmount %v, targetAmount %v, targetFee %v=========\n",inputAmount,targetAmount,targetFee)
-			continue
-		} else {
-			break
-		}
-	}
-	// *************************************************
-	// 设置找零
-	changeAddr, _ := btcutil.DecodeAddress(changeAddress, chainconfig)
-	changeSource := func()([]byte,error){
-		return txscript.PayToAddrScript(changeAddr)
-	}
-	transaction, err = btc.NewUnsignedTransaction(txOuts, feeRate, inputSource, changeSource)
+	toAddr, err := btcutil.DecodeAddress(toAddress, h.chainConfig)
 	if err != nil {
+		err = types.Errorf(types.ErrInvalidAddress, "invalid address %v: %v", toAddress, err)
 		return
 	}
-
-	for idx, _ := range transaction.(*btc.AuthoredTx).Tx.TxIn {
-		pkscript, _ := hex.DecodeString(previousOutputs[idx].ScriptPubKey)
-
-		txhashbytes, err1 := txscript.CalcSignatureHash(pkscript, hashType, transaction.(*btc.AuthoredTx).Tx, idx)
-		if err1 != nil {
-			err = err1
-			return
-		}
-		txhash := hex.EncodeToString(txhashbytes)
-		digests = append(digests, txhash)
-	}
-	transaction.(*btc.AuthoredTx).Digests = digests
-
-	if fromPublicKey[:2] == "0x" || fromPublicKey[:2] == "0X" {
-		fromPublicKey = fromPublicKey[2:]
-	}
-	bb, err := hex.DecodeString(fromPublicKey)
+	pkscript0, err := txscript.PayToAddrScript(toAddr)
 	if err != nil {
 		return
 	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	txOuts = append(txOuts, wire.NewTxOut(1, pkscript0))
+
+	tx, digests, err := h.btcHandler.AssembleTxOuts(state, fromAddress, fromPublicKey, txOuts, opts)
 	if err != nil {
 		return
 	}
-	transaction.(*btc.AuthoredTx).PubKeyData = pubKey.SerializeCompressed()
-	for i, txout := range transaction.(*btc.AuthoredTx).Tx.TxOut {
-		s := hex.EncodeToString(txout.PkScript)
-		fmt.Printf("script %v: %v\n", i, s)
-	}
-
+	transaction = tx
 	return
 }
 
-// NOT completed, may or not work
 func (h *OmniHandler) SignTransaction(hash []string, wif interface{}) (rsv []string, err error){
 	return h.btcHandler.SignTransaction(hash, wif)
 }
 
-// NOT completed, may or not work
 func (h *OmniHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
 	return h.btcHandler.MakeSignedTransaction(rsv, transaction)
 }
 
-// NOT completed, may or not work
+func (h *OmniHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *OmniHandler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	c, _ := rpcutils.NewClient(omnihost, omniport, omniuser, omnipasswd, omniusessl)
-	ret, err= btc.SendRawTransaction (c, signedTransaction.(*btc.AuthoredTx).Tx, allowHighFees)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *OmniHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	authored, ok := signedTransaction.(*btc.AuthoredTx)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	c, _ := h.newClient()
+	ret, err= btc.SendRawTransactionContext (ctx, c, authored.Tx, allowHighFees)
 	return
 }
 
 func (h *OmniHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *OmniHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
@@ -268,22 +323,22 @@ func (h *OmniHandler) GetTransactionInfo(txhash string) (fromAddress string, txO
 		}
 	} ()
 
-	client, _ := rpcutils.NewClient(omnihost, omniport, omniuser, omnipasswd, omniusessl)
+	client, _ := h.newClient()
 	reqstr := `{"jsonrpc":"1.0","id":"1","method":"omni_gettransaction","params":["`+txhash+`"]}`
-	ret, err1 := client.Send(reqstr)
+	ret, err1 := client.SendContext(ctx, reqstr)
 	if err1 != nil {
 		err = err1
 		return
 	}
 
 	if ret == "" {
-		err = fmt.Errorf("failed get transaction")
+		err = types.Errorf(types.ErrGatewayUnavailable, "failed get transaction")
 		return
 	}
 	fmt.Println("GetTransaction: "+ret)
 	omniTx := DecodeOmniTx(ret)
 	if omniTx.Error != nil {
-		err = omniTx.Error
+		err = types.ClassifyError(omniTx.Error)
 		return
 	}
 
@@ -301,17 +356,23 @@ func (h *OmniHandler) GetTransactionInfo(txhash string) (fromAddress string, txO
 }
 
 func (h *OmniHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *OmniHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
-	propertyId := Properties[h.propertyName]
-	client, _ := rpcutils.NewClient(omnihost, omniport, omniuser, omnipasswd, omniusessl)
+	propertyId := h.propertyId
+	client, _ := h.newClient()
 	reqstr := `{"jsonrpc":"1.0","id":"1","method":"omni_getbalance","params":["`+address+`",`+propertyId+`]}`
 
-	ret, err1 := client.Send(reqstr)
+	ret, err1 := client.SendContext(ctx, reqstr)
 	if err1 != nil {
 		err = err1
 		return
@@ -355,8 +416,16 @@ func parseRPCReturn (retJSON string) (result interface{}, err error) {
 			err = fmt.Errorf("unknown error")
 			return
 		}
-		err = fmt.Errorf(errStr.(string))
+		err = types.ClassifyError(fmt.Errorf("%v", errStr))
 	}
 	return
 }
 
+
+func (h *OmniHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return btc.MarshalEnvelope(h.propertyName, h.network.String(), transaction, digests)
+}
+
+func (h *OmniHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return btc.UnmarshalEnvelope(h.propertyName, h.network.String(), env)
+}
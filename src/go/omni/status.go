@@ -0,0 +1,61 @@
+package omni
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/btc"
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetTransactionStatus 用 omni_gettransaction 查询交易的确认数
+// omni 层校验失败 (valid 为 false) 的交易是 TxFailed
+func (h *OmniHandler) GetTransactionStatus(ctx context.Context, txhash string) (status *types.TxStatus, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	threshold := btc.FinalityConfirmations
+	client, err := h.newClient()
+	if err != nil {
+		return
+	}
+	reqstr := `{"jsonrpc":"1.0","id":"1","method":"omni_gettransaction","params":["`+txhash+`"]}`
+	ret, err := client.SendContext(ctx, reqstr)
+	if errors.Is(err, types.ErrNotFound) {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	if err != nil {
+		return
+	}
+	var tx struct {
+		Result *struct {
+			Blockhash string `json:"blockhash"`
+			Block uint64 `json:"block"`
+			Confirmations uint64 `json:"confirmations"`
+			Valid bool `json:"valid"`
+		} `json:"result"`
+	}
+	if err = json.Unmarshal([]byte(ret), &tx); err != nil {
+		return
+	}
+	if tx.Result == nil {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	if tx.Result.Blockhash == "" || tx.Result.Confirmations == 0 {
+		return types.MempoolTxStatus(txhash, threshold), nil
+	}
+	status = types.IncludedTxStatus(txhash, tx.Result.Block, tx.Result.Blockhash, tx.Result.Confirmations, threshold)
+	if !tx.Result.Valid {
+		status.State = types.TxFailed
+	}
+	return
+}
@@ -0,0 +1,189 @@
+package cryptocoins
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// HandlerFactory 根据币种名创建 network 上的 handler, network 为空时使用币种的默认网络
+// 不支持的币种或网络返回错误, 不支持的网络用 types.UnsupportedNetworkError
+// 前缀族的 factory 收到的是调用方传入的原始币种名, 例如 "ERC20GUSD", "OMNITetherUS"
+// gateways 是创建 handler 使用的网关配置, 不为 nil, factory 不应该读取 config.Current()
+type HandlerFactory func(coinType string, network types.Network, gateways *config.ApiGatewayConfigs) (CryptocoinHandler, error)
+
+type familyEntry struct {
+	prefix string
+	factory HandlerFactory
+	members func() []string
+}
+
+type handlerRegistry struct {
+	sync.RWMutex
+	// 规范币种名 -> factory, key 是大写
+	coins map[string]HandlerFactory
+	// 别名 -> 规范币种名, key 是大写
+	aliases map[string]string
+	// 按前缀长度从长到短排列
+	families []*familyEntry
+}
+
+var registry = &handlerRegistry{
+	coins: make(map[string]HandlerFactory),
+	aliases: make(map[string]string),
+}
+
+// Register 注册一个币种, id 是规范币种名, aliases 是别名, 都不区分大小写
+// 仓库外的 handler 可以在自己包的 init 里调用 Register, 不需要修改本包
+func Register(id string, factory HandlerFactory, aliases ...string) error {
+	if factory == nil {
+		return fmt.Errorf("register %v: nil handler factory", id)
+	}
+	key := strings.ToUpper(id)
+	if key == "" {
+		return fmt.Errorf("register: empty coin id")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if err := registry.checkName(key); err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		if err := registry.checkName(strings.ToUpper(alias)); err != nil {
+			return err
+		}
+	}
+	registry.coins[key] = factory
+	for _, alias := range aliases {
+		registry.aliases[strings.ToUpper(alias)] = key
+	}
+	return nil
+}
+
+// RegisterFamily 注册一个前缀族, 例如 "ERC20" 匹配 "ERC20GUSD", "ERC20BNB"
+// 前缀不区分大小写, members 返回族里已知的币种名, 用于 RegisteredCoins, 可以为 nil
+func RegisterFamily(prefix string, factory HandlerFactory, members func() []string) error {
+	if factory == nil {
+		return fmt.Errorf("register family %v: nil handler factory", prefix)
+	}
+	key := strings.ToUpper(prefix)
+	if key == "" {
+		return fmt.Errorf("register family: empty prefix")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, f := range registry.families {
+		if f.prefix == key {
+			return fmt.Errorf("register family %v: prefix already registered", prefix)
+		}
+	}
+	registry.families = append(registry.families, &familyEntry{
+		prefix: key,
+		factory: factory,
+		members: members,
+	})
+	sort.SliceStable(registry.families, func(i, j int) bool {
+		return len(registry.families[i].prefix) > len(registry.families[j].prefix)
+	})
+	return nil
+}
+
+// MustRegister 和 Register 一样, 出错时 panic, 用在 init 里
+func MustRegister(id string, factory HandlerFactory, aliases ...string) {
+	if err := Register(id, factory, aliases...); err != nil {
+		panic(err)
+	}
+}
+
+// MustRegisterFamily 和 RegisterFamily 一样, 出错时 panic, 用在 init 里
+func MustRegisterFamily(prefix string, factory HandlerFactory, members func() []string) {
+	if err := RegisterFamily(prefix, factory, members); err != nil {
+		panic(err)
+	}
+}
+
+func (r *handlerRegistry) checkName(key string) error {
+	if _, ok := r.coins[key]; ok {
+		return fmt.Errorf("register %v: coin already registered", key)
+	}
+	if _, ok := r.aliases[key]; ok {
+		return fmt.Errorf("register %v: alias already registered", key)
+	}
+	return nil
+}
+
+// CanonicalCoinType 返回币种的规范名, 别名会被转换, 前缀族的币种原样返回
+func CanonicalCoinType(coinType string) (id string, ok bool) {
+	key := strings.ToUpper(coinType)
+	registry.RLock()
+	defer registry.RUnlock()
+	if _, ok = registry.coins[key]; ok {
+		return key, true
+	}
+	if id, ok = registry.aliases[key]; ok {
+		return id, true
+	}
+	if registry.family(key) != nil {
+		return coinType, true
+	}
+	return "", false
+}
+
+func (r *handlerRegistry) family(key string) *familyEntry {
+	for _, f := range r.families {
+		if strings.HasPrefix(key, f.prefix) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (r *handlerRegistry) factory(coinType string) HandlerFactory {
+	key := strings.ToUpper(coinType)
+	r.RLock()
+	defer r.RUnlock()
+	if factory, ok := r.coins[key]; ok {
+		return factory
+	}
+	if id, ok := r.aliases[key]; ok {
+		return r.coins[id]
+	}
+	if f := r.family(key); f != nil {
+		return f.factory
+	}
+	return nil
+}
+
+// RegisteredCoins 返回所有注册的币种, 包括前缀族里已知的币种, 按名字排序
+func RegisteredCoins() (coins []string) {
+	registry.RLock()
+	families := make([]*familyEntry, len(registry.families))
+	copy(families, registry.families)
+	for id := range registry.coins {
+		coins = append(coins, id)
+	}
+	registry.RUnlock()
+	for _, f := range families {
+		if f.members == nil {
+			continue
+		}
+		coins = append(coins, f.members()...)
+	}
+	sort.Strings(coins)
+	return
+}
+
+// RegisteredFamilies 返回所有注册的前缀
+func RegisteredFamilies() (prefixes []string) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, f := range registry.families {
+		prefixes = append(prefixes, f.prefix)
+	}
+	sort.Strings(prefixes)
+	return
+}
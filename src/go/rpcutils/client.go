@@ -0,0 +1,218 @@
+package rpcutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 网关响应的最大长度, 超过时返回错误
+const MaxResponseSize = 16 << 20
+
+// HTTPError 是网关返回的非 2xx 响应, Body 是响应内容, 节点的错误信息一般在里面
+type HTTPError struct {
+	StatusCode int
+	Status string
+	Body []byte
+}
+
+func (e *HTTPError) Error() string {
+	body := strings.TrimSpace(string(e.Body))
+	if len(body) > 512 {
+		body = body[:512] + "..."
+	}
+	if body == "" {
+		return "HTTP error: " + e.Status
+	}
+	return fmt.Sprintf("HTTP error: %v: %v", e.Status, body)
+}
+
+// Client 是访问网关的 http client
+//	请求受 ctx 限制, ctx 没有 deadline 时使用 config.DefaultTimeout
+//	请求经过 Transport, 注册了备用节点的网关自动切换节点
+//	响应不超过 MaxResponseSize, 非 2xx 的响应返回 *HTTPError
+//	查询请求 (见 idempotent) 在网关不可用时重试, 广播交易的请求不重试
+type Client struct {
+	client *http.Client
+	// 查询请求最多发送的次数
+	Attempts int
+	// 第一次重试前等待的时间, 之后每次加倍
+	Backoff time.Duration
+}
+
+// NewHTTPClient 创建 Client, insecure 为 true 时不检查节点的证书
+func NewHTTPClient(insecure bool) *Client {
+	var base http.RoundTripper = http.DefaultTransport
+	if insecure {
+		base = insecureTransport
+	}
+	return &Client{
+		client: &http.Client{Transport: Transport(base)},
+		Attempts: 3,
+		Backoff: 200 * time.Millisecond,
+	}
+}
+
+// 包级函数使用的 Client
+var (
+	defaultClient = NewHTTPClient(false)
+	insecureClient = NewHTTPClient(true)
+)
+
+// Do 发送请求, 返回 2xx 响应的内容
+// 非 2xx 的响应同时返回响应内容和 *HTTPError, 错误按 types.ClassifyError 分类, 502, 503, 504 是 ErrGatewayUnavailable
+// 连不上网关时返回的错误是 ErrGatewayUnavailable, ctx 取消或超时时返回 ctx.Err()
+func (c *Client) Do(ctx context.Context, req *http.Request) ([]byte, error) {
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	attempts := 1
+	if idempotent(req, body) && c.Attempts > 1 {
+		attempts = c.Attempts
+	}
+	backoff := c.Backoff
+	for i := 1; ; i++ {
+		ret, err := c.do(ctx, req, body)
+		if i >= attempts || !retryable(err) {
+			return ret, err
+		}
+		select {
+		case <-ctx.Done():
+			return ret, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request, body []byte) ([]byte, error) {
+	r := req.Clone(ctx)
+	if body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	resp, err := c.client.Do(r)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, types.WrapError(types.ErrGatewayUnavailable, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxResponseSize + 1))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, types.WrapError(types.ErrGatewayUnavailable, err)
+	}
+	if len(data) > MaxResponseSize {
+		return nil, fmt.Errorf("%v: response is larger than %v bytes", req.URL.Redacted(), MaxResponseSize)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		herr := &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: data}
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return data, types.WrapError(types.ErrGatewayUnavailable, herr)
+		}
+		return data, types.ClassifyError(herr)
+	}
+	return data, nil
+}
+
+// retryable 判断请求失败是不是因为网关不可用, 节点返回的 5xx 错误 (如 500) 不重试
+func retryable(err error) bool {
+	if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	var herr *HTTPError
+	if errors.As(err, &herr) {
+		switch herr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return types.ErrorKind(err) == types.ErrGatewayUnavailable
+}
+
+// Get 发送 GET 请求
+func (c *Client) Get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(ctx, req)
+}
+
+// Post 发送 json 格式的 POST 请求, data 为空时不带请求内容
+func (c *Client) Post(ctx context.Context, url string, data []byte) ([]byte, error) {
+	var body io.Reader
+	if len(data) > 0 {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json;charset=utf-8")
+	req.Header.Set("Accept", "application/json")
+	return c.Do(ctx, req)
+}
+
+// JoinURL 拼接网关地址和 api 路径, api 为空时返回 url
+func JoinURL(url, api string) string {
+	url = strings.TrimRight(url, "/")
+	api = strings.TrimLeft(api, "/")
+	if api == "" {
+		return url
+	}
+	return url + "/" + api
+}
+
+// PostJSON 把 json 请求 data POST 到网关 url 的 api, 见 Client.Do
+func PostJSON(ctx context.Context, url, api, data string) ([]byte, error) {
+	return defaultClient.Post(ctx, JoinURL(url, api), []byte(data))
+}
+
+// Get 请求网关 url 的 api, 见 Client.Do
+func Get(ctx context.Context, url, api string) ([]byte, error) {
+	return defaultClient.Get(ctx, JoinURL(url, api))
+}
+
+// DoContext runs fn in the background and returns ctx.Err() as soon as ctx
+// is done or timeout (see WithTimeout) expires, for SDK clients (bnb, evt)
+// that do not take a context themselves.
+func DoContext (ctx context.Context, timeout time.Duration, fn func() error) error {
+	ctx, cancel := WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,93 @@
+package rpcutils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+func TestClientStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"tx not found"}`))
+	}))
+	defer srv.Close()
+
+	body, err := Get(context.Background(), srv.URL, "tx/00")
+	var herr *HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		t.Fatalf("got %v, want a 404 HTTPError", err)
+	}
+	if !errors.Is(err, types.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if string(body) != `{"error":"tx not found"}` {
+		t.Fatalf("got body %q", body)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	c := NewHTTPClient(false)
+	c.Backoff = time.Millisecond
+
+	ret, err := c.Post(context.Background(), srv.URL, []byte(`{"method":"getblockcount","params":[]}`))
+	if err != nil || string(ret) != "ok" || hits != 3 {
+		t.Fatalf("got %q, %v after %v requests, want the third attempt", ret, err, hits)
+	}
+	hits = 0
+	_, err = c.Post(context.Background(), srv.URL, []byte(`{"method":"sendrawtransaction","params":["00"]}`))
+	if !errors.Is(err, types.ErrGatewayUnavailable) || hits != 1 {
+		t.Fatalf("got %v after %v requests, sendrawtransaction should not be retried", err, hits)
+	}
+}
+
+func TestClientResponseSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", MaxResponseSize+1)))
+	}))
+	defer srv.Close()
+
+	if _, err := Get(context.Background(), srv.URL, ""); err == nil {
+		t.Fatal("response larger than MaxResponseSize should fail")
+	}
+}
+
+// handler 传入的超时比 config.DefaultTimeout 优先
+func TestTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), 0)
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || time.Until(d) < 29*time.Second {
+		t.Fatalf("got deadline %v, want config.DefaultTimeout", d)
+	}
+	ctx, cancel = WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	ctx, cancel = withDefaultTimeout(ctx)
+	defer cancel()
+	if d, _ := ctx.Deadline(); time.Until(d) < 59*time.Minute {
+		t.Fatalf("got deadline %v, the caller's deadline should be kept", d)
+	}
+
+	err := DoContext(context.Background(), 10*time.Millisecond, func() error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,479 @@
+package rpcutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
+)
+
+// Endpoint 是网关的一个节点
+type Endpoint struct {
+	// scheme://host:port[/path], 请求 url 里主节点的地址会换成它
+	URL string
+	// 节点的 basic auth, 备用节点为空时去掉请求里主节点的认证
+	User string
+	Passwd string
+	// 为 true 时不检查节点的证书
+	InsecureSkipVerify bool
+	// 越小越优先, 相同时按注册的顺序
+	Priority int
+}
+
+// Probe 检查节点健康, Check 返回节点的高度 (区块高度, ledger 序号等)
+// 节点出错, 或者高度落后所有节点里最高的高度超过 MaxLag 时不健康
+type Probe struct {
+	Name string
+	MaxLag uint64
+	Check func(ctx context.Context, client *http.Client, ep Endpoint) (uint64, error)
+}
+
+// EndpointStatus 是节点最近一次检查的结果
+type EndpointStatus struct {
+	Endpoint
+	Healthy bool
+	Height uint64
+	LastError string
+	CheckedAt time.Time
+}
+
+type endpointState struct {
+	Endpoint
+	primary bool
+	// 健康检查的结果, 没有 Probe 时总是 true
+	healthy bool
+	height uint64
+	lastErr error
+	checkedAt time.Time
+	// 请求失败后在这个时间之前不优先使用
+	downUntil time.Time
+}
+
+// Pool 是一个网关的主节点和备用节点
+type Pool struct {
+	primary string
+	key string
+	probe *Probe
+	// 健康检查的间隔, 也是请求失败的节点排到后面的时间
+	interval time.Duration
+	lock sync.RWMutex
+	endpoints []*endpointState
+	stop chan struct{}
+}
+
+// 已注册的网关, 以主节点地址为 key
+var (
+	poolsLock sync.RWMutex
+	pools = make(map[string]*Pool)
+)
+
+// Register 注册主节点地址为 primary 的网关, endpoints 是包括主节点在内的所有节点, 主节点必须是第一个
+// 同一个主节点以最后一次注册为准, 只有一个节点时取消原来的注册, 重新加载的配置去掉备用节点后请求直接发给主节点
+// 节点没有变化时保留原来的 Pool 和健康状态
+// probe 不为 nil 时在后台每隔 interval 检查节点, interval 为 0 时使用 config.DefaultHealthCheckInterval
+func Register(endpoints []Endpoint, probe *Probe, interval time.Duration) *Pool {
+	if len(endpoints) == 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = config.DefaultHealthCheckInterval * time.Second
+	}
+	primary := strings.TrimRight(endpoints[0].URL, "/")
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+	old := pools[primary]
+	if len(endpoints) == 1 {
+		if old != nil {
+			old.close()
+			delete(pools, primary)
+		}
+		return nil
+	}
+	key := poolKey(endpoints, probe)
+	if old != nil && old.key == key {
+		old.lock.Lock()
+		old.interval = interval
+		old.lock.Unlock()
+		return old
+	}
+	if old != nil {
+		old.close()
+	}
+	p := &Pool{
+		primary: primary,
+		key: key,
+		probe: probe,
+		interval: interval,
+		stop: make(chan struct{}),
+	}
+	for i, ep := range endpoints {
+		ep.URL = strings.TrimRight(ep.URL, "/")
+		p.endpoints = append(p.endpoints, &endpointState{Endpoint: ep, primary: i == 0, healthy: true})
+	}
+	sort.SliceStable(p.endpoints, func(i, j int) bool {
+		return p.endpoints[i].Priority < p.endpoints[j].Priority
+	})
+	pools[primary] = p
+	if probe != nil {
+		go p.run()
+	}
+	return p
+}
+
+func poolKey(endpoints []Endpoint, probe *Probe) string {
+	var b strings.Builder
+	if probe != nil {
+		b.WriteString(probe.Name)
+	}
+	for _, ep := range endpoints {
+		fmt.Fprintf(&b, "|%v %v %v %v %v", ep.URL, ep.User, ep.Passwd, ep.InsecureSkipVerify, ep.Priority)
+	}
+	return b.String()
+}
+
+// Unregister 取消注册主节点地址为 primary 的网关, 请求直接发给主节点
+func Unregister(primary string) {
+	primary = strings.TrimRight(primary, "/")
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+	if p := pools[primary]; p != nil {
+		p.close()
+		delete(pools, primary)
+	}
+}
+
+// Lookup 返回 url 所属网关的 Pool, 没有注册时返回 nil
+func Lookup(url string) *Pool {
+	p, _ := lookup(url)
+	return p
+}
+
+// lookup 返回 url 所属的 Pool 和 url 去掉主节点地址之后的部分
+func lookup(url string) (*Pool, string) {
+	poolsLock.RLock()
+	defer poolsLock.RUnlock()
+	var found *Pool
+	for primary, p := range pools {
+		if !strings.HasPrefix(url, primary) {
+			continue
+		}
+		if rest := url[len(primary):]; rest != "" && rest[0] != '/' && rest[0] != '?' {
+			continue
+		}
+		if found == nil || len(primary) > len(found.primary) {
+			found = p
+		}
+	}
+	if found == nil {
+		return nil, ""
+	}
+	return found, url[len(found.primary):]
+}
+
+func (p *Pool) close() {
+	close(p.stop)
+}
+
+// Interval 返回健康检查的间隔
+func (p *Pool) Interval() time.Duration {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.interval
+}
+
+// Status 返回每个节点的状态, 按优先级排序
+func (p *Pool) Status() []EndpointStatus {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	ret := make([]EndpointStatus, len(p.endpoints))
+	for i, ep := range p.endpoints {
+		ret[i] = EndpointStatus{
+			Endpoint: ep.Endpoint,
+			Healthy: ep.healthy && !time.Now().Before(ep.downUntil),
+			Height: ep.height,
+			CheckedAt: ep.checkedAt,
+		}
+		ret[i].Passwd = ""
+		if ep.lastErr != nil {
+			ret[i].LastError = ep.lastErr.Error()
+		}
+	}
+	return ret
+}
+
+// order 返回请求使用节点的顺序: 先是健康的节点, 然后是其它节点, 都按优先级
+func (p *Pool) order() []*endpointState {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	now := time.Now()
+	healthy := make([]*endpointState, 0, len(p.endpoints))
+	var others []*endpointState
+	for _, ep := range p.endpoints {
+		if ep.healthy && !now.Before(ep.downUntil) {
+			healthy = append(healthy, ep)
+		} else {
+			others = append(others, ep)
+		}
+	}
+	return append(healthy, others...)
+}
+
+// failed 记录请求失败, 节点在下一个检查间隔内排到健康节点后面
+func (p *Pool) failed(ep *endpointState, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if time.Now().After(ep.downUntil) {
+		log.Printf("gateway %v: endpoint %v failed: %v", p.primary, ep.URL, err)
+	}
+	ep.lastErr = err
+	ep.downUntil = time.Now().Add(p.interval)
+}
+
+func (p *Pool) succeeded(ep *endpointState) {
+	p.lock.Lock()
+	ep.downUntil = time.Time{}
+	p.lock.Unlock()
+}
+
+func (p *Pool) run() {
+	for {
+		p.check()
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.Interval()):
+		}
+	}
+}
+
+// check 并发检查所有节点, 更新节点的高度和健康状态
+func (p *Pool) check() {
+	p.lock.RLock()
+	endpoints := append([]*endpointState(nil), p.endpoints...)
+	p.lock.RUnlock()
+	heights := make([]uint64, len(endpoints))
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func(i int, ep Endpoint) {
+			defer wg.Done()
+			ctx, cancel := WithTimeout(context.Background(), 0)
+			defer cancel()
+			client := probeClient
+			if ep.InsecureSkipVerify {
+				client = insecureProbeClient
+			}
+			heights[i], errs[i] = p.probe.Check(ctx, client, ep)
+		}(i, ep.Endpoint)
+	}
+	wg.Wait()
+	var tip uint64
+	for i := range endpoints {
+		if errs[i] == nil && heights[i] > tip {
+			tip = heights[i]
+		}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	for i, ep := range endpoints {
+		err := errs[i]
+		if err == nil && heights[i] + p.probe.MaxLag < tip {
+			err = fmt.Errorf("%v height %v is behind the tip %v", p.probe.Name, heights[i], tip)
+		}
+		healthy := err == nil
+		if healthy != ep.healthy {
+			log.Printf("gateway %v: endpoint %v healthy: %v, %v", p.primary, ep.URL, healthy, err)
+		}
+		ep.healthy = healthy
+		ep.height = heights[i]
+		ep.checkedAt = now
+		if err != nil {
+			ep.lastErr = err
+		} else {
+			ep.downUntil = time.Time{}
+		}
+	}
+}
+
+// 不检查证书的 transport, 只用于设置了 InsecureSkipVerify 的节点
+var insecureTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+}
+
+// 健康检查使用的 client, 和请求一样只对设置了 InsecureSkipVerify 的节点不检查证书
+var (
+	probeClient = &http.Client{}
+	insecureProbeClient = &http.Client{Transport: insecureTransport}
+)
+
+// Transport 返回把请求发给已注册网关里健康节点的 RoundTripper, base 为 nil 时使用 http.DefaultTransport
+// 没有注册的地址直接用 base 发送; 已注册网关的节点检查证书, 除非节点设置了 InsecureSkipVerify
+// 查询请求失败 (连接错误, 502, 503, 504) 时换下一个节点重试,
+// 广播交易的请求 (见 idempotent) 只在连接节点失败, 请求没有发出去时重试
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &failoverTransport{base: base}
+}
+
+type failoverTransport struct {
+	base http.RoundTripper
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, rest := lookup(req.URL.String())
+	if p == nil {
+		return t.base.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	retry := idempotent(req, body)
+	endpoints := p.order()
+	for i, ep := range endpoints {
+		last := i == len(endpoints) - 1
+		r, err := rewrite(req, ep, rest, body)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := ep.transport().RoundTrip(r)
+		if err != nil {
+			p.failed(ep, err)
+			if last || req.Context().Err() != nil || !(retry || dialError(err)) {
+				return nil, err
+			}
+			continue
+		}
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			p.failed(ep, errors.New(resp.Status))
+			if last || !retry {
+				return resp, nil
+			}
+			resp.Body.Close()
+			continue
+		}
+		p.succeeded(ep)
+		return resp, nil
+	}
+	return nil, fmt.Errorf("gateway %v has no endpoint", p.primary)
+}
+
+func (ep *endpointState) transport() http.RoundTripper {
+	if ep.InsecureSkipVerify {
+		return insecureTransport
+	}
+	return http.DefaultTransport
+}
+
+// rewrite 把请求改成发给 ep, 备用节点使用它自己的认证
+func rewrite(req *http.Request, ep *endpointState, rest string, body []byte) (*http.Request, error) {
+	u, err := neturl.Parse(ep.URL + rest)
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL = u
+	r.Host = ""
+	if body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if !ep.primary {
+		r.Header.Del("Authorization")
+		if ep.User != "" || ep.Passwd != "" {
+			r.SetBasicAuth(ep.User, ep.Passwd)
+		}
+	}
+	return r, nil
+}
+
+// dialError 判断请求是否在连接节点时失败, 这时请求还没有发给节点
+func dialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// 广播交易的 json-rpc 方法和 api, 节点可能已经收到了请求, 重试会重复广播
+var (
+	submitMethods = map[string]bool{
+		"sendrawtransaction": true,
+		"sendtoaddress": true,
+		"sendmany": true,
+		"omni_sendrawtx": true,
+		"eth_sendRawTransaction": true,
+		"eth_sendTransaction": true,
+		"submit": true,
+		"submit_multisigned": true,
+	}
+	submitPaths = []string{
+		"/push_transaction",
+		"/push_transactions",
+		"/broadcasttransaction",
+		"/txs",
+		"/transactions",
+		"/tx",
+	}
+)
+
+// idempotent 判断请求是否可以在别的节点上重试, 广播交易的请求不可以
+func idempotent(req *http.Request, body []byte) bool {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return true
+	}
+	path := strings.TrimRight(req.URL.Path, "/")
+	for _, suffix := range submitPaths {
+		if strings.HasSuffix(path, suffix) {
+			return false
+		}
+	}
+	var calls []struct {
+		Method string `json:"method"`
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		if json.Unmarshal(body, &calls) != nil {
+			return false
+		}
+	} else if len(body) > 0 {
+		var call struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(body, &call) == nil {
+			calls = append(calls, call)
+		}
+	}
+	for _, call := range calls {
+		if submitMethods[call.Method] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package rpcutils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNode 返回 eth_blockNumber 为 height, 其它请求返回 name
+func fakeNode(t *testing.T, name string, height uint64, hits *int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), "eth_blockNumber") {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, height)
+			return
+		}
+		user, passwd, _ := r.BasicAuth()
+		fmt.Fprintf(w, "%v %v:%v", name, user, passwd)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// deadAddress 返回一个没有节点监听的地址
+func deadAddress() string {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+func TestFailoverToBackup(t *testing.T) {
+	var hits int32
+	backup := fakeNode(t, "backup", 1, &hits)
+	primary := deadAddress()
+	Register([]Endpoint{{URL: primary, User: "u", Passwd: "p"}, {URL: backup.URL, User: "b", Passwd: "q"}}, nil, 0)
+	defer Unregister(primary)
+
+	body, err := HttpGetContext(context.Background(), primary, "blocks", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "backup b:q" {
+		t.Fatalf("got %q, want the backup with its own credentials", body)
+	}
+	c, _ := NewClient("127.0.0.1", port(primary), "u", "p", false, false)
+	ret, err := c.Send(`{"method":"getblockcount","params":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret != "backup b:q" {
+		t.Fatalf("got %q, want the backup with its own credentials", ret)
+	}
+	if s := Lookup(primary).Status(); s[0].Healthy || !s[1].Healthy {
+		t.Fatalf("primary should be marked down after a failed request: %+v", s)
+	}
+}
+
+func TestSubmitIsNotRetried(t *testing.T) {
+	var hits int32
+	backup := fakeNode(t, "backup", 1, &hits)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	Register([]Endpoint{{URL: primary.URL}, {URL: backup.URL}}, nil, 0)
+	defer Unregister(primary.URL)
+
+	c, _ := NewClient("127.0.0.1", port(primary.URL), "", "", false, false)
+	if _, err := c.Send(`{"method":"sendrawtransaction","params":["00"]}`); err == nil {
+		t.Fatal("sendrawtransaction should fail with the primary's 503")
+	}
+	if hits != 0 {
+		t.Fatalf("sendrawtransaction was retried on the backup")
+	}
+	if _, err := c.Send(`{"method":"getblockcount","params":[]}`); err != nil {
+		t.Fatalf("read should fail over: %v", err)
+	}
+}
+
+func TestLaggingEndpoint(t *testing.T) {
+	var hits int32
+	primary := fakeNode(t, "primary", 100, &hits)
+	backup := fakeNode(t, "backup", 200, &hits)
+	p := Register([]Endpoint{{URL: primary.URL}, {URL: backup.URL, Priority: 1}}, nil, 0)
+	defer Unregister(primary.URL)
+	p.probe = EthereumProbe
+	p.check()
+
+	ret, err := PostJSON(context.Background(), primary.URL, "", `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":[]}`)
+	if err != nil || !strings.HasPrefix(string(ret), "backup") {
+		t.Fatalf("got %q, want the backup while the primary lags", ret)
+	}
+	if s := p.Status(); s[0].Healthy || s[0].Height != 100 || s[1].Height != 200 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+}
+
+func TestReregisterWithoutBackups(t *testing.T) {
+	var hits int32
+	backup := fakeNode(t, "backup", 1, &hits)
+	primary := deadAddress()
+	p := Register([]Endpoint{{URL: primary}, {URL: backup.URL}}, nil, time.Minute)
+	defer Unregister(primary)
+	if p.Interval() != time.Minute {
+		t.Fatalf("got interval %v, want the registered one", p.Interval())
+	}
+	// 重新加载的配置去掉了备用节点
+	if got := Register([]Endpoint{{URL: primary}}, nil, time.Second); got != nil || Lookup(primary) != nil {
+		t.Fatal("a single endpoint config should remove the existing pool")
+	}
+	if _, err := HttpGetContext(context.Background(), primary, "blocks", nil); err == nil {
+		t.Fatal("request to the dead primary should fail")
+	}
+	if hits != 0 {
+		t.Fatalf("request failed over to a removed backup %v times", hits)
+	}
+}
+
+func port(url string) int {
+	var p int
+	fmt.Sscanf(url[strings.LastIndex(url, ":")+1:], "%d", &p)
+	return p
+}
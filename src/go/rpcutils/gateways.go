@@ -0,0 +1,205 @@
+package rpcutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/config"
+)
+
+// 各种节点的健康检查, MaxLag 大约是一分钟的出块数
+var (
+	// bitcoind 及兼容节点的 getblockchaininfo
+	BitcoindProbe = &Probe{Name: "bitcoind", MaxLag: 2, Check: checkBitcoind}
+	// electrs 的 /blocks/tip/height
+	ElectrsProbe = &Probe{Name: "electrs", MaxLag: 2, Check: checkElectrs}
+	// geth 等以太坊系节点的 eth_blockNumber
+	EthereumProbe = &Probe{Name: "ethereum", MaxLag: 5, Check: checkEthereum}
+	// rippled 的 server_info, 高度是最新的 validated ledger
+	RippledProbe = &Probe{Name: "rippled", MaxLag: 15, Check: checkRippled}
+	// nodeos 的 /v1/chain/get_info
+	NodeosProbe = &Probe{Name: "nodeos", MaxLag: 120, Check: checkNodeos}
+)
+
+// RegisterApiGateway 注册 api 网关的备用节点, probe 为 nil 时只在请求失败时切换节点
+// interval 是健康检查的间隔, 一般是网关配置的 HealthCheckInterval()
+func RegisterApiGateway(gateway *config.SimpleApiConfig, probe *Probe, interval time.Duration) {
+	if gateway == nil {
+		return
+	}
+	endpoints := []Endpoint{{URL: gateway.ApiAddress}}
+	for _, b := range gateway.Backups {
+		endpoints = append(endpoints, Endpoint{URL: b.ApiAddress, Priority: b.Priority})
+	}
+	Register(endpoints, probe, interval)
+}
+
+// RegisterRpcGateway 注册 bitcoind 和 electrs 的备用节点
+// omni 等网关可能和比特币网关共用 electrs, 只有备用节点设置了 ElectrsAddress 时才注册 electrs
+func RegisterRpcGateway(gateway *config.RpcClientConfig, interval time.Duration) {
+	if gateway == nil {
+		return
+	}
+	rpc := []Endpoint{{URL: rpcURL(gateway.Host, gateway.Port, gateway.Usessl), User: gateway.User, Passwd: gateway.Passwd, InsecureSkipVerify: gateway.InsecureSkipVerify}}
+	electrs := []Endpoint{{URL: gateway.ElectrsAddress}}
+	for _, b := range gateway.Backups {
+		rpc = append(rpc, Endpoint{URL: rpcURL(b.Host, b.Port, b.Usessl), User: b.User, Passwd: b.Passwd, InsecureSkipVerify: b.InsecureSkipVerify, Priority: b.Priority})
+		if b.ElectrsAddress != "" {
+			electrs = append(electrs, Endpoint{URL: b.ElectrsAddress, Priority: b.Priority})
+		}
+	}
+	Register(rpc, BitcoindProbe, interval)
+	if gateway.ElectrsAddress != "" && len(electrs) > 1 {
+		Register(electrs, ElectrsProbe, interval)
+	}
+}
+
+// RegisterEosGateway 注册 nodeos 的备用节点
+func RegisterEosGateway(gateway *config.EosConfig, interval time.Duration) {
+	if gateway == nil {
+		return
+	}
+	endpoints := []Endpoint{{URL: gateway.Nodeos}}
+	for _, b := range gateway.Backups {
+		endpoints = append(endpoints, Endpoint{URL: b.ApiAddress, Priority: b.Priority})
+	}
+	Register(endpoints, NodeosProbe, interval)
+}
+
+// rpcURL 是 NewClient 请求的地址
+func rpcURL(host string, port int, useSSL bool) string {
+	if useSSL {
+		return fmt.Sprintf("https://%s:%d", host, port)
+	}
+	return fmt.Sprintf("http://%s:%d", host, port)
+}
+
+// probeRequest 向节点发送健康检查请求, data 为空时使用 GET, 返回 200 的响应内容
+func probeRequest(ctx context.Context, client *http.Client, ep Endpoint, path, data string) ([]byte, error) {
+	method := http.MethodGet
+	if data != "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, ep.URL + path, bytes.NewBufferString(data))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if data != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if ep.User != "" || ep.Passwd != "" {
+		req.SetBasicAuth(ep.User, ep.Passwd)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error: %v", resp.Status)
+	}
+	return body, nil
+}
+
+func checkBitcoind(ctx context.Context, client *http.Client, ep Endpoint) (uint64, error) {
+	body, err := probeRequest(ctx, client, ep, "", `{"jsonrpc":"1.0","id":1,"method":"getblockchaininfo","params":[]}`)
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		Result *struct {
+			Blocks uint64 `json:"blocks"`
+			InitialBlockDownload bool `json:"initialblockdownload"`
+		} `json:"result"`
+		Error interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return 0, err
+	}
+	if res.Error != nil || res.Result == nil {
+		return 0, fmt.Errorf("getblockchaininfo: %v", res.Error)
+	}
+	if res.Result.InitialBlockDownload {
+		return 0, fmt.Errorf("node is in initial block download")
+	}
+	return res.Result.Blocks, nil
+}
+
+func checkElectrs(ctx context.Context, client *http.Client, ep Endpoint) (uint64, error) {
+	body, err := probeRequest(ctx, client, ep, "/blocks/tip/height", "")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(body)), 10, 64)
+}
+
+func checkEthereum(ctx context.Context, client *http.Client, ep Endpoint) (uint64, error) {
+	body, err := probeRequest(ctx, client, ep, "", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		Result *string `json:"result"`
+		Error interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return 0, err
+	}
+	if res.Error != nil || res.Result == nil {
+		return 0, fmt.Errorf("eth_blockNumber: %v", res.Error)
+	}
+	return strconv.ParseUint(strings.TrimPrefix(*res.Result, "0x"), 16, 64)
+}
+
+func checkRippled(ctx context.Context, client *http.Client, ep Endpoint) (uint64, error) {
+	body, err := probeRequest(ctx, client, ep, "", `{"method":"server_info","params":[{}]}`)
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		Result struct {
+			Status string `json:"status"`
+			Info struct {
+				ValidatedLedger *struct {
+					Seq uint64 `json:"seq"`
+				} `json:"validated_ledger"`
+			} `json:"info"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return 0, err
+	}
+	if res.Result.Status != "success" || res.Result.Info.ValidatedLedger == nil {
+		return 0, fmt.Errorf("server_info: status %q, no validated ledger", res.Result.Status)
+	}
+	return res.Result.Info.ValidatedLedger.Seq, nil
+}
+
+func checkNodeos(ctx context.Context, client *http.Client, ep Endpoint) (uint64, error) {
+	body, err := probeRequest(ctx, client, ep, "/v1/chain/get_info", "{}")
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		HeadBlockNum *uint64 `json:"head_block_num"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return 0, err
+	}
+	if res.HeadBlockNum == nil {
+		return 0, fmt.Errorf("get_info: no head_block_num")
+	}
+	return *res.HeadBlockNum, nil
+}
@@ -1,14 +1,17 @@
 package rpcutils
 
 import (
-	"crypto/tls"
-	"io/ioutil"
-	"net/http"
+	"context"
 	neturl "net/url"
 	"strings"
 )
 
 func HttpGet(host string, path string, params map[string][]string) ([]byte, error) {
+	return HttpGetContext(context.Background(), host, path, params)
+}
+
+// HttpGetContext 请求 host 的 path, params 是查询参数, 见 Client.Do
+func HttpGetContext(ctx context.Context, host string, path string, params map[string][]string) ([]byte, error) {
 	scheme := "http"
 	if strings.HasPrefix(host, "https") {
 		scheme = "https"
@@ -27,21 +30,5 @@ func HttpGet(host string, path string, params map[string][]string) ([]byte, erro
 	if params != nil {
 		requrl = requrl+"?"+values.Encode()
 	}
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-	resp, err := client.Get(requrl)
-
-	//resp, err := http.Get(requrl)
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-
-	return body, err
-
+	return defaultClient.Get(ctx, requrl)
 }
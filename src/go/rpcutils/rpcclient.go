@@ -7,15 +7,15 @@ package rpcutils
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"time"
 	//"log"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
 // 钱包连接参数
@@ -23,7 +23,7 @@ type RpcClient struct {
 	serverAddr string
 	user       string
 	passwd     string
-	httpClient *http.Client
+	httpClient *Client
 }
 
 // 请求信息
@@ -40,54 +40,46 @@ type rpcResponse struct {
 	Err    interface{}     `json:"error"`
 }
 
-//连接配置
-func NewClient(host string, port int, user, passwd string, useSSL bool) (c *RpcClient, err error) {
+//连接配置, 用 RegisterRpcGateway 注册了备用节点时请求经过 Transport
+// insecure 为 true 时不检查节点的证书, 只用于配置了 InsecureSkipVerify 的自签名节点
+func NewClient(host string, port int, user, passwd string, useSSL, insecure bool) (c *RpcClient, err error) {
 	if len(host) == 0 {
 		err = errors.New("Bad call missing argument host")
 		return
 	}
-	var serverAddr string
-	var httpClient *http.Client
-	if useSSL {
-		serverAddr = "https://"
-		t := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		httpClient = &http.Client{Transport: t}
-	} else {
-		serverAddr = "http://"
-		httpClient = &http.Client{}
+	httpClient := defaultClient
+	if useSSL && insecure {
+		httpClient = insecureClient
 	}
-	c = &RpcClient{serverAddr: fmt.Sprintf("%s%s:%d", serverAddr, host, port), user: user, passwd: passwd, httpClient: httpClient}
+	c = &RpcClient{serverAddr: rpcURL(host, port, useSSL), user: user, passwd: passwd, httpClient: httpClient}
 	return
 }
 
-// 超时处理
-func (c *RpcClient) doTimeoutRequest(timer *time.Timer, req *http.Request) (*http.Response, error) {
-	type result struct {
-		resp *http.Response
-		err  error
+// WithTimeout 给网关请求加上超时, handler 传入自己配置里的 RPCCLIENT_TIMEOUT
+// timeout 为 0 时使用 config.DefaultTimeout
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = config.DefaultTimeout * time.Second
 	}
-	done := make(chan result, 1)
-	go func() {
-		resp, err := c.httpClient.Do(req)
-		done <- result{resp, err}
-	}()
-	// Wait for the read or the timeout
-	select {
-	case r := <-done:
-		return r.resp, r.err
-	case <-timer.C:
-		return nil, errors.New("Timeout reading data from server")
+	return context.WithTimeout(ctx, timeout)
+}
+
+// withDefaultTimeout 只在 ctx 没有 deadline 时加上 config.DefaultTimeout, handler 设置的超时优先
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
 	}
+	return WithTimeout(ctx, 0)
 }
 
 //通信
 func (c *RpcClient) Send(reqJson string) (retJSON string, err error) {
-	connectTimer := time.NewTimer(config.RPCCLIENT_TIMEOUT * time.Second)
-	reqJsonByte := []byte(reqJson)
-	payloadBuffer := bytes.NewReader(reqJsonByte)
-	req, err := http.NewRequest("POST", c.serverAddr, payloadBuffer)
+	return c.SendContext(context.Background(), reqJson)
+}
+
+// ctx 取消或超时后立即返回, ctx 没有 deadline 时请求受 config.DefaultTimeout 限制, 见 Client.Do
+func (c *RpcClient) SendContext(ctx context.Context, reqJson string) (retJSON string, err error) {
+	req, err := http.NewRequest("POST", c.serverAddr, bytes.NewReader([]byte(reqJson)))
 	if err != nil {
 		return
 	}
@@ -96,19 +88,27 @@ func (c *RpcClient) Send(reqJson string) (retJSON string, err error) {
 	if len(c.user) > 0 || len(c.passwd) > 0 {
 		req.SetBasicAuth(c.user, c.passwd)
 	}
-	resp, err := c.doTimeoutRequest(connectTimer, req)
-	if err != nil {
+	data, err := c.httpClient.Do(ctx, req)
+	var herr *HTTPError
+	if errors.As(err, &herr) {
+		err = responseError(herr.StatusCode, herr.Status, data)
 		return
 	}
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return
 	}
-	if resp.StatusCode != 200 {
-		err = errors.New("HTTP error: " + resp.Status)
-		return
-	}
 	retJSON = string(data)
 	return
 }
+
+// 钱包出错时返回 500 和 json 格式的 error, 把 error 里的信息带上并分类
+func responseError(code int, status string, data []byte) error {
+	var res rpcResponse
+	if json.Unmarshal(data, &res) == nil && res.Err != nil {
+		return types.ClassifyError(fmt.Errorf("HTTP error: %v, %v", status, res.Err))
+	}
+	if code >= 500 {
+		return types.Errorf(types.ErrGatewayUnavailable, "HTTP error: %v", status)
+	}
+	return errors.New("HTTP error: " + status)
+}
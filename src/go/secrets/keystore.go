@@ -0,0 +1,223 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// keystore 文件的 scrypt 参数, 打开时使用文件里记录的参数
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keystoreVersion = 1
+)
+
+// 用来检查密码的固定明文
+const passphraseCheck = "cryptocoins keystore"
+
+// Keystore 是用密码加密的本地 secret 文件
+// 密钥由 scrypt 从密码派生, 每个 secret 用 AES-256-GCM 单独加密, 名字作为附加数据, 不能挪给别的名字使用
+type Keystore struct {
+	lock sync.RWMutex
+	path string
+	aead cipher.AEAD
+	file keystoreFile
+}
+
+type keystoreFile struct {
+	Version int `json:"version"`
+	Salt string `json:"salt"`
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+	Check *sealed `json:"check"`
+	Secrets map[string]*sealed `json:"secrets"`
+}
+
+type sealed struct {
+	Nonce string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// NewKeystore 创建空的 keystore, Save 之后才写入 path
+func NewKeystore(path, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("keystore %v: empty passphrase", path)
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	ks := &Keystore{
+		path: path,
+		file: keystoreFile{
+			Version: keystoreVersion,
+			Salt: hex.EncodeToString(salt),
+			N: scryptN,
+			R: scryptR,
+			P: scryptP,
+			Secrets: make(map[string]*sealed),
+		},
+	}
+	if err := ks.unlock(passphrase); err != nil {
+		return nil, err
+	}
+	check, err := ks.seal("", passphraseCheck)
+	if err != nil {
+		return nil, err
+	}
+	ks.file.Check = check
+	return ks, nil
+}
+
+// OpenKeystore 打开 keystore 文件, 密码错误时返回错误, 文件不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)
+func OpenKeystore(path, passphrase string) (*Keystore, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open keystore: %w", err)
+	}
+	ks := &Keystore{path: path}
+	if err := json.Unmarshal(b, &ks.file); err != nil {
+		return nil, fmt.Errorf("keystore %v: %v", path, err)
+	}
+	if ks.file.Version != keystoreVersion || ks.file.Check == nil {
+		return nil, fmt.Errorf("keystore %v: unsupported version %v", path, ks.file.Version)
+	}
+	if ks.file.Secrets == nil {
+		ks.file.Secrets = make(map[string]*sealed)
+	}
+	if err := ks.unlock(passphrase); err != nil {
+		return nil, err
+	}
+	if check, err := ks.open("", ks.file.Check); err != nil || check != passphraseCheck {
+		return nil, fmt.Errorf("keystore %v: wrong passphrase", path)
+	}
+	return ks, nil
+}
+
+func (ks *Keystore) unlock(passphrase string) error {
+	salt, err := hex.DecodeString(ks.file.Salt)
+	if err != nil || len(salt) == 0 {
+		return fmt.Errorf("keystore %v: invalid salt", ks.path)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, ks.file.N, ks.file.R, ks.file.P, 32)
+	if err != nil {
+		return fmt.Errorf("keystore %v: %v", ks.path, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	ks.aead, err = cipher.NewGCM(block)
+	return err
+}
+
+func (ks *Keystore) seal(name, value string) (*sealed, error) {
+	nonce := make([]byte, ks.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &sealed{
+		Nonce: hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(ks.aead.Seal(nil, nonce, []byte(value), []byte(name))),
+	}, nil
+}
+
+func (ks *Keystore) open(name string, s *sealed) (string, error) {
+	nonce, err := hex.DecodeString(s.Nonce)
+	if err != nil || len(nonce) != ks.aead.NonceSize() {
+		return "", fmt.Errorf("keystore %v: secret %v has an invalid nonce", ks.path, name)
+	}
+	ciphertext, err := hex.DecodeString(s.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("keystore %v: secret %v has an invalid ciphertext", ks.path, name)
+	}
+	plaintext, err := ks.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("keystore %v: secret %v cannot be decrypted", ks.path, name)
+	}
+	return string(plaintext), nil
+}
+
+// Get 返回名为 name 的 secret, 不存在时返回的错误满足 errors.Is(err, ErrNotFound)
+func (ks *Keystore) Get(name string) (string, error) {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+	s, ok := ks.file.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %v is not in keystore %v", ErrNotFound, name, ks.path)
+	}
+	return ks.open(name, s)
+}
+
+// Put 加入或替换名为 name 的 secret, Save 之后才写入文件
+func (ks *Keystore) Put(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("empty secret name")
+	}
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	s, err := ks.seal(name, value)
+	if err != nil {
+		return err
+	}
+	ks.file.Secrets[name] = s
+	return nil
+}
+
+// Delete 删除名为 name 的 secret
+func (ks *Keystore) Delete(name string) {
+	ks.lock.Lock()
+	delete(ks.file.Secrets, name)
+	ks.lock.Unlock()
+}
+
+// Names 返回所有 secret 的名字, 按名字排序
+func (ks *Keystore) Names() (names []string) {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+	for name := range ks.file.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Save 把 keystore 写入文件, 文件权限是 0600, 先写临时文件再改名, 不会留下写了一半的文件
+func (ks *Keystore) Save() error {
+	ks.lock.RLock()
+	b, err := json.MarshalIndent(&ks.file, "", "  ")
+	ks.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(ks.path), filepath.Base(ks.path) + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ks.path)
+}
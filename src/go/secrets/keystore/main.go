@@ -0,0 +1,65 @@
+// keystore 管理 secrets 的加密 keystore 文件
+// 密码来自环境变量 CRYPTOCOINS_KEYSTORE_PASSPHRASE 或 CRYPTOCOINS_KEYSTORE_PASSPHRASE_FILE
+//	keystore -file keystore.json put NAME < value    加入或替换 secret, 文件不存在时创建
+//	keystore -file keystore.json list                列出 secret 的名字
+//	keystore -file keystore.json delete NAME         删除 secret
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/secrets"
+)
+
+func main() {
+	file := flag.String("file", os.Getenv(secrets.KeystoreEnv), "keystore file")
+	flag.Parse()
+	args := flag.Args()
+	if *file == "" || len(args) == 0 {
+		log.Fatal("usage: keystore -file keystore.json put NAME | list | delete NAME")
+	}
+	passphrase, err := secrets.KeystorePassphrase()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ks, err := secrets.OpenKeystore(*file, passphrase)
+	if errors.Is(err, os.ErrNotExist) {
+		if args[0] != "put" {
+			log.Fatal(err)
+		}
+		ks, err = secrets.NewKeystore(*file, passphrase)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case args[0] == "put" && len(args) == 2:
+		value, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ks.Put(args[1], strings.TrimRight(string(value), "\r\n")); err != nil {
+			log.Fatal(err)
+		}
+		if err := ks.Save(); err != nil {
+			log.Fatal(err)
+		}
+	case args[0] == "list" && len(args) == 1:
+		for _, name := range ks.Names() {
+			fmt.Println(name)
+		}
+	case args[0] == "delete" && len(args) == 2:
+		ks.Delete(args[1])
+		if err := ks.Save(); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown command %v", strings.Join(args, " "))
+	}
+}
@@ -0,0 +1,122 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	ks, err := NewKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenKeystore(path, "passphrase"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v, want os.ErrNotExist before Save", err)
+	}
+	for name, value := range map[string]string{"eth": "0x01", "btc": "cV1", "xrp": ""} {
+		if err := ks.Put(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ks.Delete("xrp")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("got %v, %v, want mode 0600", fi.Mode(), err)
+	}
+
+	ks, err = OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := ks.Names(); !reflect.DeepEqual(names, []string{"btc", "eth"}) {
+		t.Fatalf("got names %v", names)
+	}
+	if v, err := ks.Get("eth"); err != nil || v != "0x01" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if _, err := ks.Get("xrp"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if _, err := OpenKeystore(path, "wrong"); err == nil {
+		t.Fatal("wrong passphrase should fail")
+	}
+}
+
+func TestKeystoreInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	if _, err := NewKeystore(path, ""); err == nil {
+		t.Fatal("empty passphrase should fail")
+	}
+	ks, err := NewKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("", "x"); err == nil {
+		t.Fatal("empty name should fail")
+	}
+	// 名字是附加数据, 换个名字就解不开
+	if err := ks.Put("eth", "0x01"); err != nil {
+		t.Fatal(err)
+	}
+	ks.file.Secrets["btc"] = ks.file.Secrets["eth"]
+	if _, err := ks.Get("btc"); err == nil {
+		t.Fatal("secret moved to another name should not decrypt")
+	}
+}
+
+// 手工构造的 keystore 文件, 密钥用 RFC 7914 的 scrypt 测试向量:
+// P = "password", S = "NaCl", N = 1024, r = 8, p = 16 的前 32 字节
+func TestKeystoreKnownAnswer(t *testing.T) {
+	key, _ := hex.DecodeString("fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162")
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seal := func(nonce byte, name, value string) *sealed {
+		n := make([]byte, aead.NonceSize())
+		n[0] = nonce
+		return &sealed{
+			Nonce: hex.EncodeToString(n),
+			Ciphertext: hex.EncodeToString(aead.Seal(nil, n, []byte(value), []byte(name))),
+		}
+	}
+	b, err := json.Marshal(&keystoreFile{
+		Version: keystoreVersion,
+		Salt: hex.EncodeToString([]byte("NaCl")),
+		N: 1024,
+		R: 8,
+		P: 16,
+		Check: seal(0, "", passphraseCheck),
+		Secrets: map[string]*sealed{"eth": seal(1, "eth", "0x01")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := OpenKeystore(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ks.Get("eth"); err != nil || v != "0x01" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+}
@@ -0,0 +1,175 @@
+// Package secrets 解析网关密码, 私钥等机密配置, 不把它们写在代码和配置文件里
+// 配置文件里的值可以是引用:
+//	env:NAME        环境变量 NAME
+//	file:PATH       文件内容, 如 Docker/K8s 挂载的 secret, 去掉结尾的换行
+//	keystore:NAME   加密 keystore 里的 NAME, 见 Keystore
+//	secret:NAME     按 Lookup 的顺序查找 NAME
+// 其它值原样使用
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound 表示 secret 不存在, 用 errors.Is 判断
+var ErrNotFound = errors.New("secret not found")
+
+const (
+	EnvPrefix = "env:"
+	FilePrefix = "file:"
+	KeystorePrefix = "keystore:"
+	SecretPrefix = "secret:"
+)
+
+// 默认 keystore 的文件和密码, 密码也可以放在 KeystorePassphraseEnv + "_FILE" 指向的文件里
+const (
+	KeystoreEnv = "CRYPTOCOINS_KEYSTORE"
+	KeystorePassphraseEnv = "CRYPTOCOINS_KEYSTORE_PASSPHRASE"
+)
+
+// Lookup 查找的 secret 文件目录, 可以用环境变量 SecretsDirEnv 修改
+const (
+	DefaultSecretsDir = "/run/secrets"
+	SecretsDirEnv = "CRYPTOCOINS_SECRETS_DIR"
+)
+
+// IsRef 判断 value 是否是 secret 引用
+func IsRef(value string) bool {
+	for _, prefix := range []string{EnvPrefix, FilePrefix, KeystorePrefix, SecretPrefix} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve 返回 secret 引用的值, 不是引用的 value 原样返回
+// 引用的 secret 不存在时返回的错误满足 errors.Is(err, ErrNotFound)
+func Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, EnvPrefix):
+		return fromEnv(strings.TrimPrefix(value, EnvPrefix))
+	case strings.HasPrefix(value, FilePrefix):
+		return fromFile(strings.TrimPrefix(value, FilePrefix))
+	case strings.HasPrefix(value, KeystorePrefix):
+		name := strings.TrimPrefix(value, KeystorePrefix)
+		ks, err := DefaultKeystore()
+		if err != nil {
+			return "", fmt.Errorf("secret %v: %w", value, err)
+		}
+		return ks.Get(name)
+	case strings.HasPrefix(value, SecretPrefix):
+		return Lookup(strings.TrimPrefix(value, SecretPrefix))
+	}
+	return value, nil
+}
+
+// Lookup 按名字查找 secret, 依次查找:
+//	环境变量 name
+//	环境变量 name_FILE 指向的文件
+//	secret 目录 (默认 /run/secrets) 下的文件 name
+//	默认 keystore 里的 name
+func Lookup(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty secret name")
+	}
+	if v, ok := os.LookupEnv(name); ok {
+		return v, nil
+	}
+	if path, ok := os.LookupEnv(name + "_FILE"); ok {
+		return fromFile(path)
+	}
+	dir := os.Getenv(SecretsDirEnv)
+	if dir == "" {
+		dir = DefaultSecretsDir
+	}
+	if v, err := fromFile(filepath.Join(dir, filepath.Base(name))); err == nil {
+		return v, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+	ks, err := DefaultKeystore()
+	if errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("%w: %v is not set in the environment, %v or a keystore", ErrNotFound, name, dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret %v: %w", name, err)
+	}
+	return ks.Get(name)
+}
+
+func fromEnv(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%w: environment variable %v is not set", ErrNotFound, name)
+	}
+	return v, nil
+}
+
+func fromFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %v does not exist", ErrNotFound, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+var (
+	keystoreLock sync.Mutex
+	keystore *Keystore
+)
+
+// DefaultKeystore 返回 SetKeystore 设置的 keystore
+// 没有设置时打开环境变量 CRYPTOCOINS_KEYSTORE 指定的文件, 密码来自 CRYPTOCOINS_KEYSTORE_PASSPHRASE
+// 或 CRYPTOCOINS_KEYSTORE_PASSPHRASE_FILE, 没有配置 keystore 时返回的错误满足 errors.Is(err, ErrNotFound)
+func DefaultKeystore() (*Keystore, error) {
+	keystoreLock.Lock()
+	defer keystoreLock.Unlock()
+	if keystore != nil {
+		return keystore, nil
+	}
+	path := os.Getenv(KeystoreEnv)
+	if path == "" {
+		return nil, fmt.Errorf("%w: no keystore, %v is not set", ErrNotFound, KeystoreEnv)
+	}
+	passphrase, err := KeystorePassphrase()
+	if err != nil {
+		return nil, err
+	}
+	ks, err := OpenKeystore(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	keystore = ks
+	return ks, nil
+}
+
+// KeystorePassphrase 返回环境变量 CRYPTOCOINS_KEYSTORE_PASSPHRASE 或 CRYPTOCOINS_KEYSTORE_PASSPHRASE_FILE 指向的文件里的密码
+func KeystorePassphrase() (string, error) {
+	passphrase, err := fromEnv(KeystorePassphraseEnv)
+	if errors.Is(err, ErrNotFound) {
+		if file, ok := os.LookupEnv(KeystorePassphraseEnv + "_FILE"); ok {
+			passphrase, err = fromFile(file)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("keystore passphrase: %v", err)
+	}
+	return passphrase, nil
+}
+
+// SetKeystore 设置 keystore: 引用和 Lookup 使用的 keystore, 传 nil 时重新从环境变量打开
+func SetKeystore(ks *Keystore) {
+	keystoreLock.Lock()
+	keystore = ks
+	keystoreLock.Unlock()
+}
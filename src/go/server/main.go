@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"strconv"
+	"github.com/gaozhengxin/cryptocoins/src/go/address"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
 	api "github.com/gaozhengxin/cryptocoins/src/go"
@@ -17,14 +24,32 @@ func main () {
 	flag.Parse()
 	path := "0.0.0.0:" + *port
 	if configfile != nil {
-		config.LoadApiGateways(*configfile)
+		if err := config.LoadApiGateways(*configfile); err != nil {
+			log.Fatal(err)
+		}
 	}
 	http.HandleFunc("/gettransaction", GetTransaction)
 	http.HandleFunc("/pubkeytoaddress", PubkeyToAddress)
+	http.HandleFunc("/capabilities", Capabilities)
+	http.HandleFunc("/metadata", Metadata)
+	http.HandleFunc("/estimatefee", EstimateFee)
+	http.HandleFunc("/gettransactionstatus", GetTransactionStatus)
+	http.HandleFunc("/getaddresshistory", GetAddressHistory)
+	http.HandleFunc("/validateaddress", ValidateAddress)
+	http.HandleFunc("/deriveaddress", DeriveAddress)
 	go http.ListenAndServe(path, nil)
 	fmt.Printf("service is running on %s\n", path)
 	fmt.Printf("config file is %s\n",*configfile)
-	select{}
+	// 收到 SIGHUP 时重新加载配置文件, 之后的请求使用新的网关, 加载失败时继续使用原来的配置
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := config.LoadApiGateways(*configfile); err != nil {
+			log.Printf("reload config file %s: %v", *configfile, err)
+			continue
+		}
+		log.Printf("reloaded config file %s", *configfile)
+	}
 }
 
 type Resp struct {
@@ -39,32 +64,93 @@ type Resp2 struct {
 	Result PubkeyToAddrResult `json:"result,omitempty"`
 }
 
-var coinlist []string = []string{"BTC","ETH","ERC20BNB","ERC20HT","TRX","XRP"}
+// 所有注册的币种, 见 api.Register
+var coinlist []string = api.RegisteredCoins()
 
 type PubkeyToAddrResult map[string]string
 
+type Resp3 struct {
+	Code string `json:"code"`
+	Msg string `json:"Msg,omitempty"`
+	Result map[string]types.Capabilities `json:"result,omitempty"`
+}
+
+type Resp4 struct {
+	Code string `json:"code"`
+	Msg string `json:"Msg,omitempty"`
+	Result map[string]types.Metadata `json:"result,omitempty"`
+}
+
+type Resp5 struct {
+	Code string `json:"code"`
+	Msg string `json:"Msg,omitempty"`
+	Result *types.FeeEstimate `json:"result,omitempty"`
+}
+
+type Resp6 struct {
+	Code string `json:"code"`
+	Msg string `json:"Msg,omitempty"`
+	Result *types.TxStatus `json:"result,omitempty"`
+}
+
+type Resp7 struct {
+	Code string `json:"code"`
+	Msg string `json:"Msg,omitempty"`
+	Result *types.HistoryPage `json:"result,omitempty"`
+}
+
+type Resp8 struct {
+	Code string `json:"code"`
+	Msg string `json:"Msg,omitempty"`
+	Result *address.Info `json:"result,omitempty"`
+}
+
+type Resp9 struct {
+	Code string `json:"code"`
+	Msg string `json:"Msg,omitempty"`
+	Result *DeriveAddressResult `json:"result,omitempty"`
+}
+
+type DeriveAddressResult struct {
+	Address string `json:"address"`
+	PublicKey string `json:"publicKey"`
+	Path string `json:"path"`
+}
+
 type GetTxResult struct {
 	FromAddress string `json:"FromAddress"`
 	TxOutputs []types.TxOutput `json:"TxOutputs,omitempty"`
 	Err string `json:"Error,omitempty"`
 }
 
+// 可选参数 network, 为空时使用币种的默认网络
+func requestNetwork (request *http.Request) (types.Network, error) {
+	return types.ParseNetwork(request.Form.Get("network"))
+}
+
 func PubkeyToAddress (writer http.ResponseWriter, request *http.Request) {
 	request.ParseForm()
 	pubkey, ok := request.Form["pubkey"]
+	network, nerr := requestNetwork(request)
 	var result Resp2
 	if !ok {
 		result.Code = "401"
 		result.Msg = "require pubkey"
+	} else if nerr != nil {
+		result.Code = "401"
+		result.Msg = nerr.Error()
 	} else {
 		result.Result = make(map[string]string)
 		for _, cointype := range coinlist {
-			h := api.NewCryptocoinHandler(cointype)
+			h, err := api.NewCryptocoinHandlerForNetwork(cointype, network)
+			if err != nil {
+				// 币种不支持这个网络, 跳过
+				continue
+			}
 			address, err := h.PublicKeyToAddress(pubkey[0])
 			if err != nil {
-				result.Code = "500"
-				result.Msg = err.Error()
-				return
+				// 公钥格式不适用于这个币种, 跳过
+				continue
 			}
 			result.Result[cointype] = address
 		}
@@ -76,10 +162,10 @@ func PubkeyToAddress (writer http.ResponseWriter, request *http.Request) {
 }
 
 func GetTransaction (writer http.ResponseWriter, request *http.Request) {
-	fmt.Printf("GetTransaction request %v\n",request)
 	request.ParseForm()
 	txhash, ok1 := request.Form["txhash"]
 	cointype, ok2 := request.Form["cointype"]
+	network, nerr := requestNetwork(request)
 	var result Resp
 	if !ok1 {
 		result.Code = "401"
@@ -87,9 +173,20 @@ func GetTransaction (writer http.ResponseWriter, request *http.Request) {
 	} else if !ok2 {
 		result.Code = "401"
 		result.Msg = "require cointype"
+	} else if nerr != nil {
+		result.Code = "401"
+		result.Msg = nerr.Error()
 	} else {
+		h, err := api.NewCryptocoinHandlerForNetwork(cointype[0], network)
+		if err != nil {
+			result.Code = "401"
+			result.Msg = err.Error()
+			if err := json.NewEncoder(writer).Encode(result); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
 		result.Code = "200"
-		h := api.NewCryptocoinHandler(cointype[0])
 		fromAddress, txOutputs, _, err := h.GetTransactionInfo(txhash[0])
 		result.Result = &GetTxResult{
 			FromAddress: fromAddress,
@@ -103,3 +200,224 @@ func GetTransaction (writer http.ResponseWriter, request *http.Request) {
 		log.Fatal(err)
 	}
 }
+
+// 所有币种的功能矩阵, 可选参数 network
+func Capabilities (writer http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	network, err := requestNetwork(request)
+	var result Resp3
+	if err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else {
+		result.Code = "200"
+		result.Result = api.CoinCapabilities(network)
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 校验地址的格式和校验和, 参数 address, cointype, 可选参数 network
+// 不需要网关, network 为空时接受任意网络的地址
+func ValidateAddress (writer http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	addr := request.Form.Get("address")
+	cointype := request.Form.Get("cointype")
+	network, nerr := requestNetwork(request)
+	var result Resp8
+	if addr == "" {
+		result.Code = "401"
+		result.Msg = "require address"
+	} else if cointype == "" {
+		result.Code = "401"
+		result.Msg = "require cointype"
+	} else if nerr != nil {
+		result.Code = "401"
+		result.Msg = nerr.Error()
+	} else if info, err := api.ValidateAddress(cointype, network, addr); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else {
+		result.Code = "200"
+		result.Result = info
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 从扩展公钥派生地址, 参数 cointype, xpub, path 或者 index (可选 account, change, 默认 0), 可选参数 network
+// 只给 index 时使用币种的 BIP44 路径, xpub 应该是账户公钥 m/44'/coin'/account'
+func DeriveAddress (writer http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	cointype := request.Form.Get("cointype")
+	xpub := request.Form.Get("xpub")
+	path := request.Form.Get("path")
+	network, nerr := requestNetwork(request)
+	var bip44 [3]uint32
+	var perr error
+	for i, name := range []string{"account", "change", "index"} {
+		if v := request.Form.Get(name); v != "" && perr == nil {
+			var n uint64
+			n, perr = strconv.ParseUint(v, 10, 31)
+			bip44[i] = uint32(n)
+		}
+	}
+	var result Resp9
+	if cointype == "" {
+		result.Code = "401"
+		result.Msg = "require cointype"
+	} else if xpub == "" {
+		result.Code = "401"
+		result.Msg = "require xpub"
+	} else if path == "" && request.Form.Get("index") == "" {
+		result.Code = "401"
+		result.Msg = "require path or index"
+	} else if perr != nil {
+		result.Code = "401"
+		result.Msg = "invalid account, change or index"
+	} else if nerr != nil {
+		result.Code = "401"
+		result.Msg = nerr.Error()
+	} else if h, err := api.NewCryptocoinHandlerForNetwork(cointype, network); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else {
+		if path == "" {
+			path, err = api.DerivationPath(h, bip44[0], bip44[1], bip44[2])
+		}
+		var address, pubkey string
+		if err == nil {
+			address, pubkey, err = api.DeriveAddress(h, xpub, path)
+		}
+		if err != nil {
+			result.Code = "401"
+			result.Msg = err.Error()
+		} else {
+			result.Code = "200"
+			result.Result = &DeriveAddressResult{Address: address, PublicKey: pubkey, Path: path}
+		}
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 交易的状态和确认数, 参数 txhash, cointype, 可选参数 network
+func GetTransactionStatus (writer http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	txhash := request.Form.Get("txhash")
+	cointype := request.Form.Get("cointype")
+	network, nerr := requestNetwork(request)
+	var result Resp6
+	if txhash == "" {
+		result.Code = "401"
+		result.Msg = "require txhash"
+	} else if cointype == "" {
+		result.Code = "401"
+		result.Msg = "require cointype"
+	} else if nerr != nil {
+		result.Code = "401"
+		result.Msg = nerr.Error()
+	} else if h, err := api.NewCryptocoinHandlerForNetwork(cointype, network); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else if status, err := api.GetTransactionStatus(context.Background(), h, txhash); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else {
+		result.Code = "200"
+		result.Result = status
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 地址的一页转账历史, 参数 address, cointype, 可选参数 cursor, limit, network
+func GetAddressHistory (writer http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	address := request.Form.Get("address")
+	cointype := request.Form.Get("cointype")
+	network, nerr := requestNetwork(request)
+	page := types.PageRequest{Cursor: request.Form.Get("cursor")}
+	var lerr error
+	if limit := request.Form.Get("limit"); limit != "" {
+		page.Limit, lerr = strconv.Atoi(limit)
+	}
+	var result Resp7
+	if address == "" {
+		result.Code = "401"
+		result.Msg = "require address"
+	} else if cointype == "" {
+		result.Code = "401"
+		result.Msg = "require cointype"
+	} else if lerr != nil {
+		result.Code = "401"
+		result.Msg = "invalid limit"
+	} else if nerr != nil {
+		result.Code = "401"
+		result.Msg = nerr.Error()
+	} else if h, err := api.NewCryptocoinHandlerForNetwork(cointype, network); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else if hist, err := api.GetAddressHistory(context.Background(), h, address, page); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else {
+		result.Code = "200"
+		result.Result = hist
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 一笔转账的三档手续费, 参数 cointype, from, to, amount (最小单位), 可选参数 network
+func EstimateFee (writer http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	cointype := request.Form.Get("cointype")
+	amount, ok := new(big.Int).SetString(request.Form.Get("amount"), 10)
+	network, nerr := requestNetwork(request)
+	var result Resp5
+	if cointype == "" {
+		result.Code = "401"
+		result.Msg = "require cointype"
+	} else if !ok {
+		result.Code = "401"
+		result.Msg = "require amount"
+	} else if nerr != nil {
+		result.Code = "401"
+		result.Msg = nerr.Error()
+	} else if h, err := api.NewCryptocoinHandlerForNetwork(cointype, network); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else if est, err := api.EstimateFee(context.Background(), h, request.Form.Get("from"), request.Form.Get("to"), amount); err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else {
+		result.Code = "200"
+		result.Result = est
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 所有币种的符号, 精度和单位, 可选参数 network
+func Metadata (writer http.ResponseWriter, request *http.Request) {
+	request.ParseForm()
+	network, err := requestNetwork(request)
+	var result Resp4
+	if err != nil {
+		result.Code = "401"
+		result.Msg = err.Error()
+	} else {
+		result.Code = "200"
+		result.Result = api.CoinMetadata(network)
+	}
+	if err := json.NewEncoder(writer).Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
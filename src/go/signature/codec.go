@@ -0,0 +1,165 @@
+package signature
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/eoscanada/eos-go/ecc"
+)
+
+// New 用 ecdsa 签名的 r s 构造 RSV, 把 s 规范化为 low-S, 再用签名公钥算出 recovery id
+func New(r, s *big.Int, digest []byte, pub *btcec.PublicKey) (*RSV, error) {
+	sig := &RSV{R: new(big.Int).Set(r), S: new(big.Int).Set(s)}
+	sig.Normalize()
+	if err := sig.SetRecoveryID(digest, pub); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Normalize 把 s 换成 N - s, 同时翻转 v, 签名仍然有效并且恢复出同一个公钥
+func (sig *RSV) Normalize() *RSV {
+	if !sig.IsLowS() {
+		sig.S = new(big.Int).Sub(curveN, sig.S)
+		sig.V ^= 1
+	}
+	return sig
+}
+
+// SetRecoveryID 依次尝试 v = 0..3, 找到能恢复出 pub 的 v
+func (sig *RSV) SetRecoveryID(digest []byte, pub *btcec.PublicKey) error {
+	if pub == nil {
+		return fmt.Errorf("no public key to compute recovery id")
+	}
+	for v := byte(0); v < 4; v++ {
+		sig.V = v
+		if recovered, err := sig.Recover(digest); err == nil && recovered.IsEqual(pub) {
+			return nil
+		}
+	}
+	sig.V = 0
+	return fmt.Errorf("signature does not match public key %x", pub.SerializeCompressed())
+}
+
+// String 返回 dcrm 格式的 130 位 16 进制 rsv, 不带 0x
+func (sig *RSV) String() string {
+	return hex.EncodeToString(sig.Bytes())
+}
+
+// FromBytes 解析 65 字节的 r s v, v 为 27/28 时减去 27
+func FromBytes(b []byte) (*RSV, error) {
+	if len(b) != 65 {
+		return nil, fmt.Errorf("rsv must be 65 bytes, got %v", len(b))
+	}
+	sig := &RSV{
+		R: new(big.Int).SetBytes(b[:32]),
+		S: new(big.Int).SetBytes(b[32:64]),
+		V: b[64],
+	}
+	if sig.V >= 27 {
+		sig.V -= 27
+	}
+	if sig.V > 3 {
+		return nil, fmt.Errorf("invalid recovery id %v", b[64])
+	}
+	if err := sig.checkRange(); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (sig *RSV) checkRange() error {
+	if sig.R.Sign() <= 0 || sig.R.Cmp(curveN) >= 0 {
+		return fmt.Errorf("r is out of range")
+	}
+	if sig.S.Sign() <= 0 || sig.S.Cmp(curveN) >= 0 {
+		return fmt.Errorf("s is out of range")
+	}
+	return nil
+}
+
+// DER 返回比特币系使用的 DER 编码, btcec 会把 s 规范化为 low-S, 不包含 hashType
+func (sig *RSV) DER() []byte {
+	return (&btcec.Signature{R: sig.R, S: sig.S}).Serialize()
+}
+
+// ParseDER 解析 DER 编码的签名, DER 不带 v, 需要时用 SetRecoveryID 补上
+func ParseDER(der []byte) (*RSV, error) {
+	s, err := btcec.ParseDERSignature(der, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	sig := &RSV{R: s.R, S: s.S}
+	if err := sig.checkRange(); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Compact 返回 eos 和 evt 使用的 65 字节紧凑签名, 第一个字节是 27 + 4 + v (压缩公钥), 然后是 r s
+func (sig *RSV) Compact() []byte {
+	return append([]byte{27 + 4 + sig.V}, append(pad32(sig.R), pad32(sig.S)...)...)
+}
+
+// ParseCompact 解析紧凑签名, 第一个字节可以是 27 + v 或 27 + 4 + v
+func ParseCompact(b []byte) (*RSV, error) {
+	if len(b) != 65 {
+		return nil, fmt.Errorf("compact signature must be 65 bytes, got %v", len(b))
+	}
+	header := b[0]
+	if header < 27 || header >= 27+8 {
+		return nil, fmt.Errorf("invalid compact signature header %v", header)
+	}
+	sig := &RSV{
+		R: new(big.Int).SetBytes(b[1:33]),
+		S: new(big.Int).SetBytes(b[33:]),
+		V: (header - 27) & 3,
+	}
+	if err := sig.checkRange(); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// EOS 返回 eos-go 的 K1 签名, 字符串形式是 SIG_K1_..., evt 节点同样接受
+func (sig *RSV) EOS() (ecc.Signature, error) {
+	return ecc.NewSignatureFromData(append([]byte{byte(ecc.CurveK1)}, sig.Compact()...))
+}
+
+// ParseEOS 解析 eos-go 的 K1 签名
+func ParseEOS(s ecc.Signature) (*RSV, error) {
+	if s.Curve != ecc.CurveK1 {
+		return nil, fmt.Errorf("unsupported signature curve %v", s.Curve)
+	}
+	return ParseCompact(s.Content)
+}
+
+// Ethereum 返回 go-ethereum crypto.Sign 和 Transaction.WithSignature 使用的 65 字节签名, v 只能是 0 或 1
+func (sig *RSV) Ethereum() ([]byte, error) {
+	if sig.V > 1 {
+		return nil, fmt.Errorf("recovery id %v can not be used in ethereum signatures", sig.V)
+	}
+	return sig.Bytes(), nil
+}
+
+// ParseEthereum 解析 r s 和交易里的 v, v 可以是 0/1, 27/28 或者 EIP-155 的 chainId * 2 + 35/36
+func ParseEthereum(r, s, v *big.Int) (*RSV, error) {
+	recid := new(big.Int).Set(v)
+	switch {
+	case v.Cmp(big.NewInt(35)) >= 0:
+		recid.Sub(recid, big.NewInt(35))
+		recid.And(recid, big.NewInt(1))
+	case v.Cmp(big.NewInt(27)) >= 0:
+		recid.Sub(recid, big.NewInt(27))
+	}
+	if recid.Cmp(big.NewInt(1)) > 0 {
+		return nil, fmt.Errorf("invalid v %v", v)
+	}
+	sig := &RSV{R: new(big.Int).Set(r), S: new(big.Int).Set(s), V: byte(recid.Uint64())}
+	if err := sig.checkRange(); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
@@ -0,0 +1,161 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// 私钥为 1, 对 sha256("Satoshi Nakamoto") 的 RFC 6979 签名
+const (
+	katR = "934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8"
+	katS = "2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"
+	katDER = "3045022100" + katR + "0220" + katS
+)
+
+func katKey() (*btcec.PublicKey, []byte) {
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), []byte{1})
+	digest := sha256.Sum256([]byte("Satoshi Nakamoto"))
+	return pub, digest[:]
+}
+
+func hexInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 16)
+	return n
+}
+
+// derInt 按 DER 编码正整数, 不做 low-S 规范化
+func derInt(n *big.Int) []byte {
+	b := n.Bytes()
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return append([]byte{0x02, byte(len(b))}, b...)
+}
+
+func der(r, s *big.Int) []byte {
+	body := append(derInt(r), derInt(s)...)
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+func TestDERKnownAnswer(t *testing.T) {
+	pub, digest := katKey()
+	want, _ := hex.DecodeString(katDER)
+	sig, err := ParseDER(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.R.Cmp(hexInt(katR)) != 0 || sig.S.Cmp(hexInt(katS)) != 0 {
+		t.Fatalf("got r %x s %x", sig.R, sig.S)
+	}
+	if !sig.Verify(digest, pub) {
+		t.Fatal("known answer signature does not verify")
+	}
+	if !bytes.Equal(sig.DER(), want) {
+		t.Fatalf("got DER %x, want %x", sig.DER(), want)
+	}
+	if err := sig.SetRecoveryID(digest, pub); err != nil {
+		t.Fatal(err)
+	}
+	if recovered, err := sig.Recover(digest); err != nil || !recovered.IsEqual(pub) {
+		t.Fatalf("recovered %v, %v", recovered, err)
+	}
+}
+
+func TestDERHighS(t *testing.T) {
+	pub, digest := katKey()
+	r, s := hexInt(katR), new(big.Int).Sub(curveN, hexInt(katS))
+	sig, err := ParseDER(der(r, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.IsLowS() || !sig.Verify(digest, pub) {
+		t.Fatal("high-S input should parse as a valid high-S signature")
+	}
+	if err := sig.SetRecoveryID(digest, pub); err != nil {
+		t.Fatal(err)
+	}
+	v := sig.V
+	// DER 编码输出 low-S
+	want, _ := hex.DecodeString(katDER)
+	if !bytes.Equal(sig.DER(), want) {
+		t.Fatalf("got DER %x, want the low-S encoding %x", sig.DER(), want)
+	}
+	sig.Normalize()
+	if !sig.IsLowS() || sig.S.Cmp(hexInt(katS)) != 0 || sig.V != v^1 {
+		t.Fatalf("Normalize should flip s and v: s %x v %v", sig.S, sig.V)
+	}
+	if recovered, err := sig.Recover(digest); err != nil || !recovered.IsEqual(pub) {
+		t.Fatalf("normalized signature recovered %v, %v", recovered, err)
+	}
+}
+
+func TestNewRoundTrip(t *testing.T) {
+	pub, digest := katKey()
+	// 用 high-S 构造, New 规范化之后仍然恢复出同一个公钥
+	sig, err := New(hexInt(katR), new(big.Int).Sub(curveN, hexInt(katS)), digest, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.IsLowS() {
+		t.Fatal("New should normalize s")
+	}
+
+	parsed, err := ParseRSV("0x" + sig.String())
+	if err != nil || parsed.R.Cmp(sig.R) != 0 || parsed.S.Cmp(sig.S) != 0 || parsed.V != sig.V {
+		t.Fatalf("rsv round trip: %+v, %v", parsed, err)
+	}
+
+	compact := sig.Compact()
+	if compact[0] != 27+4+sig.V {
+		t.Fatalf("compact header %v", compact[0])
+	}
+	parsed, err = ParseCompact(compact)
+	if err != nil || parsed.String() != sig.String() {
+		t.Fatalf("compact round trip: %+v, %v", parsed, err)
+	}
+
+	eth, err := sig.Ethereum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(eth, sig.Bytes()) {
+		t.Fatalf("ethereum signature %x", eth)
+	}
+	for _, v := range []int64{int64(sig.V), 27 + int64(sig.V), 1*2 + 35 + int64(sig.V), 4*2 + 35 + int64(sig.V)} {
+		parsed, err = ParseEthereum(sig.R, sig.S, big.NewInt(v))
+		if err != nil || parsed.V != sig.V {
+			t.Fatalf("v %v: got %+v, %v", v, parsed, err)
+		}
+	}
+}
+
+func TestCodecInvalid(t *testing.T) {
+	rs := append(pad32(hexInt(katR)), pad32(hexInt(katS))...)
+	cases := []struct {
+		name string
+		err error
+	}{
+		{"short rsv", func() error { _, err := FromBytes(rs); return err }()},
+		{"recovery id 4", func() error { _, err := FromBytes(append(rs, 4)); return err }()},
+		{"zero r", func() error { _, err := FromBytes(append(make([]byte, 32), append(pad32(hexInt(katS)), 0)...)); return err }()},
+		{"s = n", func() error { _, err := FromBytes(append(pad32(hexInt(katR)), append(pad32(curveN), 0)...)); return err }()},
+		{"compact header 26", func() error { _, err := ParseCompact(append([]byte{26}, rs...)); return err }()},
+		{"compact header 35", func() error { _, err := ParseCompact(append([]byte{35}, rs...)); return err }()},
+		{"truncated DER", func() error { b, _ := hex.DecodeString(katDER); _, err := ParseDER(b[:len(b)-1]); return err }()},
+		{"ethereum v 29", func() error { _, err := ParseEthereum(hexInt(katR), hexInt(katS), big.NewInt(29)); return err }()},
+	}
+	for _, c := range cases {
+		if c.err == nil {
+			t.Fatalf("%v: want an error", c.name)
+		}
+	}
+	sig := &RSV{R: hexInt(katR), S: hexInt(katS), V: 2}
+	if _, err := sig.Ethereum(); err == nil {
+		t.Fatal("recovery id 2 should not be accepted for ethereum")
+	}
+}
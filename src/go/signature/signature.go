@@ -0,0 +1,192 @@
+// Package signature 解析和校验 dcrm 返回的 rsv 签名, 并在 rsv 和各条链的签名格式之间转换
+package signature
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+var (
+	curveN = btcec.S256().N
+	halfN = new(big.Int).Rsh(btcec.S256().N, 1)
+)
+
+// RSV 是 dcrm 返回的 65 字节签名, r 和 s 各 32 字节, v 是 recovery id
+type RSV struct {
+	R *big.Int
+	S *big.Int
+	V byte
+}
+
+// ParseRSV 解析 16 进制的 rsv, 可以带 0x 前缀, v 为 27/28 时减去 27
+func ParseRSV(rsv string) (*RSV, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(rsv, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("rsv is not hex: %v", err)
+	}
+	return FromBytes(b)
+}
+
+// IsLowS 返回 S <= N/2
+func (sig *RSV) IsLowS() bool {
+	return sig.S.Cmp(halfN) <= 0
+}
+
+// IsEOSCanonical 是 eos 和 evt 节点的 is_canonical 规则:
+// r 和 s 的 32 字节编码最高位为 0, 并且转成 DER 时不需要去掉前导 0
+func (sig *RSV) IsEOSCanonical() bool {
+	r, s := pad32(sig.R), pad32(sig.S)
+	return r[0]&0x80 == 0 && !(r[0] == 0 && r[1]&0x80 == 0) &&
+		s[0]&0x80 == 0 && !(s[0] == 0 && s[1]&0x80 == 0)
+}
+
+// Verify 用 ecdsa 校验签名, 不检查 v
+func (sig *RSV) Verify(digest []byte, pub *btcec.PublicKey) bool {
+	return (&btcec.Signature{R: sig.R, S: sig.S}).Verify(digest, pub)
+}
+
+// Recover 用 v 从签名中恢复公钥
+func (sig *RSV) Recover(digest []byte) (*btcec.PublicKey, error) {
+	compact := make([]byte, 65)
+	compact[0] = 27 + sig.V
+	copy(compact[1:33], pad32(sig.R))
+	copy(compact[33:], pad32(sig.S))
+	pub, _, err := btcec.RecoverCompact(btcec.S256(), compact, digest)
+	return pub, err
+}
+
+// Bytes 返回 65 字节的 r s v, v 是 0 到 3
+func (sig *RSV) Bytes() []byte {
+	return append(append(pad32(sig.R), pad32(sig.S)...), sig.V)
+}
+
+func pad32(n *big.Int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// Rules 是链对签名的要求
+type Rules struct {
+	// 只接受 S <= N/2 的签名, 组装时会把 S 规范化的链 (比特币系的 DER 编码) 不需要
+	LowS bool
+	// 链用 v 恢复签名者 (eth, tron, eos, evt, vechain), v 恢复出的公钥必须是签名者
+	Recovery bool
+	// eos 和 evt 的 canonical 规则, 见 IsEOSCanonical
+	EOSCanonical bool
+}
+
+// Check 校验第 index 个签名 rsv 是 pub 对 digest 的签名并且满足 rules
+// 失败返回 *types.SignatureError
+func Check(index int, rsv string, digest []byte, pub *btcec.PublicKey, rules Rules) (sig *RSV, err error) {
+	defer func() {
+		if err != nil {
+			sig, err = nil, &types.SignatureError{Index: index, Err: err}
+		}
+	}()
+	if pub == nil {
+		return nil, fmt.Errorf("no public key to verify against")
+	}
+	if sig, err = parse(rsv, digest, rules); err != nil {
+		return
+	}
+	if !rules.Recovery {
+		if !sig.Verify(digest, pub) {
+			return nil, fmt.Errorf("signature does not match public key %x", pub.SerializeCompressed())
+		}
+		return
+	}
+	recovered, err := sig.Recover(digest)
+	if err != nil {
+		return nil, fmt.Errorf("recover public key error: %v", err)
+	}
+	if !recovered.IsEqual(pub) {
+		return nil, fmt.Errorf("recovered public key %x, want %x", recovered.SerializeCompressed(), pub.SerializeCompressed())
+	}
+	return
+}
+
+// CheckSigner 同 Check, 用于只知道签名者地址的链, 用 v 恢复公钥, signer 判断公钥是不是签名者
+func CheckSigner(index int, rsv string, digest []byte, signer func(*btcec.PublicKey) bool, rules Rules) (sig *RSV, err error) {
+	defer func() {
+		if err != nil {
+			sig, err = nil, &types.SignatureError{Index: index, Err: err}
+		}
+	}()
+	if sig, err = parse(rsv, digest, rules); err != nil {
+		return
+	}
+	recovered, err := sig.Recover(digest)
+	if err != nil {
+		return nil, fmt.Errorf("recover public key error: %v", err)
+	}
+	if !signer(recovered) {
+		return nil, fmt.Errorf("recovered public key %x is not the signer", recovered.SerializeCompressed())
+	}
+	return
+}
+
+func parse(rsv string, digest []byte, rules Rules) (*RSV, error) {
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("digest must be 32 bytes, got %v", len(digest))
+	}
+	sig, err := ParseRSV(rsv)
+	if err != nil {
+		return nil, err
+	}
+	if rules.LowS && !sig.IsLowS() {
+		return nil, fmt.Errorf("s is not low-S")
+	}
+	if rules.EOSCanonical && !sig.IsEOSCanonical() {
+		return nil, fmt.Errorf("signature is not canonical")
+	}
+	return sig, nil
+}
+
+// ParsePublicKey 解析 16 进制的公钥, 可以带 0x 前缀
+// 接受 33 字节压缩公钥, 65 字节非压缩公钥和 64 字节不带 04 前缀的 x y, 并检查是曲线上的点
+// 失败返回的错误满足 errors.Is(err, types.ErrInvalidPublicKey)
+func ParsePublicKey(pubKeyHex string) (*btcec.PublicKey, error) {
+	b, err := decodePublicKey(pubKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := btcec.ParsePubKey(b, btcec.S256())
+	if err != nil {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "%v: %v", pubKeyHex, err)
+	}
+	return pub, nil
+}
+
+// NormalizePublicKey 检查公钥并返回不带 0x 的 16 进制编码
+// 压缩公钥保持压缩, 64 字节的公钥补上 04 前缀, 用于地址和公钥编码有关的链 (eos 账户名)
+func NormalizePublicKey(pubKeyHex string) (string, error) {
+	pub, err := ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return "", err
+	}
+	b, _ := decodePublicKey(pubKeyHex)
+	if len(b) == btcec.PubKeyBytesLenCompressed {
+		return hex.EncodeToString(pub.SerializeCompressed()), nil
+	}
+	return hex.EncodeToString(pub.SerializeUncompressed()), nil
+}
+
+func decodePublicKey(pubKeyHex string) ([]byte, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(pubKeyHex, "0x"), "0X")
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, types.Errorf(types.ErrInvalidPublicKey, "public key is not hex: %v", err)
+	}
+	switch len(b) {
+	case btcec.PubKeyBytesLenCompressed, btcec.PubKeyBytesLenUncompressed:
+		return b, nil
+	case 64:
+		return append([]byte{0x04}, b...), nil
+	}
+	return nil, types.Errorf(types.ErrInvalidPublicKey, "public key must be 33, 64 or 65 bytes, got %v", len(b))
+}
@@ -0,0 +1,203 @@
+package trx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	tcrypto "github.com/gaozhengxin/cryptocoins/src/go/trx/crypto"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 交易的过期时间从引用区块的时间算起, 和 createtransaction 的默认值相同
+var TxExpiration = 60 * time.Second
+
+const transferContractTypeURL = "type.googleapis.com/protocol.TransferContract"
+
+// FetchChainState 查询最新区块作为交易的引用区块
+func (h *TRXHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if err := opts.Check("TRX", SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	ref, err := h.nowBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state := types.NewChainState("TRX", h.network.String())
+	state.RefBlock = ref
+	return state, nil
+}
+
+// Assemble 在本地编码 TransferContract 交易, txID 是 raw_data protobuf 编码的 sha256, 不访问网络
+func (h *TRXHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	if err = state.Check("TRX", h.network.String()); err != nil {
+		return
+	}
+	if err = opts.Check("TRX", SupportedBuildOptions...); err != nil {
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	if len(outputs) != 1 {
+		err = fmt.Errorf("TRX: %w", types.ErrBatchNotSupported)
+		return
+	}
+	if state.RefBlock == nil {
+		err = types.MissingStateError("ref block")
+		return
+	}
+	owner, err := decodeAddress(fromAddress)
+	if err != nil {
+		return
+	}
+	to, err := decodeAddress(outputs[0].ToAddress)
+	if err != nil {
+		return
+	}
+	if !outputs[0].Amount.IsInt64() {
+		err = fmt.Errorf("invalid amount %v", outputs[0].Amount)
+		return
+	}
+	tx, err := newTransferTransaction(owner, to, outputs[0].Amount.Int64(), state.RefBlock)
+	if err != nil {
+		return
+	}
+	transaction = tx
+	digests = append(digests, tx.TxID)
+	return
+}
+
+// 返回最新区块的高度, id 和时间
+func (h *TRXHandler) nowBlock(ctx context.Context) (*types.RefBlock, error) {
+	ret, err := h.call(ctx, "wallet/getnowblock", nil)
+	if err != nil {
+		return nil, err
+	}
+	var blk struct {
+		BlockID string `json:"blockID"`
+		BlockHeader struct {
+			RawData struct {
+				Number uint64 `json:"number"`
+				// 毫秒
+				Timestamp int64 `json:"timestamp"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+	}
+	if err := json.Unmarshal([]byte(ret), &blk); err != nil || blk.BlockID == "" {
+		return nil, types.Errorf(types.ErrGatewayUnavailable, "getnowblock error: %v", ret)
+	}
+	return &types.RefBlock{
+		Number: blk.BlockHeader.RawData.Number,
+		ID: blk.BlockID,
+		Timestamp: blk.BlockHeader.RawData.Timestamp / 1000,
+	}, nil
+}
+
+// decodeAddress 把 base58check 或 16 进制的地址转成 21 字节的地址
+func decodeAddress(address string) ([]byte, error) {
+	var b []byte
+	var err error
+	if len(address) == 42 {
+		b, err = hex.DecodeString(address)
+	} else {
+		b, err = tcrypto.Base58Decode(address, ALPHABET)
+		if err == nil && len(b) == 25 {
+			// 去掉 4 字节校验和
+			b = b[:21]
+		}
+	}
+	if err != nil {
+		return nil, types.Errorf(types.ErrInvalidAddress, "invalid address %v: %v", address, err)
+	}
+	if len(b) != 21 || b[0] != prefix {
+		return nil, types.Errorf(types.ErrInvalidAddress, "invalid address %v", address)
+	}
+	return b, nil
+}
+
+// newTransferTransaction 构造和 createtransaction 相同的交易, raw_data 的 json 用来广播, protobuf 编码用来计算 txID
+func newTransferTransaction(owner, to []byte, amount int64, ref *types.RefBlock) (*Transaction, error) {
+	blockID, err := hex.DecodeString(ref.ID)
+	if err != nil || len(blockID) != 32 {
+		return nil, fmt.Errorf("invalid ref block id %v", ref.ID)
+	}
+	var num [8]byte
+	binary.BigEndian.PutUint64(num[:], ref.Number)
+	refBlockBytes := num[6:8]
+	refBlockHash := blockID[8:16]
+	timestamp := ref.Timestamp * 1000
+	expiration := timestamp + int64(TxExpiration/time.Millisecond)
+
+	var transfer []byte
+	transfer = pbBytes(transfer, 1, owner)
+	transfer = pbBytes(transfer, 2, to)
+	transfer = pbVarint(transfer, 3, uint64(amount))
+	// google.protobuf.Any
+	var param []byte
+	param = pbBytes(param, 1, []byte(transferContractTypeURL))
+	param = pbBytes(param, 2, transfer)
+	var contract []byte
+	// ContractType TransferContract = 1
+	contract = pbVarint(contract, 1, 1)
+	contract = pbBytes(contract, 2, param)
+	var raw []byte
+	raw = pbBytes(raw, 1, refBlockBytes)
+	raw = pbBytes(raw, 4, refBlockHash)
+	raw = pbVarint(raw, 8, uint64(expiration))
+	raw = pbBytes(raw, 11, contract)
+	raw = pbVarint(raw, 14, uint64(timestamp))
+	txID := sha256.Sum256(raw)
+
+	return &Transaction{
+		TxID: hex.EncodeToString(txID[:]),
+		Raw_data: RawData{
+			Contract: []Contract{map[string]interface{}{
+				"parameter": map[string]interface{}{
+					"value": map[string]interface{}{
+						"amount": amount,
+						"owner_address": hex.EncodeToString(owner),
+						"to_address": hex.EncodeToString(to),
+					},
+					"type_url": transferContractTypeURL,
+				},
+				"type": TRANSFER_CONTRACT,
+			}},
+			Ref_block_bytes: hex.EncodeToString(refBlockBytes),
+			Ref_block_hash: hex.EncodeToString(refBlockHash),
+			Expiration: expiration,
+			Timestamp: timestamp,
+		},
+	}, nil
+}
+
+// protobuf 编码, 只用到 varint 和 length-delimited 两种类型
+func uvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func pbVarint(b []byte, field, v uint64) []byte {
+	return uvarint(uvarint(b, field<<3), v)
+}
+
+func pbBytes(b []byte, field uint64, data []byte) []byte {
+	b = uvarint(uvarint(b, field<<3|2), uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,82 @@
+package trx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// TransferBandwidth 一笔 TRX 转账大约占用的带宽 (字节)
+var TransferBandwidth int64 = 270
+
+// EstimateFee 估计手续费 (sun)
+// TRX 转账只消耗带宽不消耗能量, fromAddress 剩余的免费带宽和质押带宽足够时手续费为 0,
+// 否则按 getchainparameters 的 getTransactionFee 燃烧 TRX. 三档相同, 节点不可用时是 TRX_DEFAULT_FEE
+func (h *TRXHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	fromAddress, err := hexAddress(fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	bandwidth, err := h.freeBandwidth(ctx, fromAddress)
+	if err != nil {
+		return types.FixedFeeEstimate(TRX_DEFAULT_FEE, true), nil
+	}
+	if bandwidth >= TransferBandwidth {
+		return types.FixedFeeEstimate(big.NewInt(0), false), nil
+	}
+	price, err := h.bandwidthPrice(ctx)
+	if err != nil {
+		return types.FixedFeeEstimate(TRX_DEFAULT_FEE, true), nil
+	}
+	fee := new(big.Int).Mul(big.NewInt(TransferBandwidth), price)
+	est := types.FixedFeeEstimate(fee, false)
+	est.Slow.FeeRate, est.Normal.FeeRate, est.Fast.FeeRate = price, price, price
+	return est, nil
+}
+
+// freeBandwidth 返回 address 可用的免费带宽和质押带宽
+func (h *TRXHandler) freeBandwidth(ctx context.Context, address string) (int64, error) {
+	ret, err := h.call(ctx, "wallet/getaccountresource", map[string]string{"address": address})
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		FreeNetLimit int64 `json:"freeNetLimit"`
+		FreeNetUsed int64 `json:"freeNetUsed"`
+		NetLimit int64 `json:"NetLimit"`
+		NetUsed int64 `json:"NetUsed"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return 0, err
+	}
+	return res.FreeNetLimit - res.FreeNetUsed + res.NetLimit - res.NetUsed, nil
+}
+
+// bandwidthPrice 返回每字节带宽燃烧的 sun
+func (h *TRXHandler) bandwidthPrice(ctx context.Context) (*big.Int, error) {
+	ret, err := h.call(ctx, "wallet/getchainparameters", nil)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		ChainParameter []struct {
+			Key string `json:"key"`
+			Value int64 `json:"value"`
+		} `json:"chainParameter"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return nil, err
+	}
+	for _, p := range res.ChainParameter {
+		if p.Key == "getTransactionFee" {
+			return big.NewInt(p.Value), nil
+		}
+	}
+	return nil, fmt.Errorf("getTransactionFee not found: %v", ret)
+}
@@ -0,0 +1,148 @@
+package trx
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	tcrypto "github.com/gaozhengxin/cryptocoins/src/go/trx/crypto"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// GetAddressHistory 用 solidity 节点的 gettransactionsfromthis 和 gettransactionstothis 查询地址的 TRX 转账
+// 两个列表按时间合并, 游标是两个列表各自的 offset, 形如 "20,3"
+func (h *TRXHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	address, err := hexAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	var fromOffset, toOffset int
+	if page.Cursor != "" {
+		if _, err := fmt.Sscanf(page.Cursor, "%d,%d", &fromOffset, &toOffset); err != nil {
+			return nil, fmt.Errorf("invalid cursor %v", page.Cursor)
+		}
+	}
+	limit := page.PageLimit()
+	// 多取一条, 用来判断是否还有下一页
+	outs, err := h.accountTransactions(ctx, "walletextension/gettransactionsfromthis", address, fromOffset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	ins, err := h.accountTransactions(ctx, "walletextension/gettransactionstothis", address, toOffset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	ret := &types.HistoryPage{}
+	i, j := 0, 0
+	for len(ret.Transfers) < limit && (i < len(outs) || j < len(ins)) {
+		var tx *Transaction
+		var dir types.Direction
+		if j >= len(ins) || (i < len(outs) && outs[i].Raw_data.Timestamp >= ins[j].Raw_data.Timestamp) {
+			tx, dir = outs[i], types.DirectionOut
+			i++
+		} else {
+			tx, dir = ins[j], types.DirectionIn
+			j++
+		}
+		t, ok := transferOf(tx, dir)
+		if !ok {
+			continue
+		}
+		if err := h.fillBlock(ctx, &t); err != nil {
+			return nil, err
+		}
+		ret.Transfers = append(ret.Transfers, t)
+	}
+	if i < len(outs) || j < len(ins) {
+		ret.NextCursor = fmt.Sprintf("%d,%d", fromOffset+i, toOffset+j)
+	}
+	return ret, nil
+}
+
+// 把 base58 地址转成节点接口使用的 hex 地址
+func hexAddress(address string) (string, error) {
+	if len(address) == 42 {
+		return address, nil
+	}
+	b, err := tcrypto.Base58Decode(address, ALPHABET)
+	if err != nil {
+		return "", types.Errorf(types.ErrInvalidAddress, "invalid address %v: %v", address, err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (h *TRXHandler) accountTransactions(ctx context.Context, api, address string, offset, limit int) ([]*Transaction, error) {
+	req := map[string]interface{}{
+		"account": map[string]string{"address": address},
+		"offset": offset,
+		"limit": limit,
+	}
+	ret, err := h.call(ctx, api, req)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Transaction []*Transaction `json:"transaction"`
+		Error string `json:"Error"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return nil, types.Errorf(types.ErrGatewayUnavailable, "%v error: %v", api, ret)
+	}
+	if res.Error != "" {
+		return nil, types.ClassifyError(fmt.Errorf("%v", res.Error))
+	}
+	return res.Transaction, nil
+}
+
+// 只列出 TransferContract, 其他合约返回 false
+func transferOf(tx *Transaction, dir types.Direction) (t types.Transfer, ok bool) {
+	if len(tx.Raw_data.Contract) == 0 {
+		return
+	}
+	contract, _ := tx.Raw_data.Contract[0].(map[string]interface{})
+	if contract == nil || contract["type"] != "TransferContract" {
+		return
+	}
+	param, _ := contract["parameter"].(map[string]interface{})
+	value, _ := param["value"].(map[string]interface{})
+	amount, _ := value["amount"].(float64)
+	owner, _ := value["owner_address"].(string)
+	to, _ := value["to_address"].(string)
+	t = types.Transfer{
+		TxHash: tx.TxID,
+		Direction: dir,
+		Counterparty: to,
+		Amount: big.NewInt(int64(amount)),
+		Timestamp: tx.Raw_data.Timestamp / 1000,
+	}
+	if dir == types.DirectionIn {
+		t.Counterparty = owner
+	}
+	return t, true
+}
+
+// 用 gettransactioninfobyid 补上区块高度和出块时间
+func (h *TRXHandler) fillBlock(ctx context.Context, t *types.Transfer) error {
+	ret, err := h.call(ctx, "walletsolidity/gettransactioninfobyid", map[string]string{"value": t.TxHash})
+	if err != nil {
+		return err
+	}
+	var info struct {
+		BlockNumber uint64 `json:"blockNumber"`
+		BlockTimeStamp int64 `json:"blockTimeStamp"`
+	}
+	if err := json.Unmarshal([]byte(ret), &info); err != nil {
+		return types.Errorf(types.ErrGatewayUnavailable, "gettransactioninfobyid error: %v", ret)
+	}
+	t.BlockHeight = info.BlockNumber
+	if info.BlockTimeStamp > 0 {
+		t.Timestamp = info.BlockTimeStamp / 1000
+	}
+	return nil
+}
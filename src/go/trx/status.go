@@ -0,0 +1,94 @@
+package trx
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 超级代表出 19 个块后区块固化 (solidified), 不会再被回滚
+var FinalityConfirmations uint64 = 19
+
+// GetTransactionStatus 用 wallet/gettransactioninfobyid 查询交易所在的区块
+// 执行失败的合约调用也会上链, 这时是 TxFailed
+func (h *TRXHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	threshold := FinalityConfirmations
+	req := map[string]string{"value": txhash}
+	ret, err := h.call(ctx, "wallet/gettransactioninfobyid", req)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Id string `json:"id"`
+		BlockNumber uint64 `json:"blockNumber"`
+		Result string `json:"result"`
+		Receipt struct {
+			Result string `json:"result"`
+		} `json:"receipt"`
+	}
+	if err := json.Unmarshal([]byte(ret), &info); err != nil {
+		return nil, err
+	}
+	if info.Id == "" {
+		// 还没有上链, 看节点是否收到了这笔交易
+		if ret, err = h.call(ctx, "wallet/gettransactionbyid", req); err != nil {
+			return nil, err
+		}
+		tx := &Transaction{}
+		if tx.UnmarshalJson(ret) == nil && tx.TxID != "" {
+			return types.MempoolTxStatus(txhash, threshold), nil
+		}
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	best, err := h.nowBlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blockID, err := h.blockID(ctx, info.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	status := types.IncludedTxStatus(txhash, info.BlockNumber, blockID, types.Confirmations(info.BlockNumber, best), threshold)
+	if info.Result == "FAILED" || (info.Receipt.Result != "" && info.Receipt.Result != "SUCCESS") {
+		status.State = types.TxFailed
+	}
+	return status, nil
+}
+
+// 返回最新区块的高度
+func (h *TRXHandler) nowBlockNumber(ctx context.Context) (uint64, error) {
+	ret, err := h.call(ctx, "wallet/getnowblock", nil)
+	if err != nil {
+		return 0, err
+	}
+	var blk struct {
+		BlockHeader struct {
+			RawData struct {
+				Number uint64 `json:"number"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+	}
+	if err := json.Unmarshal([]byte(ret), &blk); err != nil || blk.BlockHeader.RawData.Number == 0 {
+		return 0, types.Errorf(types.ErrGatewayUnavailable, "getnowblock error: %v", ret)
+	}
+	return blk.BlockHeader.RawData.Number, nil
+}
+
+// 返回高度为 num 的区块的 id
+func (h *TRXHandler) blockID(ctx context.Context, num uint64) (string, error) {
+	ret, err := h.call(ctx, "wallet/getblockbynum", map[string]uint64{"num": num})
+	if err != nil {
+		return "", err
+	}
+	var blk struct {
+		BlockID string `json:"blockID"`
+	}
+	if err := json.Unmarshal([]byte(ret), &blk); err != nil || blk.BlockID == "" {
+		return "", types.Errorf(types.ErrGatewayUnavailable, "getblockbynum error: %v", ret)
+	}
+	return blk.BlockID, nil
+}
@@ -1,6 +1,9 @@
 package trx
 
 import (
+	"bytes"
+	"context"
+	"time"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -8,27 +11,69 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"runtime/debug"
+	"strings"
 
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/ethereum/go-ethereum/crypto"
 	tcrypto "github.com/gaozhengxin/cryptocoins/src/go/trx/crypto"
 
 	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
 var (
-	URL = config.ApiGateways.TronGateway.ApiAddress
 	ALPHABET = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
-	prefix = byte(0x41)  // MainNet
+	// mainnet 和 shasta testnet 的地址前缀都是 0x41
+	prefix = byte(0x41)
 	//prefix = byte(0xA0)
 	TRANSFER_CONTRACT = "TransferContract"
 )
 
-type TRXHandler struct {}
+// 默认网络
+const DefaultNetwork = types.Testnet
+
+var networks = map[types.Network]bool{
+	types.Mainnet: true,
+	types.Testnet: true,
+}
+
+type TRXHandler struct {
+	network types.Network
+	url string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
+}
 
 func NewTRXHandler() *TRXHandler {
-	return &TRXHandler{}
+	h, _ := NewTRXHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewTRXHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewTRXHandlerForNetwork (network types.Network) (*TRXHandler, error) {
+	return NewTRXHandlerFromConfig(network, config.Current())
+}
+
+// NewTRXHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 TronGateway
+func NewTRXHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*TRXHandler, error) {
+	network = network.Or(DefaultNetwork)
+	if !networks[network] {
+		return nil, types.UnsupportedNetworkError("TRX", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).TronGateway
+	rpcutils.RegisterApiGateway(gateway, nil, gateways.HealthCheckInterval())
+	return &TRXHandler{
+		network: network,
+		url: gateway.ApiAddress,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *TRXHandler) Network() types.Network {
+	return h.network
 }
 
 var TRX_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -47,43 +92,59 @@ func (h *TRXHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 }
 
 func (h *TRXHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	if len(fromAddress) != 42 {
-		b, err1 := tcrypto.Base58Decode(fromAddress, ALPHABET)
-		if err1 != nil {
-			err = err1
-			return
-		}
-		fromAddress = hex.EncodeToString(b)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *TRXHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
 	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
 
-	if len(toAddress) != 42 {
-		b, err2 := tcrypto.Base58Decode(toAddress, ALPHABET)
-		if err2 != nil {
-			err = err2
-			return
-		}
-		toAddress = hex.EncodeToString(b)
+var SupportedBuildOptions = []string{}
+
+func (h *TRXHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *TRXHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: true,
+		Balance: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			return networks[n]
+		}),
+		Network: h.network,
 	}
+}
 
-	tf := &Transfer{
-		Amount: amount,
-		Owner_address: fromAddress,
-		To_address: toAddress,
+func (h *TRXHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "TRX",
+		Decimals: 6,
+		SLIP44: 195,
+		AddressFormat: types.AddressTron,
+		SmallestUnit: "sun",
 	}
+}
 
-	tfJson, err := tf.MarshalJSON()
+func (h *TRXHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	outputs := []types.TxOutput{{ToAddress: toAddress, Amount: amount}}
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
 	if err != nil {
-		panic(err.Error())
+		return
 	}
-
-	ret := rpcutils.DoCurlRequest(URL, "wallet/createtransaction", tfJson)
-
-	transaction = &Transaction{}
-	err = transaction.(*Transaction).UnmarshalJson(ret)
-
-	digest := transaction.(*Transaction).TxID
-	digests = append(digests, digest)
-	return
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
 }
 
 func (h *TRXHandler) SignTransaction(hash []string, privateKey interface{}) (rsv []string, err error) {
@@ -91,60 +152,151 @@ func (h *TRXHandler) SignTransaction(hash []string, privateKey interface{}) (rsv
 	if err != nil {
 		return
 	}
-	for i := 0; i < 10; i++ {
-		r, s, err1 := ecdsa.Sign(rand.Reader, privateKey.(*ecdsa.PrivateKey), hashBytes)
-		if err1 != nil {
-			err = err1
-			return
-		}
-		rx := fmt.Sprintf("%x", r)
-		sx := fmt.Sprintf("%x", s)
-		if isCanonical(&privateKey.(*ecdsa.PrivateKey).PublicKey, s) {
-			rsv = append(rsv, rx + sx + "00")
-			break
-		}
-		if i == 24 {
-			err = fmt.Errorf("couldn't find a canonical signature")
-			return
-		}
+	key := privateKey.(*ecdsa.PrivateKey)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hashBytes)
+	if err != nil {
+		return
 	}
+	// New 把 s 规范化成 low S 并算出 v
+	sig, err := signature.New(r, s, hashBytes, (*btcec.PublicKey)(&key.PublicKey))
+	if err != nil {
+		return
+	}
+	rsv = append(rsv, sig.String())
 	return
 }
 
+// MakeSignedTransaction 校验签名是 owner_address 对 txID 的签名, 失败返回 *types.SignatureError
 func (h *TRXHandler) MakeSignedTransaction (rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
-	signedTransaction = transaction
-	signedTransaction.(*Transaction).Signature = rsv[0]
+	tx, ok := transaction.(*Transaction)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", transaction)
+		return
+	}
+	if len(rsv) != 1 {
+		err = fmt.Errorf("expect 1 signature, got %v", len(rsv))
+		return
+	}
+	digest, err := hex.DecodeString(tx.TxID)
+	if err != nil {
+		err = fmt.Errorf("invalid txID %v: %v", tx.TxID, err)
+		return
+	}
+	owner, err := tx.ownerAddress()
+	if err != nil {
+		return
+	}
+	// tron 节点用 v 恢复签名者
+	sig, err := signature.CheckSigner(0, rsv[0], digest, func(pub *btcec.PublicKey) bool {
+		addr := append([]byte{prefix}, crypto.PubkeyToAddress(*pub.ToECDSA()).Bytes()...)
+		return strings.EqualFold(owner, hex.EncodeToString(addr))
+	}, signature.Rules{LowS: true, Recovery: true})
+	if err != nil {
+		return
+	}
+	signedTx := *tx
+	signedTx.Signature = sig.String()
+	signedTransaction = &signedTx
 	return
 }
 
+func (h *TRXHandler) MakeSignedTransactionContext (ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *TRXHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
-	req, err := signedTransaction.(*Transaction).MarshalJson()
-	ret := rpcutils.DoCurlRequest(URL, "wallet/broadcasttransaction", req)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *TRXHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	stx, ok := signedTransaction.(*Transaction)
+	if !ok {
+		err = fmt.Errorf("unexpected signed transaction type %T", signedTransaction)
+		return
+	}
+	req, err := stx.MarshalJson()
+	if err != nil {
+		return
+	}
+	ret, err := h.call(ctx, "wallet/broadcasttransaction", json.RawMessage(req))
+	if err != nil {
+		return
+	}
 	var result interface{}
 	err = json.Unmarshal([]byte(ret), &result)
 	if err != nil {
-		panic(err.Error())
+		err = types.ClassifyError(fmt.Errorf("broadcast error: %v", ret))
+		return
 	}
 	if ok := result.(map[string]interface{})["result"]; ok != nil && ok.(bool) == true {
-		txhash = signedTransaction.(*Transaction).TxID
-		ret = fmt.Sprintf("success/%v", signedTransaction.(*Transaction).TxID)
+		txhash = stx.TxID
+		ret = fmt.Sprintf("success/%v", stx.TxID)
+	} else {
+		err = broadcastError(result.(map[string]interface{}))
 	}
 	return
 }
 
+// call 把 req 编码成 json POST 到 api, req 为 nil 时不带请求内容
+func (h *TRXHandler) call(ctx context.Context, api string, req interface{}) (string, error) {
+	var data []byte
+	if req != nil {
+		var err error
+		if data, err = json.Marshal(req); err != nil {
+			return "", err
+		}
+	}
+	ret, err := rpcutils.PostJSON(ctx, h.url, api, string(data))
+	return string(ret), err
+}
+
+// 广播失败的错误码, 其他错误码根据 message 分类
+var broadcastErrorKinds = map[string]error{
+	"DUP_TRANSACTION_ERROR": types.ErrAlreadyKnown,
+	"BANDWITH_ERROR": types.ErrInsufficientFunds,
+	"SERVER_BUSY": types.ErrGatewayUnavailable,
+	"NO_CONNECTION": types.ErrGatewayUnavailable,
+	"NOT_ENOUGH_EFFECTIVE_CONNECTION": types.ErrGatewayUnavailable,
+}
+
+// result 形如 {"code":"CONTRACT_VALIDATE_ERROR","message":"<hex>"}
+func broadcastError(result map[string]interface{}) error {
+	code, _ := result["code"].(string)
+	message, _ := result["message"].(string)
+	if b, err := hex.DecodeString(message); err == nil {
+		message = string(b)
+	}
+	err := fmt.Errorf("broadcast error: %v, %v", code, message)
+	if kind, ok := broadcastErrorKinds[code]; ok {
+		return types.WrapError(kind, err)
+	}
+	return types.ClassifyError(err)
+}
+
 func (h *TRXHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	data, err := json.Marshal(struct{
-		Value string `json:"value"`
-	}{
-		Value: txhash,
-	})
-	reqData := string(data)
-	ret := rpcutils.DoPostRequest(URL, "walletsolidity/gettransactionbyid", reqData)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *TRXHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	ret, err := h.call(ctx, "walletsolidity/gettransactionbyid", map[string]string{"value": txhash})
+	if err != nil {
+		return
+	}
 	tx := &Transaction{}
 	tx.UnmarshalJson(ret)
 
 	if len(tx.Raw_data.Contract) == 0 {
-		err = fmt.Errorf("Transaction not found")
+		err = types.Errorf(types.ErrNotFound, "transaction %v not found", txhash)
 		return
 	}
 
@@ -162,15 +314,23 @@ func (h *TRXHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 }
 
 func (h *TRXHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	reqData := `{"address":"` + address + `"}`
-	ret := rpcutils.DoPostRequest(URL, "walletsolidity/getaccount", reqData)
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *TRXHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	ret, err := h.call(ctx, "walletsolidity/getaccount", map[string]string{"address": address})
+	if err != nil {
+		return
+	}
 	var retStruct map[string]interface{}
 	err = json.Unmarshal([]byte(ret), &retStruct)
 	if err != nil {
 		return
 	}
 	if retStruct["balance"] == nil {
-		err = fmt.Errorf(ret)
+		err = types.ClassifyError(fmt.Errorf("%v", ret))
 		return
 	}
 	balance = big.NewInt(int64(retStruct["balance"].(float64)))
@@ -188,31 +348,17 @@ func PublicKeyToHex (pk *PublicKey) (ret string) {
 }
 
 func HexToPublicKey(pubKeyHex string) (pk *PublicKey, err error) {
-	pub, err := hex.DecodeString(pubKeyHex)
-	if len(pub) == 65 {
-		x := new(big.Int).SetBytes(pub[1:33])
-		y := new(big.Int).SetBytes(pub[33:])
-		pk = &PublicKey{&ecdsa.PublicKey{
-			Curve: crypto.S256(),
-			X: x,
-			Y: y,
-		}}
-	} else if len(pub) == 64 {
-		x := new(big.Int).SetBytes(pub[:32])
-		y := new(big.Int).SetBytes(pub[32:])
-		pk = &PublicKey{&ecdsa.PublicKey{
-			Curve: crypto.S256(),
-			X: x,
-			Y: y,
-		}}
-	} else {
-		err = fmt.Errorf("Invalid public key length %v", len(pub))
+	pub, err := signature.ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return
 	}
+	pk = &PublicKey{pub.ToECDSA()}
 	return
 }
 
 func (pk *PublicKey) Address() (addressHR, address string, err error) {
-	data := append(pk.X.Bytes(), pk.Y.Bytes()...)
+	// x y 各 32 字节, 不能用 big.Int.Bytes(), 有前导 0 时会变短
+	data := crypto.FromECDSAPub(pk.PublicKey)[1:]
 	sha := crypto.Keccak256(data)
 	addressBytes := append([]byte{prefix}, sha[len(sha)-20:]...)
 	address = hex.EncodeToString(addressBytes)
@@ -255,7 +401,7 @@ func (tx *Transaction) UnmarshalJson(txjson string) (err error) {
 	err = json.Unmarshal([]byte(txjson), tx)
 	if err == nil {
 		if tx.Error != "" {
-			err = fmt.Errorf(tx.Error)
+			err = types.ClassifyError(fmt.Errorf("%v", tx.Error))
 		}
 	}
 	return
@@ -272,6 +418,21 @@ type RawData struct {
 type Contract interface {
 }
 
+// ownerAddress 返回第一个合约的 owner_address, 16 进制
+func (tx *Transaction) ownerAddress() (string, error) {
+	if len(tx.Raw_data.Contract) == 0 {
+		return "", fmt.Errorf("transaction has no contract")
+	}
+	contract, _ := tx.Raw_data.Contract[0].(map[string]interface{})
+	param, _ := contract["parameter"].(map[string]interface{})
+	value, _ := param["value"].(map[string]interface{})
+	owner, _ := value["owner_address"].(string)
+	if owner == "" {
+		return "", fmt.Errorf("transaction has no owner_address")
+	}
+	return owner, nil
+}
+
 type Transfer struct {
 	Amount *big.Int `json:"amount"`
 	Owner_address string `json:"owner_address"`
@@ -286,11 +447,31 @@ func (tf *Transfer) MarshalJSON() (ret string, err error) {
 	return
 }
 
-// Canonical signatures are those where 1 <= S <= N/2
-func isCanonical(pk *ecdsa.PublicKey, s *big.Int) bool {
-	if big.NewInt(1).Cmp(s) != 1 && s.Cmp(new(big.Int).Div(pk.Params().N, big.NewInt(2))) != 1 {
-		return true
+
+// payload 是 Transaction 的 json, txID 和 raw_data 原样保留
+func (h *TRXHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	tx, ok := transaction.(*Transaction)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
 	}
-	return false
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxEnvelope("TRX", h.network.String(), digests, payload), nil
 }
 
+func (h *TRXHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("TRX", h.network.String()); err != nil {
+		return
+	}
+	tx := &Transaction{}
+	// contract 是 interface{}, 用 UseNumber 避免金额被转成 float64
+	dec := json.NewDecoder(bytes.NewReader(env.Payload))
+	dec.UseNumber()
+	if err = dec.Decode(tx); err != nil {
+		return
+	}
+	transaction = tx
+	return
+}
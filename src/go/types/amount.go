@@ -0,0 +1,76 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ParseUnits 把十进制字符串 s 转换成最小单位的整数, decimals 是小数位数
+// 如 ParseUnits("1.5", 8) = 150000000
+// 不使用浮点数, 小数位数超过 decimals 时返回错误而不是舍入
+func ParseUnits(s string, decimals int) (*big.Int, error) {
+	if decimals < 0 {
+		return nil, fmt.Errorf("invalid decimals %v", decimals)
+	}
+	str := strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(str, "-") {
+		neg = true
+		str = str[1:]
+	}
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	// 末尾的 0 不影响数值
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > decimals {
+		return nil, fmt.Errorf("invalid amount %q: more than %v decimal places", s, decimals)
+	}
+	v, _ := new(big.Int).SetString(intPart + fracPart + strings.Repeat("0", decimals-len(fracPart)), 10)
+	if neg {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+// FormatUnits 把最小单位的整数转换成十进制字符串, 固定 decimals 位小数
+// 如 FormatUnits(150000000, 8) = "1.50000000"
+func FormatUnits(v *big.Int, decimals int) string {
+	if v == nil {
+		v = new(big.Int)
+	}
+	digits := new(big.Int).Abs(v).String()
+	sign := ""
+	if v.Sign() < 0 {
+		sign = "-"
+	}
+	if decimals <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+// TrimUnits 去掉 FormatUnits 结果末尾多余的 0 和小数点, 如 "1.50000000" -> "1.5"
+func TrimUnits(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	cases := []struct {
+		s string
+		decimals int
+		want string
+	}{
+		{"1.5", 8, "150000000"},
+		{"0.00000001", 8, "1"},
+		{"21000000", 8, "2100000000000000"},
+		{".5", 6, "500000"},
+		{"5.", 6, "5000000"},
+		{"0.10000000000", 8, "10000000"},
+		{" 2 ", 0, "2"},
+		{"-0.0001", 8, "-10000"},
+		// 18 位小数, 超过 int64 的范围
+		{"123.456789012345678901", 18, "123456789012345678901"},
+		// 0.1 在 float64 里不能精确表示
+		{"0.1", 18, "100000000000000000"},
+	}
+	for _, c := range cases {
+		got, err := ParseUnits(c.s, c.decimals)
+		if err != nil {
+			t.Fatalf("ParseUnits(%q, %v): %v", c.s, c.decimals, err)
+		}
+		if got.String() != c.want {
+			t.Fatalf("ParseUnits(%q, %v) = %v, want %v", c.s, c.decimals, got, c.want)
+		}
+	}
+}
+
+func TestParseUnitsInvalid(t *testing.T) {
+	cases := []struct {
+		s string
+		decimals int
+	}{
+		{"0.000000001", 8},
+		{"1.5", 0},
+		{"", 8},
+		{".", 8},
+		{"1e-4", 8},
+		{"1,000", 8},
+		{"0x10", 8},
+		{"--1", 8},
+		{"+1", 8},
+		{"1.2.3", 8},
+		{"1", -1},
+	}
+	for _, c := range cases {
+		if got, err := ParseUnits(c.s, c.decimals); err == nil {
+			t.Fatalf("ParseUnits(%q, %v) = %v, want an error", c.s, c.decimals, got)
+		}
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	wei, _ := new(big.Int).SetString("123456789012345678901", 10)
+	cases := []struct {
+		v *big.Int
+		decimals int
+		want string
+		trimmed string
+	}{
+		{big.NewInt(150000000), 8, "1.50000000", "1.5"},
+		{big.NewInt(1), 8, "0.00000001", "0.00000001"},
+		{big.NewInt(0), 6, "0.000000", "0"},
+		{nil, 2, "0.00", "0"},
+		{big.NewInt(-10000), 8, "-0.00010000", "-0.0001"},
+		{big.NewInt(42), 0, "42", "42"},
+		{big.NewInt(1000), 2, "10.00", "10"},
+		{wei, 18, "123.456789012345678901", "123.456789012345678901"},
+	}
+	for _, c := range cases {
+		got := FormatUnits(c.v, c.decimals)
+		if got != c.want {
+			t.Fatalf("FormatUnits(%v, %v) = %v, want %v", c.v, c.decimals, got, c.want)
+		}
+		if trimmed := TrimUnits(got); trimmed != c.trimmed {
+			t.Fatalf("TrimUnits(%v) = %v, want %v", got, trimmed, c.trimmed)
+		}
+		if c.v == nil {
+			continue
+		}
+		back, err := ParseUnits(got, c.decimals)
+		if err != nil || back.Cmp(c.v) != 0 {
+			t.Fatalf("ParseUnits(FormatUnits(%v)) = %v, %v", c.v, back, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"fmt"
+)
+
+// Capabilities 描述 handler 实际实现了哪些功能
+// 为 false 的功能调用时返回的错误 errors.Is(err, ErrNotSupported)
+type Capabilities struct {
+	// BuildUnsignedTransaction
+	Build bool `json:"build"`
+	// SignTransaction, 测试用的本地签名
+	Sign bool `json:"sign"`
+	// SubmitTransaction
+	Submit bool `json:"submit"`
+	// GetTransactionInfo
+	TxLookup bool `json:"txLookup"`
+	// GetAddressBalance
+	Balance bool `json:"balance"`
+	// 一笔交易多个收款人, 见 BuildUnsignedBatchTransaction
+	MultiOutput bool `json:"multiOutput"`
+	// 交易可以带 memo
+	Memo bool `json:"memo"`
+	// handler 处理的是链上的 token (erc20, omni property, evt fungible token)
+	Tokens bool `json:"tokens"`
+	// EstimateFee 向节点查询手续费, 否则只有 GetDefaultFee 的默认值
+	FeeEstimate bool `json:"feeEstimate"`
+	// GetTransactionStatus 可以查询交易的确认数和最终状态
+	TxStatus bool `json:"txStatus"`
+	// GetAddressHistory 可以分页查询地址的转账历史
+	History bool `json:"history"`
+	// FetchChainState 和 Assemble 把交易构造拆成联网和离线两步, 见 ChainState
+	OfflineBuild bool `json:"offlineBuild"`
+	// BuildUnsignedTransaction 支持的参数, 见 BuildOptions
+	BuildOptions []string `json:"buildOptions"`
+	// 支持的网络
+	Networks []Network `json:"networks"`
+	// handler 当前的网络
+	Network Network `json:"network,omitempty"`
+}
+
+// 网络的排列顺序
+var allNetworks = []Network{Mainnet, Testnet, Regtest}
+
+// Networks 按 mainnet, testnet, regtest 的顺序返回 supported 为 true 的网络
+func Networks(supported func(Network) bool) (networks []Network) {
+	for _, n := range allNetworks {
+		if supported(n) {
+			networks = append(networks, n)
+		}
+	}
+	return
+}
+
+// HasBuildOption 判断 BuildOptions 里是否有 name
+func (c Capabilities) HasBuildOption(name string) bool {
+	for _, o := range c.BuildOptions {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NotSupportedError 返回 coinType 不支持 function 的错误, 可以用 errors.Is 判断 ErrNotSupported
+func NotSupportedError(coinType, function string) error {
+	return fmt.Errorf("%v %v: %w", coinType, function, ErrNotSupported)
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ChainState 是构造交易需要的链上状态
+// handler 的 FetchChainState 从节点取得, Assemble 只用 ChainState 和参数构造交易, 不访问网络
+// 冷钱包可以在联网的机器上取得 ChainState, 序列化成 json 后在离线的机器上构造交易
+// 没有用到的字段为空, 每个币种需要哪些字段见各 handler 的 Assemble
+type ChainState struct {
+	CoinType string `json:"cointype"`
+	Network string `json:"network"`
+	// utxo 币种可以花费的输出
+	UTXOs []UTXO `json:"utxos,omitempty"`
+	// 账户的 nonce, xrp 的 Sequence, bnb 和 atom 的 sequence, ven 的随机 nonce
+	Nonce *uint64 `json:"nonce,omitempty"`
+	// bnb 和 atom 的账户编号
+	AccountNumber *uint64 `json:"accountNumber,omitempty"`
+	// eth 系是十进制的 chain id, eos 是 16 进制的 chain id, bnb 和 atom 是 chain-id 字符串, ven 是十进制的 chain tag
+	ChainID string `json:"chainId,omitempty"`
+	// eos, trx, ven 的交易引用的区块
+	RefBlock *RefBlock `json:"refBlock,omitempty"`
+	// eth 系的 gas price 和 gas limit, 构造参数没有指定并且没有默认值时向节点查询
+	GasPrice *big.Int `json:"gasPrice,omitempty"`
+	GasLimit *uint64 `json:"gasLimit,omitempty"`
+}
+
+// UTXO 是一个可以花费的输出
+type UTXO struct {
+	TxHash string `json:"txid"`
+	Vout uint32 `json:"vout"`
+	Address string `json:"address"`
+	// 16 进制的锁定脚本
+	ScriptPubKey string `json:"scriptPubKey"`
+	// 链上最小单位的金额, 例如 satoshi
+	Amount *big.Int `json:"amount"`
+	Confirmations int64 `json:"confirmations"`
+}
+
+// RefBlock 是交易引用的区块, 交易的过期时间从区块时间算起
+type RefBlock struct {
+	Number uint64 `json:"number"`
+	// 16 进制的区块 id 或 hash
+	ID string `json:"id"`
+	// 区块时间, unix 秒
+	Timestamp int64 `json:"timestamp"`
+}
+
+// NewChainState 返回 coinType 在 network 上的空 ChainState
+func NewChainState(coinType, network string) *ChainState {
+	return &ChainState{CoinType: coinType, Network: network}
+}
+
+// Check 检查 ChainState 的币种和网络是否和 handler 一致
+func (s *ChainState) Check(coinType, network string) error {
+	if s == nil {
+		return fmt.Errorf("nil chain state")
+	}
+	if !strings.EqualFold(s.CoinType, coinType) {
+		return fmt.Errorf("chain state coin type mismatch: got %v, want %v", s.CoinType, coinType)
+	}
+	if s.Network != network {
+		return fmt.Errorf("chain state network mismatch: got %v, want %v", s.Network, network)
+	}
+	return nil
+}
+
+// MissingStateError 返回 ChainState 缺少 field 的错误
+func MissingStateError(field string) error {
+	return fmt.Errorf("chain state has no %v", field)
+}
@@ -0,0 +1,180 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 当前信封格式版本
+const TxEnvelopeVersion uint8 = 2
+
+// 从版本 2 开始 eos, eth 系 (eth, etc, erc20), ven, evt 的 payload 带有构造交易的公钥或地址, 签名时用来校验签名者
+// 这些币种不能解码版本 1 的信封, 其它币种的 payload 没有变化
+const TxEnvelopeSignerVersion uint8 = 2
+
+// TxEnvelope 是未签名交易的统一封装, 可以持久化或者发送到别的进程
+// BuildUnsignedTransaction 和 MakeSignedTransaction 可以在不同节点上执行
+// Payload 由各币种的 handler 编码, 格式见各 handler 的 MarshalUnsignedTransaction
+type TxEnvelope struct {
+	Version  uint8    `json:"version"`
+	CoinType string   `json:"cointype"`
+	Network  string   `json:"network"`
+	Digests  []string `json:"digests"`
+	Payload  []byte   `json:"payload"`
+}
+
+func NewTxEnvelope(coinType, network string, digests []string, payload []byte) *TxEnvelope {
+	return &TxEnvelope{
+		Version:  TxEnvelopeVersion,
+		CoinType: coinType,
+		Network:  network,
+		Digests:  digests,
+		Payload:  payload,
+	}
+}
+
+// Check 检查信封的版本, 币种和网络是否和 handler 一致
+func (env *TxEnvelope) Check(coinType, network string) error {
+	if env == nil {
+		return fmt.Errorf("nil transaction envelope")
+	}
+	if err := checkVersion(env.Version); err != nil {
+		return err
+	}
+	if !strings.EqualFold(env.CoinType, coinType) {
+		return fmt.Errorf("transaction envelope coin type mismatch: got %v, want %v", env.CoinType, coinType)
+	}
+	if env.Network != network {
+		return fmt.Errorf("transaction envelope network mismatch: got %v, want %v", env.Network, network)
+	}
+	return nil
+}
+
+// CheckMinVersion 拒绝版本早于 min 的信封, 用于 payload 格式有不兼容变化的币种
+func (env *TxEnvelope) CheckMinVersion(min uint8) error {
+	if env.Version < min {
+		return fmt.Errorf("transaction envelope version %v is no longer supported for %v, rebuild the transaction", env.Version, env.CoinType)
+	}
+	return nil
+}
+
+// 版本为 0 或者比当前版本新的信封不能解码
+func checkVersion(version uint8) error {
+	if version == 0 || version > TxEnvelopeVersion {
+		return fmt.Errorf("unsupported transaction envelope version: %v", version)
+	}
+	return nil
+}
+
+// 没有方法的别名, 避免 MarshalJSON 递归调用自己
+type txEnvelope TxEnvelope
+
+// MarshalJSON 实现 json.Marshaler, 字段见 TxEnvelope 的 json tag, payload 是 base64
+func (env TxEnvelope) MarshalJSON() ([]byte, error) {
+	return json.Marshal(txEnvelope(env))
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler, 和 UnmarshalBinary 一样拒绝不支持的版本
+func (env *TxEnvelope) UnmarshalJSON(b []byte) error {
+	var e txEnvelope
+	if err := json.Unmarshal(b, &e); err != nil {
+		return err
+	}
+	if err := checkVersion(e.Version); err != nil {
+		return err
+	}
+	*env = TxEnvelope(e)
+	return nil
+}
+
+// MarshalBinary 紧凑的二进制格式:
+// version(1 byte) | cointype | network | len(digests) | digest... | payload
+// 字符串和 payload 都是 uvarint 长度前缀, len(digests) 是 uvarint
+func (env *TxEnvelope) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(env.Version)
+	writeBytes(&buf, []byte(env.CoinType))
+	writeBytes(&buf, []byte(env.Network))
+	writeUvarint(&buf, uint64(len(env.Digests)))
+	for _, d := range env.Digests {
+		writeBytes(&buf, []byte(d))
+	}
+	writeBytes(&buf, env.Payload)
+	return buf.Bytes(), nil
+}
+
+func (env *TxEnvelope) UnmarshalBinary(b []byte) (err error) {
+	r := bytes.NewReader(b)
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("read envelope version error: %v", err)
+	}
+	if err := checkVersion(version); err != nil {
+		return err
+	}
+	cointype, err := readBytes(r)
+	if err != nil {
+		return fmt.Errorf("read envelope coin type error: %v", err)
+	}
+	network, err := readBytes(r)
+	if err != nil {
+		return fmt.Errorf("read envelope network error: %v", err)
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("read envelope digests error: %v", err)
+	}
+	if n > uint64(r.Len()) {
+		return fmt.Errorf("read envelope digests error: too many digests %v", n)
+	}
+	var digests []string
+	for i := uint64(0); i < n; i++ {
+		d, err := readBytes(r)
+		if err != nil {
+			return fmt.Errorf("read envelope digest %v error: %v", i, err)
+		}
+		digests = append(digests, string(d))
+	}
+	payload, err := readBytes(r)
+	if err != nil {
+		return fmt.Errorf("read envelope payload error: %v", err)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%v trailing bytes after transaction envelope", r.Len())
+	}
+	env.Version = version
+	env.CoinType = string(cointype)
+	env.Network = string(network)
+	env.Digests = digests
+	env.Payload = payload
+	return nil
+}
+
+func writeUvarint(buf *bytes.Buffer, x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	buf.Write(b[:n])
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > uint64(r.Len()) {
+		return nil, fmt.Errorf("length %v exceeds remaining %v bytes", l, r.Len())
+	}
+	b := make([]byte, l)
+	if _, err := r.Read(b); err != nil && l > 0 {
+		return nil, err
+	}
+	return b, nil
+}
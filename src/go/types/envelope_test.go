@@ -0,0 +1,97 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTxEnvelopeRoundTrip(t *testing.T) {
+	cases := []*TxEnvelope{
+		NewTxEnvelope("BTC", "mainnet", []string{"00ff", "ee11"}, []byte{1, 2, 3}),
+		NewTxEnvelope("ETH", "testnet", []string{"abcd"}, []byte{}),
+		NewTxEnvelope("XRP", "", nil, []byte{0}),
+	}
+	for _, env := range cases {
+		b, err := env.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := new(TxEnvelope)
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%v: UnmarshalBinary: %v", env.CoinType, err)
+		}
+		if !reflect.DeepEqual(got, env) {
+			t.Fatalf("binary round trip: got %+v, want %+v", got, env)
+		}
+
+		b, err = json.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = new(TxEnvelope)
+		if err := json.Unmarshal(b, got); err != nil {
+			t.Fatalf("%v: json.Unmarshal: %v", env.CoinType, err)
+		}
+		if got.Version != env.Version || got.CoinType != env.CoinType || got.Network != env.Network ||
+			len(got.Digests) != len(env.Digests) || string(got.Payload) != string(env.Payload) {
+			t.Fatalf("json round trip: got %+v, want %+v", got, env)
+		}
+	}
+}
+
+func TestTxEnvelopeInvalid(t *testing.T) {
+	env := NewTxEnvelope("BTC", "mainnet", []string{"00ff"}, []byte{1, 2, 3})
+	valid, _ := env.MarshalBinary()
+	cases := []struct {
+		name string
+		b []byte
+	}{
+		{"empty", nil},
+		{"version 0", append([]byte{0}, valid[1:]...)},
+		{"future version", append([]byte{TxEnvelopeVersion + 1}, valid[1:]...)},
+		{"truncated coin type", valid[:3]},
+		{"truncated digest", valid[:len(valid)-6]},
+		{"truncated payload", valid[:len(valid)-1]},
+		{"trailing bytes", append(append([]byte{}, valid...), 0)},
+		{"too many digests", []byte{TxEnvelopeVersion, 0, 0, 100}},
+	}
+	for _, c := range cases {
+		if err := new(TxEnvelope).UnmarshalBinary(c.b); err == nil {
+			t.Errorf("%v: UnmarshalBinary should fail", c.name)
+		}
+	}
+
+	for _, version := range []uint8{0, TxEnvelopeVersion + 1} {
+		b, _ := json.Marshal(&TxEnvelope{Version: version, CoinType: "BTC"})
+		got := new(TxEnvelope)
+		if err := json.Unmarshal(b, got); err == nil {
+			t.Errorf("json.Unmarshal of version %v should fail", version)
+		}
+		if got.CoinType != "" {
+			t.Errorf("failed json.Unmarshal of version %v changed the envelope", version)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"version":1,"payload":"not base64"}`), new(TxEnvelope)); err == nil {
+		t.Error("json.Unmarshal of a malformed payload should fail")
+	}
+}
+
+// 版本 1 的信封仍然能解码, payload 不兼容的币种用 CheckMinVersion 拒绝
+func TestTxEnvelopeV1(t *testing.T) {
+	v1 := &TxEnvelope{Version: 1, CoinType: "ETH", Network: "mainnet", Digests: []string{"abcd"}, Payload: []byte{1}}
+	b, _ := v1.MarshalBinary()
+	env := new(TxEnvelope)
+	if err := env.UnmarshalBinary(b); err != nil {
+		t.Fatalf("UnmarshalBinary of version 1: %v", err)
+	}
+	if err := env.Check("ETH", "mainnet"); err != nil {
+		t.Fatalf("Check of version 1: %v", err)
+	}
+	if err := env.CheckMinVersion(TxEnvelopeSignerVersion); err == nil {
+		t.Fatal("version 1 envelope should be rejected by CheckMinVersion")
+	}
+	if err := NewTxEnvelope("ETH", "mainnet", nil, nil).CheckMinVersion(TxEnvelopeSignerVersion); err != nil {
+		t.Fatalf("current envelope: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// handler 没有实现的功能返回这个错误, 见 Capabilities
+var ErrNotSupported = errors.New("not supported")
+
+// 不支持一笔交易多个收款人的币种返回这个错误
+var ErrBatchNotSupported = fmt.Errorf("batch transaction (multiple outputs) is %w", ErrNotSupported)
+
+// handler 不支持请求的网络
+var ErrUnsupportedNetwork = fmt.Errorf("network is %w", ErrNotSupported)
+
+// 错误分类, handler 返回的错误用 errors.Is 判断属于哪一类
+var (
+	// 交易或账户不存在, 交易可能还没有广播到这个节点
+	ErrNotFound = errors.New("not found")
+	// 交易已广播, 还没有上链
+	ErrPending = errors.New("transaction is pending")
+	// 余额不足
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// 地址格式错误或者不属于 handler 的网络
+	ErrInvalidAddress = errors.New("invalid address")
+	// 手续费太低, 节点拒绝交易
+	ErrFeeTooLow = errors.New("fee too low")
+	// nonce/sequence 冲突, 或者 utxo 已经被花掉
+	ErrNonceConflict = errors.New("nonce conflict")
+	// 网关或节点连不上, 可以重试
+	ErrGatewayUnavailable = errors.New("gateway unavailable")
+	// 交易已经在节点的交易池或者链上
+	ErrAlreadyKnown = errors.New("transaction already known")
+	// 交易上链了但是执行失败
+	ErrTxFailed = errors.New("transaction failed")
+	// 签名无效, 不满足链的规则, 或者不是构造交易时的公钥签的
+	ErrInvalidSignature = errors.New("invalid signature")
+	// 公钥长度不对, 不是 16 进制, 或者不是 secp256k1 曲线上的点
+	ErrInvalidPublicKey = errors.New("invalid public key")
+)
+
+// Error 是带分类的错误, errors.Is(err, Kind) 成立, 原始错误 Err 可以用 errors.Unwrap/errors.As 取出
+type Error struct {
+	Kind error
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	if e.Kind == nil {
+		return e.Err.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && errors.Is(e.Kind, target)
+}
+
+// SignatureError 是第 Index 个签名无效的错误, 比特币系的 Index 是交易输入的序号
+// errors.Is(err, ErrInvalidSignature) 成立
+type SignatureError struct {
+	Index int
+	Err error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("%v for input %v: %v", ErrInvalidSignature, e.Index, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SignatureError) Is(target error) bool {
+	return target == ErrInvalidSignature
+}
+
+// WrapError 给 err 加上分类 kind, err 为 nil 时返回 nil
+func WrapError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf 返回分类为 kind 的错误, 格式同 fmt.Errorf
+func Errorf(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// 节点返回的错误信息里的关键字, 按顺序匹配, 都用小写
+// 覆盖 bitcoind, geth, rippled, tron, cosmos, binance chain, eos, vechain 的常见错误
+var nodeMessages = []struct {
+	kind error
+	keywords []string
+}{
+	{ErrAlreadyKnown, []string{"already known", "already in block chain", "txn-already-known", "txn-already-in-mempool", "known transaction", "known tx", "tx already exists", "dup_transaction_error", "tx_duplicate", "tefalready"}},
+	{ErrNonceConflict, []string{"nonce too low", "txn-mempool-conflict", "missingorspent", "missing inputs", "tefpast_seq", "invalid sequence", "incorrect account sequence"}},
+	{ErrFeeTooLow, []string{"fee too low", "min relay fee not met", "mempool min fee not met", "insufficient priority", "underpriced", "insufficient fee", "telinsuf_fee_p"}},
+	{ErrInsufficientFunds, []string{"insufficient funds", "insufficient fund", "insufficient balance", "balance is not sufficient", "not enough balance", "overdrawn balance", "unfunded", "insufficient energy"}},
+	{ErrInvalidAddress, []string{"invalid address", "bad address", "invalid account", "actmalformed"}},
+	{ErrNotFound, []string{"not found", "no such mempool or blockchain transaction", "txnnotfound", "unknown transaction"}},
+	{ErrGatewayUnavailable, []string{"connection refused", "no such host", "i/o timeout", "connection reset", "http error: 5", "bad gateway", "service unavailable", "gateway timeout"}},
+}
+
+// ClassifyMessage 根据节点返回的错误信息判断分类, 不认识的信息返回 nil
+func ClassifyMessage(msg string) error {
+	msg = strings.ToLower(msg)
+	for _, m := range nodeMessages {
+		for _, k := range m.keywords {
+			if strings.Contains(msg, k) {
+				return m.kind
+			}
+		}
+	}
+	return nil
+}
+
+// ClassifyError 根据错误信息给 err 加上分类
+// err 为 nil, 已经有分类或者不认识时原样返回
+func ClassifyError(err error) error {
+	if err == nil || ErrorKind(err) != nil {
+		return err
+	}
+	if kind := ClassifyMessage(err.Error()); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	return err
+}
+
+// ErrorKind 返回 err 的分类, 没有分类时返回 nil
+func ErrorKind(err error) error {
+	for _, kind := range []error{ErrNotSupported, ErrNotFound, ErrPending, ErrInsufficientFunds, ErrInvalidAddress, ErrFeeTooLow, ErrNonceConflict, ErrGatewayUnavailable, ErrAlreadyKnown, ErrTxFailed, ErrInvalidSignature, ErrInvalidPublicKey} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// Retryable 判断 err 是否是暂时的, 稍后用同样的参数重试可能成功
+func Retryable(err error) bool {
+	return errors.Is(err, ErrGatewayUnavailable) || errors.Is(err, ErrPending) || errors.Is(err, ErrNotFound)
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"math/big"
+)
+
+// FeeQuote 一个速度档位的手续费, 金额都是最小单位
+type FeeQuote struct {
+	// 这笔转账的总手续费
+	Fee *big.Int `json:"fee"`
+	// 单价: utxo 币种是每 kB 的手续费, 以太坊是 gas price, 其他币种为空
+	FeeRate *big.Int `json:"feeRate,omitempty"`
+	// 以太坊的 gas limit
+	GasLimit uint64 `json:"gasLimit,omitempty"`
+}
+
+// FeeEstimate 一笔转账 slow/normal/fast 三档的手续费
+type FeeEstimate struct {
+	Slow FeeQuote `json:"slow"`
+	Normal FeeQuote `json:"normal"`
+	Fast FeeQuote `json:"fast"`
+	// 节点无法给出估计, 三档都是 GetDefaultFee 的默认值
+	Fallback bool `json:"fallback"`
+}
+
+// FixedFeeEstimate 返回三档相同的手续费 fee
+func FixedFeeEstimate(fee *big.Int, fallback bool) *FeeEstimate {
+	q := FeeQuote{Fee: new(big.Int).Set(fee)}
+	return &FeeEstimate{Slow: q, Normal: q, Fast: q, Fallback: fallback}
+}
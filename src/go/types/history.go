@@ -0,0 +1,56 @@
+package types
+
+import (
+	"math/big"
+)
+
+// Direction 转账相对于查询地址的方向
+type Direction string
+
+const (
+	// 转入查询的地址
+	DirectionIn Direction = "in"
+	// 从查询的地址转出, 包括转给自己
+	DirectionOut Direction = "out"
+)
+
+// Transfer 地址历史里的一笔转账, 金额是最小单位
+type Transfer struct {
+	TxHash string `json:"txHash"`
+	Direction Direction `json:"direction"`
+	// 转出时是收款地址, 转入时是付款地址, 查不到时为空
+	Counterparty string `json:"counterparty,omitempty"`
+	// 转出时不包括找零和手续费, 查不到对方地址的 utxo 交易是地址余额的变化
+	Amount *big.Int `json:"amount"`
+	// 没有上链或者网关不提供时为 0
+	BlockHeight uint64 `json:"blockHeight,omitempty"`
+	// unix 时间 (秒), 网关不提供时为 0
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+// 每页默认的条数
+const DefaultPageLimit = 20
+
+// PageRequest 分页查询的参数
+type PageRequest struct {
+	// 上一页返回的 NextCursor, 查询第一页时为空
+	Cursor string `json:"cursor,omitempty"`
+	// 每页最多多少条, 0 表示 DefaultPageLimit; 网关的页大小固定时只作为参考
+	Limit int `json:"limit,omitempty"`
+}
+
+// PageLimit 返回每页的条数
+func (p PageRequest) PageLimit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	return p.Limit
+}
+
+// HistoryPage 地址历史的一页, 从新到旧排列
+type HistoryPage struct {
+	Transfers []Transfer `json:"transfers"`
+	// 下一页的游标, 为空表示没有更多
+	// 按区块扫描的币种一页可能没有转账, 只要 NextCursor 不为空就可以继续查询
+	NextCursor string `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"math/big"
+)
+
+// 地址格式
+const (
+	AddressBase58Check = "base58check"
+	AddressBech32 = "bech32"
+	AddressCashAddr = "cashaddr"
+	AddressHex = "hex"
+	AddressRipple = "ripple"
+	AddressTron = "tron"
+	AddressEOSAccount = "eos-account"
+	AddressEVT = "evt-public-key"
+)
+
+// 没有注册 SLIP-44 coin type 的币种使用 SLIP44Unregistered
+const SLIP44Unregistered uint32 = 0xffffffff
+
+// Metadata 描述币种的精度和单位, 接口里的金额都是最小单位的整数
+type Metadata struct {
+	// 币种或 token 的符号, 如 BTC, USDT
+	Symbol string `json:"symbol"`
+	// 小数位数, 1 个币 = 10^Decimals 个最小单位
+	Decimals int `json:"decimals"`
+	// SLIP-44 coin type, 见 https://github.com/satoshilabs/slips/blob/master/slip-0044.md
+	// token 使用所在链的 coin type
+	SLIP44 uint32 `json:"slip44"`
+	// 地址格式, 见 AddressBase58Check 等
+	AddressFormat string `json:"addressFormat"`
+	// 最小单位的名称, 如 satoshi, wei, drop
+	SmallestUnit string `json:"smallestUnit,omitempty"`
+}
+
+// ToBaseUnits 把十进制的币数 (如 "1.5") 转换成最小单位的整数
+func (m Metadata) ToBaseUnits(amount string) (*big.Int, error) {
+	return ParseUnits(amount, m.Decimals)
+}
+
+// FromBaseUnits 把最小单位的整数转换成十进制的币数, 去掉末尾的 0
+func (m Metadata) FromBaseUnits(amount *big.Int) string {
+	return TrimUnits(FormatUnits(amount, m.Decimals))
+}
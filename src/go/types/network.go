@@ -0,0 +1,43 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Network 是 handler 使用的网络, 决定地址格式, chain id 和网关
+// 空字符串表示使用 handler 的默认网络
+type Network string
+
+const (
+	Mainnet Network = "mainnet"
+	Testnet Network = "testnet"
+	Regtest Network = "regtest"
+)
+
+// ParseNetwork 解析网络名, 不区分大小写, 空字符串返回空 Network
+func ParseNetwork(s string) (Network, error) {
+	switch n := Network(strings.ToLower(strings.TrimSpace(s))); n {
+	case "", Mainnet, Testnet, Regtest:
+		return n, nil
+	default:
+		return "", fmt.Errorf("unknown network: %v", s)
+	}
+}
+
+func (n Network) String() string {
+	return string(n)
+}
+
+// Or 返回 n, n 为空时返回 def
+func (n Network) Or(def Network) Network {
+	if n == "" {
+		return def
+	}
+	return n
+}
+
+// UnsupportedNetworkError 返回 coinType 不支持 network 的错误, 可以用 errors.Is 判断 ErrUnsupportedNetwork
+func UnsupportedNetworkError(coinType string, network Network) error {
+	return fmt.Errorf("%v %v: %w", coinType, network, ErrUnsupportedNetwork)
+}
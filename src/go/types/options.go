@@ -0,0 +1,147 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// BuildOptions 是 BuildUnsignedTransaction 的可选参数
+// json 字段名和原来的 jsonstring 保持兼容, 例如 {"feeRate":0.0001,"changeAddress":"..."}
+// 金额和费率不经过 float64, feeRate 可以写成数字或者十进制字符串 "0.0001"
+// 没有设置的字段为 nil, handler 使用默认值
+type BuildOptions struct {
+	// utxo 币种的手续费率, 单位是 币/kB, 例如 BTC/kB, handler 用 ParseUnits 换算成最小单位
+	FeeRate *json.Number `json:"feeRate,omitempty"`
+	// 手续费, 单位是链上最小单位, 例如 XRP 的 drops
+	Fee *big.Int `json:"fee,omitempty"`
+	GasPrice *big.Int `json:"gasPrice,omitempty"`
+	GasLimit *uint64 `json:"gasLimit,omitempty"`
+	ChangeAddress *string `json:"changeAddress,omitempty"`
+	Memo *string `json:"memo,omitempty"`
+	DestinationTag *uint32 `json:"destinationTag,omitempty"`
+	// 覆盖 nonce/sequence, 不设置时从节点查询
+	Nonce *uint64 `json:"nonce,omitempty"`
+	// utxo 至少需要的确认数
+	Confirmations *int64 `json:"confirmations,omitempty"`
+}
+
+const (
+	OptFeeRate = "feeRate"
+	OptFee = "fee"
+	OptGasPrice = "gasPrice"
+	OptGasLimit = "gasLimit"
+	OptChangeAddress = "changeAddress"
+	OptMemo = "memo"
+	OptDestinationTag = "destinationTag"
+	OptNonce = "nonce"
+	OptConfirmations = "confirmations"
+)
+
+// ParseBuildOptions 解析 jsonstring, 空字符串和 null 返回空的 BuildOptions
+// 未知字段返回错误
+func ParseBuildOptions(jsonstring string) (*BuildOptions, error) {
+	opts := &BuildOptions{}
+	s := strings.TrimSpace(jsonstring)
+	if s == "" || s == "null" {
+		return opts, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(opts); err != nil {
+		return nil, fmt.Errorf("invalid build options: %v", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("invalid build options: trailing data after json object")
+	}
+	return opts, nil
+}
+
+// Fields 返回已经设置的字段名
+func (opts *BuildOptions) Fields() (fields []string) {
+	if opts == nil {
+		return
+	}
+	if opts.FeeRate != nil {
+		fields = append(fields, OptFeeRate)
+	}
+	if opts.Fee != nil {
+		fields = append(fields, OptFee)
+	}
+	if opts.GasPrice != nil {
+		fields = append(fields, OptGasPrice)
+	}
+	if opts.GasLimit != nil {
+		fields = append(fields, OptGasLimit)
+	}
+	if opts.ChangeAddress != nil {
+		fields = append(fields, OptChangeAddress)
+	}
+	if opts.Memo != nil {
+		fields = append(fields, OptMemo)
+	}
+	if opts.DestinationTag != nil {
+		fields = append(fields, OptDestinationTag)
+	}
+	if opts.Nonce != nil {
+		fields = append(fields, OptNonce)
+	}
+	if opts.Confirmations != nil {
+		fields = append(fields, OptConfirmations)
+	}
+	return
+}
+
+// Check 检查设置的字段是否都被 handler 支持, 以及数值是否合法
+func (opts *BuildOptions) Check(coinType string, supported ...string) error {
+	for _, f := range opts.Fields() {
+		ok := false
+		for _, s := range supported {
+			if f == s {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("build option %v is not supported by %v", f, coinType)
+		}
+	}
+	if opts == nil {
+		return nil
+	}
+	if opts.FeeRate != nil {
+		if r, ok := new(big.Rat).SetString(opts.FeeRate.String()); !ok || r.Sign() <= 0 {
+			return fmt.Errorf("invalid build option feeRate: %v", *opts.FeeRate)
+		}
+	}
+	if opts.Fee != nil && opts.Fee.Sign() <= 0 {
+		return fmt.Errorf("invalid build option fee: %v", opts.Fee)
+	}
+	if opts.GasPrice != nil && opts.GasPrice.Sign() <= 0 {
+		return fmt.Errorf("invalid build option gasPrice: %v", opts.GasPrice)
+	}
+	if opts.GasLimit != nil && *opts.GasLimit == 0 {
+		return fmt.Errorf("invalid build option gasLimit: %v", *opts.GasLimit)
+	}
+	if opts.ChangeAddress != nil && *opts.ChangeAddress == "" {
+		return fmt.Errorf("invalid build option changeAddress: empty address")
+	}
+	if opts.Confirmations != nil && *opts.Confirmations < 0 {
+		return fmt.Errorf("invalid build option confirmations: %v", *opts.Confirmations)
+	}
+	return nil
+}
+
+// ParseAndCheckBuildOptions 解析并检查 jsonstring
+func ParseAndCheckBuildOptions(jsonstring string, coinType string, supported ...string) (*BuildOptions, error) {
+	opts, err := ParseBuildOptions(jsonstring)
+	if err != nil {
+		return nil, err
+	}
+	if err = opts.Check(coinType, supported...); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,69 @@
+package types
+
+// TxState 交易所处的阶段
+type TxState string
+
+const (
+	// 节点查不到这笔交易
+	TxUnknown TxState = "unknown"
+	// 在交易池里, 还没有上链
+	TxMempool TxState = "mempool"
+	// 已经上链, 确认数还没有达到 FinalityThreshold
+	TxIncluded TxState = "included"
+	// 确认数达到 FinalityThreshold, 不会再被回滚
+	TxFinal TxState = "final"
+	// 已经上链但是执行失败 (以太坊 revert, 瑞波 tec 结果等), 不会再变化
+	TxFailed TxState = "failed"
+)
+
+// Done 返回交易是否已经不会再变化
+func (s TxState) Done() bool {
+	return s == TxFinal || s == TxFailed
+}
+
+// TxStatus 交易在链上的状态, 见 GetTransactionStatus
+type TxStatus struct {
+	TxHash string `json:"txHash"`
+	State TxState `json:"state"`
+	// 交易所在的区块, 没有上链时为空
+	BlockHeight uint64 `json:"blockHeight,omitempty"`
+	BlockHash string `json:"blockHash,omitempty"`
+	// 包含交易的区块算 1 个确认
+	Confirmations uint64 `json:"confirmations"`
+	// 链上的交易达到这么多确认后不会再被回滚
+	FinalityThreshold uint64 `json:"finalityThreshold"`
+}
+
+// UnknownTxStatus 返回节点查不到的交易的状态
+func UnknownTxStatus(txhash string, threshold uint64) *TxStatus {
+	return &TxStatus{TxHash: txhash, State: TxUnknown, FinalityThreshold: threshold}
+}
+
+// MempoolTxStatus 返回还在交易池里的交易的状态
+func MempoolTxStatus(txhash string, threshold uint64) *TxStatus {
+	return &TxStatus{TxHash: txhash, State: TxMempool, FinalityThreshold: threshold}
+}
+
+// IncludedTxStatus 返回已经上链的交易的状态, 确认数达到 threshold 时是 TxFinal, 否则是 TxIncluded
+func IncludedTxStatus(txhash string, height uint64, blockHash string, confirmations, threshold uint64) *TxStatus {
+	s := &TxStatus{
+		TxHash: txhash,
+		State: TxIncluded,
+		BlockHeight: height,
+		BlockHash: blockHash,
+		Confirmations: confirmations,
+		FinalityThreshold: threshold,
+	}
+	if confirmations >= threshold {
+		s.State = TxFinal
+	}
+	return s
+}
+
+// Confirmations 根据最新区块高度计算交易的确认数
+func Confirmations(height, bestHeight uint64) uint64 {
+	if bestHeight < height {
+		return 0
+	}
+	return bestHeight - height + 1
+}
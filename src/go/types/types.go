@@ -1,8 +1,27 @@
 package types
 
-import "math/big"
+import (
+	"fmt"
+	"math/big"
+)
 
 type TxOutput struct {
 	ToAddress string
 	Amount *big.Int
 }
+
+// CheckOutputs 检查批量交易的输出, 地址不能为空, 金额必须为正
+func CheckOutputs(outputs []TxOutput) error {
+	if len(outputs) == 0 {
+		return fmt.Errorf("no transaction outputs")
+	}
+	for i, out := range outputs {
+		if out.ToAddress == "" {
+			return fmt.Errorf("output %v: empty to address", i)
+		}
+		if out.Amount == nil || out.Amount.Sign() <= 0 {
+			return fmt.Errorf("output %v: invalid amount %v", i, out.Amount)
+		}
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package cryptocoins
 
 import (
 	"regexp"
-	"strings"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/address"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
 var RegExpmap map[string]string = map[string]string {
@@ -21,26 +23,78 @@ var RegExpmap map[string]string = map[string]string {
 	"EVT":"^EVT[a-zA-Z\\d]{50}$",
 }
 
+// 地址格式和网络有关的币种, 指定网络时优先使用, 没有的币种使用 RegExpmap
+// address 包支持的币种不使用正则表达式, 见 AddressValidator
+var NetworkRegExpmap map[types.Network]map[string]string = map[types.Network]map[string]string {
+	types.Mainnet: map[string]string {
+		"BTC":"^(1|3)[a-zA-Z\\d]{25,33}$",
+		"USDT":"^(1|3)[a-zA-Z\\d]{25,33}$",
+		"BCH":"^(bitcoincash:)?(p|q)[0-9a-z]{41}$",
+		"BNB":"^bnb1[qpzry9x8gf2tvdw0s3jn54khce6mua7l]{38}$",
+	},
+	types.Testnet: map[string]string {
+		"BTC":"^(m|n|2)[a-zA-Z\\d]{25,33}$",
+		"USDT":"^(m|n|2)[a-zA-Z\\d]{25,33}$",
+		"BCH":"^(bchtest:)?(p|q)[0-9a-z]{41}$",
+		"BNB":"^tbnb1[qpzry9x8gf2tvdw0s3jn54khce6mua7l]{38}$",
+	},
+	types.Regtest: map[string]string {
+		"BTC":"^(m|n|2)[a-zA-Z\\d]{25,33}$",
+		"USDT":"^(m|n|2)[a-zA-Z\\d]{25,33}$",
+	},
+}
+
+// AddressValidator 校验地址, address 包支持的币种解码地址并检查校验和, 其他币种用正则表达式 Exp 匹配
 type AddressValidator struct {
 	Exp string
+	cointype string
+	network types.Network
+}
+
+func validatorCoinType (cointype string) string {
+	return address.CoinType(cointype)
 }
 
 func NewAddressValidator (cointype string) *AddressValidator {
-	if strings.HasPrefix(cointype,"ERC20") {
-		cointype = "ETH"
+	return &AddressValidator{
+		Exp: RegExpmap[validatorCoinType(cointype)],
+		cointype: cointype,
+	}
+}
+
+// NewAddressValidatorForNetwork 只接受 network 上的地址, network 为空时和 NewAddressValidator 相同
+func NewAddressValidatorForNetwork (cointype string, network types.Network) *AddressValidator {
+	v := NewAddressValidator(cointype)
+	v.network = network
+	if exp, ok := NetworkRegExpmap[network][validatorCoinType(cointype)]; ok {
+		v.Exp = exp
 	}
-	if strings.HasPrefix(cointype,"OMNI") {
-		cointype = "BTC"
+	return v
+}
+
+func (v *AddressValidator) IsValidAddress (address string) bool {
+	_, err := v.Validate(address)
+	return err == nil
+}
+
+// Validate 校验地址, 返回地址的网络和类型 (P2PKH, P2SH, P2WPKH 等)
+// 无效时返回 types.ErrInvalidAddress 分类的错误, 说明原因
+// address 包不支持的币种只匹配正则表达式, 返回的 Info 没有网络和类型
+func (v *AddressValidator) Validate (addr string) (*address.Info, error) {
+	if address.Supported(v.cointype) {
+		return address.Validate(v.cointype, v.network, addr)
 	}
-	if strings.HasPrefix(cointype,"EVT") {
-		cointype = "EVT"
+	// 空的正则表达式匹配任何字符串
+	if v.Exp == "" {
+		return nil, types.Errorf(types.ErrInvalidAddress, "no address format for %v", v.cointype)
 	}
-	return &AddressValidator{
-		Exp: RegExpmap[cointype],
+	if match, _ := regexp.MatchString(v.Exp, addr); !match {
+		return nil, types.Errorf(types.ErrInvalidAddress, "%v does not match %v address format", addr, v.cointype)
 	}
+	return &address.Info{Coin: validatorCoinType(v.cointype), Network: v.network}, nil
 }
 
-func (v *AddressValidator) IsValidAddress (address string) bool {
-	match, _ := regexp.MatchString(v.Exp, address)
-	return match
+// ValidateAddress 校验 cointype 在 network 上的地址, network 为空时接受任意网络的地址
+func ValidateAddress (cointype string, network types.Network, addr string) (*address.Info, error) {
+	return NewAddressValidatorForNetwork(cointype, network).Validate(addr)
 }
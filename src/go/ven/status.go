@@ -0,0 +1,61 @@
+package ven
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// vechain 交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 12
+
+// GetTransactionStatus 用 transactions/{id}/receipt 查询交易所在的区块, reverted 的交易是 TxFailed
+func (h *VENHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	threshold := FinalityConfirmations
+	b, err := rpcutils.HttpGetContext(ctx, h.url, "transactions/"+txhash+"/receipt", nil)
+	if err != nil {
+		return nil, err
+	}
+	var receipt *struct {
+		Reverted bool `json:"reverted"`
+		Meta struct {
+			BlockID string `json:"blockID"`
+			BlockNumber uint64 `json:"blockNumber"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(b, &receipt); err != nil {
+		return nil, types.ClassifyError(errors.New("receipt error: " + string(b)))
+	}
+	if receipt == nil {
+		// 没有 receipt, 交易还在交易池里或者不存在
+		switch err := h.pendingError(ctx, txhash); {
+		case errors.Is(err, types.ErrPending):
+			return types.MempoolTxStatus(txhash, threshold), nil
+		case errors.Is(err, types.ErrNotFound):
+			return types.UnknownTxStatus(txhash, threshold), nil
+		default:
+			return nil, err
+		}
+	}
+	b, err = rpcutils.HttpGetContext(ctx, h.url, "blocks/best", nil)
+	if err != nil {
+		return nil, err
+	}
+	var best struct {
+		Number uint64 `json:"number"`
+	}
+	if err := json.Unmarshal(b, &best); err != nil {
+		return nil, types.ClassifyError(errors.New("best block error: " + string(b)))
+	}
+	height := receipt.Meta.BlockNumber
+	status := types.IncludedTxStatus(txhash, height, receipt.Meta.BlockID, types.Confirmations(height, best.Number), threshold)
+	if receipt.Reverted {
+		status.State = types.TxFailed
+	}
+	return status, nil
+}
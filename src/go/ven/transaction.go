@@ -0,0 +1,153 @@
+package ven
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"golang.org/x/crypto/blake2b"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 交易默认参数, 见 thor/tx
+var (
+	// 交易有效期, 单位是区块
+	DefaultExpiration uint32 = 720
+	// 基础 gas 和每个 clause 的 gas
+	TxGas uint64 = 5000
+	ClauseGas uint64 = 16000
+)
+
+// Clause 是 thor 交易里的一次调用, 一笔交易可以有多个 clause
+type Clause struct {
+	To *Address `rlp:"nil"`
+	Value *big.Int
+	Data []byte
+}
+
+// Transaction 是 thor 交易, 字段顺序和 rlp 编码一致
+// Signature 为空时是未签名交易
+type Transaction struct {
+	ChainTag byte
+	BlockRef uint64
+	Expiration uint32
+	Clauses []*Clause
+	GasPriceCoef uint8
+	Gas uint64
+	DependsOn *Bytes32 `rlp:"nil"`
+	Nonce uint64
+	Reserved []interface{}
+	Signature []byte
+}
+
+// SigningHash 是不含签名的交易 rlp 编码的 blake2b-256
+func (tx *Transaction) SigningHash() (hash Bytes32, err error) {
+	b, err := rlp.EncodeToBytes([]interface{}{
+		tx.ChainTag,
+		tx.BlockRef,
+		tx.Expiration,
+		tx.Clauses,
+		tx.GasPriceCoef,
+		tx.Gas,
+		tx.DependsOn,
+		tx.Nonce,
+		tx.Reserved,
+	})
+	if err != nil {
+		return
+	}
+	hash = Bytes32(blake2b.Sum256(b))
+	return
+}
+
+// Encode 返回交易的 rlp 编码, 已签名交易可以直接提交
+func (tx *Transaction) Encode() ([]byte, error) {
+	return rlp.EncodeToBytes(tx)
+}
+
+func DecodeTransaction(b []byte) (*Transaction, error) {
+	tx := new(Transaction)
+	if err := rlp.DecodeBytes(b, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func randomNonce() (nonce uint64, err error) {
+	var b [8]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		return
+	}
+	nonce = binary.BigEndian.Uint64(b[:])
+	return
+}
+
+type blockRes struct {
+	ID string `json:"id"`
+	Number uint64 `json:"number"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+func getBlock(ctx context.Context, url, revision string) (block *blockRes, err error) {
+	b, err := rpcutils.HttpGetContext(ctx, url, "blocks/"+revision, nil)
+	if err != nil {
+		return
+	}
+	block = new(blockRes)
+	if err = json.Unmarshal(b, block); err != nil || block.ID == "" {
+		err = fmt.Errorf("get block %v error: %v", revision, string(b))
+		return
+	}
+	return
+}
+
+// chain tag 是创世块 id 的最后一个字节
+func getChainTag(ctx context.Context, url string) (chainTag byte, err error) {
+	block, err := getBlock(ctx, url, "0")
+	if err != nil {
+		return
+	}
+	id, err := ParseBytes32(block.ID)
+	if err != nil {
+		return
+	}
+	chainTag = id[len(id)-1]
+	return
+}
+
+// block ref 是引用块 id 的前 8 个字节
+func blockRef(blockID string) (ref uint64, err error) {
+	id, err := ParseBytes32(blockID)
+	if err != nil {
+		return
+	}
+	ref = binary.BigEndian.Uint64(id[:8])
+	return
+}
+
+func sendRawTransaction(ctx context.Context, url string, raw []byte) (txhash string, err error) {
+	req, err := json.Marshal(map[string]string{"raw": "0x" + hex.EncodeToString(raw)})
+	if err != nil {
+		return
+	}
+	ret, err := rpcutils.PostJSON(ctx, url, "transactions", string(req))
+	if err != nil {
+		return
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err = json.Unmarshal(ret, &res); err != nil || res.ID == "" {
+		err = types.ClassifyError(fmt.Errorf("submit transaction error: %v", string(ret)))
+		return
+	}
+	txhash = res.ID
+	return
+}
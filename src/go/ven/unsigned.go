@@ -0,0 +1,57 @@
+package ven
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// UnsignedTransaction 是未签名交易和构造交易的地址, MakeSignedTransaction 校验签名者是 From
+type UnsignedTransaction struct {
+	Tx *Transaction
+	From Address
+}
+
+// Encode 返回信封的 payload, rlp 编码的 [tx, from]
+func (utx *UnsignedTransaction) Encode() ([]byte, error) {
+	return rlp.EncodeToBytes(utx)
+}
+
+// DecodeUnsignedTransaction 解码 UnsignedTransaction.Encode 的结果
+func DecodeUnsignedTransaction(b []byte) (*UnsignedTransaction, error) {
+	utx := new(UnsignedTransaction)
+	if err := rlp.DecodeBytes(b, utx); err != nil {
+		return nil, err
+	}
+	return utx, nil
+}
+
+// checkSignature 校验用 v 恢复出的签名者是 From, From 为空时返回 ErrInvalidSignature
+// 返回 65 字节的签名, v 是 0 或 1
+func (utx *UnsignedTransaction) checkSignature(rsv []string) ([]byte, error) {
+	if len(rsv) != 1 {
+		return nil, fmt.Errorf("expect 1 signature, got %v", len(rsv))
+	}
+	if utx.From == (Address{}) {
+		return nil, types.Errorf(types.ErrInvalidSignature, "unsigned transaction has no from address")
+	}
+	hash, err := utx.Tx.SigningHash()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signature.CheckSigner(0, rsv[0], hash[:], func(pub *btcec.PublicKey) bool {
+		return Address(ethcrypto.PubkeyToAddress(*pub.ToECDSA())) == utx.From
+	}, signature.Rules{Recovery: true})
+	if err != nil {
+		return nil, err
+	}
+	b, err := sig.Ethereum()
+	if err != nil {
+		return nil, &types.SignatureError{Index: 0, Err: err}
+	}
+	return b, nil
+}
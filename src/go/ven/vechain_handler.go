@@ -1,19 +1,22 @@
 package ven
 
 import  (
+	"context"
+	"time"
 	"crypto/ecdsa"
 	//"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"math/big"
 	"runtime/debug"
+	"strconv"
 
 
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
@@ -22,11 +25,57 @@ var (
 	err error
 )
 
+// 默认网络
+const DefaultNetwork = types.Mainnet
+
+// vechain 各网络的地址格式相同, chain tag 从节点获取, 网络只决定网关
+var networks = map[types.Network]bool{
+	types.Mainnet: true,
+	types.Testnet: true,
+}
+
 type VENHandler struct {
+	network types.Network
+	url string
+	// 网关配置的十进制 chain tag, 为空时向节点查询
+	chainTag string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
 }
 
 func NewVENHandler () *VENHandler {
-	return &VENHandler{}
+	h, _ := NewVENHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewVENHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewVENHandlerForNetwork (network types.Network) (*VENHandler, error) {
+	return NewVENHandlerFromConfig(network, config.Current())
+}
+
+// NewVENHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 VechainGateway
+func NewVENHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*VENHandler, error) {
+	network = network.Or(DefaultNetwork)
+	if !networks[network] {
+		return nil, types.UnsupportedNetworkError("VEN", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).VechainGateway
+	rpcutils.RegisterApiGateway(gateway, nil, gateways.HealthCheckInterval())
+	if gateway.ChainID != "" {
+		if _, err := strconv.ParseUint(gateway.ChainID, 10, 8); err != nil {
+			return nil, fmt.Errorf("invalid chain tag %q", gateway.ChainID)
+		}
+	}
+	return &VENHandler{
+		network: network,
+		url: gateway.ApiAddress,
+		chainTag: gateway.ChainID,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *VENHandler) Network() types.Network {
+	return h.network
 }
 
 var VEN_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -36,44 +85,284 @@ func (h *VENHandler) GetDefaultFee() *big.Int {
 }
 
 func (h *VENHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	data := hexEncPubkey(pubKeyHex[2:])
-
-	pub, err := decodePubkey(data)
-
-	addressStruct := ethcrypto.PubkeyToAddress(*pub)
+	pub, err := signature.ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return
+	}
+	addressStruct := ethcrypto.PubkeyToAddress(*pub.ToECDSA())
 	address = Address(addressStruct).String()
 	return
 }
 
 func (h *VENHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *VENHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+var SupportedBuildOptions = []string{types.OptGasLimit, types.OptNonce}
+
+func (h *VENHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *VENHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		Balance: true,
+		MultiOutput: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			return networks[n]
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *VENHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "VET",
+		Decimals: 18,
+		SLIP44: 818,
+		AddressFormat: types.AddressHex,
+		SmallestUnit: "wei",
+	}
+}
+
+func (h *VENHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedBatchTransaction(ctx, fromAddress, fromPublicKey, []types.TxOutput{{ToAddress: toAddress, Amount: amount}}, opts)
+}
+
+// 每个收款人一个 clause
+func (h *VENHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		return
+	}
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 chain tag 和最新块, 网关配置了 chain tag 时不查询 chain tag
+// 构造参数没有指定 nonce 时生成随机 nonce
+func (h *VENHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if err := opts.Check("VEN", SupportedBuildOptions...); err != nil {
+		return nil, err
+	}
+	chainID := h.chainTag
+	if chainID == "" {
+		chainTag, err := getChainTag(ctx, h.url)
+		if err != nil {
+			return nil, err
+		}
+		chainID = strconv.Itoa(int(chainTag))
+	}
+	best, err := getBlock(ctx, h.url, "best")
+	if err != nil {
+		return nil, err
+	}
+	state := types.NewChainState("VEN", h.network.String())
+	state.ChainID = chainID
+	state.RefBlock = &types.RefBlock{Number: best.Number, ID: best.ID, Timestamp: best.Timestamp}
+	if opts == nil || opts.Nonce == nil {
+		nonce, err := randomNonce()
+		if err != nil {
+			return nil, err
+		}
+		state.Nonce = &nonce
+	}
+	return state, nil
+}
+
+// Assemble 用 state 的 chain tag, 引用块和 nonce 构造交易, 不访问网络
+func (h *VENHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	if err = state.Check("VEN", h.network.String()); err != nil {
+		return
+	}
+	if err = opts.Check("VEN", SupportedBuildOptions...); err != nil {
+		return
+	}
+	if err = types.CheckOutputs(outputs); err != nil {
+		return
+	}
+	from, err := ParseAddress(fromAddress)
+	if err != nil {
+		err = types.Errorf(types.ErrInvalidAddress, "invalid from address %v: %v", fromAddress, err)
+		return
+	}
+	var clauses []*Clause
+	for _, out := range outputs {
+		to, e := ParseAddress(out.ToAddress)
+		if e != nil {
+			err = types.Errorf(types.ErrInvalidAddress, "invalid to address %v: %v", out.ToAddress, e)
+			return
+		}
+		clauses = append(clauses, &Clause{To: &to, Value: new(big.Int).Set(out.Amount)})
+	}
+	chainTag, err := strconv.ParseUint(state.ChainID, 10, 8)
+	if err != nil {
+		err = types.MissingStateError("chain tag")
+		return
+	}
+	if state.RefBlock == nil {
+		err = types.MissingStateError("ref block")
+		return
+	}
+	ref, err := blockRef(state.RefBlock.ID)
+	if err != nil {
+		return
+	}
+	gas := TxGas + ClauseGas*uint64(len(clauses))
+	if opts != nil && opts.GasLimit != nil {
+		gas = *opts.GasLimit
+	}
+	nonce := state.Nonce
+	if opts != nil && opts.Nonce != nil {
+		nonce = opts.Nonce
+	}
+	if nonce == nil {
+		err = types.MissingStateError("nonce")
+		return
+	}
+	tx := &Transaction{
+		ChainTag: byte(chainTag),
+		BlockRef: ref,
+		Expiration: DefaultExpiration,
+		Clauses: clauses,
+		Gas: gas,
+		Nonce: *nonce,
+		Reserved: []interface{}{},
+	}
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return
+	}
+	transaction = &UnsignedTransaction{Tx: tx, From: from}
+	digests = append(digests, hex.EncodeToString(hash[:]))
 	return
 }
 
 func (h *VENHandler) SignTransaction(hash []string, privateKey interface{}) (rsv []string, err error) {
+	hashBytes, err := hex.DecodeString(hash[0])
+	if err != nil {
+		return
+	}
+	rsvBytes, err := ethcrypto.Sign(hashBytes, privateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		return
+	}
+	rsv = append(rsv, hex.EncodeToString(rsvBytes))
 	return
 }
 
 func (h *VENHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransactionContext(context.Background(), rsv, transaction)
+}
+
+// MakeSignedTransactionContext 校验用 v 恢复出的签名者是构造交易的地址, 失败返回 *types.SignatureError
+func (h *VENHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", transaction)
+		return
+	}
+	sig, err := utx.checkSignature(rsv)
+	if err != nil {
+		return
+	}
+	signedTx := *utx.Tx
+	signedTx.Signature = sig
+	signedTransaction = &signedTx
 	return
 }
 
 func (h *VENHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *VENHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	tx, ok := signedTransaction.(*Transaction)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", signedTransaction)
+		return
+	}
+	if len(tx.Signature) == 0 {
+		err = fmt.Errorf("transaction is not signed")
+		return
+	}
+	raw, err := tx.Encode()
+	if err != nil {
+		return
+	}
+	return sendRawTransaction(ctx, h.url, raw)
+}
+
+// payload 是 rlp 编码的 [tx, from], 见 UnsignedTransaction
+func (h *VENHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	utx, ok := transaction.(*UnsignedTransaction)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	payload, err := utx.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxEnvelope("VEN", h.network.String(), digests, payload), nil
+}
+
+func (h *VENHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("VEN", h.network.String()); err != nil {
+		return
+	}
+	if err = env.CheckMinVersion(types.TxEnvelopeSignerVersion); err != nil {
+		return
+	}
+	utx, err := DecodeUnsignedTransaction(env.Payload)
+	if err != nil {
+		return
+	}
+	transaction = utx
 	return
 }
 
 func (h *VENHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *VENHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
-	b, err := rpcutils.HttpGet(config.VECHAIN_GATEWAY, "transactions/"+txhash+"/receipt", nil)
+	b, err := rpcutils.HttpGetContext(ctx, h.url, "transactions/"+txhash+"/receipt", nil)
 	if err != nil {
 		return
 	}
 	var body interface{}
 	json.Unmarshal(b, &body)
+	if body == nil {
+		// 没有 receipt, 交易还在交易池里或者不存在
+		err = h.pendingError(ctx, txhash)
+		return
+	}
 	transfers := body.(map[string]interface{})["outputs"].([]interface{})[0].(map[string]interface{})["transfers"].([]interface{})
 	for _, transfer := range transfers {
 		fromAddress = transfer.(map[string]interface{})["sender"].(string)
@@ -92,29 +381,42 @@ func (h *VENHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 	return
 }
 
+func (h *VENHandler) pendingError(ctx context.Context, txhash string) error {
+	b, err := rpcutils.HttpGetContext(ctx, h.url, "transactions/"+txhash, map[string][]string{"pending": {"true"}})
+	if err != nil {
+		return err
+	}
+	var tx interface{}
+	json.Unmarshal(b, &tx)
+	if tx == nil {
+		return types.Errorf(types.ErrNotFound, "transaction %v not found", txhash)
+	}
+	return types.ErrPending
+}
+
 func (h *VENHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	return
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
 }
 
-func hexEncPubkey(h string) (ret [64]byte) {
-	b, err := hex.DecodeString(h)
+func (h *VENHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	b, err := rpcutils.HttpGetContext(ctx, h.url, "accounts/"+address, nil)
 	if err != nil {
-		panic(err)
+		return
 	}
-	if len(b) != len(ret) {
-		panic("invalid length")
+	var res struct {
+		Balance string `json:"balance"`
 	}
-	copy(ret[:], b)
-	return ret
-}
-
-func decodePubkey(e [64]byte) (*ecdsa.PublicKey, error) {
-	p := &ecdsa.PublicKey{Curve: ethcrypto.S256(), X: new(big.Int), Y: new(big.Int)}
-	half := len(e) / 2
-	p.X.SetBytes(e[:half])
-	p.Y.SetBytes(e[half:])
-	if !p.Curve.IsOnCurve(p.X, p.Y) {
-		return nil, errors.New("invalid secp256k1 curve point")
+	if err = json.Unmarshal(b, &res); err != nil || res.Balance == "" {
+		err = fmt.Errorf("get balance error: %v", string(b))
+		return
 	}
-	return p, nil
+	balance, ok := new(big.Int).SetString(res.Balance, 0)
+	if !ok {
+		err = fmt.Errorf("parse balance error, got: %v", res.Balance)
+	}
+	return
 }
+
+
@@ -0,0 +1,98 @@
+package xrp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// EstimateFee 估计手续费 (drops)
+// 使用 rippled 的 fee 方法, slow 是 minimum_fee, normal 是 open_ledger_fee, fast 是 median_fee 和 open_ledger_fee 中较大的
+// fee 方法不可用时三档都是 server_info 的 base_fee_xrp * load_factor, 都不可用时三档都是 XRP_DEFAULT_FEE
+func (h *XRPHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if est, err := estimateFee(ctx, h.url); err == nil {
+		return est, nil
+	}
+	if fee, err := serverInfoFee(ctx, h.url); err == nil {
+		return types.FixedFeeEstimate(fee, false), nil
+	}
+	return types.FixedFeeEstimate(XRP_DEFAULT_FEE, true), nil
+}
+
+func estimateFee(ctx context.Context, url string) (*types.FeeEstimate, error) {
+	ret, err := rippledCall(ctx, url, "fee", struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Result struct {
+			Drops struct {
+				MinimumFee string `json:"minimum_fee"`
+				OpenLedgerFee string `json:"open_ledger_fee"`
+				MedianFee string `json:"median_fee"`
+			} `json:"drops"`
+			Status string `json:"status"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil || res.Result.Status != "success" {
+		return nil, fmt.Errorf("fee error: %v", ret)
+	}
+	drops := res.Result.Drops
+	var fees [3]*big.Int
+	for i, s := range []string{drops.MinimumFee, drops.OpenLedgerFee, drops.MedianFee} {
+		fee, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("fee error: %v", ret)
+		}
+		fees[i] = fee
+	}
+	if fees[2].Cmp(fees[1]) < 0 {
+		fees[2] = fees[1]
+	}
+	return &types.FeeEstimate{
+		Slow: types.FeeQuote{Fee: fees[0]},
+		Normal: types.FeeQuote{Fee: fees[1]},
+		Fast: types.FeeQuote{Fee: fees[2]},
+	}, nil
+}
+
+func serverInfoFee(ctx context.Context, url string) (*big.Int, error) {
+	ret, err := rippledCall(ctx, url, "server_info", struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Result struct {
+			Info struct {
+				LoadFactor json.Number `json:"load_factor"`
+				ValidatedLedger struct {
+					BaseFeeXRP json.Number `json:"base_fee_xrp"`
+				} `json:"validated_ledger"`
+			} `json:"info"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return nil, fmt.Errorf("server_info error: %v", ret)
+	}
+	info := res.Result.Info
+	baseFee, err := types.ParseUnits(info.ValidatedLedger.BaseFeeXRP.String(), Decimals)
+	if err != nil {
+		return nil, err
+	}
+	if info.LoadFactor == "" {
+		return baseFee, nil
+	}
+	// load_factor 可能是小数, 按 6 位小数计算后取整
+	loadFactor, err := types.ParseUnits(info.LoadFactor.String(), 6)
+	if err != nil {
+		return nil, err
+	}
+	fee := new(big.Int).Mul(baseFee, loadFactor)
+	return fee.Div(fee, big.NewInt(1000000)), nil
+}
@@ -0,0 +1,98 @@
+package xrp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+	"github.com/rubblelabs/ripple/data"
+)
+
+// 瑞波时间从 2000-01-01 开始计算
+const rippleEpoch = 946684800
+
+// GetAddressHistory 用 rippled 的 account_tx 查询地址的 XRP 转账, 游标是 account_tx 返回的 marker
+// 只列出执行成功的 XRP Payment, 金额是实际到账的 delivered_amount
+func (h *XRPHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	if _, err := data.NewAccountFromAddress(address); err != nil {
+		return nil, types.Errorf(types.ErrInvalidAddress, "invalid address %v: %v", address, err)
+	}
+	params := map[string]interface{}{
+		"account": address,
+		"ledger_index_min": -1,
+		"ledger_index_max": -1,
+		"limit": page.PageLimit(),
+		"forward": false,
+	}
+	if page.Cursor != "" {
+		params["marker"] = json.RawMessage(page.Cursor)
+	}
+	ret, err := rippledCall(ctx, h.url, "account_tx", params)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Result struct {
+			Error string `json:"error"`
+			ErrorMessage string `json:"error_message"`
+			Marker json.RawMessage `json:"marker"`
+			Transactions []struct {
+				Meta struct {
+					TransactionResult string `json:"TransactionResult"`
+					DeliveredAmount interface{} `json:"delivered_amount"`
+				} `json:"meta"`
+				Tx struct {
+					TransactionType string `json:"TransactionType"`
+					Account string `json:"Account"`
+					Destination string `json:"Destination"`
+					Hash string `json:"hash"`
+					LedgerIndex uint64 `json:"ledger_index"`
+					Date int64 `json:"date"`
+				} `json:"tx"`
+			} `json:"transactions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return nil, types.Errorf(types.ErrGatewayUnavailable, "account_tx error: %v", ret)
+	}
+	result := res.Result
+	if result.Error != "" {
+		return nil, types.ClassifyError(fmt.Errorf("%v, error message: %v", result.Error, result.ErrorMessage))
+	}
+	hist := &types.HistoryPage{}
+	if len(result.Marker) > 0 && string(result.Marker) != "null" {
+		hist.NextCursor = string(result.Marker)
+	}
+	for _, t := range result.Transactions {
+		// IOU 的 delivered_amount 是对象, 只列出 XRP (drops 字符串)
+		drops, ok := t.Meta.DeliveredAmount.(string)
+		if t.Tx.TransactionType != "Payment" || t.Meta.TransactionResult != "tesSUCCESS" || !ok {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(drops, 10)
+		if !ok {
+			continue
+		}
+		transfer := types.Transfer{
+			TxHash: t.Tx.Hash,
+			Direction: types.DirectionIn,
+			Counterparty: t.Tx.Account,
+			Amount: amount,
+			BlockHeight: t.Tx.LedgerIndex,
+			Timestamp: t.Tx.Date + rippleEpoch,
+		}
+		if t.Tx.Account == address {
+			transfer.Direction = types.DirectionOut
+			transfer.Counterparty = t.Tx.Destination
+		} else if t.Tx.Destination != address {
+			continue
+		}
+		hist.Transfers = append(hist.Transfers, transfer)
+	}
+	return hist, nil
+}
@@ -0,0 +1,58 @@
+package xrp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
+	"github.com/gaozhengxin/cryptocoins/src/go/types"
+)
+
+// 进入验证过的账本 (validated ledger) 后交易不会被回滚
+var FinalityConfirmations uint64 = 1
+
+// GetTransactionStatus 用 rippled 的 tx 方法查询交易状态
+// 结果不是 tesSUCCESS 的交易 (tec 结果) 也会进入账本并扣除手续费, 这时是 TxFailed
+func (h *XRPHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	threshold := FinalityConfirmations
+	ret, err := rippledCall(ctx, h.url, "tx", map[string]interface{}{"transaction": txhash, "binary": false})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Result struct {
+			Error string `json:"error"`
+			ErrorMessage string `json:"error_message"`
+			LedgerIndex uint64 `json:"ledger_index"`
+			Validated bool `json:"validated"`
+			Meta *struct {
+				TransactionResult string `json:"TransactionResult"`
+			} `json:"meta"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(ret), &res); err != nil {
+		return nil, err
+	}
+	result := res.Result
+	if result.Error == "txnNotFound" {
+		return types.UnknownTxStatus(txhash, threshold), nil
+	}
+	if result.Error != "" {
+		return nil, types.ClassifyError(fmt.Errorf("%v, error message: %v", result.Error, result.ErrorMessage))
+	}
+	if result.LedgerIndex == 0 {
+		return types.MempoolTxStatus(txhash, threshold), nil
+	}
+	var confirmations uint64
+	if result.Validated {
+		confirmations = 1
+	}
+	status := types.IncludedTxStatus(txhash, result.LedgerIndex, "", confirmations, threshold)
+	if result.Validated && result.Meta != nil && result.Meta.TransactionResult != "tesSUCCESS" {
+		status.State = types.TxFailed
+	}
+	return status, nil
+}
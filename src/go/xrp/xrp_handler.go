@@ -1,12 +1,14 @@
 package xrp
 
 import (
+	"bytes"
+	"context"
+	"time"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"math"
 	"math/big"
-	"net/http"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -15,26 +17,69 @@ import (
 	"github.com/rubblelabs/ripple/data"
 
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/secrets"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	rpcutils "github.com/gaozhengxin/cryptocoins/src/go/rpcutils"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
 var (
 	fee int64 = 1
-	url = config.ApiGateways.RippleGateway.ApiAddress
 )
 
+// 下面的 parseXxx 和 XRP_xxx 函数不返回错误, 出错时 panic, 由调用方 recover
 func checkErr(err error) {
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		panic(err)
 	}
 }
 
-type XRPHandler struct {}
+// 默认网络
+const DefaultNetwork = types.Testnet
+
+// 1 XRP = 10^6 drops
+const Decimals = 6
+
+// ripple 各网络的地址格式相同, 网络只决定网关
+var networks = map[types.Network]bool{
+	types.Mainnet: true,
+	types.Testnet: true,
+}
+
+type XRPHandler struct {
+	network types.Network
+	url string
+	// 网关请求的超时, 见 rpcutils.WithTimeout
+	timeout time.Duration
+}
 
 func NewXRPHandler () *XRPHandler {
-	return &XRPHandler{}
+	h, _ := NewXRPHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewXRPHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewXRPHandlerForNetwork (network types.Network) (*XRPHandler, error) {
+	return NewXRPHandlerFromConfig(network, config.Current())
+}
+
+// NewXRPHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 RippleGateway
+func NewXRPHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*XRPHandler, error) {
+	network = network.Or(DefaultNetwork)
+	if !networks[network] {
+		return nil, types.UnsupportedNetworkError("XRP", network)
+	}
+	gateway := gateways.ForNetwork(string(network)).RippleGateway
+	rpcutils.RegisterApiGateway(gateway, rpcutils.RippledProbe, gateways.HealthCheckInterval())
+	return &XRPHandler{
+		network: network,
+		url: gateway.ApiAddress,
+		timeout: gateways.ForNetwork(string(network)).Timeout(),
+	}, nil
+}
+
+func (h *XRPHandler) Network() types.Network {
+	return h.network
 }
 
 var XRP_DEFAULT_FEE, _ = new(big.Int).SetString("1",10)
@@ -44,24 +89,89 @@ func (h *XRPHandler) GetDefaultFee() *big.Int {
 }
 
 func (h *XRPHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	pub, err := hex.DecodeString(pubKeyHex)
-	address = XRP_publicKeyToAddress(pub)
+	pub, err := signature.ParsePublicKey(pubKeyHex)
+	if err != nil {
+		return
+	}
+	// ripple 的账户是压缩公钥的 hash160
+	address = XRP_publicKeyToAddress(pub.SerializeCompressed())
 	return
 }
 
 // jsonstring:'{"fee":1}'
 func (h *XRPHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *XRPHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+// nonce 对应 ripple 的 Sequence
+var SupportedBuildOptions = []string{types.OptFee, types.OptDestinationTag, types.OptNonce}
+
+func (h *XRPHandler) SupportedBuildOptions() []string {
+	return SupportedBuildOptions
+}
+
+func (h *XRPHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		Build: true,
+		Sign: true,
+		Submit: true,
+		TxLookup: true,
+		TxStatus: true,
+		History: true,
+		Balance: true,
+		FeeEstimate: true,
+		OfflineBuild: true,
+		BuildOptions: SupportedBuildOptions,
+		Networks: types.Networks(func(n types.Network) bool {
+			return networks[n]
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *XRPHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "XRP",
+		Decimals: Decimals,
+		SLIP44: 144,
+		AddressFormat: types.AddressRipple,
+		SmallestUnit: "drop",
+	}
+}
+
+func (h *XRPHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	outputs := []types.TxOutput{{ToAddress: toAddress, Amount: amount}}
+	state, err := h.FetchChainState(ctx, fromAddress, fromPublicKey, outputs, opts)
+	if err != nil {
+		return
+	}
+	return h.Assemble(state, fromAddress, fromPublicKey, outputs, opts)
+}
+
+// FetchChainState 查询 fromAddress 当前的 Sequence, 构造参数指定了 nonce 时不访问网络
+func (h *XRPHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (state *types.ChainState, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
-	var args interface{}
-	json.Unmarshal([]byte(jsonstring), &args)
-	userFee := args.(map[string]interface{})["fee"]
-	if userFee != nil {
-		fee = int64(userFee.(float64))
+	if err = opts.Check("XRP", SupportedBuildOptions...); err != nil {
+		return
+	}
+	state = types.NewChainState("XRP", h.network.String())
+	if opts != nil && opts.Nonce != nil {
+		return
 	}
 	if fromAddress == "" {
 		fromAddress, err = h.PublicKeyToAddress(fromPublicKey)
@@ -69,11 +179,76 @@ func (h *XRPHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddr
 			return
 		}
 	}
-	pub, err := hex.DecodeString(fromPublicKey)
-	xrp_pubKey := XRP_importPublicKey(pub)
+	txseq, err := getSeq(ctx, h.url, fromAddress)
+	if err != nil {
+		return
+	}
+	seq := uint64(txseq)
+	state.Nonce = &seq
+	return
+}
+
+// Assemble 用 state 的 Sequence 构造 Payment, 不访问网络
+func (h *XRPHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	if opts == nil {
+		opts = &types.BuildOptions{}
+	}
+	if err = state.Check("XRP", h.network.String()); err != nil {
+		return
+	}
+	if err = opts.Check("XRP", SupportedBuildOptions...); err != nil {
+		return
+	}
+	if len(outputs) != 1 {
+		err = fmt.Errorf("XRP: %w", types.ErrBatchNotSupported)
+		return
+	}
+	toAddress, amount := outputs[0].ToAddress, outputs[0].Amount
+	txFee := fee
+	if opts.Fee != nil {
+		if !opts.Fee.IsInt64() {
+			err = fmt.Errorf("invalid build option fee: %v", opts.Fee)
+			return
+		}
+		txFee = opts.Fee.Int64()
+	}
+	nonce := opts.Nonce
+	if nonce == nil {
+		nonce = state.Nonce
+	}
+	if nonce == nil {
+		err = types.MissingStateError("sequence")
+		return
+	}
+	if *nonce > math.MaxUint32 {
+		err = fmt.Errorf("invalid sequence: %v", *nonce)
+		return
+	}
+	if _, err1 := data.NewAccountFromAddress(toAddress); err1 != nil {
+		err = types.Errorf(types.ErrInvalidAddress, "invalid address %v: %v", toAddress, err1)
+		return
+	}
+	pk, err := signature.ParsePublicKey(fromPublicKey)
+	if err != nil {
+		return
+	}
+	// SigningPubKey 是 33 字节的压缩公钥
+	xrp_pubKey := XRP_importPublicKey(pk.SerializeCompressed())
 	amt := amount.String()
-	txseq := getSeq(fromAddress)
-	transaction, hash, _ := XRP_newUnsignedPaymentTransaction(xrp_pubKey, nil, txseq, toAddress, amt, fee, "", false, false, false)
+	transaction, hash, _ := XRP_newUnsignedPaymentTransaction(xrp_pubKey, nil, uint32(*nonce), toAddress, amt, txFee, "", false, false, false)
+	if opts.DestinationTag != nil {
+		transaction.(*data.Payment).DestinationTag = opts.DestinationTag
+		hash, _, err = data.SigningHash(transaction.(*data.Payment))
+		if err != nil {
+			return
+		}
+	}
 	digests = append(digests, hash.String())
 	return
 }
@@ -94,67 +269,156 @@ func (h *XRPHandler) SignTransaction(hash []string, privateKey interface{}) (rsv
 		return
 	}
 
-	sig, err := crypto.Sign(key.Private(&keyseq), hashBytes, nil)
+	der, err := crypto.Sign(key.Private(&keyseq), hashBytes, nil)
 	if err != nil {
 		return
 	}
-	signature, err := btcec.ParseSignature(sig, btcec.S256())
-	fmt.Printf("==================\n!!!!! signature is %+v\n==================\n\n", signature)
+	sig, err := signature.ParseDER(der)
 	if err != nil {
 		return
 	}
-	rx := fmt.Sprintf("%X", signature.R)
-	rx = make64(rx)
-	sx := fmt.Sprintf("%X", signature.S)
-	sx = make64(sx)
-	rsv = append(rsv, rx + sx + "00")
+	pub, err := btcec.ParsePubKey(key.Public(&keyseq), btcec.S256())
+	if err != nil {
+		return
+	}
+	if err = sig.Normalize().SetRecoveryID(hashBytes, pub); err != nil {
+		return
+	}
+	rsv = append(rsv, sig.String())
 	return
 }
 
+// MakeSignedTransaction 校验签名是 SigningPubKey 对交易的 signing hash 的签名, 失败返回 *types.SignatureError
 func (h *XRPHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
-	sig := rsvToSig(rsv[0])
-	signedTransaction = XRP_makeSignedTx(transaction.(data.Transaction), sig)
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	tx, ok := transaction.(data.Transaction)
+	if !ok {
+		err = fmt.Errorf("unexpected transaction type %T", transaction)
+		return
+	}
+	if len(rsv) != 1 {
+		err = fmt.Errorf("expect 1 signature, got %v", len(rsv))
+		return
+	}
+	signingPubKey := tx.GetPublicKey()
+	if signingPubKey == nil {
+		err = fmt.Errorf("transaction has no SigningPubKey")
+		return
+	}
+	pub, err := btcec.ParsePubKey(signingPubKey.Bytes(), btcec.S256())
+	if err != nil {
+		err = fmt.Errorf("invalid SigningPubKey: %v", err)
+		return
+	}
+	hash, _, err := data.SigningHash(tx)
+	if err != nil {
+		return
+	}
+	// rippled 只接受 fully canonical 的签名, DER 会把 S 规范化成 low S
+	sig, err := signature.Check(0, rsv[0], hash.Bytes(), pub, signature.Rules{})
+	if err != nil {
+		return
+	}
+	signedTransaction = XRP_makeSignedTx(tx, sig.DER())
 	return
 }
 
+func (h *XRPHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
+}
+
 func (h *XRPHandler) SubmitTransaction(signedTransaction interface{}) (txhash string, err error) {
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *XRPHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (txhash string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
 	defer func () {
 		if e := recover(); e != nil {
 			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
 			return
 		}
 	} ()
-fmt.Printf("++++++++++++++++++++++++\n%+v\n++++++++++++++++++++++++\n",signedTransaction)
-	ret := XRP_submitTx(signedTransaction.(data.Transaction))
+	ret, err := submitTx(ctx, h.url, signedTransaction.(data.Transaction))
+	if err != nil {
+		return
+	}
 
 	var retStruct interface{}
 	json.Unmarshal([]byte(ret), &retStruct)
 	result := retStruct.(map[string]interface{})["result"].(map[string]interface{})
 	if result["error"] != nil {
 		txhash = ""
-		err = fmt.Errorf("%v, %v Error message: %v", result["error"], result["error_exception"], result["error_message"])
+		err = types.ClassifyError(fmt.Errorf("%v, %v Error message: %v", result["error"], result["error_exception"], result["error_message"]))
 		return
 	}
-fmt.Printf("%+v\n\n",result)
 	if result["engine_result_message"].(string) == "The transaction was applied. Only final in a validated ledger." {
 		txhash = result["tx_json"].(map[string]interface{})["hash"].(string)
 	} else if res := result["engine_result_message"].(string); res != "" {
-		err = fmt.Errorf(res)
+		err = engineResultError(result["engine_result"], res)
 	}
 
 	return
 }
 
+// rippled 的 engine_result, 见 https://xrpl.org/transaction-results.html
+var engineResultKinds = map[string]error{
+	"tefALREADY": types.ErrAlreadyKnown,
+	"tefPAST_SEQ": types.ErrNonceConflict,
+	"terPRE_SEQ": types.ErrNonceConflict,
+	"tefMAX_LEDGER": types.ErrNonceConflict,
+	"telINSUF_FEE_P": types.ErrFeeTooLow,
+	"telCAN_NOT_QUEUE_FEE": types.ErrFeeTooLow,
+	"terINSUF_FEE_B": types.ErrInsufficientFunds,
+	"tecUNFUNDED_PAYMENT": types.ErrInsufficientFunds,
+	"tecINSUFFICIENT_RESERVE": types.ErrInsufficientFunds,
+	"tecNO_DST_INSUF_XRP": types.ErrInsufficientFunds,
+}
+
+func engineResultError(engineResult interface{}, message string) error {
+	err := fmt.Errorf("%v: %v", engineResult, message)
+	if code, ok := engineResult.(string); ok {
+		if kind, ok := engineResultKinds[code]; ok {
+			return types.WrapError(kind, err)
+		}
+	}
+	return types.ClassifyError(err)
+}
+
 func (h *XRPHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	data := "{\"method\":\"tx\", \"params\":[{\"transaction\":\"" + txhash + "\", \"binary\":false}]}"
-	ret := rpcutils.DoPostRequest(url, "", data)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *XRPHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	ret, err := rippledCall(ctx, h.url, "tx", map[string]interface{}{"transaction": txhash, "binary": false})
+	if err != nil {
+		return
+	}
 
 	var retStruct interface{}
 	json.Unmarshal([]byte(ret), &retStruct)
 	result := retStruct.(map[string]interface{})["result"].(map[string]interface{})
 
 	if result["error"] != nil {
-		err = fmt.Errorf("%v, error code: %v,  error message: %v", result["error"].(string), result["error_code"].(float64), result["error_message"].(string))
+		err = types.ClassifyError(fmt.Errorf("%v, error code: %v,  error message: %v", result["error"].(string), result["error_code"].(float64), result["error_message"].(string)))
+		return
+	}
+	if validated, _ := result["validated"].(bool); !validated {
+		err = types.ErrPending
 		return
 	}
 
@@ -170,8 +434,26 @@ func (h *XRPHandler) GetTransactionInfo(txhash string) (fromAddress string, txOu
 }
 
 func (h *XRPHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	account := getAccount(address)
-	balance, _ = new(big.Int).SetString(account.Balance, 10)
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *XRPHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	ctx, cancel := rpcutils.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+	account, err := getAccount(ctx, h.url, address)
+	if err != nil {
+		return
+	}
+	balance, ok := new(big.Int).SetString(account.Balance, 10)
+	if !ok {
+		err = types.Errorf(types.ErrNotFound, "cannot get balance of %v", address)
+	}
 	return
 }
 
@@ -201,21 +483,10 @@ type JsonRet struct {
 	Result Account_info_Res
 }
 
-func rsvToSig(rsv string) []byte {
-	b, _ := hex.DecodeString(rsv)
-	rx := hex.EncodeToString(b[:32])
-	sx := hex.EncodeToString(b[32:64])
-	r, _ := new(big.Int).SetString(rx, 16)
-	s, _ := new(big.Int).SetString(sx, 16)
-	signature := &btcec.Signature{
-		R: r,
-		S: s,
-	}
-	return signature.Serialize()
-}
-
 type Account_info_Res struct {
-	Account_data Account
+	Account_data *Account
+	Error string `json:"error"`
+	ErrorMessage string `json:"error_message"`
 }
 
 type Account struct {
@@ -223,76 +494,122 @@ type Account struct {
 	Sequence uint32
 }
 
-func make64 (str string) string {
-	for l := len(str); l < 64; l++ {
-		str = "0" + str
+// getAccount 用 account_info 查询帐户
+// 帐户不存在 (actNotFound) 是 ErrNotFound, 节点的其它错误不认识时是 ErrGatewayUnavailable
+func getAccount(ctx context.Context, url string, address string) (Account, error) {
+	ret, err := rippledCall(ctx, url, "account_info", map[string]string{"account": address})
+	if err != nil {
+		return Account{}, err
 	}
-	return str
-}
-
-func getAccount (address string) (Account) {
-	// TODO
-	reader := strings.NewReader("{\"method\":\"account_info\",\"params\":[{\"account\":\"" + address + "\"}]}")
-        request, err := http.NewRequest("POST", url, reader)
-        checkErr(err)
-        client := &http.Client{}
-        resp, err := client.Do(request)
-        checkErr(err)
-        defer resp.Body.Close()
-        body, err := ioutil.ReadAll(resp.Body)
 	jsonRet := new(JsonRet)
-	err = json.Unmarshal(body, jsonRet)
-	checkErr(err)
-	return jsonRet.Result.Account_data
+	if err := json.Unmarshal([]byte(ret), jsonRet); err != nil {
+		return Account{}, types.Errorf(types.ErrGatewayUnavailable, "account_info error: %v", ret)
+	}
+	result := jsonRet.Result
+	if result.Error == "actNotFound" {
+		return Account{}, types.Errorf(types.ErrNotFound, "account %v not found", address)
+	}
+	if result.Error != "" {
+		err = types.ClassifyError(fmt.Errorf("account_info %v: %v, error message: %v", address, result.Error, result.ErrorMessage))
+		if types.ErrorKind(err) == nil {
+			err = types.WrapError(types.ErrGatewayUnavailable, err)
+		}
+		return Account{}, err
+	}
+	if result.Account_data == nil {
+		return Account{}, types.Errorf(types.ErrGatewayUnavailable, "account_info %v: no account_data in %v", address, ret)
+	}
+	return *result.Account_data, nil
 }
 
 // 查帐户目前的sequence
-func getSeq(address string) uint32 {
-	account := getAccount(address)
-	return account.Sequence
+func getSeq(ctx context.Context, url string, address string) (uint32, error) {
+	account, err := getAccount(ctx, url, address)
+	if err != nil {
+		return 0, err
+	}
+	return account.Sequence, nil
 }
 
-func XRP_newUnsignedSimplePaymentTransaction(fromAddress string, publicKey []byte, toAddress string, amount *big.Int, fee int64) (data.Transaction, data.Hash256, []byte) {
+// url 是 rippled 的地址, 一般是 handler 的网关, 见 XRPHandler.Remit
+func XRP_newUnsignedSimplePaymentTransaction(url string, fromAddress string, publicKey []byte, toAddress string, amount *big.Int, fee int64) (tx data.Transaction, hash data.Hash256, msg []byte, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
 	dcrm_key := XRP_importPublicKey(publicKey)
-	z := new(big.Int).Div(amount, big.NewInt(1000000))
-	d := new(big.Int).Sub(amount, new(big.Int).Mul(amount, big.NewInt(1000000)))
-	amt := z.String() + "." + d.String() + "/XRP/" + fromAddress
-	dcrm_txseq := getSeq(fromAddress)  // 一般是1
-	return XRP_newUnsignedPaymentTransaction(dcrm_key, nil, dcrm_txseq, toAddress, amt, fee, "", false, false, false)
+	amt := types.FormatUnits(amount, Decimals) + "/XRP/" + fromAddress
+	dcrm_txseq, err := getSeq(context.Background(), url, fromAddress)  // 一般是1
+	if err != nil {
+		return
+	}
+	tx, hash, msg = XRP_newUnsignedPaymentTransaction(dcrm_key, nil, dcrm_txseq, toAddress, amt, fee, "", false, false, false)
+	return
+}
+
+// Remit 用 seed 的帐户向 toaddress 转账, 交易发给 handler 的网关, 返回 submit 的结果
+func (h *XRPHandler) Remit(seed string, cryptoType string, keyseq *uint32, toaddress string, amount *big.Int, fee int64) (string, error) {
+	return XRP_Remit(h.url, seed, cryptoType, keyseq, toaddress, amount, fee)
 }
 
-// 普通xrp转账
-func XRP_Remit(seed string, cryptoType string, keyseq *uint32, toaddress string, amount *big.Int, fee int64) {
+// FundAddress 见 XRP_FundAddress, 交易发给 handler 的网关
+func (h *XRPHandler) FundAddress(toaddress string) (string, error) {
+	return XRP_FundAddress(h.url, toaddress)
+}
+
+// 普通xrp转账, url 是 rippled 的地址, 返回 submit 的结果
+func XRP_Remit(url string, seed string, cryptoType string, keyseq *uint32, toaddress string, amount *big.Int, fee int64) (res string, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
         key := XRP_importKeyFromSeed(seed, cryptoType)
         fromaddress := XRP_getAddress(key, keyseq)
-        txseq := getSeq(fromaddress)
-	z := new(big.Int).Div(amount, big.NewInt(1000000))
-	d := new(big.Int).Sub(amount, new(big.Int).Mul(z, big.NewInt(1000000)))
-	amt := z.String() + "." + d.String() + "/XRP/" + fromaddress
+        txseq, err := getSeq(context.Background(), url, fromaddress)
+        if err != nil {
+                return
+        }
+	amt := types.FormatUnits(amount, Decimals) + "/XRP/" + fromaddress
         tx, hash, _ := XRP_newUnsignedPaymentTransaction(key, keyseq, txseq, toaddress, amt, fee, "", false, false, false)
         sig := XRP_getSig(tx, key, keyseq, hash, nil)
         signedTx := XRP_makeSignedTx(tx, sig)
-        res := XRP_submitTx(signedTx)
-        fmt.Println(res)
+        return XRP_submitTx(url, signedTx)
 }
 
+// 大帐户 seed 的 secret 名, 见 XRP_FundAddress
+const XRP_FUND_SEED_SECRET = "XRP_FUND_SEED"
+
 // 给一个地址打10000块钱激活, 需要一个有足够钱的大帐户
-// 大帐户地址: rwLc28nRV7WZiBv6vsHnpxUGAVcj8qpAtE
-// 大帐户seed: ssfL5tmpTTqCw5sHjnRHQ4yyUCQKf
+// 大帐户seed 从 secret XRP_FUND_SEED_SECRET 读取, 见 secrets.Lookup
 // 大帐户密钥类型: ecdsa  keysequence: 0
-func XRP_FundAddress(toaddress string) {
-        key := XRP_importKeyFromSeed("ssfL5tmpTTqCw5sHjnRHQ4yyUCQKf","ecdsa")
+// 返回 submit 的结果
+func XRP_FundAddress(url string, toaddress string) (res string, err error) {
+	defer func () {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("Runtime error: %v\n%v", e, string(debug.Stack()))
+			return
+		}
+	} ()
+        seed, err := secrets.Lookup(XRP_FUND_SEED_SECRET)
+        if err != nil {
+                return
+        }
+        key := XRP_importKeyFromSeed(seed,"ecdsa")
         keyseq := uint32(0)
+        fromaddress := XRP_getAddress(key, &keyseq)
         txseq := uint32(1)  // 新帐户是1
-        tx, hash, msg := XRP_newUnsignedPaymentTransaction(key, &keyseq, txseq, toaddress, "10000/XRP/rwLc28nRV7WZiBv6vsHnpxUGAVcj8qpAtE", int64(10), "", false, false, false)
+        tx, hash, msg := XRP_newUnsignedPaymentTransaction(key, &keyseq, txseq, toaddress, "10000/XRP/" + fromaddress, int64(10), "", false, false, false)
 
         // 签名
         sig := XRP_getSig(tx, key, &keyseq, hash, msg)
 
         // 构造交易结构, 发送交易
         XRP_makeSignedTx(tx, sig)
-        res := XRP_submitTx(tx)
-        fmt.Printf("%v\n",res)
+        return XRP_submitTx(url, tx)
 }
 
 // keyseq is only supported by ecdsa, leave nil when key crypto type is ed25519
@@ -353,12 +670,58 @@ func XRP_makeSignedTx(tx data.Transaction, sig []byte) data.Transaction {
 	return tx
 }
 
-func XRP_submitTx(signedTx data.Transaction) string {
+// XRP_submitTx 把交易发给地址是 url 的 rippled, 返回 submit 的响应
+func XRP_submitTx(url string, signedTx data.Transaction) (string, error) {
+	return XRP_submitTxContext(context.Background(), url, signedTx)
+}
+
+func XRP_submitTxContext(ctx context.Context, url string, signedTx data.Transaction) (string, error) {
+	return submitTx(ctx, url, signedTx)
+}
+
+func submitTx(ctx context.Context, url string, signedTx data.Transaction) (string, error) {
 	_, raw, err := data.Raw(signedTx)
-	checkErr(err)
+	if err != nil {
+		return "", err
+	}
 	txBlob := fmt.Sprintf("%X", raw)
+	return rippledCall(ctx, url, "submit", map[string]string{"tx_blob": txBlob})
+}
 
-	data := "{\"method\":\"submit\",\"params\":[{\"tx_blob\":\"" + txBlob + "\"}]}"
+// rippledCall 发送 rippled 的 json-rpc 请求 method, params 是请求参数
+func rippledCall(ctx context.Context, url, method string, params interface{}) (string, error) {
+	req, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": []interface{}{params},
+	})
+	if err != nil {
+		return "", err
+	}
+	ret, err := rpcutils.PostJSON(ctx, url, "", string(req))
+	return string(ret), err
+}
+
+// payload 是 ripple 二进制编码的交易, 包含 SigningPubKey
+func (h *XRPHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	tx, ok := transaction.(data.Transaction)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transaction type %T", transaction)
+	}
+	_, payload, err := data.Raw(tx)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxEnvelope("XRP", h.network.String(), digests, payload), nil
+}
 
-	return rpcutils.DoPostRequest(url, "", data)
+func (h *XRPHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	if err = env.Check("XRP", h.network.String()); err != nil {
+		return
+	}
+	tx, err := data.ReadTransaction(bytes.NewReader(env.Payload))
+	if err != nil {
+		return
+	}
+	transaction = tx
+	return
 }
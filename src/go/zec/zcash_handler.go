@@ -1,31 +1,58 @@
 package zec
 
 import (
-	"encoding/hex"
-	"fmt"
+	"context"
 	"math/big"
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
 	"github.com/gaozhengxin/cryptocoins/src/go/btc"
 	"github.com/gaozhengxin/cryptocoins/src/go/config"
+	"github.com/gaozhengxin/cryptocoins/src/go/signature"
 	"github.com/gaozhengxin/cryptocoins/src/go/types"
 )
 
-var ChainConfig = chaincfg.Params {
-	PubKeyHashAddrID: 0x4b,
+// 默认网络
+const DefaultNetwork = types.Mainnet
+
+// 各网络的链参数
+var chainConfigs = map[types.Network]*chaincfg.Params{
+	types.Mainnet: {Name: "mainnet", PubKeyHashAddrID: 0x4b},
 }
 
 var allowHighFees = true
 
 type ZECHandler struct {
+	network types.Network
+	chainConfig *chaincfg.Params
 	btcHandler *btc.BTCHandler
 }
 
 func NewZECHandler () *ZECHandler {
-	return &ZECHandler{
-		btcHandler: btc.NewBTCHandlerWithConfig(config.ZCASH_SERVER_HOST,config.ZCASH_SERVER_PORT,config.ZCASH_USER,config.ZCASH_PASSWD,config.ZCASH_USESSL),
+	h, _ := NewZECHandlerForNetwork(DefaultNetwork)
+	return h
+}
+
+// NewZECHandlerForNetwork 用进程默认的网关配置 config.Current() 创建 network 的 handler
+func NewZECHandlerForNetwork (network types.Network) (*ZECHandler, error) {
+	return NewZECHandlerFromConfig(network, config.Current())
+}
+
+// NewZECHandlerFromConfig 创建 network 的 handler, 网关使用 gateways 里 network 的 ZcashGateway
+func NewZECHandlerFromConfig (network types.Network, gateways *config.ApiGatewayConfigs) (*ZECHandler, error) {
+	network = network.Or(DefaultNetwork)
+	params, ok := chainConfigs[network]
+	if !ok {
+		return nil, types.UnsupportedNetworkError("ZCASH", network)
 	}
+	return &ZECHandler{
+		network: network,
+		chainConfig: params,
+		btcHandler: btc.NewBTCHandlerForChain(network, params, gateways.ForNetwork(string(network)).ZcashGateway, gateways.HealthCheckInterval(), gateways.ForNetwork(string(network)).Timeout()),
+	}, nil
+}
+
+func (h *ZECHandler) Network() types.Network {
+	return h.network
 }
 
 var ZEC_DEFAULT_FEE, _ = new(big.Int).SetString("50000",10)
@@ -34,21 +61,19 @@ func (h *ZECHandler) GetDefaultFee() *big.Int {
 	return ZEC_DEFAULT_FEE
 }
 
+// EstimateFee 用节点的 estimatesmartfee 估计手续费, 节点无法估计时三档都是 ZEC_DEFAULT_FEE
+func (h *ZECHandler) EstimateFee(ctx context.Context, fromAddress, toAddress string, amount *big.Int) (*types.FeeEstimate, error) {
+	return h.btcHandler.EstimateFeeWithFallback(ctx, fromAddress, toAddress, amount, ZEC_DEFAULT_FEE)
+}
+
 func (h *ZECHandler) PublicKeyToAddress(pubKeyHex string) (address string, err error) {
-	if pubKeyHex[:2] == "0x" || pubKeyHex[:2] == "0X" {
-		pubKeyHex = pubKeyHex[2:]
-	}
-	bb, err := hex.DecodeString(pubKeyHex)
-	if err != nil {
-		return
-	}
-	pubKey, err := btcec.ParsePubKey(bb, btcec.S256())
+	pubKey, err := signature.ParsePublicKey(pubKeyHex)
 	if err != nil {
 		return
 	}
 	b := pubKey.SerializeCompressed()
 	pkHash := btcutil.Hash160(b)
-	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, &ChainConfig)
+	addressPubKeyHash, err := btcutil.NewAddressPubKeyHash(pkHash, h.chainConfig)
 	if err != nil {
 		return
 	}
@@ -57,33 +82,124 @@ func (h *ZECHandler) PublicKeyToAddress(pubKeyHex string) (address string, err e
 	return
 }
 
-// NOT completed, may or not work
+// Overwinter 之后 zcash 的交易格式和签名 digest 都和 btc 不同, btc 构造的交易会被节点拒绝, 还没有实现
+// 构造, 签名和提交都返回 types.ErrNotSupported, 见 Capabilities
 func (h *ZECHandler) BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
-	transaction, digests, err = h.btcHandler.BuildUnsignedTransaction(fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+	return h.BuildUnsignedTransactionContext(context.Background(), fromAddress, fromPublicKey, toAddress, amount, jsonstring)
+}
+
+func (h *ZECHandler) BuildUnsignedTransactionContext(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, jsonstring string) (transaction interface{}, digests []string, err error) {
+	opts, err := types.ParseBuildOptions(jsonstring)
+	if err != nil {
+		return
+	}
+	return h.BuildUnsignedTransactionWithOptions(ctx, fromAddress, fromPublicKey, toAddress, amount, opts)
+}
+
+func (h *ZECHandler) SupportedBuildOptions() []string {
+	return nil
+}
+
+func (h *ZECHandler) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		TxLookup: true,
+		TxStatus: true,
+		History: h.btcHandler.HasElectrs(),
+		FeeEstimate: true,
+		Networks: types.Networks(func(n types.Network) bool {
+			_, ok := chainConfigs[n]
+			return ok
+		}),
+		Network: h.network,
+	}
+}
+
+func (h *ZECHandler) Metadata() types.Metadata {
+	return types.Metadata{
+		Symbol: "ZEC",
+		Decimals: 8,
+		SLIP44: 133,
+		AddressFormat: types.AddressBase58Check,
+		SmallestUnit: "zatoshi",
+	}
+}
+
+func (h *ZECHandler) BuildUnsignedTransactionWithOptions(ctx context.Context, fromAddress, fromPublicKey, toAddress string, amount *big.Int, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	err = types.NotSupportedError("ZCASH", "BuildUnsignedTransaction")
+	return
+}
+
+func (h *ZECHandler) BuildUnsignedBatchTransaction(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	err = types.NotSupportedError("ZCASH", "BuildUnsignedBatchTransaction")
+	return
+}
+
+func (h *ZECHandler) FetchChainState(ctx context.Context, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (*types.ChainState, error) {
+	return nil, types.NotSupportedError("ZCASH", "FetchChainState")
+}
+
+func (h *ZECHandler) Assemble(state *types.ChainState, fromAddress, fromPublicKey string, outputs []types.TxOutput, opts *types.BuildOptions) (transaction interface{}, digests []string, err error) {
+	err = types.NotSupportedError("ZCASH", "Assemble")
 	return
 }
 
-// NOT completed, may or not work
 func (h *ZECHandler) SignTransaction(hash []string, wif interface{}) (rsv []string, err error){
-	return h.btcHandler.SignTransaction(hash, wif)
+	err = types.NotSupportedError("ZCASH", "SignTransaction")
+	return
 }
 
-// NOT completed, may or not work
 func (h *ZECHandler) MakeSignedTransaction(rsv []string, transaction interface{}) (signedTransaction interface{}, err error){
-	return h.btcHandler.MakeSignedTransaction(rsv, transaction)
+	err = types.NotSupportedError("ZCASH", "MakeSignedTransaction")
+	return
+}
+
+func (h *ZECHandler) MakeSignedTransactionContext(ctx context.Context, rsv []string, transaction interface{}) (signedTransaction interface{}, err error) {
+	return h.MakeSignedTransaction(rsv, transaction)
 }
 
-// NOT completed, may or not work
 func (h *ZECHandler) SubmitTransaction(signedTransaction interface{}) (ret string, err error) {
-	return h.SubmitTransaction(signedTransaction)
+	return h.SubmitTransactionContext(context.Background(), signedTransaction)
+}
+
+func (h *ZECHandler) SubmitTransactionContext(ctx context.Context, signedTransaction interface{}) (ret string, err error) {
+	err = types.NotSupportedError("ZCASH", "SubmitTransaction")
+	return
 }
 
 func (h *ZECHandler) GetTransactionInfo(txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
-	return h.GetTransactionInfo(txhash)
+	return h.GetTransactionInfoContext(context.Background(), txhash)
+}
+
+func (h *ZECHandler) GetTransactionInfoContext(ctx context.Context, txhash string) (fromAddress string, txOutputs []types.TxOutput, jsonstring string, err error) {
+	return h.btcHandler.GetTransactionInfoContext(ctx, txhash)
+}
+
+// ZEC 交易达到这么多确认后认为不会被回滚
+var FinalityConfirmations uint64 = 24
+
+func (h *ZECHandler) GetTransactionStatus(ctx context.Context, txhash string) (*types.TxStatus, error) {
+	return h.btcHandler.TransactionStatus(ctx, txhash, FinalityConfirmations)
+}
+
+// GetAddressHistory 从节点网关配置的 electrs 查询地址历史, 没有配置 electrs 时返回 types.ErrNotSupported
+func (h *ZECHandler) GetAddressHistory(ctx context.Context, address string, page types.PageRequest) (*types.HistoryPage, error) {
+	return h.btcHandler.ElectrsHistory(ctx, address, page)
 }
 
 // TODO
 func (h *ZECHandler) GetAddressBalance(address string, jsonstring string) (balance *big.Int, err error) {
-	err = fmt.Errorf("function currently not available")
+	return h.GetAddressBalanceContext(context.Background(), address, jsonstring)
+}
+
+func (h *ZECHandler) GetAddressBalanceContext(ctx context.Context, address string, jsonstring string) (balance *big.Int, err error) {
+	err = types.NotSupportedError("ZEC", "GetAddressBalance")
 	return nil, err
 }
+
+func (h *ZECHandler) MarshalUnsignedTransaction(transaction interface{}, digests []string) (*types.TxEnvelope, error) {
+	return btc.MarshalEnvelope("ZCASH", h.network.String(), transaction, digests)
+}
+
+func (h *ZECHandler) UnmarshalUnsignedTransaction(env *types.TxEnvelope) (transaction interface{}, err error) {
+	return btc.UnmarshalEnvelope("ZCASH", h.network.String(), env)
+}